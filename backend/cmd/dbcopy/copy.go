@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"sems-backend/internal/database"
+)
+
+// maxParams stays under PostgreSQL's 65535 bind parameters per statement
+const maxParams = 60000
+
+type copier struct {
+	src         *sql.DB
+	dst         *sql.DB
+	postgres    bool
+	batchSize   int
+	dropOrphans bool
+}
+
+type checkpoint struct {
+	lastKey    string
+	rowsCopied int64
+	completed  bool
+}
+
+// columns lists the columns both databases have, in source order, and the
+// target's PostgreSQL type for each ("" for SQLite targets)
+func (c *copier) columns(ctx context.Context, table string) ([]string, map[string]string, error) {
+	srcCols, err := sqliteColumns(ctx, c.src, table)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dstTypes := map[string]string{}
+	if c.postgres {
+		rows, err := c.dst.QueryContext(ctx, `SELECT column_name, data_type FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = ?`, table)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var name, typ string
+			if err := rows.Scan(&name, &typ); err != nil {
+				return nil, nil, err
+			}
+			dstTypes[name] = typ
+		}
+		if err := rows.Err(); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		names, err := sqliteColumns(ctx, c.dst, table)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, n := range names {
+			dstTypes[n] = ""
+		}
+	}
+
+	var cols []string
+	for _, col := range srcCols {
+		if _, ok := dstTypes[col]; !ok {
+			log.Printf("⚠️  %s.%s does not exist in the target and is skipped", table, col)
+			continue
+		}
+		cols = append(cols, col)
+	}
+	if len(cols) == 0 {
+		return nil, nil, fmt.Errorf("%s has no columns in common with the target", table)
+	}
+	return cols, dstTypes, nil
+}
+
+func sqliteColumns(ctx context.Context, db *sql.DB, table string) ([]string, error) {
+	rows, err := db.QueryContext(ctx, `SELECT name FROM pragma_table_info(?) ORDER BY cid`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var cols []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		cols = append(cols, name)
+	}
+	return cols, rows.Err()
+}
+
+func sourceHasTable(ctx context.Context, db *sql.DB, table string) (bool, error) {
+	var n int
+	err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, table).Scan(&n)
+	return n > 0, err
+}
+
+// orphans counts source rows whose references point at missing parents
+func (c *copier) orphans(ctx context.Context, t tableSpec) (map[string]int64, error) {
+	found := map[string]int64{}
+	for _, r := range t.refs {
+		parent := specFor(r.parent)
+		var n int64
+		q := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE %s IS NOT NULL AND %s NOT IN (SELECT %s FROM %s)`,
+			t.name, r.column, r.column, parent.key, parent.name)
+		if err := c.src.QueryRowContext(ctx, q).Scan(&n); err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			found[r.column] = n
+		}
+	}
+	return found, nil
+}
+
+func ensureCheckpointTable(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS dbcopy_checkpoints (
+		table_name TEXT PRIMARY KEY,
+		last_key TEXT NOT NULL DEFAULT '',
+		rows_copied BIGINT NOT NULL DEFAULT 0,
+		completed_at TIMESTAMP,
+		updated_at TIMESTAMP NOT NULL
+	)`)
+	return err
+}
+
+func loadCheckpoint(ctx context.Context, db *sql.DB, table string) (*checkpoint, error) {
+	var cp checkpoint
+	var completedAt sql.NullTime
+	err := db.QueryRowContext(ctx, `SELECT last_key, rows_copied, completed_at FROM dbcopy_checkpoints WHERE table_name = ?`, table).
+		Scan(&cp.lastKey, &cp.rowsCopied, &completedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cp.completed = completedAt.Valid
+	return &cp, nil
+}
+
+func saveCheckpoint(ctx context.Context, tx *sql.Tx, table string, cp checkpoint) error {
+	var completedAt interface{}
+	if cp.completed {
+		completedAt = time.Now().UTC()
+	}
+	_, err := tx.ExecContext(ctx, `INSERT INTO dbcopy_checkpoints (table_name, last_key, rows_copied, completed_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (table_name) DO UPDATE SET last_key = excluded.last_key, rows_copied = excluded.rows_copied,
+			completed_at = excluded.completed_at, updated_at = excluded.updated_at`,
+		table, cp.lastKey, cp.rowsCopied, completedAt, time.Now().UTC())
+	return err
+}
+
+// copyTable streams t in primary-key order, committing each batch together
+// with its checkpoint so an interrupted run resumes after the last batch.
+func (c *copier) copyTable(ctx context.Context, t tableSpec, cp checkpoint) error {
+	cols, types, err := c.columns(ctx, t.name)
+	if err != nil {
+		return err
+	}
+	keyIdx := -1
+	exprs := make([]string, len(cols))
+	for i, col := range cols {
+		exprs[i] = t.expr(col, c.dropOrphans)
+		if col == t.key {
+			keyIdx = i
+		}
+	}
+	if keyIdx < 0 {
+		return fmt.Errorf("%s: key column %s missing", t.name, t.key)
+	}
+
+	batch := c.batchSize
+	if batch*len(cols) > maxParams {
+		batch = maxParams / len(cols)
+	}
+
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE %s AND %s > ? ORDER BY %s LIMIT ?`,
+		strings.Join(exprs, ", "), t.name, t.where(c.dropOrphans), t.key, t.key)
+	started := time.Now()
+
+	for {
+		values, lastKey, err := c.readBatch(ctx, query, cp.lastKey, batch, cols, types, t, keyIdx)
+		if err != nil {
+			return err
+		}
+		if len(values) == 0 {
+			break
+		}
+
+		tx, err := c.dst.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if err := insertRows(ctx, tx, t.name, cols, values); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("%s: insert after key %q: %w", t.name, cp.lastKey, err)
+		}
+		next := checkpoint{lastKey: lastKey, rowsCopied: cp.rowsCopied + int64(len(values))}
+		if err := saveCheckpoint(ctx, tx, t.name, next); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		cp = next
+		log.Printf("   %s: %d rows (%.0f rows/s)", t.name, cp.rowsCopied, float64(cp.rowsCopied)/time.Since(started).Seconds())
+
+		if len(values) < batch {
+			break
+		}
+	}
+
+	if len(t.deferred) > 0 {
+		if err := c.fillDeferred(ctx, t, types); err != nil {
+			return err
+		}
+	}
+
+	tx, err := c.dst.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	cp.completed = true
+	if err := saveCheckpoint(ctx, tx, t.name, cp); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (c *copier) readBatch(ctx context.Context, query, after string, limit int, cols []string, types map[string]string, t tableSpec, keyIdx int) ([][]interface{}, string, error) {
+	rows, err := c.src.QueryContext(ctx, query, after, limit)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: read: %w", t.name, err)
+	}
+	defer rows.Close()
+
+	var out [][]interface{}
+	var lastKey string
+	for rows.Next() {
+		raw := make([]interface{}, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range raw {
+			ptrs[i] = &raw[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, "", err
+		}
+		lastKey = fmt.Sprint(textValue(raw[keyIdx]))
+		for i, col := range cols {
+			if t.isDeferred(col) {
+				raw[i] = nil
+				continue
+			}
+			v, err := convert(raw[i], types[col])
+			if err != nil {
+				return nil, "", fmt.Errorf("%s %s=%s column %s: %w", t.name, t.key, lastKey, col, err)
+			}
+			raw[i] = v
+		}
+		out = append(out, raw)
+	}
+	return out, lastKey, rows.Err()
+}
+
+func textValue(v interface{}) interface{} {
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return v
+}
+
+// insertRows writes one multi-row INSERT; rows already present from an
+// earlier attempt are skipped
+func insertRows(ctx context.Context, tx *sql.Tx, table string, cols []string, rows [][]interface{}) error {
+	placeholder := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(cols)), ", ") + ")"
+	var b strings.Builder
+	fmt.Fprintf(&b, "INSERT INTO %s (%s) VALUES ", table, strings.Join(cols, ", "))
+	args := make([]interface{}, 0, len(rows)*len(cols))
+	for i, row := range rows {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(placeholder)
+		args = append(args, row...)
+	}
+	b.WriteString(" ON CONFLICT DO NOTHING")
+	_, err := tx.ExecContext(ctx, b.String(), args...)
+	return err
+}
+
+// fillDeferred sets self-referencing columns once every row they can point
+// at exists. It is idempotent, so a resumed run simply repeats it.
+func (c *copier) fillDeferred(ctx context.Context, t tableSpec, types map[string]string) error {
+	exprs := make([]string, len(t.deferred))
+	notNull := make([]string, len(t.deferred))
+	sets := make([]string, len(t.deferred))
+	for i, col := range t.deferred {
+		exprs[i] = t.expr(col, c.dropOrphans)
+		notNull[i] = col + " IS NOT NULL"
+		sets[i] = col + " = ?"
+	}
+	query := fmt.Sprintf(`SELECT %s, %s FROM %s WHERE %s AND (%s)`,
+		t.key, strings.Join(exprs, ", "), t.name, t.where(c.dropOrphans), strings.Join(notNull, " OR "))
+	update := fmt.Sprintf(`UPDATE %s SET %s WHERE %s = ?`, t.name, strings.Join(sets, ", "), t.key)
+
+	rows, err := c.src.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	var pending [][]interface{}
+	for rows.Next() {
+		raw := make([]interface{}, len(t.deferred)+1)
+		ptrs := make([]interface{}, len(raw))
+		for i := range raw {
+			ptrs[i] = &raw[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			rows.Close()
+			return err
+		}
+		args := make([]interface{}, 0, len(raw))
+		for i, col := range t.deferred {
+			v, err := convert(raw[i+1], types[col])
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			args = append(args, v)
+		}
+		pending = append(pending, append(args, textValue(raw[0])))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for start := 0; start < len(pending); start += c.batchSize {
+		end := min(start+c.batchSize, len(pending))
+		tx, err := c.dst.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		for _, args := range pending[start:end] {
+			if _, err := tx.ExecContext(ctx, update, args...); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("%s: set %s: %w", t.name, strings.Join(t.deferred, ", "), err)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	if len(pending) > 0 {
+		log.Printf("   %s: linked %s on %d rows", t.name, strings.Join(t.deferred, ", "), len(pending))
+	}
+	return nil
+}
+
+// clearTarget empties the given tables, children first
+func clearTarget(ctx context.Context, names []string) error {
+	for i := len(tables) - 1; i >= 0; i-- {
+		for _, n := range names {
+			if n != tables[i].name {
+				continue
+			}
+			if _, err := database.DB.ExecContext(ctx, "DELETE FROM "+n); err != nil {
+				return fmt.Errorf("clear %s: %w", n, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"sems-backend/internal/config"
+	"sems-backend/internal/database"
+)
+
+func openMigrated(t *testing.T, path string) {
+	t.Helper()
+	if err := database.InitDB(config.DatabaseConfig{Driver: "sqlite", Path: path, MaxOpenConns: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.RunMigrations(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCopyBetweenSQLiteFiles(t *testing.T) {
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "src.db")
+
+	openMigrated(t, srcPath)
+	for _, stmt := range []string{
+		// "a" sorts before its admin "b", so admin_id can only be set after both exist
+		`INSERT INTO users (id, email, password_hash, role, admin_id, is_active) VALUES ('a', 'a@x', 'h', 'USER', 'b', 1)`,
+		`INSERT INTO users (id, email, password_hash, role, plant_id) VALUES ('b', 'b@x', 'h', 'ADMIN', 'missing-plant')`,
+		`INSERT INTO devices (id, user_id, device_name, device_type, api_key) VALUES ('d1', 'a', 'D1', 'INVERTER', 'k1')`,
+		`INSERT INTO energy_data (id, device_id, timestamp, solar_power) VALUES ('e1', 'd1', '2025-01-02 03:04:05+05:30', 1.5)`,
+		`INSERT INTO energy_data (id, device_id, timestamp, solar_power) VALUES ('e2', 'd1', '2025-01-02 04:04:05+05:30', 2)`,
+		`INSERT INTO energy_data (id, device_id, timestamp, solar_power) VALUES ('e3', 'deleted-device', '2025-01-02 05:04:05+05:30', 3)`,
+	} {
+		if _, err := database.DB.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	database.CloseDB()
+
+	src, err := sql.Open("sqlite", "file:"+srcPath+"?mode=ro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	openMigrated(t, filepath.Join(dir, "dst.db"))
+	defer database.CloseDB()
+
+	ctx := context.Background()
+	c := &copier{src: src, dst: database.DB, batchSize: 2}
+	if err := run(ctx, c, true, false, false); err == nil || !strings.Contains(err.Error(), "energy_data.device_id: 1 rows") {
+		t.Fatalf("expected orphan report, got %v", err)
+	}
+
+	c.dropOrphans = true
+	if err := run(ctx, c, true, false, false); err != nil {
+		t.Fatal(err)
+	}
+
+	var adminID sql.NullString
+	database.DB.QueryRow(`SELECT admin_id FROM users WHERE id = 'a'`).Scan(&adminID)
+	if adminID.String != "b" {
+		t.Errorf("admin_id = %q, want b", adminID.String)
+	}
+	var plantID sql.NullString
+	database.DB.QueryRow(`SELECT plant_id FROM users WHERE id = 'b'`).Scan(&plantID)
+	if plantID.Valid {
+		t.Errorf("dangling plant_id should be unlinked, got %q", plantID.String)
+	}
+	var readings int
+	database.DB.QueryRow(`SELECT COUNT(*) FROM energy_data`).Scan(&readings)
+	if readings != 2 {
+		t.Errorf("energy_data rows = %d, want 2", readings)
+	}
+
+	// A second run resumes from completed checkpoints and still verifies
+	if err := run(ctx, c, false, false, false); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConvertForPostgres(t *testing.T) {
+	ist := time.FixedZone("IST", 19800)
+	cases := []struct {
+		in     interface{}
+		pgType string
+		want   interface{}
+	}{
+		{int64(1), "boolean", true},
+		{int64(0), "boolean", false},
+		{"2025-01-02 03:04:05.5+05:30", "timestamp with time zone", time.Date(2025, 1, 1, 21, 34, 5, 5e8, time.UTC)},
+		{"2025-01-02 03:04:05.123 +0530 IST m=+0.001", "timestamp with time zone", time.Date(2025, 1, 1, 21, 34, 5, 123e6, time.UTC)},
+		{time.Date(2025, 1, 2, 3, 4, 5, 0, ist), "timestamp with time zone", time.Date(2025, 1, 1, 21, 34, 5, 0, time.UTC)},
+		{int64(5), "double precision", float64(5)},
+		{[]byte("abc"), "text", "abc"},
+		{nil, "boolean", nil},
+	}
+	for _, tc := range cases {
+		got, err := convert(tc.in, tc.pgType)
+		if err != nil {
+			t.Errorf("convert(%v, %s): %v", tc.in, tc.pgType, err)
+			continue
+		}
+		if canonical(got) != canonical(tc.want) {
+			t.Errorf("convert(%v, %s) = %v, want %v", tc.in, tc.pgType, got, tc.want)
+		}
+	}
+
+	if _, err := convert("yes please", "boolean"); err == nil {
+		t.Error("expected error for non-boolean text")
+	}
+}
@@ -0,0 +1,250 @@
+// Command dbcopy moves a SEMS SQLite database into the configured target
+// database (normally PostgreSQL). The target schema is migrated first, then
+// every table is streamed across in batches. Progress is checkpointed per
+// table in the target, so an interrupted copy resumes where it stopped, and
+// the run ends by comparing row counts and checksums on both sides.
+//
+//	SEMS_DB_DRIVER=postgres SEMS_DB_URL=postgres://... dbcopy -source ./sems.db
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"sems-backend/internal/config"
+	"sems-backend/internal/database"
+)
+
+func main() {
+	source := flag.String("source", "./sems.db", "SQLite file to copy from (opened read-only)")
+	driver := flag.String("to-driver", "", "target driver, overriding database.driver (sqlite or postgres)")
+	url := flag.String("to-url", "", "target PostgreSQL URL, overriding database.url")
+	path := flag.String("to-path", "", "target SQLite file, overriding database.path")
+	batch := flag.Int("batch", 1000, "rows per insert batch")
+	replace := flag.Bool("replace", false, "delete existing rows in target tables that have not been copied yet (e.g. seed data)")
+	restart := flag.Bool("restart", false, "discard checkpoints and copy every table again (implies -replace)")
+	dropOrphans := flag.Bool("drop-orphans", false, "skip rows whose parent row is missing instead of failing")
+	verifyOnly := flag.Bool("verify-only", false, "only compare row counts and checksums")
+	flag.Parse()
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	target := cfg.Database
+	if *driver != "" {
+		target.Driver = *driver
+	}
+	if *url != "" {
+		target.URL = *url
+	}
+	if *path != "" {
+		target.Path = *path
+	}
+	if *batch < 1 {
+		log.Fatal("-batch must be at least 1")
+	}
+	if target.Driver == "sqlite" && sameFile(*source, target.Path) {
+		log.Fatal("source and target are the same SQLite file")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	src, err := sql.Open("sqlite", "file:"+*source+"?mode=ro")
+	if err != nil {
+		log.Fatalf("Open source: %v", err)
+	}
+	defer src.Close()
+	if err := src.PingContext(ctx); err != nil {
+		log.Fatalf("Open source %s: %v", *source, err)
+	}
+
+	if err := database.InitDB(target); err != nil {
+		log.Fatalf("Open target: %v", err)
+	}
+	defer database.CloseDB()
+	if err := database.RunMigrations(); err != nil {
+		log.Fatalf("Migrate target: %v", err)
+	}
+
+	c := &copier{
+		src:         src,
+		dst:         database.DB,
+		postgres:    database.Current.Name() == "postgres",
+		batchSize:   *batch,
+		dropOrphans: *dropOrphans,
+	}
+
+	if err := run(ctx, c, *replace || *restart, *restart, *verifyOnly); err != nil {
+		database.CloseDB()
+		log.Fatal(err)
+	}
+}
+
+func run(ctx context.Context, c *copier, replace, restart, verifyOnly bool) error {
+	var present []tableSpec
+	for _, t := range tables {
+		ok, err := sourceHasTable(ctx, c.src, t.name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			log.Printf("ℹ️  %s is not in the source, skipping", t.name)
+			continue
+		}
+		present = append(present, t)
+	}
+	if err := reportUnknownTables(ctx, c.src); err != nil {
+		return err
+	}
+
+	if !verifyOnly {
+		if err := c.copyAll(ctx, present, replace, restart); err != nil {
+			return err
+		}
+	}
+	return c.verifyAll(ctx, present)
+}
+
+func (c *copier) copyAll(ctx context.Context, present []tableSpec, replace, restart bool) error {
+	// SQLite never enforced foreign keys; the target does
+	var problems []string
+	for _, t := range present {
+		found, err := c.orphans(ctx, t)
+		if err != nil {
+			return err
+		}
+		for col, n := range found {
+			problems = append(problems, fmt.Sprintf("%s.%s: %d rows reference a missing %s", t.name, col, n, t.refParent(col)))
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		if !c.dropOrphans {
+			return fmt.Errorf("source has dangling references; rerun with -drop-orphans to skip or unlink them:\n  %s", strings.Join(problems, "\n  "))
+		}
+		log.Printf("⚠️  Dropping or unlinking orphaned rows:\n  %s", strings.Join(problems, "\n  "))
+	}
+
+	if err := ensureCheckpointTable(ctx, c.dst); err != nil {
+		return err
+	}
+	if restart {
+		if _, err := c.dst.ExecContext(ctx, `DELETE FROM dbcopy_checkpoints`); err != nil {
+			return err
+		}
+	}
+
+	checkpoints := map[string]*checkpoint{}
+	var fresh []string
+	for _, t := range present {
+		cp, err := loadCheckpoint(ctx, c.dst, t.name)
+		if err != nil {
+			return err
+		}
+		checkpoints[t.name] = cp
+		if cp != nil {
+			continue
+		}
+		var n int64
+		if err := c.dst.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+t.name).Scan(&n); err != nil {
+			return err
+		}
+		if n > 0 && !replace {
+			return fmt.Errorf("target table %s already has %d rows (a fresh schema includes seed data); rerun with -replace to overwrite them", t.name, n)
+		}
+		fresh = append(fresh, t.name)
+	}
+	if replace && len(fresh) > 0 {
+		if err := clearTarget(ctx, fresh); err != nil {
+			return err
+		}
+	}
+
+	for _, t := range present {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("interrupted; rerun to resume: %w", err)
+		}
+		cp := checkpoints[t.name]
+		if cp != nil && cp.completed {
+			log.Printf("✅ %s already copied (%d rows)", t.name, cp.rowsCopied)
+			continue
+		}
+		if cp == nil {
+			cp = &checkpoint{}
+			log.Printf("▶️  Copying %s", t.name)
+		} else {
+			log.Printf("▶️  Resuming %s after key %q (%d rows done)", t.name, cp.lastKey, cp.rowsCopied)
+		}
+		if err := c.copyTable(ctx, t, *cp); err != nil {
+			return err
+		}
+		log.Printf("✅ %s copied", t.name)
+	}
+	return nil
+}
+
+func (c *copier) verifyAll(ctx context.Context, present []tableSpec) error {
+	log.Println("🔎 Verifying row counts and checksums")
+	failed := 0
+	for _, t := range present {
+		src, dst, err := c.verifyTable(ctx, t)
+		if err != nil {
+			return fmt.Errorf("verify %s: %w", t.name, err)
+		}
+		status := "ok"
+		switch {
+		case src.rows != dst.rows:
+			status = "ROW COUNT MISMATCH"
+			failed++
+		case src.sum != dst.sum:
+			status = "CHECKSUM MISMATCH"
+			failed++
+		}
+		log.Printf("   %-26s source %-10d target %-10d %s", t.name, src.rows, dst.rows, status)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d tables differ between source and target", failed)
+	}
+	log.Println("🎉 Target matches source")
+	return nil
+}
+
+// reportUnknownTables lists source tables this tool does not copy
+func reportUnknownTables(ctx context.Context, src *sql.DB) error {
+	rows, err := src.QueryContext(ctx, `SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	known := map[string]bool{"schema_migrations": true, "dbcopy_checkpoints": true}
+	for _, t := range tables {
+		known[t.name] = true
+	}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if !known[name] {
+			log.Printf("⚠️  Source table %s is not part of the SEMS schema and is not copied", name)
+		}
+	}
+	return rows.Err()
+}
+
+func sameFile(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// reference is a foreign key as declared in the schema. SQLite never enforced
+// them, so source files can hold rows whose parent was deleted.
+type reference struct {
+	column  string
+	parent  string
+	cascade bool // ON DELETE CASCADE: orphans are dropped, otherwise the column is nulled
+}
+
+type tableSpec struct {
+	name     string
+	key      string
+	refs     []reference
+	deferred []string // self references, filled in after the whole table is copied
+}
+
+// tables are copied in this order so parents exist before their children
+var tables = []tableSpec{
+	{name: "regions", key: "id"},
+	{name: "organizations", key: "id"},
+	{name: "solar_plants", key: "id", refs: []reference{{column: "org_id", parent: "organizations"}}},
+	{name: "users", key: "id",
+		refs: []reference{
+			{column: "admin_id", parent: "users"},
+			{column: "installer_id", parent: "users"},
+			{column: "plant_id", parent: "solar_plants"},
+			{column: "org_id", parent: "organizations"},
+		},
+		deferred: []string{"admin_id", "installer_id"},
+	},
+	{name: "devices", key: "id", refs: []reference{{column: "user_id", parent: "users", cascade: true}, {column: "org_id", parent: "organizations"}}},
+	{name: "energy_data", key: "id", refs: []reference{{column: "device_id", parent: "devices", cascade: true}}},
+	{name: "alerts", key: "id"},
+	{name: "solar_profiles", key: "id", refs: []reference{{column: "user_id", parent: "users", cascade: true}}},
+	{name: "notifications", key: "id", refs: []reference{{column: "user_id", parent: "users", cascade: true}}},
+	{name: "notification_preferences", key: "user_id", refs: []reference{{column: "user_id", parent: "users", cascade: true}}},
+	{name: "tickets", key: "id", refs: []reference{{column: "user_id", parent: "users", cascade: true}, {column: "org_id", parent: "organizations"}}},
+	{name: "inventory_items", key: "id", refs: []reference{{column: "org_id", parent: "organizations"}}},
+	{name: "grafana_tokens", key: "id", refs: []reference{{column: "user_id", parent: "users", cascade: true}}},
+	{name: "auth_sessions", key: "id", refs: []reference{{column: "user_id", parent: "users", cascade: true}}},
+	{name: "retired_refresh_tokens", key: "hash", refs: []reference{{column: "session_id", parent: "auth_sessions", cascade: true}}},
+	{name: "signing_keys", key: "kid"},
+	{name: "account_tokens", key: "id", refs: []reference{{column: "user_id", parent: "users", cascade: true}}},
+	{name: "user_two_factor", key: "user_id", refs: []reference{{column: "user_id", parent: "users", cascade: true}}},
+	{name: "recovery_codes", key: "id", refs: []reference{{column: "user_id", parent: "users", cascade: true}}},
+	{name: "user_identities", key: "id", refs: []reference{{column: "user_id", parent: "users", cascade: true}}},
+	{name: "roles", key: "name"},
+	{name: "api_tokens", key: "id", refs: []reference{{column: "user_id", parent: "users", cascade: true}}},
+	{name: "audit_log", key: "id"},
+	{name: "device_keys", key: "id", refs: []reference{{column: "device_id", parent: "devices", cascade: true}}},
+	{name: "impersonations", key: "id", refs: []reference{{column: "admin_id", parent: "users", cascade: true}, {column: "user_id", parent: "users", cascade: true}}},
+}
+
+func specFor(name string) tableSpec {
+	for _, t := range tables {
+		if t.name == name {
+			return t
+		}
+	}
+	panic("dbcopy: unknown table " + name)
+}
+
+func (t tableSpec) isDeferred(column string) bool {
+	for _, c := range t.deferred {
+		if c == column {
+			return true
+		}
+	}
+	return false
+}
+
+func (t tableSpec) refParent(column string) string {
+	for _, r := range t.refs {
+		if r.column == column {
+			return r.parent
+		}
+	}
+	return ""
+}
+
+// where selects the source rows that are copied. Without dropOrphans every row
+// is copied (the preflight check has already refused orphans); with it, rows
+// whose cascading parent is missing (or itself dropped) are skipped.
+func (t tableSpec) where(dropOrphans bool) string {
+	if !dropOrphans {
+		return "1=1"
+	}
+	conds := []string{"1=1"}
+	for _, r := range t.refs {
+		if !r.cascade {
+			continue
+		}
+		parent := specFor(r.parent)
+		conds = append(conds, fmt.Sprintf("(%s IS NULL OR %s IN (SELECT %s FROM %s WHERE %s))",
+			r.column, r.column, parent.key, parent.name, parent.where(true)))
+	}
+	return strings.Join(conds, " AND ")
+}
+
+// expr is the source expression for column: nullable references to a missing
+// parent become NULL when orphans are dropped.
+func (t tableSpec) expr(column string, dropOrphans bool) string {
+	if dropOrphans {
+		for _, r := range t.refs {
+			if r.column == column && !r.cascade {
+				parent := specFor(r.parent)
+				return fmt.Sprintf("CASE WHEN %s IN (SELECT %s FROM %s WHERE %s) THEN %s END",
+					column, parent.key, parent.name, parent.where(true), column)
+			}
+		}
+	}
+	return column
+}
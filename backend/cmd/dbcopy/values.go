@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeLayouts cover what SQLite files written by SEMS contain: the driver's
+// "sqlite" format, RFC 3339, and Go's time.String() from older builds.
+var timeLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02",
+}
+
+func parseTime(s string) (time.Time, error) {
+	if i := strings.Index(s, " m="); i > 0 { // monotonic clock suffix
+		s = s[:i]
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised timestamp %q", s)
+}
+
+// convert maps a value read from SQLite to the PostgreSQL column type it is
+// written to. SQLite targets take values unchanged.
+func convert(v interface{}, pgType string) (interface{}, error) {
+	if b, ok := v.([]byte); ok {
+		v = string(b)
+	}
+	if v == nil || pgType == "" {
+		return v, nil
+	}
+
+	switch pgType {
+	case "boolean":
+		switch x := v.(type) {
+		case bool:
+			return x, nil
+		case int64:
+			return x != 0, nil
+		case float64:
+			return x != 0, nil
+		case string:
+			if x == "" {
+				return nil, nil
+			}
+			return strconv.ParseBool(x)
+		}
+	case "timestamp with time zone", "timestamp without time zone", "date":
+		switch x := v.(type) {
+		case time.Time:
+			return x.UTC(), nil
+		case int64:
+			return time.Unix(x, 0).UTC(), nil
+		case string:
+			if x == "" {
+				return nil, nil
+			}
+			t, err := parseTime(x)
+			return t.UTC(), err
+		}
+	case "double precision", "real", "numeric":
+		switch x := v.(type) {
+		case float64:
+			return x, nil
+		case int64:
+			return float64(x), nil
+		case string:
+			if x == "" {
+				return nil, nil
+			}
+			return strconv.ParseFloat(x, 64)
+		}
+	case "integer", "bigint", "smallint":
+		switch x := v.(type) {
+		case int64:
+			return x, nil
+		case bool:
+			if x {
+				return int64(1), nil
+			}
+			return int64(0), nil
+		case float64:
+			if x == math.Trunc(x) {
+				return int64(x), nil
+			}
+		case string:
+			if x == "" {
+				return nil, nil
+			}
+			return strconv.ParseInt(x, 10, 64)
+		}
+	default: // text and anything else stored as text
+		switch x := v.(type) {
+		case string:
+			return x, nil
+		case int64:
+			return strconv.FormatInt(x, 10), nil
+		case float64:
+			return strconv.FormatFloat(x, 'f', -1, 64), nil
+		case bool:
+			return strconv.FormatBool(x), nil
+		case time.Time:
+			return x.UTC().Format(time.RFC3339Nano), nil
+		}
+	}
+	return nil, fmt.Errorf("cannot store %T %v as %s", v, v, pgType)
+}
+
+// canonical renders a value identically whichever database it was read from,
+// for checksums. Times are compared at PostgreSQL's microsecond precision.
+func canonical(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return "\x00"
+	case []byte:
+		return "s:" + string(x)
+	case string:
+		return "s:" + x
+	case bool:
+		if x {
+			return "b:1"
+		}
+		return "b:0"
+	case int64:
+		return "i:" + strconv.FormatInt(x, 10)
+	case float64:
+		return "f:" + strconv.FormatFloat(x, 'g', -1, 64)
+	case time.Time:
+		return "t:" + x.UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano)
+	}
+	return fmt.Sprintf("%T:%v", v, v)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"sems-backend/internal/auth"
+	"sems-backend/internal/users"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const passwordAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz23456789"
+
+// generatePassword returns a random password without look-alike characters
+func generatePassword(length int) (string, error) {
+	var b strings.Builder
+	max := big.NewInt(int64(len(passwordAlphabet)))
+	for i := 0; i < length; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(passwordAlphabet[n.Int64()])
+	}
+	return b.String(), nil
+}
+
+func hashNewPassword() (plain, hash string, err error) {
+	plain, err = generatePassword(20)
+	if err != nil {
+		return "", "", err
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(plain), bcrypt.DefaultCost)
+	if err != nil {
+		return "", "", err
+	}
+	return plain, string(hashed), nil
+}
+
+func printCredentials(email, password string) {
+	fmt.Printf("Email:    %s\nPassword: %s\n", email, password)
+	fmt.Println("The password is shown only once; ask the user to change it after signing in.")
+}
+
+func adminCreate(args []string) error {
+	fs := newFlags("admin create")
+	email := fs.String("email", "", "login email (required)")
+	role := fs.String("role", "ADMIN", "ADMIN or SUPER_ADMIN")
+	first := fs.String("first", "", "first name")
+	last := fs.String("last", "", "last name")
+	region := fs.String("region", "", "region an ADMIN manages")
+	plant := fs.String("plant", "", "plant ID an ADMIN manages")
+	fs.Parse(args)
+
+	*role = strings.ToUpper(*role)
+	if *email == "" {
+		return errors.New("-email is required")
+	}
+	if *role != "ADMIN" && *role != "SUPER_ADMIN" {
+		return fmt.Errorf("-role must be ADMIN or SUPER_ADMIN, got %q", *role)
+	}
+	if _, err := users.GetUserByEmail(*email); err == nil {
+		return fmt.Errorf("an account for %s already exists; use 'semsctl user reset-password'", *email)
+	}
+
+	plain, hash, err := hashNewPassword()
+	if err != nil {
+		return err
+	}
+	user, err := users.CreateUser(*first, *last, *email, hash, *role, "", "", "", "", "", "", "", *region, 0, 0, "", "", *plant)
+	if err != nil {
+		return err
+	}
+	// The operator vouches for the address
+	if err := users.MarkEmailVerified(user.ID); err != nil {
+		return err
+	}
+	fmt.Printf("Created %s account\n", *role)
+	printCredentials(*email, plain)
+	return nil
+}
+
+func userResetPassword(args []string) error {
+	fs := newFlags("user reset-password")
+	email := fs.String("email", "", "account email (required)")
+	fs.Parse(args)
+
+	user, err := findUser(*email)
+	if err != nil {
+		return err
+	}
+	plain, hash, err := hashNewPassword()
+	if err != nil {
+		return err
+	}
+	if err := users.UpdatePasswordHash(user.ID, hash); err != nil {
+		return err
+	}
+	revoked, err := auth.RevokeUserSessions(user.ID)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Password reset for %s (%s), %d sessions signed out\n", user.Email, user.Role, revoked)
+	printCredentials(user.Email, plain)
+	return nil
+}
+
+func userResetTwoFactor(args []string) error {
+	fs := newFlags("user reset-2fa")
+	email := fs.String("email", "", "account email (required)")
+	fs.Parse(args)
+
+	user, err := findUser(*email)
+	if err != nil {
+		return err
+	}
+	if err := auth.ResetTwoFactor(user.ID); err != nil {
+		return err
+	}
+	fmt.Printf("Two-factor authentication removed for %s (%s); sessions signed out\n", user.Email, user.Role)
+	return nil
+}
+
+func userSetActive(active bool) func(args []string) error {
+	name := "user deactivate"
+	if active {
+		name = "user activate"
+	}
+	return func(args []string) error {
+		fs := newFlags(name)
+		email := fs.String("email", "", "account email (required)")
+		fs.Parse(args)
+
+		user, err := findUser(*email)
+		if err != nil {
+			return err
+		}
+		if err := users.SetActive(user.ID, active); err != nil {
+			return err
+		}
+		if !active {
+			if _, err := auth.RevokeUserSessions(user.ID); err != nil {
+				return err
+			}
+		}
+		state := "deactivated"
+		if active {
+			state = "activated"
+		}
+		fmt.Printf("%s (%s) %s\n", user.Email, user.Role, state)
+		return nil
+	}
+}
+
+func findUser(email string) (*users.User, error) {
+	if email == "" {
+		return nil, errors.New("-email is required")
+	}
+	user, err := users.GetUserByEmail(email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("no account for %s", email)
+	}
+	return user, err
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"sems-backend/internal/database"
+	"sems-backend/internal/devices"
+
+	"github.com/google/uuid"
+)
+
+func deviceRotateKey(args []string) error {
+	fs := newFlags("device rotate-key")
+	id := fs.String("id", "", "device ID (required)")
+	fs.Parse(args)
+
+	deviceID, err := uuid.Parse(*id)
+	if err != nil {
+		return fmt.Errorf("-id must be a device UUID: %w", err)
+	}
+	key, err := devices.RotateAPIKey(deviceID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no device %s", deviceID)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("New API key for %s: %s\n", deviceID, key)
+	fmt.Println("The previous key works until the rotation overlap (devices.key_overlap) ends; update the device configuration.")
+	return nil
+}
+
+func deviceStatus(args []string) error {
+	fs := newFlags("device status")
+	id := fs.String("id", "", "only this device")
+	offline := fs.Bool("offline", false, "only active devices that are not reporting")
+	fs.Parse(args)
+
+	now := time.Now().UTC()
+	// Epoch seconds rather than MAX(timestamp): aggregates lose SQLite's column type
+	query := `
+		SELECT d.id, COALESCE(d.name, d.device_name, ''), d.device_type, COALESCE(u.email, ''), d.is_active,
+		       (SELECT MAX(` + database.Current.UnixEpoch("e.timestamp") + `) FROM energy_data e WHERE e.device_id = d.id),
+		       (SELECT COUNT(*) FROM energy_data e WHERE e.device_id = d.id AND e.timestamp >= ?)
+		FROM devices d
+		LEFT JOIN users u ON d.user_id = u.id`
+	params := []interface{}{now.Add(-24 * time.Hour)}
+	if *id != "" {
+		query += " WHERE d.id = ?"
+		params = append(params, *id)
+	}
+	query += " ORDER BY d.created_at"
+
+	rows, err := database.DB.Query(query, params...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tTYPE\tOWNER\tSTATUS\tLAST READING\tREADINGS 24H")
+	shown := 0
+	for rows.Next() {
+		var deviceID, name, deviceType, owner string
+		var active bool
+		var lastEpoch sql.NullInt64
+		var recent int
+		if err := rows.Scan(&deviceID, &name, &deviceType, &owner, &active, &lastEpoch, &recent); err != nil {
+			return err
+		}
+		lastReading := sql.NullTime{Time: time.Unix(lastEpoch.Int64, 0), Valid: lastEpoch.Valid}
+
+		status := "offline"
+		switch {
+		case !active:
+			status = "inactive"
+		case lastReading.Valid && now.Sub(lastReading.Time) <= devices.OnlineWindow:
+			status = "online"
+		}
+		if *offline && status != "offline" {
+			continue
+		}
+
+		last := "never"
+		if lastReading.Valid {
+			last = fmt.Sprintf("%s (%s ago)", lastReading.Time.UTC().Format("2006-01-02 15:04Z"), now.Sub(lastReading.Time).Round(time.Minute))
+		}
+		if owner == "" {
+			owner = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\n", deviceID, name, deviceType, owner, status, last, recent)
+		shown++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if shown == 0 && *id != "" {
+		return fmt.Errorf("no device %s", *id)
+	}
+	return nil
+}
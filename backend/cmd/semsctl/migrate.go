@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"sems-backend/internal/database"
+	"sems-backend/internal/devices"
+	"sems-backend/internal/orgs"
+)
+
+func migrateUp(args []string) error {
+	newFlags("migrate up").Parse(args)
+	if err := database.RunMigrations(); err != nil {
+		return err
+	}
+	n, err := devices.SecureLegacyKeys()
+	if n > 0 {
+		fmt.Printf("Hashed %d plain-text device API keys\n", n)
+	}
+	if err != nil {
+		return err
+	}
+	n, err = orgs.AdoptLegacy()
+	if n > 0 {
+		fmt.Printf("Moved %d accounts into organizations\n", n)
+	}
+	return err
+}
+
+func migrateDown(args []string) error {
+	fs := newFlags("migrate down")
+	steps := fs.Int("steps", 1, "number of migrations to roll back")
+	fs.Parse(args)
+	if *steps < 1 {
+		return fmt.Errorf("-steps must be at least 1")
+	}
+	return database.RollbackMigrations(*steps)
+}
+
+func migrateStatus(args []string) error {
+	newFlags("migrate status").Parse(args)
+	records, err := database.MigrationStatus()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATE\tAPPLIED AT")
+	for _, r := range records {
+		applied := "-"
+		if r.AppliedAt != nil {
+			applied = r.AppliedAt.UTC().Format("2006-01-02 15:04:05Z")
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", r.Version, r.Name, r.State, applied)
+	}
+	return w.Flush()
+}
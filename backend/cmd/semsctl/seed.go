@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"sems-backend/internal/database"
+	"sems-backend/internal/devices"
+	"sems-backend/internal/users"
+
+	"github.com/google/uuid"
+)
+
+const (
+	demoAdminEmail     = "demo.admin@sems.local"
+	demoInstallerEmail = "demo.installer@sems.local"
+	demoUserEmail      = "demo.user@sems.local"
+	demoRegion         = "Delhi"
+	demoPlantID        = "550e8400-e29b-41d4-a716-446655440001"
+	demoCapacityKW     = 5.0
+)
+
+func seedDemo(args []string) error {
+	fs := newFlags("seed demo")
+	days := fs.Int("days", 7, "days of hourly readings to generate")
+	fs.Parse(args)
+	if *days < 0 {
+		return fmt.Errorf("-days must not be negative")
+	}
+
+	if _, err := users.GetUserByEmail(demoAdminEmail); err == nil {
+		return fmt.Errorf("demo data already present (%s exists)", demoAdminEmail)
+	}
+
+	type account struct {
+		email, password string
+	}
+	var created []account
+	create := func(first, email, role, adminID, installerID string) (*users.User, error) {
+		plain, hash, err := hashNewPassword()
+		if err != nil {
+			return nil, err
+		}
+		user, err := users.CreateUser(first, "Demo", email, hash, role, "9999999999", "", "", "", "New Delhi", "Delhi", "110085", demoRegion, 28.7041, 77.1025, adminID, installerID, demoPlantID)
+		if err != nil {
+			return nil, fmt.Errorf("create %s: %w", email, err)
+		}
+		if err := users.MarkEmailVerified(user.ID); err != nil {
+			return nil, err
+		}
+		created = append(created, account{email, plain})
+		return user, nil
+	}
+
+	admin, err := create("Admin", demoAdminEmail, "ADMIN", "", "")
+	if err != nil {
+		return err
+	}
+	installer, err := create("Installer", demoInstallerEmail, "INSTALLER", admin.ID, "")
+	if err != nil {
+		return err
+	}
+	owner, err := create("User", demoUserEmail, "USER", admin.ID, installer.ID)
+	if err != nil {
+		return err
+	}
+
+	ownerID, err := uuid.Parse(owner.ID)
+	if err != nil {
+		return err
+	}
+	device, err := devices.CreateDevice(ownerID, "Demo Rooftop Inverter", "INVERTER", "Rohini, New Delhi")
+	if err != nil {
+		return err
+	}
+	// Trend and stats queries join through users.device_id
+	_, err = database.DB.Exec(`
+		UPDATE users SET device_linked = true, device_id = ?, installation_status = ?, plant_capacity_kw = ?, updated_at = ?
+		WHERE id = ?`,
+		device.ID.String(), users.InstallationStatusInstalled, demoCapacityKW, time.Now(), owner.ID)
+	if err != nil {
+		return err
+	}
+
+	readings, err := seedReadings(device.ID.String(), *days)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range created {
+		printCredentials(a.email, a.password)
+		fmt.Println()
+	}
+	fmt.Printf("Device %s (API key %s) with %d readings\n", device.ID, device.APIKey, readings)
+	return nil
+}
+
+// seedReadings inserts hourly readings following a daylight solar curve
+func seedReadings(deviceID string, days int) (int, error) {
+	ist := time.FixedZone("IST", 5*3600+1800)
+	end := time.Now().Truncate(time.Hour)
+	start := end.Add(-time.Duration(days) * 24 * time.Hour)
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO energy_data (id, device_id, timestamp, solar_power, load_power, grid_power, battery_level, temperature, humidity, grid_status)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, true)`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	battery := 50.0
+	n := 0
+	for ts := start.Add(time.Hour); !ts.After(end); ts = ts.Add(time.Hour) {
+		hour := float64(ts.In(ist).Hour())
+		solar := 0.0
+		if hour >= 6 && hour <= 18 {
+			solar = demoCapacityKW * math.Sin(math.Pi*(hour-6)/12) * (0.8 + 0.2*rand.Float64())
+		}
+		load := 0.6 + 0.4*rand.Float64()
+		if hour >= 18 && hour <= 22 {
+			load += 1.2
+		}
+		battery = math.Max(10, math.Min(100, battery+(solar-load)*4))
+		temperature := 24 + 8*math.Sin(math.Pi*(hour-8)/12)
+
+		if _, err := stmt.Exec(uuid.New().String(), deviceID, ts, solar, load, load-solar, battery, temperature, 40+20*rand.Float64()); err != nil {
+			return 0, err
+		}
+		n++
+	}
+	return n, tx.Commit()
+}
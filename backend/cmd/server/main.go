@@ -2,19 +2,30 @@ package main
 
 import (
 	"log"
+	"net/http"
+	"sems-backend/internal/audit"
 	"sems-backend/internal/auth"
+	"sems-backend/internal/authz"
+	"sems-backend/internal/config"
 	"sems-backend/internal/database"
 	"sems-backend/internal/devices"
 	"sems-backend/internal/energy"
 	"sems-backend/internal/govt"
+	"sems-backend/internal/grafana"
 	installerPkg "sems-backend/internal/installer"
 	"sems-backend/internal/inventory"
+	"sems-backend/internal/keys"
+	"sems-backend/internal/lifecycle"
+	"sems-backend/internal/metrics"
 	"sems-backend/internal/middleware"
 	"sems-backend/internal/notifications"
+	"sems-backend/internal/orgs"
 	"sems-backend/internal/plants"
+	"sems-backend/internal/ratelimit"
 	"sems-backend/internal/regions"
 	"sems-backend/internal/reports"
 	"sems-backend/internal/tickets"
+	"sems-backend/internal/timectx"
 	"sems-backend/internal/users"
 	"sems-backend/internal/weather"
 	"time"
@@ -23,7 +34,6 @@ import (
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
-	"golang.org/x/crypto/bcrypt"
 
 	_ "sems-backend/docs"
 )
@@ -47,39 +57,96 @@ import (
 // @name Authorization
 
 func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	auth.Configure(cfg.Auth)
+	auth.ConfigureSSO(cfg.OIDC)
+	devices.Configure(cfg.Devices)
+	ratelimit.Configure(cfg.RateLimit)
+	keys.Configure(cfg.Auth)
+	energy.Configure(cfg.Energy, cfg.AI)
+	users.Configure(cfg.Energy)
+	timectx.Configure(cfg.Energy.DefaultTimezone)
+	metrics.Configure(cfg.Metrics)
+	notifications.Configure(cfg.Email)
+	weather.Configure(cfg.Weather)
+
 	// Initialize database (skip if not available for demo)
-	if err := database.InitDB(); err != nil {
+	if err := database.InitDB(cfg.Database); err != nil {
 		log.Println("Database not available, running in demo mode:", err)
 	} else {
-		defer database.CloseDB()
-
-		// Run migrations
+		// A half-migrated schema is worse than not starting
 		if err := database.RunMigrations(); err != nil {
-			log.Println("Failed to run migrations, continuing in demo mode:", err)
+			log.Fatalf("Migrations failed: %v", err)
+		}
+		// Keys stored in plain text before hashing are converted once
+		if n, err := devices.SecureLegacyKeys(); err != nil {
+			log.Fatalf("Securing device API keys failed: %v", err)
+		} else if n > 0 {
+			log.Printf("🔑 Hashed %d plain-text device API keys", n)
 		}
+		// Free-text organization names from before organizations existed
+		if n, err := orgs.AdoptLegacy(); err != nil {
+			log.Fatalf("Adopting legacy organizations failed: %v", err)
+		} else if n > 0 {
+			log.Printf("🏢 Moved %d accounts into organizations", n)
+		}
+	}
+
+	// Custom roles live in the database, so required 2FA roles are checked once it is open
+	if err := authz.CheckRoles(cfg.Auth.Require2FARoles); err != nil {
+		log.Fatalf("Invalid configuration: auth.require_2fa_roles: %v", err)
+	}
+
+	// Signing keys come from the database when there is one, otherwise memory
+	if err := keys.Init(); err != nil {
+		log.Fatalf("Signing keys unavailable: %v", err)
 	}
 
 	// Initialize Govt/Subsidy package
 	govt.Init()
 
-	// Start Anomaly Detection Worker (every 15 minutes)
-	energy.StartAnomalyDetectionWorker(15 * time.Minute)
+	// Background workers and readiness checks
+	lc := lifecycle.New()
+	lc.Every("anomaly-detection", cfg.Workers.AnomalyInterval.Duration, energy.RunAnomalyScan)
+	lc.Every("signing-keys", time.Minute, keys.Maintain)
+	lc.Every("login-throttle", time.Minute, auth.PruneLoginThrottle)
+	lc.Every("sessions", time.Hour, auth.PruneSessions)
+	lc.Every("account-tokens", time.Hour, auth.PruneAccountTokens)
+	lc.Every("ingestion-nonces", time.Minute, devices.PruneNonces)
+	lc.Every("rate-limit", time.Minute, ratelimit.Prune)
+	lc.Every("impersonations", time.Minute, auth.CloseImpersonations)
+	lc.AddCheck("database", true, database.Ping)
+	lc.AddCheck("migrations", true, database.CheckMigrations)
+	lc.AddCheck("signing_keys", true, keys.Check)
+	lc.AddCheck("ai_service", false, energy.CheckAIService)
 
 	r := gin.Default()
+	// Client addresses feed login throttling and the metrics network check
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatalf("Invalid server.trusted_proxies: %v", err)
+	}
 
 	// CORS middleware
 	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:5173", "http://127.0.0.1:5173"},
+		AllowOrigins:     cfg.Server.CORSOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"},
 		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization"},
+		ExposeHeaders:    []string{"Retry-After"},
 		AllowCredentials: true,
 	}))
 
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{
-			"status": "SEMS backend running",
-		})
-	})
+	// Per-route request budgets; 429 with Retry-After once spent
+	r.Use(ratelimit.Middleware())
+
+	// Mutating requests not recorded by a handler still leave an audit entry
+	r.Use(audit.Middleware())
+
+	r.GET("/health", lc.ReadyHandler)
+	r.GET("/health/live", lc.LiveHandler)
+	r.GET("/health/ready", lc.ReadyHandler)
 
 	r.GET("/test", func(c *gin.Context) {
 		c.JSON(200, gin.H{"message": "root test works"})
@@ -88,30 +155,85 @@ func main() {
 	// Swagger
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
-	// Seed endpoint to create initial super admin (for testing)
-	r.POST("/seed/superadmin", func(c *gin.Context) {
-		hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("SuperAdmin@123"), bcrypt.DefaultCost)
-		_, err := users.CreateUser("Super", "Admin", "superAdmin@solar.com", string(hashedPassword), "SUPER_ADMIN", "", "", "", "", "", "", "", "", 0, 0, "", "", "")
-		if err != nil {
-			c.JSON(500, gin.H{"error": "Failed to create super admin", "details": err.Error()})
-			return
-		}
-		c.JSON(200, gin.H{"message": "Super admin created successfully", "email": "superAdmin@solar.com", "password": "SuperAdmin@123"})
-	})
+	// Prometheus metrics (internal networks or SEMS_METRICS_TOKEN only)
+	metrics.OnScrape(devices.RecordStatusMetrics)
+	metrics.OnScrape(energy.RecordAlertMetrics)
+	r.GET("/metrics", metrics.RequireScraper(), metrics.Handler())
 
 	// Public auth routes
 	r.POST("/auth/register", auth.Register)
 	r.POST("/auth/login", auth.Login)
+	r.POST("/auth/login/2fa", auth.LoginTwoFactor)
+	r.POST("/auth/login/2fa/setup", auth.SetupTwoFactor)
+	r.POST("/auth/login/2fa/enable", auth.EnableTwoFactor)
+	r.GET("/auth/oidc/providers", auth.SSOProviders)
+	r.GET("/auth/oidc/:provider/login", auth.SSOLogin)
+	r.GET("/auth/oidc/:provider/callback", auth.SSOCallback)
+	r.POST("/auth/oidc/:provider/link", middleware.AuthMiddleware(), auth.SSOLink)
+	r.POST("/auth/oidc/exchange", auth.SSOExchange)
+	r.POST("/auth/refresh", auth.Refresh)
+	r.POST("/auth/logout", auth.Logout)
+	r.POST("/auth/logout-all", middleware.AuthMiddleware(), auth.LogoutAll)
+	r.POST("/auth/forgot-password", auth.ForgotPassword)
+	r.POST("/auth/reset-password", auth.ResetPassword)
+	r.POST("/auth/verify-email", auth.VerifyEmail)
+	r.POST("/auth/resend-verification", auth.ResendVerification)
+	r.GET("/auth/permissions", middleware.AuthMiddleware(), authz.MyPermissionsHandler)
+	r.GET("/auth/impersonation", middleware.AuthMiddleware(), auth.ImpersonationStatus)
+	r.DELETE("/auth/impersonation", middleware.AuthMiddleware(), auth.EndImpersonation)
+
+	apiTokens := r.Group("/auth/tokens")
+	apiTokens.Use(middleware.AuthMiddleware())
+	{
+		apiTokens.GET("", auth.ListAPITokens)
+		apiTokens.POST("", auth.CreateAPIToken)
+		apiTokens.DELETE("/:id", auth.RevokeAPIToken)
+	}
+
+	twoFactor := r.Group("/auth/2fa")
+	twoFactor.Use(middleware.AuthMiddleware())
+	{
+		twoFactor.GET("", auth.TwoFactorStatus)
+		twoFactor.POST("/setup", auth.SetupTwoFactor)
+		twoFactor.POST("/enable", auth.EnableTwoFactor)
+		twoFactor.POST("/disable", auth.DisableTwoFactor)
+		twoFactor.POST("/recovery-codes", auth.RegenerateRecoveryCodes)
+	}
+
+	r.GET("/.well-known/jwks.json", keys.JWKSHandler)
 
 	// IoT data ingestion (public, authenticated by API key)
 	r.POST("/iot/data", energy.IngestData)
 
+	// Grafana JSON datasource (authenticated by datasource token)
+	grafanaGroup := r.Group("/grafana")
+	grafanaGroup.Use(grafana.TokenAuth())
+	{
+		grafanaGroup.GET("", grafana.TestHandler)
+		grafanaGroup.POST("/search", grafana.SearchHandler)
+		grafanaGroup.POST("/query", grafana.QueryHandler)
+		grafanaGroup.POST("/annotations", grafana.AnnotationsHandler)
+	}
+
 	// Public hierarchy for map
 	r.GET("/public/hierarchy", users.GetPublicHierarchyHandler)
+	r.GET("/public/organizations/:slug/branding", orgs.BrandingHandler)
 
-	// USER Routes (USER, ADMIN can access)
+	// The caller's organization; members read it, org admins manage it
+	orgGroup := r.Group("/org")
+	orgGroup.Use(middleware.AuthMiddleware())
+	{
+		orgGroup.GET("", orgs.MineHandler)
+		manage := middleware.RequirePermission(authz.OrgManage)
+		orgGroup.PUT("", manage, orgs.UpdateMineHandler)
+		orgGroup.GET("/members", manage, users.ListMembersHandler)
+		orgGroup.POST("/members", manage, users.CreateMemberHandler)
+		orgGroup.PUT("/members/:id", manage, users.UpdateMemberHandler)
+	}
+
+	// USER Routes (the caller's own account)
 	user := r.Group("/user")
-	user.Use(middleware.AuthMiddleware(), middleware.RequireRole("USER", "ADMIN", "SUPER_ADMIN"))
+	user.Use(middleware.AuthMiddleware(), middleware.RequirePermission(authz.PortalAccess))
 	{
 		user.GET("/profile", users.GetCurrentUserHandler)
 		user.PUT("/profile", users.UpdateUserHandler)
@@ -123,6 +245,12 @@ func main() {
 		user.POST("/energy/predict", energy.GetSolarPrediction)
 		user.GET("/energy/history", energy.GetEnergyHistoryHandler)
 		user.GET("/energy/analytics", energy.GetEnergyAnalyticsHandler)
+		user.GET("/energy/query", energy.QueryTimeSeriesHandler)
+
+		// Grafana datasource tokens
+		user.GET("/grafana/tokens", grafana.GetTokensHandler)
+		user.POST("/grafana/tokens", grafana.CreateTokenHandler)
+		user.DELETE("/grafana/tokens/:id", grafana.RevokeTokenHandler)
 		// Device management for users
 		user.GET("/devices", devices.GetDevicesHandler)
 		user.POST("/devices", devices.CreateUserDeviceHandler)
@@ -130,6 +258,11 @@ func main() {
 		user.PUT("/devices/:id", devices.UpdateDeviceHandler)
 		user.DELETE("/devices/:id", devices.DeleteDeviceHandler)
 		user.POST("/devices/:id/regenerate-key", devices.RegenerateAPIKeyHandler)
+		user.GET("/devices/:id/keys", devices.ListAPIKeysHandler)
+		user.DELETE("/devices/:id/keys/:keyId", devices.RevokeAPIKeyHandler)
+		user.POST("/devices/:id/signing-secret", devices.CreateSigningSecretHandler)
+		user.DELETE("/devices/:id/signing-secret", devices.DeleteSigningSecretHandler)
+		user.PUT("/devices/:id/signing-policy", devices.SetSignaturePolicyHandler)
 		user.GET("/devices/:id/power", devices.GetDevicePowerHandler)
 		// Notifications
 		user.GET("/notifications", notifications.GetNotificationsHandler)
@@ -152,107 +285,163 @@ func main() {
 	inventoryRepo := inventory.NewRepository(database.DB)
 	inventoryH := inventory.NewHandler(inventoryRepo)
 
-	// Inventory Routes (Accessible to all authenticated users for reading, Admins for writing)
+	// Inventory Routes (Accessible to all authenticated users for reading)
 	inventoryGroup := r.Group("/inventory")
 	inventoryGroup.Use(middleware.AuthMiddleware())
 	{
 		inventoryGroup.GET("", inventoryH.GetAllItems)
 		inventoryGroup.GET("/:id", inventoryH.GetItem)
-		// Write access restricted to ADMIN and SUPER_ADMIN
-		inventoryGroup.POST("", middleware.RequireRole("ADMIN", "SUPER_ADMIN"), inventoryH.CreateItem)
-		inventoryGroup.PUT("/:id", middleware.RequireRole("ADMIN", "SUPER_ADMIN"), inventoryH.UpdateItem)
-		inventoryGroup.DELETE("/:id", middleware.RequireRole("ADMIN", "SUPER_ADMIN"), inventoryH.DeleteItem)
+		manage := middleware.RequirePermission(authz.InventoryManage)
+		inventoryGroup.POST("", manage, inventoryH.CreateItem)
+		inventoryGroup.PUT("/:id", manage, inventoryH.UpdateItem)
+		inventoryGroup.DELETE("/:id", manage, inventoryH.DeleteItem)
 	}
 
 	// INSTALLER Routes
 	installerGroup := r.Group("/installer")
-	installerGroup.Use(middleware.AuthMiddleware(), middleware.RequireRole("INSTALLER", "SUPER_ADMIN"))
+	installerGroup.Use(middleware.AuthMiddleware())
 	{
-		installerGroup.POST("/devices", devices.CreateDeviceHandler)
-		installerGroup.GET("/jobs", installerPkg.GetAvailableJobsHandler)
-		installerGroup.POST("/jobs/:id/complete", installerPkg.CompleteInstallationHandler)
+		installerGroup.POST("/devices", middleware.RequirePermission(authz.DevicesProvision), devices.CreateDeviceHandler)
+		jobs := middleware.RequirePermission(authz.InstallationsManage)
+		installerGroup.GET("/jobs", jobs, installerPkg.GetAvailableJobsHandler)
+		installerGroup.POST("/jobs/:id/complete", jobs, installerPkg.CompleteInstallationHandler)
 		// Tickets
-		installerGroup.GET("/tickets", tickets.GetInstallerTicketsHandler)
-		installerGroup.PUT("/tickets/:id/status", tickets.UpdateTicketStatusHandler)
+		work := middleware.RequirePermission(authz.TicketsWork)
+		installerGroup.GET("/tickets", work, tickets.GetInstallerTicketsHandler)
+		installerGroup.PUT("/tickets/:id/status", work, tickets.UpdateTicketStatusHandler)
 	}
 
 	// SUPER_ADMIN Routes
 	superAdmin := r.Group("/superadmin")
-	superAdmin.Use(middleware.AuthMiddleware(), middleware.RequireRole("SUPER_ADMIN"))
+	superAdmin.Use(middleware.AuthMiddleware())
 	{
-		superAdmin.GET("/admins", users.GetAdminsHandler)
-		superAdmin.GET("/installers", users.GetInstallersHandler)
-		superAdmin.POST("/admins", users.CreateUserHandler)
-		superAdmin.GET("/admins/:id", users.GetUserHandler)
-		superAdmin.PUT("/admins/:id", users.UpdateUserHandler)
-		superAdmin.DELETE("/admins/:id", users.DeleteUserHandler)
-		superAdmin.GET("/users", users.GetUsersHandler) // all users
-		superAdmin.GET("/global/stats", users.GetGlobalStatsHandler)
-		superAdmin.GET("/stats/regional", users.GetRegionalStatsHandler)
-		superAdmin.GET("/hierarchy", users.GetSystemHierarchyHandler)
+		staff := middleware.RequirePermission(authz.StaffManage)
+		superAdmin.GET("/admins", staff, users.GetAdminsHandler)
+		superAdmin.GET("/installers", middleware.RequirePermission(authz.UsersRead), users.GetInstallersHandler)
+		superAdmin.POST("/admins", staff, users.CreateUserHandler)
+		superAdmin.GET("/admins/:id", staff, users.GetUserHandler)
+		superAdmin.PUT("/admins/:id", staff, users.UpdateUserHandler)
+		superAdmin.DELETE("/admins/:id", staff, users.DeleteUserHandler)
+		superAdmin.GET("/users", middleware.RequirePermission(authz.UsersRead), users.GetUsersHandler) // all users
+		global := middleware.RequirePermission(authz.AnalyticsGlobal)
+		superAdmin.GET("/global/stats", global, users.GetGlobalStatsHandler)
+		superAdmin.GET("/stats/regional", global, users.GetRegionalStatsHandler)
+		superAdmin.GET("/hierarchy", global, users.GetSystemHierarchyHandler)
+		security := middleware.RequirePermission(authz.SecurityManage)
+		superAdmin.GET("/lockouts", security, auth.ListLockouts)
+		superAdmin.DELETE("/lockouts", security, auth.ClearLockout)
+
+		// Roles and their permissions
+		rolesPerm := middleware.RequirePermission(authz.RolesManage)
+		superAdmin.GET("/permissions", rolesPerm, authz.ListPermissionsHandler)
+		superAdmin.GET("/roles", rolesPerm, authz.ListRolesHandler)
+		superAdmin.POST("/roles", rolesPerm, authz.CreateRoleHandler)
+		superAdmin.PUT("/roles/:name", rolesPerm, authz.UpdateRoleHandler)
+		superAdmin.DELETE("/roles/:name", rolesPerm, authz.DeleteRoleHandler)
 
 		// SuperAdmin Device Management - View ALL devices across all users
-		superAdmin.GET("/devices", devices.GetAllDevicesHandler)
-		superAdmin.GET("/devices/:id", devices.GetDeviceHandler)
-		superAdmin.GET("/devices/:id/power", devices.GetDevicePowerHandler)
+		devicesRead := middleware.RequirePermission(authz.DevicesRead)
+		superAdmin.GET("/devices", devicesRead, devices.GetAllDevicesHandler)
+		superAdmin.GET("/devices/:id", devicesRead, devices.GetDeviceHandler)
+		superAdmin.GET("/devices/:id/power", devicesRead, devices.GetDevicePowerHandler)
+		superAdmin.GET("/devices/:id/keys", devicesRead, devices.ListAPIKeysHandler)
 
 		// SuperAdmin Energy Analytics - View ALL energy data
-		superAdmin.GET("/energy/analytics", energy.GetEnergyAnalyticsHandler)
-		superAdmin.GET("/energy/history", energy.GetEnergyHistoryHandler)
-		superAdmin.GET("/energy/current", energy.CurrentEnergy)
-		superAdmin.GET("/energy/trend", energy.GetGlobalEnergyTrendHandler)
+		superAdmin.GET("/energy/analytics", global, energy.GetEnergyAnalyticsHandler)
+		superAdmin.GET("/energy/history", global, energy.GetEnergyHistoryHandler)
+		superAdmin.GET("/energy/current", global, energy.CurrentEnergy)
+		superAdmin.GET("/energy/trend", global, energy.GetGlobalEnergyTrendHandler)
+		superAdmin.GET("/energy/query", global, energy.QueryTimeSeriesHandler)
 
 		// Regions routes
-		superAdmin.GET("/regions", regions.GetRegionsHandler)
-		superAdmin.POST("/regions", regions.CreateRegionHandler)
-		superAdmin.PUT("/regions/:id", regions.UpdateRegionHandler)
-		superAdmin.DELETE("/regions/:id", regions.DeleteRegionHandler)
-		superAdmin.GET("/test-regions", func(c *gin.Context) { c.JSON(200, gin.H{"message": "test regions works"}) })
-		superAdmin.GET("/test", func(c *gin.Context) { c.JSON(200, gin.H{"message": "test route works"}) })
+		regionsPerm := middleware.RequirePermission(authz.RegionsManage)
+		superAdmin.GET("/regions", regionsPerm, regions.GetRegionsHandler)
+		superAdmin.POST("/regions", regionsPerm, regions.CreateRegionHandler)
+		superAdmin.PUT("/regions/:id", regionsPerm, regions.UpdateRegionHandler)
+		superAdmin.DELETE("/regions/:id", regionsPerm, regions.DeleteRegionHandler)
+		superAdmin.GET("/test-regions", regionsPerm, func(c *gin.Context) { c.JSON(200, gin.H{"message": "test regions works"}) })
+		superAdmin.GET("/test", middleware.RequirePermission(authz.SystemConfig), func(c *gin.Context) { c.JSON(200, gin.H{"message": "test route works"}) })
 
 		// Plants routes
-		superAdmin.GET("/plants", plants.GetPlantsHandler)
-		superAdmin.POST("/plants", plants.CreatePlantHandler)
-		superAdmin.GET("/plants/:id", plants.GetPlantHandler)
-		superAdmin.PUT("/plants/:id", plants.UpdatePlantHandler)
-		superAdmin.DELETE("/plants/:id", plants.DeletePlantHandler)
+		plantsPerm := middleware.RequirePermission(authz.PlantsManage)
+		superAdmin.GET("/plants", plantsPerm, plants.GetPlantsHandler)
+		superAdmin.POST("/plants", plantsPerm, plants.CreatePlantHandler)
+		superAdmin.GET("/plants/:id", plantsPerm, plants.GetPlantHandler)
+		superAdmin.PUT("/plants/:id", plantsPerm, plants.UpdatePlantHandler)
+		superAdmin.DELETE("/plants/:id", plantsPerm, plants.DeletePlantHandler)
 
 		// Reports
-		superAdmin.GET("/reports/users/export", reports.ExportUsersHandler)
-		superAdmin.GET("/reports/plants/export", reports.ExportPlantsHandler)
+		export := middleware.RequirePermission(authz.ReportsExport)
+		superAdmin.GET("/reports/users/export", export, reports.ExportUsersHandler)
+		superAdmin.GET("/reports/plants/export", export, reports.ExportPlantsHandler)
+
+		// Audit log
+		auditRead := middleware.RequirePermission(authz.AuditRead)
+		superAdmin.GET("/audit", auditRead, audit.QueryHandler)
+		superAdmin.GET("/audit/export", auditRead, audit.ExportHandler)
+		superAdmin.GET("/audit/verify", auditRead, audit.VerifyHandler)
+
+		// Organizations
+		orgsPerm := middleware.RequirePermission(authz.OrgsManage)
+		superAdmin.GET("/organizations", orgsPerm, orgs.ListHandler)
+		superAdmin.POST("/organizations", orgsPerm, orgs.CreateHandler)
+		superAdmin.GET("/organizations/:id", orgsPerm, orgs.GetHandler)
+		superAdmin.PUT("/organizations/:id", orgsPerm, orgs.UpdateHandler)
+		superAdmin.DELETE("/organizations/:id", orgsPerm, orgs.DeleteHandler)
+		superAdmin.PUT("/organizations/:id/members/:userId", orgsPerm, orgs.AddMemberHandler)
+		superAdmin.DELETE("/organizations/:id/members/:userId", orgsPerm, orgs.RemoveMemberHandler)
+
+		// Running configuration (secrets redacted)
+		superAdmin.GET("/config", middleware.RequirePermission(authz.SystemConfig), config.Handler(cfg))
 	}
 
 	// ADMIN Routes
 	admin := r.Group("/admin")
-	admin.Use(middleware.AuthMiddleware(), middleware.RequireRole("ADMIN", "SUPER_ADMIN"))
+	admin.Use(middleware.AuthMiddleware())
 	{
-		admin.GET("/users", users.GetUsersHandler)
-		admin.GET("/installers", users.GetInstallersHandler)
-		admin.POST("/users", users.CreateUserHandler)
-		admin.GET("/users/:id", users.GetUserHandler)
-		admin.PUT("/users/:id", users.UpdateUserHandler)
-		admin.DELETE("/users/:id", users.DeleteUserHandler)
-		admin.GET("/analytics", users.GetAdminStatsHandler)
+		usersRead := middleware.RequirePermission(authz.UsersRead)
+		usersWrite := middleware.RequirePermission(authz.UsersWrite)
+		admin.GET("/users", usersRead, users.GetUsersHandler)
+		admin.GET("/installers", usersRead, users.GetInstallersHandler)
+		admin.POST("/users", usersWrite, users.CreateUserHandler)
+		admin.GET("/users/:id", usersRead, users.GetUserHandler)
+		admin.PUT("/users/:id", usersWrite, users.UpdateUserHandler)
+		admin.DELETE("/users/:id", usersWrite, users.DeleteUserHandler)
+		admin.POST("/users/:id/impersonate", middleware.RequirePermission(authz.UsersImpersonate), auth.StartImpersonation)
+		admin.GET("/analytics", middleware.RequirePermission(authz.AnalyticsRead), users.GetAdminStatsHandler)
 
 		// Device management for admins
-		admin.GET("/devices", devices.GetAllDevicesHandler)
-		admin.GET("/devices/:id", devices.GetDeviceHandler)
-		admin.GET("/devices/:id/power", devices.GetDevicePowerHandler)
-		admin.PUT("/devices/:id", devices.UpdateDeviceHandler)
-		admin.DELETE("/devices/:id", devices.DeleteDeviceHandler)
+		devicesRead := middleware.RequirePermission(authz.DevicesRead)
+		devicesWrite := middleware.RequirePermission(authz.DevicesWrite)
+		admin.GET("/devices", devicesRead, devices.GetAllDevicesHandler)
+		admin.GET("/devices/:id", devicesRead, devices.GetDeviceHandler)
+		admin.GET("/devices/:id/power", devicesRead, devices.GetDevicePowerHandler)
+		admin.PUT("/devices/:id", devicesWrite, devices.UpdateDeviceHandler)
+		admin.DELETE("/devices/:id", devicesWrite, devices.DeleteDeviceHandler)
+		admin.GET("/devices/:id/keys", devicesRead, devices.ListAPIKeysHandler)
+		admin.DELETE("/devices/:id/keys/:keyId", devicesWrite, devices.RevokeAPIKeyHandler)
+		admin.POST("/devices/:id/signing-secret", devicesWrite, devices.CreateSigningSecretHandler)
+		admin.DELETE("/devices/:id/signing-secret", devicesWrite, devices.DeleteSigningSecretHandler)
+		admin.PUT("/devices/:id/signing-policy", devicesWrite, devices.SetSignaturePolicyHandler)
+
+		// Time-series queries over devices in the admin's scope
+		admin.GET("/energy/query", middleware.RequirePermission(authz.AnalyticsRead), energy.QueryTimeSeriesHandler)
 	}
 
 	// GOVERNMENT Routes
 	govtGroup := r.Group("/govt")
-	govtGroup.Use(middleware.AuthMiddleware(), middleware.RequireRole("GOVT", "SUPER_ADMIN"))
+	govtGroup.Use(middleware.AuthMiddleware())
 	{
-		govtGroup.GET("/dashboard/stats", govt.GetDashboardStatsHandler)
-		govtGroup.GET("/subsidies/pending", govt.GetPendingSubsidiesHandler)
-		govtGroup.GET("/subsidies/history", govt.GetSubsidyHistoryHandler)
-		govtGroup.PUT("/subsidies/:id/status", govt.UpdateSubsidyStatusHandler)
-		govtGroup.GET("/subsidy/reports", func(c *gin.Context) { c.JSON(200, gin.H{"message": "Regional Reports Placeholder"}) })
+		subsidyRead := middleware.RequirePermission(authz.SubsidyRead)
+		govtGroup.GET("/dashboard/stats", subsidyRead, govt.GetDashboardStatsHandler)
+		govtGroup.GET("/subsidies/pending", subsidyRead, govt.GetPendingSubsidiesHandler)
+		govtGroup.GET("/subsidies/history", subsidyRead, govt.GetSubsidyHistoryHandler)
+		govtGroup.PUT("/subsidies/:id/status", middleware.RequirePermission(authz.SubsidyApprove), govt.UpdateSubsidyStatusHandler)
+		govtGroup.GET("/subsidy/reports", subsidyRead, func(c *gin.Context) { c.JSON(200, gin.H{"message": "Regional Reports Placeholder"}) })
 	}
 
-	log.Println("Server starting on :8080 with regions support")
-	r.Run(":8080")
+	srv := &http.Server{Addr: cfg.Addr(), Handler: r}
+	if err := lc.Serve(srv, cfg.Server.DrainDelay.Duration, cfg.Server.ShutdownTimeout.Duration, database.CloseDB); err != nil {
+		log.Fatalf("Server error: %v", err)
+	}
 }
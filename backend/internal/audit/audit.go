@@ -0,0 +1,354 @@
+// Package audit keeps an append-only record of who changed what. Each entry
+// carries the hash of the one before it, so editing or removing a row breaks
+// the chain and shows up in Verify.
+package audit
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sems-backend/internal/database"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// genesisHash is the previous hash of the first entry
+const genesisHash = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// recordedKey marks a request an explicit hook already recorded
+const recordedKey = "audit_recorded"
+
+// Entry is one audited action
+type Entry struct {
+	ID           string            `json:"id"`
+	Seq          int64             `json:"seq"`
+	CreatedAt    time.Time         `json:"created_at"`
+	ActorID      string            `json:"actor_id"`
+	ActorRole    string            `json:"actor_role"`
+	OnBehalfOf   string            `json:"on_behalf_of,omitempty"` // account the actor was impersonating
+	Action       string            `json:"action"`
+	ResourceType string            `json:"resource_type"`
+	ResourceID   string            `json:"resource_id"`
+	Changes      map[string]Change `json:"changes,omitempty"`
+	IPAddress    string            `json:"ip_address"`
+	PrevHash     string            `json:"prev_hash"`
+	Hash         string            `json:"hash"`
+
+	changes string // Changes as stored and hashed
+}
+
+// Change is a field's value before and after an action
+type Change struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// sensitive fields are recorded as changed without their values
+var sensitive = []string{"password", "secret", "token", "api_key", "hash"}
+
+const redacted = "[redacted]"
+
+// mu serialises appends within the process; the unique seq column catches
+// writers in other processes
+var mu sync.Mutex
+
+// Record appends an entry for the caller's action on a resource. before and
+// after are the resource's state around the action, either may be nil. A
+// failure to record is logged and does not fail the request, which has
+// already taken effect. Under impersonation the admin is the actor and the
+// impersonated account is recorded as on behalf of.
+func Record(c *gin.Context, action, resourceType, resourceID string, before, after interface{}) {
+	c.Set(recordedKey, true)
+	e := &Entry{
+		ActorID:      c.GetString("user_id"),
+		ActorRole:    c.GetString("role"),
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Changes:      Diff(before, after),
+		IPAddress:    c.ClientIP(),
+	}
+	if admin := c.GetString("impersonator_id"); admin != "" {
+		e.OnBehalfOf = e.ActorID
+		e.ActorID, e.ActorRole = admin, c.GetString("impersonator_role")
+	}
+	if err := Append(e); err != nil {
+		log.Printf("❌ Audit %s on %s %s by %s not recorded: %v", action, resourceType, resourceID, e.ActorID, err)
+	}
+}
+
+// Append adds e to the end of the chain, filling in its ID, sequence number,
+// time and hashes
+func Append(e *Entry) error {
+	changes := ""
+	if len(e.Changes) > 0 {
+		b, err := json.Marshal(e.Changes)
+		if err != nil {
+			return err
+		}
+		changes = string(b)
+	}
+	e.changes = changes
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	var err error
+	for attempt := 0; attempt < 3; attempt++ {
+		if err = appendOnce(e); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func appendOnce(e *Entry) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	e.Seq, e.PrevHash = 1, genesisHash
+	var last int64
+	var lastHash string
+	err = tx.QueryRow(`SELECT seq, hash FROM audit_log ORDER BY seq DESC LIMIT 1`).Scan(&last, &lastHash)
+	switch {
+	case err == nil:
+		e.Seq, e.PrevHash = last+1, lastHash
+	case !errors.Is(err, sql.ErrNoRows):
+		return err
+	}
+
+	e.ID = uuid.New().String()
+	// PostgreSQL keeps microseconds; hash what the database will return
+	e.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	e.Hash = e.computeHash()
+
+	if _, err := tx.Exec(`
+		INSERT INTO audit_log (id, seq, created_at, actor_id, actor_role, on_behalf_of, action, resource_type, resource_id, changes, ip_address, prev_hash, hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.ID, e.Seq, e.CreatedAt, e.ActorID, e.ActorRole, e.OnBehalfOf, e.Action, e.ResourceType, e.ResourceID,
+		e.changes, e.IPAddress, e.PrevHash, e.Hash); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// computeHash covers every field and the previous entry's hash. OnBehalfOf
+// is only hashed when set, so entries from before it existed still verify.
+func (e *Entry) computeHash() string {
+	values := []interface{}{
+		e.Seq, e.CreatedAt.UTC().Format(time.RFC3339Nano), e.ActorID, e.ActorRole, e.Action,
+		e.ResourceType, e.ResourceID, e.changes, e.IPAddress, e.PrevHash,
+	}
+	if e.OnBehalfOf != "" {
+		values = append(values, e.OnBehalfOf)
+	}
+	fields, _ := json.Marshal(values)
+	sum := sha256.Sum256(fields)
+	return hex.EncodeToString(sum[:])
+}
+
+// Diff lists the fields that differ between two states of a resource. Both
+// are compared through their JSON form; values of sensitive fields are
+// replaced by a marker.
+func Diff(before, after interface{}) map[string]Change {
+	from, to := fields(before), fields(after)
+	changes := map[string]Change{}
+	for k, v := range from {
+		if w, ok := to[k]; !ok || !reflect.DeepEqual(v, w) {
+			changes[k] = Change{From: v, To: to[k]}
+		}
+	}
+	for k, w := range to {
+		if _, ok := from[k]; !ok {
+			changes[k] = Change{To: w}
+		}
+	}
+	for k, ch := range changes {
+		if isSensitive(k) {
+			changes[k] = Change{From: mask(ch.From), To: mask(ch.To)}
+		}
+	}
+	return changes
+}
+
+func fields(v interface{}) map[string]interface{} {
+	m := map[string]interface{}{}
+	if v == nil {
+		return m
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return m
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return map[string]interface{}{"value": string(b)}
+	}
+	return m
+}
+
+func isSensitive(field string) bool {
+	field = strings.ToLower(field)
+	for _, s := range sensitive {
+		if strings.Contains(field, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func mask(v interface{}) interface{} {
+	if v == nil || v == "" {
+		return v
+	}
+	return redacted
+}
+
+// Filter selects entries; zero fields match everything
+type Filter struct {
+	ActorID      string
+	OnBehalfOf   string
+	Action       string
+	ResourceType string
+	ResourceID   string
+	From         time.Time
+	To           time.Time
+}
+
+func (f Filter) where() (string, []interface{}) {
+	clause, args := "1=1", []interface{}{}
+	for _, c := range []struct{ column, value string }{
+		{"actor_id", f.ActorID}, {"on_behalf_of", f.OnBehalfOf}, {"action", f.Action}, {"resource_type", f.ResourceType}, {"resource_id", f.ResourceID},
+	} {
+		if c.value != "" {
+			clause += " AND " + c.column + " = ?"
+			args = append(args, c.value)
+		}
+	}
+	if !f.From.IsZero() {
+		clause += " AND created_at >= ?"
+		args = append(args, f.From.UTC())
+	}
+	if !f.To.IsZero() {
+		clause += " AND created_at < ?"
+		args = append(args, f.To.UTC())
+	}
+	return clause, args
+}
+
+const entryColumns = `id, seq, created_at, actor_id, actor_role, on_behalf_of, action, resource_type, resource_id, changes, ip_address, prev_hash, hash`
+
+// Query returns one page of matching entries, newest first, and the number of
+// matches
+func Query(f Filter, limit, offset int) ([]*Entry, int, error) {
+	where, args := f.where()
+	var total int
+	if err := database.DB.QueryRow(`SELECT COUNT(*) FROM audit_log WHERE `+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := database.DB.Query(`SELECT `+entryColumns+` FROM audit_log WHERE `+where+
+		` ORDER BY seq DESC LIMIT ? OFFSET ?`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	entries, err := scanEntries(rows)
+	return entries, total, err
+}
+
+// Each calls fn for every matching entry in chain order
+func Each(f Filter, fn func(*Entry) error) error {
+	where, args := f.where()
+	rows, err := database.DB.Query(`SELECT `+entryColumns+` FROM audit_log WHERE `+where+` ORDER BY seq`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		e, err := scanEntry(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// VerifyResult reports the state of the chain
+type VerifyResult struct {
+	Entries  int    `json:"entries"`
+	Valid    bool   `json:"valid"`
+	BrokenAt int64  `json:"broken_at,omitempty"` // seq of the first entry that does not fit
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Verify walks the whole chain and reports the first entry that was changed,
+// removed or inserted out of order
+func Verify() (*VerifyResult, error) {
+	result := &VerifyResult{Valid: true}
+	prev, want := genesisHash, int64(1)
+	err := Each(Filter{}, func(e *Entry) error {
+		reason := ""
+		switch {
+		case e.Seq != want:
+			reason = fmt.Sprintf("expected entry %d, found %d", want, e.Seq)
+		case e.PrevHash != prev:
+			reason = "previous hash does not match"
+		case e.computeHash() != e.Hash:
+			reason = "entry does not match its hash"
+		}
+		if reason != "" {
+			result.Valid, result.BrokenAt, result.Reason = false, e.Seq, reason
+			return errStop
+		}
+		result.Entries++
+		prev, want = e.Hash, e.Seq+1
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStop) {
+		return nil, err
+	}
+	return result, nil
+}
+
+var errStop = errors.New("stop")
+
+func scanEntries(rows *sql.Rows) ([]*Entry, error) {
+	entries := []*Entry{}
+	for rows.Next() {
+		e, err := scanEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func scanEntry(rows *sql.Rows) (*Entry, error) {
+	e := &Entry{}
+	if err := rows.Scan(&e.ID, &e.Seq, &e.CreatedAt, &e.ActorID, &e.ActorRole, &e.OnBehalfOf, &e.Action, &e.ResourceType,
+		&e.ResourceID, &e.changes, &e.IPAddress, &e.PrevHash, &e.Hash); err != nil {
+		return nil, err
+	}
+	e.CreatedAt = e.CreatedAt.UTC()
+	if e.changes != "" {
+		if err := json.Unmarshal([]byte(e.changes), &e.Changes); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"log"
+	"sems-backend/internal/database"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Account token purposes
+const (
+	purposePasswordReset = "password_reset"
+	purposeVerifyEmail   = "verify_email"
+)
+
+const (
+	resetTokenTTL  = time.Hour
+	verifyTokenTTL = 48 * time.Hour
+
+	// resendInterval stops one address from being flooded with emails
+	resendInterval = time.Minute
+)
+
+var ErrTokenInvalid = errors.New("token is invalid, expired or already used")
+
+// issueAccountToken creates a single-use token for the user, replacing any
+// unused token with the same purpose. It returns "" without error when a
+// token was issued less than resendInterval ago.
+func issueAccountToken(userID, purpose string, ttl time.Duration) (string, error) {
+	now := time.Now().UTC()
+
+	var recent int
+	err := database.DB.QueryRow(`
+		SELECT COUNT(*) FROM account_tokens
+		WHERE user_id = ? AND purpose = ? AND created_at > ?`,
+		userID, purpose, now.Add(-resendInterval)).Scan(&recent)
+	if err != nil {
+		return "", err
+	}
+	if recent > 0 {
+		return "", nil
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	plain := base64.RawURLEncoding.EncodeToString(secret)
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		UPDATE account_tokens SET used_at = ?
+		WHERE user_id = ? AND purpose = ? AND used_at IS NULL`, now, userID, purpose); err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO account_tokens (id, user_id, purpose, token_hash, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		uuid.New().String(), userID, purpose, hashToken(plain), now, now.Add(ttl)); err != nil {
+		return "", err
+	}
+	return plain, tx.Commit()
+}
+
+// consumeAccountToken marks a token used and returns its user. A token works
+// once, for its own purpose, before it expires.
+func consumeAccountToken(plain, purpose string) (string, error) {
+	var id, userID string
+	var expiresAt time.Time
+	var usedAt sql.NullTime
+	err := database.DB.QueryRow(`
+		SELECT id, user_id, expires_at, used_at FROM account_tokens
+		WHERE token_hash = ? AND purpose = ?`, hashToken(plain), purpose).Scan(&id, &userID, &expiresAt, &usedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrTokenInvalid
+	}
+	if err != nil {
+		return "", err
+	}
+	now := time.Now().UTC()
+	if usedAt.Valid || !now.Before(expiresAt) {
+		return "", ErrTokenInvalid
+	}
+
+	result, err := database.DB.Exec(`
+		UPDATE account_tokens SET used_at = ?
+		WHERE id = ? AND used_at IS NULL`, now, id)
+	if err != nil {
+		return "", err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return "", ErrTokenInvalid
+	}
+	return userID, nil
+}
+
+// PruneAccountTokens deletes used and expired tokens. Ones issued within
+// resendInterval stay so the resend limit still sees them. Run it periodically.
+func PruneAccountTokens(ctx context.Context) {
+	now := time.Now().UTC()
+	result, err := database.DB.ExecContext(ctx, `
+		DELETE FROM account_tokens
+		WHERE (used_at IS NOT NULL OR `+database.Current.Time("expires_at")+` <= `+database.Current.Time("?")+`)
+		AND `+database.Current.Time("created_at")+` <= `+database.Current.Time("?"), now, now.Add(-resendInterval))
+	if err != nil {
+		log.Printf("⚠️  Failed to prune account tokens: %v", err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		log.Printf("🧹 Pruned %d used or expired account tokens", n)
+	}
+}
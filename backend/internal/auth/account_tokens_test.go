@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"sems-backend/internal/database"
+)
+
+func TestAccountTokensAreSingleUse(t *testing.T) {
+	user := openTestDB(t)
+
+	reset, err := issueAccountToken(user.ID, purposePasswordReset, resetTokenTTL)
+	if err != nil || reset == "" {
+		t.Fatalf("issue: %q, %v", reset, err)
+	}
+	if again, err := issueAccountToken(user.ID, purposePasswordReset, resetTokenTTL); err != nil || again != "" {
+		t.Fatalf("second token within the resend interval: %q, %v", again, err)
+	}
+
+	if _, err := consumeAccountToken(reset, purposeVerifyEmail); !errors.Is(err, ErrTokenInvalid) {
+		t.Fatalf("token used for another purpose: %v", err)
+	}
+	userID, err := consumeAccountToken(reset, purposePasswordReset)
+	if err != nil || userID != user.ID {
+		t.Fatalf("consume: %q, %v", userID, err)
+	}
+	if _, err := consumeAccountToken(reset, purposePasswordReset); !errors.Is(err, ErrTokenInvalid) {
+		t.Fatalf("token used twice: %v", err)
+	}
+
+	// An expired token is refused even if unused
+	if _, err := database.DB.Exec(`DELETE FROM account_tokens`); err != nil {
+		t.Fatal(err)
+	}
+	expired, err := issueAccountToken(user.ID, purposeVerifyEmail, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := consumeAccountToken(expired, purposeVerifyEmail); !errors.Is(err, ErrTokenInvalid) {
+		t.Fatalf("expired token: %v", err)
+	}
+}
+
+func TestPruneAccountTokens(t *testing.T) {
+	user := openTestDB(t)
+	count := func() int {
+		t.Helper()
+		var n int
+		if err := database.DB.QueryRow(`SELECT COUNT(*) FROM account_tokens`).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	used, err := issueAccountToken(user.ID, purposePasswordReset, resetTokenTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := consumeAccountToken(used, purposePasswordReset); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := issueAccountToken(user.ID, purposeVerifyEmail, -1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Fresh tokens stay so the resend limit still counts them
+	PruneAccountTokens(context.Background())
+	if n := count(); n != 2 {
+		t.Fatalf("%d tokens after pruning fresh ones, want 2", n)
+	}
+
+	if _, err := database.DB.Exec(`UPDATE account_tokens SET created_at = ?`, time.Now().UTC().Add(-2*resendInterval)); err != nil {
+		t.Fatal(err)
+	}
+	valid, err := issueAccountToken(user.ID, purposePasswordReset, resetTokenTTL)
+	if err != nil || valid == "" {
+		t.Fatalf("issue: %q, %v", valid, err)
+	}
+	if _, err := database.DB.Exec(`UPDATE account_tokens SET created_at = ?`, time.Now().UTC().Add(-2*resendInterval)); err != nil {
+		t.Fatal(err)
+	}
+
+	PruneAccountTokens(context.Background())
+	if n := count(); n != 1 {
+		t.Fatalf("%d tokens left, want only the unused one", n)
+	}
+	if _, err := consumeAccountToken(valid, purposePasswordReset); err != nil {
+		t.Fatalf("unused token pruned: %v", err)
+	}
+}
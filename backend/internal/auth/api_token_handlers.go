@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateAPITokenRequest describes a new personal access token
+type CreateAPITokenRequest struct {
+	Name          string   `json:"name" binding:"required"`
+	Scopes        []string `json:"scopes" binding:"required"`
+	ExpiresInDays int      `json:"expires_in_days"` // default 90, at most 365
+}
+
+// @Summary List API tokens
+// @Description The signed-in user's personal access tokens and the scopes a token can carry
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 500 {object} map[string]string
+// @Security BearerAuth
+// @Router /auth/tokens [get]
+func ListAPITokens(c *gin.Context) {
+	tokens, err := listAPITokens(c.GetString("user_id"))
+	if err != nil {
+		log.Printf("List API tokens error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tokens"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tokens": tokens, "scopes": TokenScopes})
+}
+
+// @Summary Create API token
+// @Description Issue a personal access token for scripts and integrations. It acts with the user's role, limited to its scopes. The plaintext token is only returned once.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param request body CreateAPITokenRequest true "Token"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security BearerAuth
+// @Router /auth/tokens [post]
+func CreateAPIToken(c *gin.Context) {
+	var req CreateAPITokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ttl := defaultAPITokenTTL
+	if req.ExpiresInDays != 0 {
+		ttl = time.Duration(req.ExpiresInDays) * 24 * time.Hour
+	}
+
+	plain, token, err := createAPIToken(c.GetString("user_id"), req.Name, req.Scopes, ttl)
+	if errors.Is(err, errAPITokenRequest) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Create API token error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+	log.Printf("🔑 API token %s (%s) created by %s", token.Prefix, token.Name, token.UserID)
+	c.JSON(http.StatusCreated, gin.H{"token": plain, "details": token})
+}
+
+// @Summary Revoke API token
+// @Description Revoke one of the signed-in user's personal access tokens; it stops working at once
+// @Tags Auth
+// @Produce json
+// @Param id path string true "Token ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /auth/tokens/{id} [delete]
+func RevokeAPIToken(c *gin.Context) {
+	err := revokeAPIToken(c.GetString("user_id"), c.Param("id"))
+	if errors.Is(err, ErrAPITokenNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Revoke API token error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke token"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Token revoked"})
+}
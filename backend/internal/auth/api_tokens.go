@@ -0,0 +1,242 @@
+package auth
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sems-backend/internal/database"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const apiTokenPrefix = "spt_"
+
+const (
+	defaultAPITokenTTL = 90 * 24 * time.Hour
+	maxAPITokenTTL     = 365 * 24 * time.Hour
+)
+
+var (
+	ErrAPITokenInvalid  = errors.New("api token is invalid, expired or revoked")
+	ErrAPITokenNotFound = errors.New("api token not found")
+	errAPITokenRequest  = errors.New("invalid api token request")
+)
+
+// TokenScope is what a personal access token may be used for. Scopes narrow
+// the routes a token reaches; the owner's role still decides what it may do.
+type TokenScope struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	ReadOnly    bool   `json:"read_only"`
+
+	routes []string // route patterns the scope covers; "/prefix/*" covers everything below
+}
+
+// TokenScopes lists the scopes a token can carry
+var TokenScopes = []TokenScope{
+	{Name: "telemetry:read", Description: "Read devices, energy readings and statistics", ReadOnly: true,
+		routes: []string{
+			"/user/energy/*",
+			"/user/devices", "/user/devices/:id", "/user/devices/:id/power",
+			"/admin/devices", "/admin/devices/:id", "/admin/devices/:id/power",
+			"/admin/analytics", "/admin/energy/query",
+			"/superadmin/devices", "/superadmin/devices/:id", "/superadmin/devices/:id/power",
+			"/superadmin/energy/*", "/superadmin/global/stats", "/superadmin/stats/regional", "/superadmin/hierarchy",
+		}},
+	{Name: "reports:export", Description: "Download reports and exports", ReadOnly: true,
+		routes: []string{"/user/reports/*", "/superadmin/reports/*"}},
+	{Name: "devices:manage", Description: "Register, change and remove devices and rotate their keys",
+		routes: []string{
+			"/user/devices", "/user/devices/*",
+			"/admin/devices", "/admin/devices/*",
+			"/superadmin/devices", "/superadmin/devices/*",
+			"/installer/devices",
+		}},
+}
+
+// APIToken is a personal access token as shown to its owner; the secret is
+// only returned on creation
+type APIToken struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// IsAPIToken reports whether a bearer credential is a personal access token
+// rather than a JWT
+func IsAPIToken(bearer string) bool {
+	return strings.HasPrefix(bearer, apiTokenPrefix)
+}
+
+// Allows reports whether one of the token's scopes covers a request. route is
+// the matched route pattern, e.g. /user/devices/:id.
+func (t *APIToken) Allows(method, route string) bool {
+	for _, name := range t.Scopes {
+		scope := tokenScope(name)
+		if scope == nil || (scope.ReadOnly && method != "GET" && method != "HEAD") {
+			continue
+		}
+		for _, pattern := range scope.routes {
+			if pattern == route || (strings.HasSuffix(pattern, "/*") && strings.HasPrefix(route, strings.TrimSuffix(pattern, "*"))) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func tokenScope(name string) *TokenScope {
+	for i := range TokenScopes {
+		if TokenScopes[i].Name == name {
+			return &TokenScopes[i]
+		}
+	}
+	return nil
+}
+
+// createAPIToken issues a token for the user and returns the plaintext once
+func createAPIToken(userID, name string, scopes []string, ttl time.Duration) (string, *APIToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 64 {
+		return "", nil, fmt.Errorf("%w: name must be 1-64 characters", errAPITokenRequest)
+	}
+	if ttl <= 0 || ttl > maxAPITokenTTL {
+		return "", nil, fmt.Errorf("%w: expiry must be between 1 and 365 days", errAPITokenRequest)
+	}
+	seen := map[string]bool{}
+	kept := []string{}
+	for _, s := range scopes {
+		if tokenScope(s) == nil {
+			return "", nil, fmt.Errorf("%w: unknown scope %q", errAPITokenRequest, s)
+		}
+		if !seen[s] {
+			seen[s] = true
+			kept = append(kept, s)
+		}
+	}
+	if len(kept) == 0 {
+		return "", nil, fmt.Errorf("%w: at least one scope is required", errAPITokenRequest)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+	plain := apiTokenPrefix + hex.EncodeToString(secret)
+
+	now := time.Now().UTC()
+	token := &APIToken{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Name:      name,
+		Prefix:    plain[:len(apiTokenPrefix)+8],
+		Scopes:    kept,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	_, err := database.DB.Exec(`
+		INSERT INTO api_tokens (id, user_id, name, token_prefix, token_hash, scopes, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		token.ID, token.UserID, token.Name, token.Prefix, hashToken(plain), strings.Join(kept, ","), now, token.ExpiresAt)
+	if err != nil {
+		return "", nil, err
+	}
+	return plain, token, nil
+}
+
+// listAPITokens returns the user's tokens, newest first
+func listAPITokens(userID string) ([]APIToken, error) {
+	rows, err := database.DB.Query(`
+		SELECT id, user_id, name, token_prefix, scopes, created_at, expires_at, last_used_at, last_used_ip, revoked_at
+		FROM api_tokens
+		WHERE user_id = ?
+		ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []APIToken{}
+	for rows.Next() {
+		var t APIToken
+		var scopes string
+		var lastUsed, revoked sql.NullTime
+		var lastIP sql.NullString
+		if err := rows.Scan(&t.ID, &t.UserID, &t.Name, &t.Prefix, &scopes, &t.CreatedAt, &t.ExpiresAt, &lastUsed, &lastIP, &revoked); err != nil {
+			return nil, err
+		}
+		t.Scopes = strings.Split(scopes, ",")
+		if lastUsed.Valid {
+			t.LastUsedAt = &lastUsed.Time
+		}
+		t.LastUsedIP = lastIP.String
+		if revoked.Valid {
+			t.RevokedAt = &revoked.Time
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// revokeAPIToken revokes one of the user's tokens
+func revokeAPIToken(userID, tokenID string) error {
+	result, err := database.DB.Exec(`
+		UPDATE api_tokens SET revoked_at = ?
+		WHERE id = ? AND user_id = ? AND revoked_at IS NULL`,
+		time.Now().UTC(), tokenID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrAPITokenNotFound
+	}
+	return nil
+}
+
+// AuthenticateAPIToken resolves a plaintext token to the token and the current
+// state of its owner's account, and records the use
+func AuthenticateAPIToken(plain, ip string) (*APIToken, *SessionUser, error) {
+	var t APIToken
+	var u SessionUser
+	var scopes string
+	var active sql.NullBool
+	var revoked sql.NullTime
+	err := database.DB.QueryRow(`
+		SELECT t.id, t.user_id, t.name, t.scopes, t.expires_at, t.revoked_at, u.email, u.role, u.is_active
+		FROM api_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = ?`, hashToken(plain)).Scan(
+		&t.ID, &t.UserID, &t.Name, &scopes, &t.ExpiresAt, &revoked, &u.Email, &u.Role, &active)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, ErrAPITokenInvalid
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now().UTC()
+	if revoked.Valid || !now.Before(t.ExpiresAt) {
+		return nil, nil, ErrAPITokenInvalid
+	}
+	if !active.Bool {
+		return nil, nil, ErrAccountDeactivated
+	}
+	t.Scopes = strings.Split(scopes, ",")
+
+	if _, err := database.DB.Exec(`
+		UPDATE api_tokens SET last_used_at = ?, last_used_ip = ? WHERE id = ?`, now, ip, t.ID); err != nil {
+		return nil, nil, err
+	}
+	t.LastUsedAt, t.LastUsedIP = &now, ip
+	return &t, &u, nil
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"sems-backend/internal/database"
+)
+
+func TestAPITokenLifecycle(t *testing.T) {
+	user := openTestDB(t)
+
+	if _, _, err := createAPIToken(user.ID, "ci", []string{"telemetry:write"}, time.Hour); !errors.Is(err, errAPITokenRequest) {
+		t.Fatalf("unknown scope accepted: %v", err)
+	}
+	if _, _, err := createAPIToken(user.ID, "ci", []string{"telemetry:read"}, 2*maxAPITokenTTL); !errors.Is(err, errAPITokenRequest) {
+		t.Fatalf("expiry beyond the maximum accepted: %v", err)
+	}
+
+	plain, created, err := createAPIToken(user.ID, "ci", []string{"telemetry:read", "telemetry:read"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsAPIToken(plain) || len(created.Scopes) != 1 {
+		t.Fatalf("token %q with scopes %v", created.Prefix, created.Scopes)
+	}
+
+	// Only the hash is stored
+	var stored int
+	database.DB.QueryRow(`SELECT COUNT(*) FROM api_tokens WHERE token_hash = ?`, plain).Scan(&stored)
+	if stored != 0 {
+		t.Fatal("plaintext token stored")
+	}
+
+	token, owner, err := AuthenticateAPIToken(plain, "10.0.0.7")
+	if err != nil || token.UserID != user.ID || owner.Role != user.Role {
+		t.Fatalf("authenticate: %v", err)
+	}
+	listed, err := listAPITokens(user.ID)
+	if err != nil || len(listed) != 1 || listed[0].LastUsedAt == nil || listed[0].LastUsedIP != "10.0.0.7" {
+		t.Fatalf("last use not recorded: %+v %v", listed, err)
+	}
+
+	scopes := []struct {
+		method, route string
+		want          bool
+	}{
+		{"GET", "/user/energy/history", true},
+		{"GET", "/superadmin/devices/:id", true},
+		{"GET", "/superadmin/energy/trend", true},
+		{"GET", "/user/reports/energy/export", false},
+		{"GET", "/user/devices/:id/keys", false},
+		{"GET", "/admin/devices/:id/keys", false},
+		{"GET", "/superadmin/devices/:id/keys", false},
+		{"PUT", "/user/devices/:id", false},
+		{"GET", "/user/profile", false},
+		{"POST", "/auth/tokens", false},
+	}
+	for _, s := range scopes {
+		if got := token.Allows(s.method, s.route); got != s.want {
+			t.Errorf("telemetry:read on %s %s = %v, want %v", s.method, s.route, got, s.want)
+		}
+	}
+	manage := &APIToken{Scopes: []string{"devices:manage"}}
+	if !manage.Allows("DELETE", "/user/devices/:id") || !manage.Allows("GET", "/admin/devices/:id/keys") || manage.Allows("GET", "/user/energy/history") {
+		t.Error("devices:manage scope")
+	}
+	export := &APIToken{Scopes: []string{"reports:export"}}
+	if !export.Allows("GET", "/user/reports/energy/export") || export.Allows("GET", "/user/energy/history") {
+		t.Error("reports:export scope")
+	}
+
+	if err := revokeAPIToken(user.ID, created.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := AuthenticateAPIToken(plain, ""); !errors.Is(err, ErrAPITokenInvalid) {
+		t.Fatalf("revoked token accepted: %v", err)
+	}
+	if err := revokeAPIToken(user.ID, created.ID); !errors.Is(err, ErrAPITokenNotFound) {
+		t.Fatalf("revoked twice: %v", err)
+	}
+
+	expired, _, err := createAPIToken(user.ID, "old", []string{"reports:export"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	database.DB.Exec(`UPDATE api_tokens SET expires_at = ? WHERE token_hash = ?`, time.Now().UTC().Add(-time.Minute), hashToken(expired))
+	if _, _, err := AuthenticateAPIToken(expired, ""); !errors.Is(err, ErrAPITokenInvalid) {
+		t.Fatalf("expired token accepted: %v", err)
+	}
+}
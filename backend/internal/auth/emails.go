@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"net/url"
+	"sems-backend/internal/notifications"
+	"sems-backend/internal/users"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// accountEmail wraps a short message and an optional button in the SEMS layout
+func accountEmail(name, message, buttonText, link string) string {
+	button := ""
+	if link != "" {
+		button = fmt.Sprintf(`<p style="margin: 24px 0;"><a href="%s" style="background: #f59e0b; color: white; padding: 12px 24px; border-radius: 8px; text-decoration: none; font-weight: bold;">%s</a></p>
+			<p style="font-size: 12px; color: #6b7280;">Or open this link: %s</p>`, html.EscapeString(link), buttonText, html.EscapeString(link))
+	}
+	return fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<body style="font-family: Arial, sans-serif; line-height: 1.6; color: #333;">
+	<div style="max-width: 600px; margin: 0 auto; padding: 20px;">
+		<h2 style="color: #ea580c;">☀️ Solar Energy Management System</h2>
+		<p>Hello %s,</p>
+		<p>%s</p>
+		%s
+		<p style="font-size: 12px; color: #6b7280;">If you did not expect this email, you can ignore it.</p>
+	</div>
+</body>
+</html>`, html.EscapeString(name), message, button)
+}
+
+// appLink builds a web app link carrying a token in its query string
+func appLink(path, token string) string {
+	return strings.TrimRight(appURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
+
+// sendAsync keeps SMTP latency out of the response, which would otherwise
+// reveal whether an account exists
+func sendAsync(to, subject, body string) {
+	go func() {
+		if err := notifications.SendEmail(to, subject, body); err != nil {
+			log.Printf("❌ Account email to %s failed: %v", to, err)
+		}
+	}()
+}
+
+func sendVerificationEmail(user *users.User, token string) {
+	sendAsync(user.Email, "Verify your email address", accountEmail(user.FirstName,
+		"Please confirm this is your email address. The link is valid for 48 hours.",
+		"Verify email", appLink("/verify-email", token)))
+}
+
+func sendPasswordResetEmail(user *users.User, token string) {
+	sendAsync(user.Email, "Reset your password", accountEmail(user.FirstName,
+		"We received a request to reset your password. The link is valid for 1 hour and works once.",
+		"Reset password", appLink("/reset-password", token)))
+}
+
+func sendPasswordChangedEmail(user *users.User) {
+	sendAsync(user.Email, "Your password was changed", accountEmail(user.FirstName,
+		"Your password was just changed and all your sessions were signed out. If this was not you, reset your password now and contact support.",
+		"", ""))
+}
+
+func sendTwoFactorChangedEmail(user *users.User, enabled bool) {
+	subject, message := "Two-factor authentication enabled",
+		"Two-factor authentication is now on for your account. Keep your recovery codes somewhere safe."
+	if !enabled {
+		subject, message = "Two-factor authentication disabled",
+			"Two-factor authentication was turned off for your account. If this was not you, reset your password now and contact support."
+	}
+	sendAsync(user.Email, subject, accountEmail(user.FirstName, message, "", ""))
+}
+
+// notifyAccountLocked tells the owner by email and in the app, since the
+// failures may not have been theirs
+func notifyAccountLocked(user *users.User, ip string) {
+	message := fmt.Sprintf("Sign-in to your account was locked for %s after %d failed attempts, the last one from %s. If this was not you, consider changing your password.",
+		lockoutDuration, maxLoginFailures, ip)
+	sendAsync(user.Email, "Sign-in to your account was locked", accountEmail(user.FirstName, html.EscapeString(message),
+		"Reset password", strings.TrimRight(appURL, "/")+"/forgot-password"))
+
+	if id, err := uuid.Parse(user.ID); err == nil {
+		if _, err := notifications.CreateNotification(id, notifications.NotificationTypeAlert, "Account temporarily locked",
+			message, notifications.SeverityHigh, ""); err != nil {
+			log.Printf("Lockout notification error: %v", err)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"sems-backend/internal/audit"
+	"sems-backend/internal/database"
+	"sems-backend/internal/keys"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// ImpersonationClaim marks an access token issued to an admin viewing the app
+// as a customer; it holds the impersonation ID
+const ImpersonationClaim = "imp"
+
+var impersonationTTL = 30 * time.Minute
+
+// Impersonation is an admin's time-limited session as a customer. Its tokens
+// act as the customer; the admin's own session must stay open throughout.
+type Impersonation struct {
+	ID        string     `json:"id"`
+	AdminID   string     `json:"admin_id"`
+	AdminRole string     `json:"admin_role"`
+	UserID    string     `json:"user_id"`
+	Reason    string     `json:"reason"`
+	ReadOnly  bool       `json:"read_only"`
+	IPAddress string     `json:"ip_address"`
+	StartedAt time.Time  `json:"started_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+	EndReason string     `json:"end_reason,omitempty"` // ended, expired or signed_out
+
+	adminSessionID string
+}
+
+// readOnlyPosts change nothing despite their method
+var readOnlyPosts = map[string]bool{
+	"/user/energy/predict": true,
+}
+
+// Allows reports whether an impersonation token may make a request. Account
+// security and credentials that would outlive the impersonation stay with
+// the customer, and read-only impersonations cannot change anything.
+func (imp *Impersonation) Allows(method, route string) bool {
+	switch {
+	case route == "/auth/impersonation", route == "/auth/permissions":
+		return true
+	case strings.HasPrefix(route, "/auth/"), strings.HasPrefix(route, "/user/grafana/tokens"):
+		return false
+	}
+	if !imp.ReadOnly {
+		return true
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return readOnlyPosts[route]
+}
+
+func startImpersonation(adminID, adminRole, adminSessionID, userID, reason, ip string, readOnly bool) (*Impersonation, error) {
+	now := time.Now().UTC()
+	imp := &Impersonation{
+		ID:             uuid.New().String(),
+		AdminID:        adminID,
+		AdminRole:      adminRole,
+		UserID:         userID,
+		Reason:         reason,
+		ReadOnly:       readOnly,
+		IPAddress:      ip,
+		StartedAt:      now,
+		ExpiresAt:      now.Add(impersonationTTL),
+		adminSessionID: adminSessionID,
+	}
+	_, err := database.DB.Exec(`
+		INSERT INTO impersonations (id, admin_id, admin_role, admin_session_id, user_id, reason, read_only, ip_address, started_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		imp.ID, imp.AdminID, imp.AdminRole, imp.adminSessionID, imp.UserID, imp.Reason, imp.ReadOnly, imp.IPAddress,
+		imp.StartedAt, imp.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return imp, nil
+}
+
+// impersonationJWT issues the impersonation's access token. It names the
+// customer as user and the admin as actor, and expires with the impersonation.
+func impersonationJWT(imp *Impersonation, email, role string) (string, error) {
+	return keys.Sign(jwt.MapClaims{
+		"user_id":          imp.UserID,
+		"email":            email,
+		"role":             role,
+		ImpersonationClaim: imp.ID,
+		"act":              map[string]string{"sub": imp.AdminID},
+		"read_only":        imp.ReadOnly,
+		"exp":              imp.ExpiresAt.Unix(),
+		"iat":              imp.StartedAt.Unix(),
+	})
+}
+
+const selectImpersonation = `
+	SELECT id, admin_id, admin_role, admin_session_id, user_id, reason, read_only, ip_address,
+	       started_at, expires_at, ended_at, end_reason
+	FROM impersonations`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanImpersonation(row rowScanner) (*Impersonation, error) {
+	imp := &Impersonation{}
+	var endedAt sql.NullTime
+	err := row.Scan(&imp.ID, &imp.AdminID, &imp.AdminRole, &imp.adminSessionID, &imp.UserID, &imp.Reason,
+		&imp.ReadOnly, &imp.IPAddress, &imp.StartedAt, &imp.ExpiresAt, &endedAt, &imp.EndReason)
+	if err != nil {
+		return nil, err
+	}
+	if endedAt.Valid {
+		imp.EndedAt = &endedAt.Time
+	}
+	return imp, nil
+}
+
+func getImpersonation(id string) (*Impersonation, error) {
+	return scanImpersonation(database.DB.QueryRow(selectImpersonation+` WHERE id = ?`, id))
+}
+
+// ValidateImpersonation checks that an impersonation token's impersonation
+// is still open, along with the admin session that started it, and returns
+// the impersonation and the customer's current email and role.
+func ValidateImpersonation(id, userID string) (*Impersonation, *SessionUser, error) {
+	imp, err := getImpersonation(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, ErrSessionInvalid
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if imp.UserID != userID || imp.EndedAt != nil || !time.Now().Before(imp.ExpiresAt) {
+		return nil, nil, ErrSessionInvalid
+	}
+	// Signing out or losing the admin account ends the impersonation too
+	if _, err := ValidateSession(imp.adminSessionID, imp.AdminID); err != nil {
+		if errors.Is(err, ErrAccountDeactivated) {
+			err = ErrSessionInvalid
+		}
+		return nil, nil, err
+	}
+
+	var u SessionUser
+	var active sql.NullBool
+	err = database.DB.QueryRow(`SELECT email, role, is_active FROM users WHERE id = ?`, userID).Scan(&u.Email, &u.Role, &active)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, ErrSessionInvalid
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if !active.Bool {
+		return nil, nil, ErrAccountDeactivated
+	}
+	return imp, &u, nil
+}
+
+// endImpersonation closes an open impersonation and reports whether it was
+// still open
+func endImpersonation(id, reason string, at time.Time) (bool, error) {
+	result, err := database.DB.Exec(`
+		UPDATE impersonations SET ended_at = ?, end_reason = ?
+		WHERE id = ? AND ended_at IS NULL`, at.UTC(), reason, id)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// CloseImpersonations ends impersonations that expired or whose admin signed
+// out, and records their end in the audit log; run it periodically
+func CloseImpersonations(ctx context.Context) {
+	now := time.Now().UTC()
+	rows, err := database.DB.QueryContext(ctx, selectImpersonation+`
+		WHERE ended_at IS NULL AND (expires_at <= ? OR NOT EXISTS (
+			SELECT 1 FROM auth_sessions s
+			WHERE s.id = admin_session_id AND s.revoked_at IS NULL AND s.expires_at > ?))`, now, now)
+	if err != nil {
+		log.Printf("Impersonation cleanup error: %v", err)
+		return
+	}
+	var stale []*Impersonation
+	for rows.Next() {
+		imp, err := scanImpersonation(rows)
+		if err != nil {
+			log.Printf("Impersonation cleanup error: %v", err)
+			break
+		}
+		stale = append(stale, imp)
+	}
+	rows.Close()
+
+	for _, imp := range stale {
+		reason, at := "signed_out", now
+		if !now.Before(imp.ExpiresAt) {
+			reason, at = "expired", imp.ExpiresAt
+		}
+		ended, err := endImpersonation(imp.ID, reason, at)
+		if err != nil {
+			log.Printf("Impersonation cleanup error: %v", err)
+			continue
+		}
+		if !ended {
+			continue
+		}
+		if err := audit.Append(&audit.Entry{
+			ActorID:      imp.AdminID,
+			ActorRole:    imp.AdminRole,
+			OnBehalfOf:   imp.UserID,
+			Action:       "impersonation.end",
+			ResourceType: "impersonation",
+			ResourceID:   imp.ID,
+			Changes:      audit.Diff(nil, map[string]string{"end_reason": reason}),
+			IPAddress:    imp.IPAddress,
+		}); err != nil {
+			log.Printf("❌ Audit of impersonation %s end not recorded: %v", imp.ID, err)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"sems-backend/internal/audit"
+	"sems-backend/internal/authz"
+	"sems-backend/internal/notifications"
+	"sems-backend/internal/users"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// StartImpersonationRequest says why an admin needs to see a customer's view
+type StartImpersonationRequest struct {
+	Reason   string `json:"reason" binding:"required,max=500"` // e.g. the ticket being triaged
+	ReadOnly *bool  `json:"read_only"`                         // default true
+}
+
+// @Summary Start impersonation
+// @Description Issue a short-lived token that acts as a customer in the caller's scope, for support. The token is read-only unless read_only is false and the caller also holds users:write. It cannot reach account security or create credentials, and it ends when it expires or the caller signs out. The customer is notified and every request is audited.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param request body StartImpersonationRequest true "Reason"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /admin/users/{id}/impersonate [post]
+func StartImpersonation(c *gin.Context) {
+	var req StartImpersonationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// Personal access tokens and impersonation tokens carry no session
+	sessionID := c.GetString("session_id")
+	if sessionID == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Impersonation must be started from a signed-in session"})
+		return
+	}
+	caller, err := authz.Caller(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+	userID := c.Param("id")
+	if userID == caller.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot impersonate yourself"})
+		return
+	}
+	target, err := authz.Lookup(userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Impersonation lookup error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start impersonation"})
+		return
+	}
+
+	account := authz.Resource{Kind: authz.Account, OwnerID: userID}
+	if ok, err := authz.Can(caller, authz.UsersImpersonate, account); err != nil || !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+	// Impersonating must not lend the caller anything they lack
+	for _, p := range target.Permissions() {
+		if !caller.Has(p) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Cannot impersonate an account with permissions you do not hold"})
+			return
+		}
+	}
+	readOnly := req.ReadOnly == nil || *req.ReadOnly
+	if !readOnly {
+		if ok, err := authz.Can(caller, authz.UsersWrite, account); err != nil || !ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Acting as a customer requires users:write"})
+			return
+		}
+	}
+
+	user, err := users.GetUserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if !user.IsActive {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Account is deactivated"})
+		return
+	}
+	admin, err := users.GetUserByID(caller.ID)
+	if err != nil {
+		log.Printf("Impersonation lookup error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start impersonation"})
+		return
+	}
+
+	imp, err := startImpersonation(caller.ID, caller.Role, sessionID, userID, req.Reason, c.ClientIP(), readOnly)
+	if err != nil {
+		log.Printf("Start impersonation error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start impersonation"})
+		return
+	}
+	token, err := impersonationJWT(imp, user.Email, user.Role)
+	if err != nil {
+		log.Printf("Impersonation token error: %v", err)
+		endImpersonation(imp.ID, "ended", time.Now())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	audit.Record(c, "impersonation.start", "impersonation", imp.ID, nil, gin.H{
+		"user_id": userID, "reason": req.Reason, "read_only": readOnly, "expires_at": imp.ExpiresAt,
+	})
+	notifyImpersonated(user, admin, imp)
+	log.Printf("🎭 %s started impersonating %s until %s (read-only: %t)", caller.ID, userID, imp.ExpiresAt.Format(time.RFC3339), readOnly)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"token":         token,
+		"expires_in":    int(impersonationTTL.Seconds()),
+		"impersonation": imp,
+		"user": gin.H{
+			"id":    user.ID,
+			"name":  user.FirstName + " " + user.LastName,
+			"email": user.Email,
+			"role":  user.Role,
+		},
+	})
+}
+
+// @Summary Impersonation status
+// @Description Whether the token in use impersonates a customer, and if so who started it, why, until when and whether it is read-only
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /auth/impersonation [get]
+func ImpersonationStatus(c *gin.Context) {
+	id := c.GetString("impersonation_id")
+	if id == "" {
+		c.JSON(http.StatusOK, gin.H{"impersonating": false})
+		return
+	}
+	imp, err := getImpersonation(id)
+	if err != nil {
+		log.Printf("Impersonation status error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch impersonation"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"impersonating": true, "impersonation": imp})
+}
+
+// @Summary End impersonation
+// @Description End the impersonation the token in use belongs to; the token stops working at once
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Security BearerAuth
+// @Router /auth/impersonation [delete]
+func EndImpersonation(c *gin.Context) {
+	id := c.GetString("impersonation_id")
+	if id == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not impersonating"})
+		return
+	}
+	if _, err := endImpersonation(id, "ended", time.Now()); err != nil {
+		log.Printf("End impersonation error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end impersonation"})
+		return
+	}
+	audit.Record(c, "impersonation.end", "impersonation", id, nil, gin.H{"end_reason": "ended"})
+	c.JSON(http.StatusOK, gin.H{"message": "Impersonation ended"})
+}
+
+// notifyImpersonated tells the customer by email and in the app who is
+// viewing their account, why and until when
+func notifyImpersonated(user, admin *users.User, imp *Impersonation) {
+	mode := "They can only look, not change anything."
+	if !imp.ReadOnly {
+		mode = "They can act on your behalf; every action is recorded."
+	}
+	message := fmt.Sprintf("%s %s from support started viewing your account as you until %s UTC, for: %s. %s",
+		admin.FirstName, admin.LastName, imp.ExpiresAt.Format("2006-01-02 15:04"), imp.Reason, mode)
+	sendAsync(user.Email, "Support is viewing your account", accountEmail(user.FirstName, html.EscapeString(message), "", ""))
+
+	if id, err := uuid.Parse(user.ID); err == nil {
+		if _, err := notifications.CreateNotification(id, notifications.NotificationTypeSystem, "Support is viewing your account",
+			message, notifications.SeverityMedium, ""); err != nil {
+			log.Printf("Impersonation notification error: %v", err)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"sems-backend/internal/audit"
+	"sems-backend/internal/database"
+	"sems-backend/internal/users"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestImpersonationLifecycle(t *testing.T) {
+	admin := openTestDB(t)
+	customer, err := users.CreateUser("Cara", "Customer", "cara@test", "x", "USER", "", "", "", "", "", "", "", "", 0, 0, "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionID, _, err := createSession(admin.ID, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imp, err := startImpersonation(admin.ID, admin.Role, sessionID, customer.ID, "ticket 42", "127.0.0.1", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ValidateImpersonation(imp.ID, admin.ID); !errors.Is(err, ErrSessionInvalid) {
+		t.Fatalf("impersonation accepted for another account: %v", err)
+	}
+	got, as, err := ValidateImpersonation(imp.ID, customer.ID)
+	if err != nil || as.Role != "USER" || got.AdminID != admin.ID {
+		t.Fatalf("validate: %+v %v", as, err)
+	}
+
+	routes := []struct {
+		method, route string
+		want          bool
+	}{
+		{"GET", "/user/energy/history", true},
+		{"POST", "/user/energy/predict", true},
+		{"PUT", "/user/profile", false},
+		{"GET", "/auth/impersonation", true},
+		{"DELETE", "/auth/impersonation", true},
+		{"POST", "/auth/tokens", false},
+		{"GET", "/auth/2fa", false},
+		{"GET", "/user/grafana/tokens", false},
+	}
+	for _, r := range routes {
+		if ok := got.Allows(r.method, r.route); ok != r.want {
+			t.Errorf("read-only impersonation on %s %s = %v, want %v", r.method, r.route, ok, r.want)
+		}
+	}
+	acting := &Impersonation{ReadOnly: false}
+	if !acting.Allows("PUT", "/user/profile") || acting.Allows("POST", "/auth/logout-all") {
+		t.Error("acting impersonation")
+	}
+
+	// Audit entries name the admin as actor, on behalf of the customer
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/user/energy/history", nil)
+	c.Set("user_id", customer.ID)
+	c.Set("role", "USER")
+	c.Set("impersonator_id", admin.ID)
+	c.Set("impersonator_role", admin.Role)
+	audit.Record(c, "GET /user/energy/history", "history", "", nil, nil)
+
+	// Signing the admin out ends the impersonation, and the cleanup records it
+	if _, err := RevokeUserSessions(admin.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ValidateImpersonation(imp.ID, customer.ID); !errors.Is(err, ErrSessionInvalid) {
+		t.Fatalf("impersonation outlived the admin session: %v", err)
+	}
+	CloseImpersonations(context.Background())
+	if ended, _ := getImpersonation(imp.ID); ended.EndedAt == nil || ended.EndReason != "signed_out" {
+		t.Fatalf("not closed: %+v", ended)
+	}
+
+	// Expired impersonations are closed at their expiry
+	sessionID, _, _ = createSession(admin.ID, "test", "127.0.0.1")
+	old, err := startImpersonation(admin.ID, admin.Role, sessionID, customer.ID, "ticket 43", "127.0.0.1", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	database.DB.Exec(`UPDATE impersonations SET expires_at = ? WHERE id = ?`, time.Now().UTC().Add(-time.Minute), old.ID)
+	if _, _, err := ValidateImpersonation(old.ID, customer.ID); !errors.Is(err, ErrSessionInvalid) {
+		t.Fatalf("expired impersonation accepted: %v", err)
+	}
+	CloseImpersonations(context.Background())
+	if ended, _ := getImpersonation(old.ID); ended.EndReason != "expired" {
+		t.Fatalf("expired impersonation: %+v", ended)
+	}
+
+	entries, _, err := audit.Query(audit.Filter{OnBehalfOf: customer.ID}, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("%d entries on behalf of the customer, want 3", len(entries))
+	}
+	for _, e := range entries {
+		if e.ActorID != admin.ID {
+			t.Errorf("%s recorded as %s", e.Action, e.ActorID)
+		}
+	}
+	if result, err := audit.Verify(); err != nil || !result.Valid {
+		t.Fatalf("audit chain: %+v %v", result, err)
+	}
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary List login lockouts
+// @Description Accounts and client addresses with recent failed logins, including active backoffs and lockouts
+// @Tags SuperAdmin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /superadmin/lockouts [get]
+func ListLockouts(c *gin.Context) {
+	lockouts := LoginLockouts()
+	if lockouts == nil {
+		lockouts = []LoginLockout{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"lockouts":           lockouts,
+		"max_login_failures": maxLoginFailures,
+		"max_ip_failures":    maxIPFailures,
+		"lockout_duration":   lockoutDuration.String(),
+	})
+}
+
+// @Summary Clear a login lockout
+// @Description Reset the failed login count of an account (email) or client address (ip)
+// @Tags SuperAdmin
+// @Produce json
+// @Security BearerAuth
+// @Param email query string false "Account email"
+// @Param ip query string false "Client address"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /superadmin/lockouts [delete]
+func ClearLockout(c *gin.Context) {
+	kind, key := "account", c.Query("email")
+	if key == "" {
+		kind, key = "ip", c.Query("ip")
+	}
+	if key == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "email or ip is required"})
+		return
+	}
+	if !ClearLoginLockout(kind, key) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No failed logins recorded"})
+		return
+	}
+	log.Printf("🔓 Login lockout of %s %s cleared by %s", kind, key, c.GetString("user_id"))
+	c.JSON(http.StatusOK, gin.H{"message": "Lockout cleared"})
+}
@@ -3,7 +3,10 @@ package auth
 import (
 	"log"
 	"net/http"
+	"sems-backend/internal/config"
+	"sems-backend/internal/keys"
 	"sems-backend/internal/users"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -17,11 +20,35 @@ type LoginRequest struct {
 }
 
 type LoginResponse struct {
-	Token string      `json:"token"`
-	User  interface{} `json:"user"`
+	Token        string      `json:"token"`
+	RefreshToken string      `json:"refresh_token"`
+	ExpiresIn    int         `json:"expires_in"` // access token lifetime in seconds
+	User         interface{} `json:"user"`
 }
 
-var jwtSecret = []byte("SEMS_SECRET") // TODO: Move to env
+var (
+	tokenTTL   = 15 * time.Minute
+	refreshTTL = 30 * 24 * time.Hour
+
+	appURL            = "http://localhost:5173"
+	unverifiedLogin   = "allow"
+	verificationGrace = 72 * time.Hour
+)
+
+// Configure sets the token lifetimes from configuration; signing keys are
+// configured in the keys package
+func Configure(cfg config.AuthConfig) {
+	tokenTTL = cfg.TokenTTL.Duration
+	refreshTTL = cfg.RefreshTTL.Duration
+	appURL = cfg.AppURL
+	unverifiedLogin = cfg.UnverifiedLogin
+	verificationGrace = cfg.VerificationGrace.Duration
+	require2FARoles = cfg.Require2FARoles
+	maxLoginFailures = cfg.MaxLoginFailures
+	maxIPFailures = cfg.MaxIPFailures
+	lockoutDuration = cfg.LockoutDuration.Duration
+	impersonationTTL = cfg.ImpersonationTTL.Duration
+}
 
 // @Summary Login
 // @Description Authenticate user and return JWT token
@@ -32,64 +59,145 @@ var jwtSecret = []byte("SEMS_SECRET") // TODO: Move to env
 // @Success 200 {object} LoginResponse
 // @Failure 400 {object} map[string]string
 // @Failure 401 {object} map[string]string
+// @Failure 429 {object} map[string]interface{}
 // @Failure 500 {object} map[string]string
 // @Router /auth/login [post]
 func Login(c *gin.Context) {
-	// Debug logging
-	log.Println("Login endpoint called")
-
 	var req LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		log.Printf("Login binding error: %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
 		return
 	}
 
-	log.Printf("Login request: email=%s", req.Email)
+	if wait, locked := loginWait(req.Email, c.ClientIP()); wait > 0 {
+		tooManyAttempts(c, wait, locked)
+		return
+	}
 
-	// Get user from database
+	// Unknown accounts and wrong passwords look the same and count alike
 	user, err := users.GetUserByEmail(req.Email)
+	if err == nil {
+		err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password))
+	} else {
+		user = nil
+	}
 	if err != nil {
-		log.Printf("User not found: %v", err)
+		loginFailed(c, req.Email, user)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
-	// Check password
-	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password))
+	if !user.IsActive {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is deactivated"})
+		return
+	}
+
+	verified, err := users.IsEmailVerified(user.ID)
 	if err != nil {
-		log.Printf("Password mismatch: %v", err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		log.Printf("Email verification lookup error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check account"})
+		return
+	}
+	if !verified && !unverifiedLoginAllowed(user.CreatedAt) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Email address not verified", "code": "email_unverified"})
+		return
+	}
+
+	completeLogin(c, user, verified)
+}
+
+// completeLogin answers a login whose first factor succeeded. Accounts with a
+// second factor, or whose role requires one, get a short-lived challenge
+// instead of a session.
+func completeLogin(c *gin.Context, user *users.User, verified bool) {
+	enabled, err := twoFactorEnabled(user.ID)
+	if err != nil {
+		log.Printf("Two-factor lookup error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check account"})
+		return
+	}
+	if enabled || twoFactorRequired(user.Role) {
+		purpose, flag := mfaPurposeLogin, "mfa_required"
+		if !enabled {
+			purpose, flag = mfaPurposeEnroll, "mfa_enrollment_required"
+		}
+		mfaToken, err := issueMFAToken(user.ID, purpose)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{flag: true, "mfa_token": mfaToken})
 		return
 	}
 
-	// Generate JWT token
-	token, err := generateJWT(user.ID, user.Email, user.Role)
+	resp, err := startSession(c, user, verified)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		log.Printf("Start session error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start session"})
 		return
 	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// startSession creates a session for a fully authenticated user and issues
+// its first token pair
+func startSession(c *gin.Context, user *users.User, verified bool) (*LoginResponse, error) {
+	clearLoginFailures(user.Email)
+	sessionID, refreshToken, err := createSession(user.ID, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		return nil, err
+	}
+	token, err := generateJWT(user.ID, user.Email, user.Role, sessionID)
+	if err != nil {
+		return nil, err
+	}
 
-	c.JSON(http.StatusOK, LoginResponse{
-		Token: token,
+	return &LoginResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(tokenTTL.Seconds()),
 		User: gin.H{
-			"id":    user.ID,
-			"name":  user.FirstName + " " + user.LastName,
-			"email": user.Email,
-			"role":  user.Role,
+			"id":             user.ID,
+			"name":           user.FirstName + " " + user.LastName,
+			"email":          user.Email,
+			"role":           user.Role,
+			"email_verified": verified,
 		},
-	})
+	}, nil
+}
+
+// loginFailed counts a failed attempt and tells the owner when it locks
+// their account; user is nil for unknown emails
+func loginFailed(c *gin.Context, email string, user *users.User) {
+	if !recordLoginFailure(email, c.ClientIP()) || user == nil {
+		return
+	}
+	log.Printf("🔒 Account %s locked for %s after %d failed logins", user.ID, lockoutDuration, maxLoginFailures)
+	notifyAccountLocked(user, c.ClientIP())
+}
+
+func tooManyAttempts(c *gin.Context, wait time.Duration, locked bool) {
+	seconds := int(wait.Round(time.Second) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	msg := "Too many failed attempts, try again later"
+	if locked {
+		msg = "Too many failed attempts; sign-in is locked for a while"
+	}
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": msg, "code": "login_throttled", "retry_after": seconds})
 }
 
-func generateJWT(userID, email, role string) (string, error) {
+func generateJWT(userID, email, role, sessionID string) (string, error) {
 	claims := jwt.MapClaims{
 		"user_id": userID,
 		"email":   email,
 		"role":    role,
-		"exp":     time.Now().Add(24 * time.Hour).Unix(),
+		"sid":     sessionID,
+		"exp":     time.Now().Add(tokenTTL).Unix(),
 		"iat":     time.Now().Unix(),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	return keys.Sign(claims)
 }
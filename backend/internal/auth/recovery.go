@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sems-backend/internal/users"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type EmailRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=6"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// The same reply whether or not the account exists
+const emailSentMessage = "If an account exists for that email, a message is on its way"
+
+// unverifiedLoginAllowed applies the auth.unverified_login policy
+func unverifiedLoginAllowed(createdAt time.Time) bool {
+	switch unverifiedLogin {
+	case "deny":
+		return false
+	case "grace":
+		return time.Since(createdAt) < verificationGrace
+	default:
+		return true
+	}
+}
+
+// @Summary Forgot password
+// @Description Email a single-use password reset link. The response does not reveal whether the account exists.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param body body EmailRequest true "Account email"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Router /auth/forgot-password [post]
+func ForgotPassword(c *gin.Context) {
+	var req EmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A valid email is required"})
+		return
+	}
+
+	user, err := users.GetUserByEmail(req.Email)
+	// Accounts provisioned by SSO sign in through their identity provider only
+	if err == nil && user.IsActive && !ssoOnly(user.ID) {
+		token, err := issueAccountToken(user.ID, purposePasswordReset, resetTokenTTL)
+		if err != nil {
+			log.Printf("Issue reset token error: %v", err)
+		} else if token != "" {
+			sendPasswordResetEmail(user, token)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"message": emailSentMessage})
+}
+
+// @Summary Reset password
+// @Description Set a new password with a reset token. All sessions of the account are signed out.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param body body ResetPasswordRequest true "Reset token and new password"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /auth/reset-password [post]
+func ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := consumeAccountToken(req.Token, purposePasswordReset)
+	if errors.Is(err, ErrTokenInvalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Reset link is invalid or has expired"})
+		return
+	}
+	if err != nil {
+		log.Printf("Consume reset token error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), 10)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+	if err := users.UpdatePasswordHash(userID, string(hashedPassword)); err != nil {
+		log.Printf("Update password error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+	if _, err := RevokeUserSessions(userID); err != nil {
+		log.Printf("Revoke sessions after reset error: %v", err)
+	}
+	// Following the emailed link proves the address as well
+	if err := users.MarkEmailVerified(userID); err != nil {
+		log.Printf("Mark email verified error: %v", err)
+	}
+
+	if user, err := users.GetUserByID(userID); err == nil {
+		sendPasswordChangedEmail(user)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset. Please log in with your new password."})
+}
+
+// @Summary Verify email
+// @Description Confirm an email address with the token from the verification email
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param body body VerifyEmailRequest true "Verification token"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /auth/verify-email [post]
+func VerifyEmail(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token is required"})
+		return
+	}
+
+	userID, err := consumeAccountToken(req.Token, purposeVerifyEmail)
+	if errors.Is(err, ErrTokenInvalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Verification link is invalid or has expired"})
+		return
+	}
+	if err == nil {
+		err = users.MarkEmailVerified(userID)
+	}
+	if err != nil {
+		log.Printf("Verify email error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified"})
+}
+
+// @Summary Resend verification email
+// @Description Send a new verification link to an unverified account. The response does not reveal whether the account exists.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param body body EmailRequest true "Account email"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Router /auth/resend-verification [post]
+func ResendVerification(c *gin.Context) {
+	var req EmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A valid email is required"})
+		return
+	}
+
+	user, err := users.GetUserByEmail(req.Email)
+	if err == nil && user.IsActive {
+		if verified, err := users.IsEmailVerified(user.ID); err == nil && !verified {
+			startVerification(user)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"message": emailSentMessage})
+}
+
+// startVerification issues a verification token and emails it
+func startVerification(user *users.User) {
+	token, err := issueAccountToken(user.ID, purposeVerifyEmail, verifyTokenTTL)
+	if err != nil {
+		log.Printf("Issue verification token error: %v", err)
+		return
+	}
+	if token != "" {
+		sendVerificationEmail(user, token)
+	}
+}
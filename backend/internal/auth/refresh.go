@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sems-backend/internal/users"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type RefreshResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// @Summary Refresh tokens
+// @Description Exchange a refresh token for a new access token and refresh token. Each refresh token works once.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param body body RefreshRequest true "Refresh token"
+// @Success 200 {object} RefreshResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /auth/refresh [post]
+func Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "refresh_token is required"})
+		return
+	}
+
+	userID, sessionID, refreshToken, err := rotateSession(req.RefreshToken)
+	if errors.Is(err, ErrSessionInvalid) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session expired"})
+		return
+	}
+	if err != nil {
+		log.Printf("Refresh session error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		return
+	}
+
+	// Issue the access token with the account's current role
+	user, err := users.GetUserByID(userID)
+	if err != nil || !user.IsActive {
+		RevokeUserSessions(userID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Account is deactivated"})
+		return
+	}
+	token, err := generateJWT(user.ID, user.Email, user.Role, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, RefreshResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(tokenTTL.Seconds()),
+	})
+}
+
+// @Summary Logout
+// @Description End the session a refresh token belongs to. Its access tokens stop working immediately.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param body body RefreshRequest true "Refresh token"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /auth/logout [post]
+func Logout(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "refresh_token is required"})
+		return
+	}
+	if err := revokeByRefreshToken(req.RefreshToken); err != nil {
+		log.Printf("Logout error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+// @Summary Logout everywhere
+// @Description End all sessions of the signed-in user, including the current one
+// @Tags Auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /auth/logout-all [post]
+func LogoutAll(c *gin.Context) {
+	userID := c.GetString("user_id")
+	revoked, err := RevokeUserSessions(userID)
+	if err != nil {
+		log.Printf("Logout all error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out of all sessions", "sessions_revoked": revoked})
+}
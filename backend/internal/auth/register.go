@@ -87,9 +87,10 @@ func Register(c *gin.Context) {
 	}
 
 	// Notification will be sent after Onboarding Complete
+	startVerification(user)
 
 	c.JSON(http.StatusCreated, gin.H{
-		"message": "User registered successfully",
+		"message": "User registered successfully. Check your email to verify your address.",
 		"user": gin.H{
 			"id":         user.ID,
 			"first_name": user.FirstName,
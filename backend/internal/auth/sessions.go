@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"sems-backend/internal/database"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const refreshTokenPrefix = "srt_"
+
+// sessionRetention is how long an ended session is kept before it is deleted
+const sessionRetention = 7 * 24 * time.Hour
+
+var (
+	// ErrSessionInvalid covers unknown, expired and revoked sessions alike
+	ErrSessionInvalid     = errors.New("session expired or revoked")
+	ErrAccountDeactivated = errors.New("account is deactivated")
+)
+
+// SessionUser is the current state of the account behind a session
+type SessionUser struct {
+	Email string
+	Role  string
+}
+
+// createSession starts a session for the user and returns its refresh token
+func createSession(userID, userAgent, ip string) (string, string, error) {
+	plain, err := newRefreshToken()
+	if err != nil {
+		return "", "", err
+	}
+	now := time.Now().UTC()
+	id := uuid.New().String()
+	_, err = database.DB.Exec(`
+		INSERT INTO auth_sessions (id, user_id, refresh_hash, user_agent, ip_address, created_at, last_used_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		id, userID, hashToken(plain), userAgent, ip, now, now, now.Add(refreshTTL))
+	if err != nil {
+		return "", "", err
+	}
+	return id, plain, nil
+}
+
+// rotateSession exchanges a refresh token for a new one. Each token works
+// once; presenting any token the session has already rotated away from means
+// it was copied, so the session is revoked.
+func rotateSession(plain string) (userID, sessionID, next string, err error) {
+	hash := hashToken(plain)
+
+	var expiresAt time.Time
+	var revokedAt sql.NullTime
+	err = database.DB.QueryRow(`
+		SELECT id, user_id, expires_at, revoked_at FROM auth_sessions
+		WHERE refresh_hash = ?`, hash).Scan(&sessionID, &userID, &expiresAt, &revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		result, err := database.DB.Exec(`
+			UPDATE auth_sessions SET revoked_at = ?
+			WHERE id IN (SELECT session_id FROM retired_refresh_tokens WHERE hash = ?)
+			AND revoked_at IS NULL`, time.Now().UTC(), hash)
+		if err != nil {
+			return "", "", "", err
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			log.Println("⚠️  Rotated refresh token presented again; session revoked")
+		}
+		return "", "", "", ErrSessionInvalid
+	}
+	if err != nil {
+		return "", "", "", err
+	}
+	now := time.Now().UTC()
+	if revokedAt.Valid || !now.Before(expiresAt) {
+		return "", "", "", ErrSessionInvalid
+	}
+
+	next, err = newRefreshToken()
+	if err != nil {
+		return "", "", "", err
+	}
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return "", "", "", err
+	}
+	defer tx.Rollback()
+
+	// Matching on the old hash makes concurrent refreshes with one token race to a single winner
+	result, err := tx.Exec(`
+		UPDATE auth_sessions SET refresh_hash = ?, last_used_at = ?, expires_at = ?
+		WHERE id = ? AND refresh_hash = ? AND revoked_at IS NULL`,
+		hashToken(next), now, now.Add(refreshTTL), sessionID, hash)
+	if err != nil {
+		return "", "", "", err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return "", "", "", ErrSessionInvalid
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO retired_refresh_tokens (hash, session_id, retired_at)
+		VALUES (?, ?, ?)`, hash, sessionID, now); err != nil {
+		return "", "", "", err
+	}
+	return userID, sessionID, next, tx.Commit()
+}
+
+// PruneSessions forgets the rotated tokens of sessions that have ended, since
+// reuse of them can no longer do harm, and deletes sessions that ended more
+// than sessionRetention ago. Sessions an open impersonation started from are
+// kept. Run it periodically.
+func PruneSessions(ctx context.Context) {
+	now := time.Now().UTC()
+	ended := `revoked_at IS NOT NULL OR ` + database.Current.Time("expires_at") + ` <= ` + database.Current.Time("?")
+	_, err := database.DB.ExecContext(ctx, `
+		DELETE FROM retired_refresh_tokens
+		WHERE session_id IN (SELECT id FROM auth_sessions WHERE `+ended+`)`, now)
+	if err != nil {
+		log.Printf("⚠️  Failed to prune retired refresh tokens: %v", err)
+		return
+	}
+
+	cutoff := now.Add(-sessionRetention)
+	result, err := database.DB.ExecContext(ctx, `
+		DELETE FROM auth_sessions
+		WHERE (`+database.Current.Time("revoked_at")+` <= `+database.Current.Time("?")+`
+			OR `+database.Current.Time("expires_at")+` <= `+database.Current.Time("?")+`)
+		AND id NOT IN (SELECT admin_session_id FROM impersonations WHERE ended_at IS NULL)`, cutoff, cutoff)
+	if err != nil {
+		log.Printf("⚠️  Failed to prune ended sessions: %v", err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		log.Printf("🧹 Pruned %d ended sessions", n)
+	}
+}
+
+// revokeByRefreshToken ends the session a refresh token belongs to
+func revokeByRefreshToken(plain string) error {
+	_, err := database.DB.Exec(`
+		UPDATE auth_sessions SET revoked_at = ?
+		WHERE refresh_hash = ? AND revoked_at IS NULL`, time.Now().UTC(), hashToken(plain))
+	return err
+}
+
+// RevokeUserSessions ends every session of the user, e.g. after a password
+// change; access tokens stop working on their next request.
+func RevokeUserSessions(userID string) (int64, error) {
+	result, err := database.DB.Exec(`
+		UPDATE auth_sessions SET revoked_at = ?
+		WHERE user_id = ? AND revoked_at IS NULL`, time.Now().UTC(), userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// ValidateSession checks that an access token's session is still open and its
+// account active, and returns the account's current email and role.
+func ValidateSession(sessionID, userID string) (*SessionUser, error) {
+	var u SessionUser
+	var active sql.NullBool
+	var expiresAt time.Time
+	var revokedAt sql.NullTime
+	err := database.DB.QueryRow(`
+		SELECT u.email, u.role, u.is_active, s.expires_at, s.revoked_at
+		FROM auth_sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.id = ? AND s.user_id = ?`, sessionID, userID).Scan(&u.Email, &u.Role, &active, &expiresAt, &revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSessionInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if revokedAt.Valid || !time.Now().Before(expiresAt) {
+		return nil, ErrSessionInvalid
+	}
+	if !active.Bool {
+		return nil, ErrAccountDeactivated
+	}
+	return &u, nil
+}
+
+func newRefreshToken() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return refreshTokenPrefix + hex.EncodeToString(secret), nil
+}
+
+func hashToken(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"sems-backend/internal/config"
+	"sems-backend/internal/database"
+	"sems-backend/internal/users"
+)
+
+// openTestDB migrates a fresh database and returns its seeded super admin
+func openTestDB(t *testing.T) *users.User {
+	t.Helper()
+	if err := database.InitDB(config.DatabaseConfig{Driver: "sqlite", Path: filepath.Join(t.TempDir(), "auth.db"), MaxOpenConns: 1}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(database.CloseDB)
+	if err := database.RunMigrations(); err != nil {
+		t.Fatal(err)
+	}
+	user, err := users.GetUserByEmail("superadmin@solar.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestRefreshRotationAndReuse(t *testing.T) {
+	user := openTestDB(t)
+
+	sessionID, first, err := createSession(user.ID, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, rotatedID, second, err := rotateSession(first)
+	if err != nil || rotatedID != sessionID {
+		t.Fatalf("rotate: session %q, err %v", rotatedID, err)
+	}
+	if _, err := ValidateSession(sessionID, user.ID); err != nil {
+		t.Fatalf("session should still be valid: %v", err)
+	}
+
+	// Replaying the first token revokes the session, so the second stops working too
+	if _, _, _, err := rotateSession(first); !errors.Is(err, ErrSessionInvalid) {
+		t.Fatalf("reused token: got %v", err)
+	}
+	if _, _, _, err := rotateSession(second); !errors.Is(err, ErrSessionInvalid) {
+		t.Fatalf("token of revoked session: got %v", err)
+	}
+	if _, err := ValidateSession(sessionID, user.ID); !errors.Is(err, ErrSessionInvalid) {
+		t.Fatalf("revoked session validated: %v", err)
+	}
+
+	// Any earlier token counts as reuse, not just the one rotated last
+	familyID, oldest, err := createSession(user.ID, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := oldest
+	for i := 0; i < 3; i++ {
+		if _, _, next, err = rotateSession(next); err != nil {
+			t.Fatalf("rotation %d: %v", i+1, err)
+		}
+	}
+	if _, _, _, err := rotateSession(oldest); !errors.Is(err, ErrSessionInvalid) {
+		t.Fatalf("reused oldest token: got %v", err)
+	}
+	if _, err := ValidateSession(familyID, user.ID); !errors.Is(err, ErrSessionInvalid) {
+		t.Fatalf("session survived reuse of an old token: %v", err)
+	}
+
+	// Once the session has ended its retired tokens are forgotten
+	PruneSessions(context.Background())
+	var retired int
+	if err := database.DB.QueryRow(`SELECT COUNT(*) FROM retired_refresh_tokens`).Scan(&retired); err != nil {
+		t.Fatal(err)
+	}
+	if retired != 0 {
+		t.Errorf("%d retired tokens of ended sessions kept", retired)
+	}
+
+	// Deactivation is seen by the next request, not at token expiry
+	otherID, _, err := createSession(user.ID, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := users.SetActive(user.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateSession(otherID, user.ID); !errors.Is(err, ErrAccountDeactivated) {
+		t.Fatalf("deactivated account: got %v", err)
+	}
+}
+
+func TestPruneSessionsKeepsRecentAndImpersonated(t *testing.T) {
+	user := openTestDB(t)
+	now := time.Now().UTC()
+	longAgo := now.Add(-sessionRetention - time.Hour)
+
+	session := func(change string, args ...interface{}) string {
+		t.Helper()
+		id, _, err := createSession(user.ID, "test", "127.0.0.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if change != "" {
+			if _, err := database.DB.Exec(`UPDATE auth_sessions SET `+change+` WHERE id = ?`, append(args, id)...); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return id
+	}
+	active := session("")
+	recent := session("revoked_at = ?", now.Add(-time.Hour))
+	revoked := session("revoked_at = ?", longAgo)
+	expired := session("expires_at = ?", longAgo)
+	impersonating := session("revoked_at = ?", longAgo)
+	if _, err := database.DB.Exec(`INSERT INTO impersonations (id, admin_id, admin_role, admin_session_id, user_id, reason, started_at, expires_at)
+		VALUES ('imp', ?, 'SUPER_ADMIN', ?, ?, 'support', ?, ?)`, user.ID, impersonating, user.ID, now, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	PruneSessions(context.Background())
+
+	for _, s := range []struct {
+		name, id string
+		kept     bool
+	}{
+		{"active", active, true},
+		{"recently revoked", recent, true},
+		{"revoked", revoked, false},
+		{"expired", expired, false},
+		{"impersonating", impersonating, true},
+	} {
+		var n int
+		if err := database.DB.QueryRow(`SELECT COUNT(*) FROM auth_sessions WHERE id = ?`, s.id).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if (n == 1) != s.kept {
+			t.Errorf("%s session kept = %v, want %v", s.name, n == 1, s.kept)
+		}
+	}
+}
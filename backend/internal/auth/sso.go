@@ -0,0 +1,256 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"sems-backend/internal/config"
+	"sems-backend/internal/database"
+	"sems-backend/internal/oidc"
+	"sems-backend/internal/users"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ssoLoginTTL   = 10 * time.Minute // from redirect to callback
+	ssoHandoffTTL = time.Minute      // from callback to the web app's exchange
+	ssoCookie     = "sems_oidc_state"
+
+	// unusablePassword never matches, so provisioned accounts sign in only
+	// through their identity provider
+	unusablePassword = "!"
+)
+
+var (
+	errSSOConflict  = errors.New("an account with this email exists; its owner must link the identity provider while signed in")
+	errSSONoEmail   = errors.New("identity provider did not supply a verified email")
+	errSSOHandoff   = errors.New("sign-in code is invalid or has expired")
+	ssoProviders    = map[string]*oidc.Provider{}
+	ssoProviderList []*oidc.Provider
+	ssoSecureCookie bool
+)
+
+// ConfigureSSO sets up the configured OpenID Connect providers
+func ConfigureSSO(cfg config.OIDCConfig) {
+	ssoProviders = map[string]*oidc.Provider{}
+	ssoProviderList = nil
+	for _, pc := range cfg.Providers {
+		p := oidc.New(pc, cfg.APIURL)
+		ssoProviders[pc.Name] = p
+		ssoProviderList = append(ssoProviderList, p)
+		log.Printf("🔑 SSO provider %s, redirect URI %s", pc.Name, p.RedirectURL())
+	}
+	ssoSecureCookie = strings.HasPrefix(cfg.APIURL, "https://")
+}
+
+// ssoLogin is a sign-in the browser was sent to a provider for, keyed by state.
+// linkUserID is set when a signed-in account is linking the provider instead.
+type ssoLogin struct {
+	provider   string
+	verifier   string
+	nonce      string
+	linkUserID string
+	expires    time.Time
+}
+
+// ssoHandoff carries a signed-in user from the callback to the web app, which
+// exchanges its code for tokens so they never appear in a URL
+type ssoHandoff struct {
+	userID  string
+	expires time.Time
+}
+
+var ssoPending = struct {
+	sync.Mutex
+	logins   map[string]*ssoLogin
+	handoffs map[string]*ssoHandoff // by code hash
+}{logins: map[string]*ssoLogin{}, handoffs: map[string]*ssoHandoff{}}
+
+func startSSOLogin(provider, linkUserID string) (state string, login *ssoLogin, err error) {
+	login = &ssoLogin{provider: provider, linkUserID: linkUserID, expires: time.Now().Add(ssoLoginTTL)}
+	if state, err = oidc.NewVerifier(); err != nil {
+		return "", nil, err
+	}
+	if login.verifier, err = oidc.NewVerifier(); err != nil {
+		return "", nil, err
+	}
+	if login.nonce, err = oidc.NewVerifier(); err != nil {
+		return "", nil, err
+	}
+
+	ssoPending.Lock()
+	defer ssoPending.Unlock()
+	pruneSSOPending(time.Now())
+	ssoPending.logins[state] = login
+	return state, login, nil
+}
+
+// takeSSOLogin returns the pending sign-in for state once
+func takeSSOLogin(state string) *ssoLogin {
+	ssoPending.Lock()
+	defer ssoPending.Unlock()
+	login := ssoPending.logins[state]
+	delete(ssoPending.logins, state)
+	if login == nil || time.Now().After(login.expires) {
+		return nil
+	}
+	return login
+}
+
+func issueSSOHandoff(userID string) (string, error) {
+	code, err := oidc.NewVerifier()
+	if err != nil {
+		return "", err
+	}
+	ssoPending.Lock()
+	defer ssoPending.Unlock()
+	pruneSSOPending(time.Now())
+	ssoPending.handoffs[hashToken(code)] = &ssoHandoff{userID: userID, expires: time.Now().Add(ssoHandoffTTL)}
+	return code, nil
+}
+
+func consumeSSOHandoff(code string) (string, error) {
+	ssoPending.Lock()
+	defer ssoPending.Unlock()
+	key := hashToken(code)
+	h := ssoPending.handoffs[key]
+	delete(ssoPending.handoffs, key)
+	if h == nil || time.Now().After(h.expires) {
+		return "", errSSOHandoff
+	}
+	return h.userID, nil
+}
+
+func pruneSSOPending(now time.Time) {
+	for k, l := range ssoPending.logins {
+		if now.After(l.expires) {
+			delete(ssoPending.logins, k)
+		}
+	}
+	for k, h := range ssoPending.handoffs {
+		if now.After(h.expires) {
+			delete(ssoPending.handoffs, k)
+		}
+	}
+}
+
+// resolveSSOUser finds or provisions the account for a verified identity.
+// Accounts SSO provisioned follow the provider's role on every sign-in. An
+// existing account with the same email is never taken over; its owner links
+// the provider explicitly (see linkSSOIdentity), and keeps the role the
+// platform gave it.
+func resolveSSOUser(provider string, id *oidc.Identity, role string) (*users.User, error) {
+	var userID string
+	var provisioned bool
+	err := database.DB.QueryRow(`SELECT user_id, provisioned FROM user_identities WHERE provider = ? AND subject = ?`, provider, id.Subject).Scan(&userID, &provisioned)
+	switch {
+	case err == nil:
+		user, err := users.GetUserByID(userID)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := database.DB.Exec(`UPDATE user_identities SET email = ?, last_login_at = ? WHERE provider = ? AND subject = ?`,
+			id.Email, time.Now().UTC(), provider, id.Subject); err != nil {
+			return nil, err
+		}
+		if !provisioned {
+			return user, nil
+		}
+		return user, syncSSORole(user, role)
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, err
+	}
+
+	if id.Email == "" || !id.EmailVerified {
+		return nil, errSSONoEmail
+	}
+	_, err = users.GetUserByEmail(id.Email)
+	switch {
+	case err == nil:
+		return nil, errSSOConflict
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, err
+	}
+
+	first, last := id.GivenName, id.FamilyName
+	if first == "" && last == "" {
+		first, last, _ = strings.Cut(id.Name, " ")
+	}
+	user, err := users.CreateUser(first, last, id.Email, unusablePassword, role, "", "", "", "", "", "", "", "", 0, 0, "", "", "")
+	if err != nil {
+		return nil, err
+	}
+	if err := users.MarkEmailVerified(user.ID); err != nil {
+		return nil, err
+	}
+	if err := linkIdentity(provider, id, user.ID, true); err != nil {
+		return nil, err
+	}
+	log.Printf("👤 Provisioned %s account %s from SSO provider %s", role, user.ID, provider)
+	return user, nil
+}
+
+// linkSSOIdentity attaches an identity to the signed-in account that asked
+// for it. An identity already linked to another account is refused.
+func linkSSOIdentity(provider string, id *oidc.Identity, userID string) error {
+	user, err := users.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if !ssoLinkable(user.Role) {
+		return errSSOConflict
+	}
+	var linked string
+	err = database.DB.QueryRow(`SELECT user_id FROM user_identities WHERE provider = ? AND subject = ?`, provider, id.Subject).Scan(&linked)
+	switch {
+	case err == nil && linked == userID:
+		return nil
+	case err == nil:
+		return errSSOConflict
+	case !errors.Is(err, sql.ErrNoRows):
+		return err
+	}
+	if err := linkIdentity(provider, id, userID, false); err != nil {
+		return err
+	}
+	log.Printf("👤 Account %s linked to SSO provider %s", userID, provider)
+	return nil
+}
+
+// ssoLinkable reports whether an account of role may sign in through SSO;
+// customer and super admin accounts never do
+func ssoLinkable(role string) bool {
+	return role != "USER" && role != "SUPER_ADMIN"
+}
+
+func linkIdentity(provider string, id *oidc.Identity, userID string, provisioned bool) error {
+	now := time.Now().UTC()
+	_, err := database.DB.Exec(`
+		INSERT INTO user_identities (id, provider, subject, user_id, email, provisioned, created_at, last_login_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		uuid.New().String(), provider, id.Subject, userID, id.Email, provisioned, now, now)
+	return err
+}
+
+func syncSSORole(user *users.User, role string) error {
+	if user.Role == role || user.Role == "SUPER_ADMIN" {
+		return nil
+	}
+	if err := users.SetRole(user.ID, role); err != nil {
+		return err
+	}
+	log.Printf("👤 Role of %s changed from %s to %s by SSO", user.ID, user.Role, role)
+	user.Role = role
+	return nil
+}
+
+// ssoOnly reports whether the account was created by SSO and has no password
+func ssoOnly(userID string) bool {
+	var n int
+	err := database.DB.QueryRow(`SELECT COUNT(*) FROM user_identities WHERE user_id = ? AND provisioned = true`, userID).Scan(&n)
+	return err == nil && n > 0
+}
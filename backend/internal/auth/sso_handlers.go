@@ -0,0 +1,219 @@
+package auth
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"sems-backend/internal/users"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SSOExchangeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// @Summary List SSO providers
+// @Description Identity providers staff can sign in with
+// @Tags Auth
+// @Produce json
+// @Success 200 {array} map[string]string
+// @Router /auth/oidc/providers [get]
+func SSOProviders(c *gin.Context) {
+	out := []gin.H{}
+	for _, p := range ssoProviderList {
+		out = append(out, gin.H{"name": p.Name(), "display_name": p.DisplayName()})
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// @Summary Start SSO login
+// @Description Redirect the browser to the identity provider (authorization code flow with PKCE)
+// @Tags Auth
+// @Param provider path string true "Provider name"
+// @Success 302
+// @Failure 404 {object} map[string]string
+// @Failure 503 {object} map[string]string
+// @Router /auth/oidc/{provider}/login [get]
+func SSOLogin(c *gin.Context) {
+	p := ssoProviders[c.Param("provider")]
+	if p == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown SSO provider"})
+		return
+	}
+
+	state, login, err := startSSOLogin(p.Name(), "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start sign-in"})
+		return
+	}
+	target, err := p.AuthURL(c.Request.Context(), state, login.nonce, login.verifier)
+	if err != nil {
+		log.Printf("SSO provider %s unavailable: %v", p.Name(), err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Identity provider is unavailable"})
+		return
+	}
+
+	// Binds the callback to this browser so a stolen callback URL is useless
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(ssoCookie, state, int(ssoLoginTTL.Seconds()), "/", "", ssoSecureCookie, true)
+	c.Redirect(http.StatusFound, target)
+}
+
+// @Summary Link an SSO provider
+// @Description Start linking an identity provider to the signed-in staff account. The browser opens the returned URL; the callback links the identity and returns to the web app with linked={provider}.
+// @Tags Auth
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Success 200 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 503 {object} map[string]string
+// @Security BearerAuth
+// @Router /auth/oidc/{provider}/link [post]
+func SSOLink(c *gin.Context) {
+	p := ssoProviders[c.Param("provider")]
+	if p == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown SSO provider"})
+		return
+	}
+	user, err := users.GetUserByID(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	if !ssoLinkable(user.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "SSO is not available for this account"})
+		return
+	}
+
+	state, login, err := startSSOLogin(p.Name(), user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start linking"})
+		return
+	}
+	target, err := p.AuthURL(c.Request.Context(), state, login.nonce, login.verifier)
+	if err != nil {
+		log.Printf("SSO provider %s unavailable: %v", p.Name(), err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Identity provider is unavailable"})
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(ssoCookie, state, int(ssoLoginTTL.Seconds()), "/", "", ssoSecureCookie, true)
+	c.JSON(http.StatusOK, gin.H{"url": target})
+}
+
+// @Summary SSO callback
+// @Description The identity provider redirects here. On success the browser continues to the web app with a one-time code for /auth/oidc/exchange.
+// @Tags Auth
+// @Param provider path string true "Provider name"
+// @Param code query string false "Authorization code"
+// @Param state query string true "State"
+// @Success 302
+// @Router /auth/oidc/{provider}/callback [get]
+func SSOCallback(c *gin.Context) {
+	provider := c.Param("provider")
+	p := ssoProviders[provider]
+	state := c.Query("state")
+	cookie, _ := c.Cookie(ssoCookie)
+	c.SetCookie(ssoCookie, "", -1, "/", "", ssoSecureCookie, true)
+
+	login := takeSSOLogin(state)
+	if p == nil || login == nil || login.provider != provider || cookie != state {
+		redirectToApp(c, "error", "sso_expired")
+		return
+	}
+	if idpErr := c.Query("error"); idpErr != "" {
+		log.Printf("SSO provider %s returned %s: %s", provider, idpErr, c.Query("error_description"))
+		redirectToApp(c, "error", "sso_cancelled")
+		return
+	}
+
+	id, err := p.Exchange(c.Request.Context(), c.Query("code"), login.verifier, login.nonce)
+	if err != nil {
+		log.Printf("SSO %s exchange failed: %v", provider, err)
+		redirectToApp(c, "error", "sso_failed")
+		return
+	}
+	if login.linkUserID != "" {
+		err := linkSSOIdentity(provider, id, login.linkUserID)
+		switch {
+		case errors.Is(err, errSSOConflict):
+			redirectToApp(c, "error", "sso_account_conflict")
+		case err != nil:
+			log.Printf("SSO %s link error: %v", provider, err)
+			redirectToApp(c, "error", "sso_failed")
+		default:
+			redirectToApp(c, "linked", provider)
+		}
+		return
+	}
+	role, ok := p.Role(id)
+	if !ok {
+		log.Printf("SSO %s: subject %s has no mapped role", provider, id.Subject)
+		redirectToApp(c, "error", "sso_not_authorized")
+		return
+	}
+
+	user, err := resolveSSOUser(provider, id, role)
+	switch {
+	case errors.Is(err, errSSOConflict):
+		redirectToApp(c, "error", "sso_account_conflict")
+		return
+	case errors.Is(err, errSSONoEmail):
+		redirectToApp(c, "error", "sso_no_email")
+		return
+	case err != nil:
+		log.Printf("SSO %s account error: %v", provider, err)
+		redirectToApp(c, "error", "sso_failed")
+		return
+	}
+	if !user.IsActive {
+		redirectToApp(c, "error", "account_disabled")
+		return
+	}
+
+	code, err := issueSSOHandoff(user.ID)
+	if err != nil {
+		redirectToApp(c, "error", "sso_failed")
+		return
+	}
+	redirectToApp(c, "code", code)
+}
+
+// @Summary Finish SSO login
+// @Description Exchange the one-time code from the SSO callback for a session, or a second-factor challenge like /auth/login
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param body body SSOExchangeRequest true "One-time code"
+// @Success 200 {object} LoginResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Router /auth/oidc/exchange [post]
+func SSOExchange(c *gin.Context) {
+	var req SSOExchangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code is required"})
+		return
+	}
+	userID, err := consumeSSOHandoff(req.Code)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	user, err := users.GetUserByID(userID)
+	if err != nil || !user.IsActive {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Account is deactivated"})
+		return
+	}
+	// The identity provider verified the email
+	completeLogin(c, user, true)
+}
+
+func redirectToApp(c *gin.Context, key, value string) {
+	c.Redirect(http.StatusFound, strings.TrimRight(appURL, "/")+"/sso/callback?"+key+"="+url.QueryEscape(value))
+}
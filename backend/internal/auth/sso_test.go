@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"sems-backend/internal/config"
+	"sems-backend/internal/keys"
+	"sems-backend/internal/oidc/oidctest"
+	"sems-backend/internal/users"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestSSOProvisionsAndSignsIn(t *testing.T) {
+	openTestDB(t)
+	cfg := config.Default()
+	cfg.Auth.SigningAlgorithm = "HS256"
+	keys.Configure(cfg.Auth)
+	if err := keys.Init(); err != nil {
+		t.Fatal(err)
+	}
+	idp := oidctest.NewServer(t)
+	ConfigureSSO(config.OIDCConfig{APIURL: "http://sems.test", Providers: []config.OIDCProvider{{
+		Name:         "gov",
+		Issuer:       idp.URL,
+		ClientID:     idp.ClientID,
+		ClientSecret: idp.ClientSecret,
+		RoleMapping:  map[string]string{"officers": "GOVT", "sems-admins": "ADMIN"},
+	}}})
+	t.Cleanup(func() { ConfigureSSO(config.OIDCConfig{}) })
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/auth/oidc/:provider/login", SSOLogin)
+	r.GET("/auth/oidc/:provider/callback", SSOCallback)
+	r.POST("/auth/oidc/exchange", SSOExchange)
+	r.POST("/auth/oidc/:provider/link", func(c *gin.Context) { c.Set("user_id", c.GetHeader("X-Test-User")) }, SSOLink)
+
+	// authorize sends the browser to the provider and back, and returns where
+	// the callback sent it
+	authorize := func(target string, cookie *http.Cookie, claims jwt.MapClaims) url.Values {
+		t.Helper()
+		idp.SetClaims(claims)
+		noFollow := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+		resp, err := noFollow.Get(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		callback, _ := url.Parse(resp.Header.Get("Location"))
+
+		req := httptest.NewRequest(http.MethodGet, callback.RequestURI(), nil)
+		req.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		app, _ := url.Parse(w.Header().Get("Location"))
+		return app.Query()
+	}
+	signIn := func(claims jwt.MapClaims) url.Values {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/oidc/gov/login", nil))
+		if w.Code != http.StatusFound {
+			t.Fatalf("login: %d %s", w.Code, w.Body)
+		}
+		return authorize(w.Header().Get("Location"), w.Result().Cookies()[0], claims)
+	}
+	startLink := func(userID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/auth/oidc/gov/link", nil)
+		req.Header.Set("X-Test-User", userID)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	link := func(userID string, claims jwt.MapClaims) url.Values {
+		t.Helper()
+		w := startLink(userID)
+		var body struct {
+			URL string `json:"url"`
+		}
+		if json.Unmarshal(w.Body.Bytes(), &body); w.Code != http.StatusOK || body.URL == "" {
+			t.Fatalf("link: %d %s", w.Code, w.Body)
+		}
+		return authorize(body.URL, w.Result().Cookies()[0], claims)
+	}
+
+	result := signIn(jwt.MapClaims{"sub": "officer-1", "email": "officer@gov.test", "email_verified": true,
+		"given_name": "Asha", "family_name": "Rao", "groups": []string{"staff", "officers"}})
+	if result.Get("code") == "" {
+		t.Fatalf("callback: %v", result)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/auth/oidc/exchange", strings.NewReader(`{"code":"`+result.Get("code")+`"}`)))
+	var resp LoginResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK || resp.Token == "" {
+		t.Fatalf("exchange: %d %s", w.Code, w.Body)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/auth/oidc/exchange", strings.NewReader(`{"code":"`+result.Get("code")+`"}`)))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("code exchanged twice: %d", w.Code)
+	}
+
+	user, err := users.GetUserByEmail("officer@gov.test")
+	if err != nil || user.Role != "GOVT" || user.FirstName != "Asha" || !ssoOnly(user.ID) {
+		t.Fatalf("provisioned user: %+v, %v", user, err)
+	}
+
+	// The provider's groups decide the role on every sign-in
+	signIn(jwt.MapClaims{"sub": "officer-1", "email": "officer@gov.test", "email_verified": true, "groups": []string{"officers", "sems-admins"}})
+	if user, _ = users.GetUserByID(user.ID); user.Role != "ADMIN" {
+		t.Fatalf("role after group change: %s", user.Role)
+	}
+	if got := signIn(jwt.MapClaims{"sub": "visitor", "email": "v@gov.test", "email_verified": true}); got.Get("error") != "sso_not_authorized" {
+		t.Fatalf("unmapped user: %v", got)
+	}
+	// The seeded super admin cannot be taken over through a matching email
+	if got := signIn(jwt.MapClaims{"sub": "x", "email": "superadmin@solar.com", "email_verified": true, "groups": []string{"officers"}}); got.Get("error") != "sso_account_conflict" {
+		t.Fatalf("super admin linked: %v", got)
+	}
+
+	// An existing staff account is not linked just because the email matches,
+	// so the provider cannot sign in as it or change its role
+	lead, err := users.CreateUser("Lena", "Lead", "lead@gov.test", "x", "ORG_ADMIN", "", "", "", "", "", "", "", "", 0, 0, "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	leadClaims := jwt.MapClaims{"sub": "lead-1", "email": "lead@gov.test", "email_verified": true, "groups": []string{"officers"}}
+	if got := signIn(leadClaims); got.Get("error") != "sso_account_conflict" {
+		t.Fatalf("existing staff account linked by email: %v", got)
+	}
+
+	// Its owner links the provider while signed in; the role stays theirs
+	if got := link(lead.ID, leadClaims); got.Get("linked") != "gov" {
+		t.Fatalf("explicit link: %v", got)
+	}
+	if got := signIn(leadClaims); got.Get("code") == "" {
+		t.Fatalf("sign-in after linking: %v", got)
+	}
+	if u, _ := users.GetUserByID(lead.ID); u.Role != "ORG_ADMIN" || ssoOnly(lead.ID) {
+		t.Fatalf("linked account changed by SSO: role %s", u.Role)
+	}
+
+	// The identity belongs to one account, and customers cannot link at all
+	other, err := users.CreateUser("Omar", "Other", "other@gov.test", "x", "INSTALLER", "", "", "", "", "", "", "", "", 0, 0, "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := link(other.ID, leadClaims); got.Get("error") != "sso_account_conflict" {
+		t.Fatalf("identity linked twice: %v", got)
+	}
+	customer, err := users.CreateUser("Cara", "Customer", "cara@gov.test", "x", "USER", "", "", "", "", "", "", "", "", 0, 0, "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := startLink(customer.ID); w.Code != http.StatusForbidden {
+		t.Fatalf("customer link: %d", w.Code)
+	}
+}
@@ -0,0 +1,190 @@
+package auth
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Failed logins are counted per account and per client address. After a few
+// free attempts each further failure doubles the wait before the next
+// attempt, and reaching the limit locks the account or address out. Counters
+// are kept in memory, so a restart clears them.
+const (
+	freeAccountFailures = 3
+	freeIPFailures      = 10
+	backoffBase         = time.Second
+)
+
+var (
+	maxLoginFailures = 10
+	maxIPFailures    = 50
+	lockoutDuration  = 15 * time.Minute
+)
+
+type failureCounter struct {
+	failures    int
+	lastFailure time.Time
+	nextAttempt time.Time
+	lockedUntil time.Time
+}
+
+// LoginLockout is the admin view of a throttled account or address
+type LoginLockout struct {
+	Kind        string     `json:"kind"` // account or ip
+	Key         string     `json:"key"`  // email or client address
+	Failures    int        `json:"failures"`
+	LastFailure time.Time  `json:"last_failure"`
+	NextAttempt *time.Time `json:"next_attempt,omitempty"`
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+}
+
+var loginThrottle = struct {
+	sync.Mutex
+	accounts map[string]*failureCounter // by normalized email
+	ips      map[string]*failureCounter
+}{accounts: map[string]*failureCounter{}, ips: map[string]*failureCounter{}}
+
+func accountKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// wait is how long until the next attempt may be made
+func (f *failureCounter) wait(now time.Time) time.Duration {
+	if f == nil {
+		return 0
+	}
+	until := f.nextAttempt
+	if f.lockedUntil.After(until) {
+		until = f.lockedUntil
+	}
+	if until.After(now) {
+		return until.Sub(now)
+	}
+	return 0
+}
+
+// fail counts a failure and reports whether it started a lockout
+func (f *failureCounter) fail(now time.Time, free, max int) bool {
+	f.failures++
+	f.lastFailure = now
+	if f.failures > free {
+		delay := backoffBase << min(f.failures-free-1, 20)
+		f.nextAttempt = now.Add(min(delay, lockoutDuration))
+	}
+	if f.failures >= max && !f.lockedUntil.After(now) {
+		f.lockedUntil = now.Add(lockoutDuration)
+		return true
+	}
+	return false
+}
+
+// loginWait returns how long the account and address must wait before
+// another login attempt, and whether that is because of a lockout
+func loginWait(email, ip string) (time.Duration, bool) {
+	loginThrottle.Lock()
+	defer loginThrottle.Unlock()
+	now := time.Now()
+	account, addr := loginThrottle.accounts[accountKey(email)], loginThrottle.ips[ip]
+
+	wait := max(account.wait(now), addr.wait(now))
+	locked := (account != nil && account.lockedUntil.After(now)) || (addr != nil && addr.lockedUntil.After(now))
+	return wait, locked
+}
+
+// recordLoginFailure counts a failed password or second factor and reports
+// whether the account was just locked
+func recordLoginFailure(email, ip string) bool {
+	loginThrottle.Lock()
+	defer loginThrottle.Unlock()
+	now := time.Now()
+
+	addr := loginThrottle.ips[ip]
+	if addr == nil {
+		addr = &failureCounter{}
+		loginThrottle.ips[ip] = addr
+	}
+	addr.fail(now, freeIPFailures, maxIPFailures)
+
+	key := accountKey(email)
+	account := loginThrottle.accounts[key]
+	if account == nil {
+		account = &failureCounter{}
+		loginThrottle.accounts[key] = account
+	}
+	return account.fail(now, freeAccountFailures, maxLoginFailures)
+}
+
+// clearLoginFailures forgets an account's failures after a complete login.
+// The address keeps its count so one valid account cannot reset it.
+func clearLoginFailures(email string) {
+	loginThrottle.Lock()
+	defer loginThrottle.Unlock()
+	delete(loginThrottle.accounts, accountKey(email))
+}
+
+// PruneLoginThrottle forgets counters that have been quiet for a lockout
+// period; run it periodically
+func PruneLoginThrottle(ctx context.Context) {
+	loginThrottle.Lock()
+	defer loginThrottle.Unlock()
+	now := time.Now()
+	for _, set := range []map[string]*failureCounter{loginThrottle.accounts, loginThrottle.ips} {
+		for key, f := range set {
+			if now.Sub(f.lastFailure) > lockoutDuration && !f.lockedUntil.After(now) {
+				delete(set, key)
+			}
+		}
+	}
+}
+
+// LoginLockouts lists accounts and addresses with recent failures, locked
+// ones first
+func LoginLockouts() []LoginLockout {
+	loginThrottle.Lock()
+	defer loginThrottle.Unlock()
+	now := time.Now()
+
+	var out []LoginLockout
+	add := func(kind string, set map[string]*failureCounter) {
+		for key, f := range set {
+			l := LoginLockout{Kind: kind, Key: key, Failures: f.failures, LastFailure: f.lastFailure}
+			if f.nextAttempt.After(now) {
+				t := f.nextAttempt
+				l.NextAttempt = &t
+			}
+			if f.lockedUntil.After(now) {
+				t := f.lockedUntil
+				l.LockedUntil = &t
+			}
+			out = append(out, l)
+		}
+	}
+	add("account", loginThrottle.accounts)
+	add("ip", loginThrottle.ips)
+
+	sort.Slice(out, func(i, j int) bool {
+		if (out[i].LockedUntil != nil) != (out[j].LockedUntil != nil) {
+			return out[i].LockedUntil != nil
+		}
+		return out[i].LastFailure.After(out[j].LastFailure)
+	})
+	return out
+}
+
+// ClearLoginLockout removes the counter of an account or address and reports
+// whether there was one
+func ClearLoginLockout(kind, key string) bool {
+	loginThrottle.Lock()
+	defer loginThrottle.Unlock()
+
+	set := loginThrottle.ips
+	if kind == "account" {
+		set, key = loginThrottle.accounts, accountKey(key)
+	}
+	_, ok := set[key]
+	delete(set, key)
+	return ok
+}
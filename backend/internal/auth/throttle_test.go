@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginThrottleBacksOffThenLocks(t *testing.T) {
+	const email, ip = "Owner@Example.com", "192.0.2.10"
+
+	for i := 1; i <= freeAccountFailures; i++ {
+		if recordLoginFailure(email, ip) {
+			t.Fatalf("locked after %d failures", i)
+		}
+	}
+	if wait, _ := loginWait(email, ip); wait != 0 {
+		t.Fatalf("wait within the free attempts: %s", wait)
+	}
+
+	recordLoginFailure(email, ip)
+	wait, locked := loginWait("owner@example.com", "198.51.100.1")
+	if wait <= 0 || wait > backoffBase || locked {
+		t.Fatalf("first backoff from another address: %s, locked %v", wait, locked)
+	}
+
+	var lockedNow bool
+	for i := freeAccountFailures + 2; i <= maxLoginFailures; i++ {
+		lockedNow = recordLoginFailure(email, ip)
+	}
+	if !lockedNow {
+		t.Fatal("account not locked at the limit")
+	}
+	if wait, locked := loginWait(email, ip); !locked || wait < lockoutDuration-time.Second {
+		t.Fatalf("lockout: %s, locked %v", wait, locked)
+	}
+	if recordLoginFailure(email, ip) {
+		t.Fatal("lockout reported twice")
+	}
+
+	// A successful login elsewhere clears the account but not the address
+	clearLoginFailures(email)
+	if wait, _ := loginWait(email, "198.51.100.1"); wait != 0 {
+		t.Fatalf("account still throttled after clearing: %s", wait)
+	}
+	if wait, _ := loginWait("someone@example.com", ip); wait == 0 {
+		t.Fatal("address backoff cleared with the account")
+	}
+	if !ClearLoginLockout("ip", ip) || ClearLoginLockout("ip", ip) {
+		t.Fatal("clearing the address")
+	}
+}
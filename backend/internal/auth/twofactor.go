@@ -0,0 +1,302 @@
+package auth
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"math/big"
+	"sems-backend/internal/database"
+	"sems-backend/internal/keys"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// MFA challenge token purposes: finishing a login with a code, or enrolling
+// because the role requires a second factor
+const (
+	mfaPurposeLogin  = "login"
+	mfaPurposeEnroll = "enroll"
+)
+
+const (
+	mfaTokenTTL       = 5 * time.Minute
+	maxMFAAttempts    = 5
+	recoveryCodeCount = 10
+	recoveryAlphabet  = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+var (
+	ErrTwoFactorEnabled = errors.New("two-factor authentication is already enabled")
+	ErrMFATokenInvalid  = errors.New("sign-in challenge is invalid or has expired")
+)
+
+var require2FARoles []string
+
+type twoFactor struct {
+	secret   []byte
+	enabled  bool
+	lastStep int64
+}
+
+func twoFactorRequired(role string) bool {
+	for _, r := range require2FARoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// getTwoFactor returns sql.ErrNoRows when the user never started enrollment
+func getTwoFactor(userID string) (*twoFactor, error) {
+	var sealed string
+	var enabledAt sql.NullTime
+	tf := &twoFactor{}
+	err := database.DB.QueryRow(`
+		SELECT sealed_secret, enabled_at, last_used_step FROM user_two_factor
+		WHERE user_id = ?`, userID).Scan(&sealed, &enabledAt, &tf.lastStep)
+	if err != nil {
+		return nil, err
+	}
+	tf.secret, err = keys.Unseal(sealed, "totp:"+userID)
+	if err != nil {
+		return nil, err
+	}
+	tf.enabled = enabledAt.Valid
+	return tf, nil
+}
+
+// twoFactorEnabled is false for users who never enrolled or did not finish
+func twoFactorEnabled(userID string) (bool, error) {
+	tf, err := getTwoFactor(userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return tf.enabled, nil
+}
+
+// savePendingSecret stores a new secret until the user proves they can
+// generate codes with it; an enabled secret is never replaced
+func savePendingSecret(userID string, secret []byte) error {
+	sealed, err := keys.Seal(secret, "totp:"+userID)
+	if err != nil {
+		return err
+	}
+	result, err := database.DB.Exec(`
+		INSERT INTO user_two_factor (user_id, sealed_secret, last_used_step, created_at)
+		VALUES (?, ?, 0, ?)
+		ON CONFLICT (user_id) DO UPDATE SET sealed_secret = excluded.sealed_secret, last_used_step = 0, created_at = excluded.created_at
+		WHERE user_two_factor.enabled_at IS NULL`,
+		userID, sealed, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrTwoFactorEnabled
+	}
+	return nil
+}
+
+func enableTwoFactor(userID string, step int64) error {
+	result, err := database.DB.Exec(`
+		UPDATE user_two_factor SET enabled_at = ?, last_used_step = ?
+		WHERE user_id = ? AND enabled_at IS NULL`, time.Now().UTC(), step, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrTwoFactorEnabled
+	}
+	return nil
+}
+
+func disableTwoFactor(userID string) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM user_two_factor WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// checkSecondFactor accepts a current TOTP code or an unused recovery code.
+// Each TOTP time step works once, so an observed code cannot be replayed.
+func checkSecondFactor(userID, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	tf, err := getTwoFactor(userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil || !tf.enabled {
+		return false, err
+	}
+
+	if step, ok := matchTOTP(tf.secret, code, time.Now()); ok {
+		result, err := database.DB.Exec(`
+			UPDATE user_two_factor SET last_used_step = ?
+			WHERE user_id = ? AND last_used_step < ?`, step, userID, step)
+		if err != nil {
+			return false, err
+		}
+		n, _ := result.RowsAffected()
+		return n == 1, nil
+	}
+	return useRecoveryCode(userID, code)
+}
+
+// newRecoveryCodes replaces the user's recovery codes and returns the plaintext once
+func newRecoveryCodes(userID string) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	max := big.NewInt(int64(len(recoveryAlphabet)))
+	for i := range codes {
+		var b strings.Builder
+		for j := 0; j < 10; j++ {
+			if j == 5 {
+				b.WriteByte('-')
+			}
+			n, err := rand.Int(rand.Reader, max)
+			if err != nil {
+				return nil, err
+			}
+			b.WriteByte(recoveryAlphabet[n.Int64()])
+		}
+		codes[i] = b.String()
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	for _, code := range codes {
+		if _, err := tx.Exec(`
+			INSERT INTO recovery_codes (id, user_id, code_hash, created_at)
+			VALUES (?, ?, ?, ?)`, uuid.New().String(), userID, hashToken(normalizeRecoveryCode(code)), now); err != nil {
+			return nil, err
+		}
+	}
+	return codes, tx.Commit()
+}
+
+func useRecoveryCode(userID, code string) (bool, error) {
+	result, err := database.DB.Exec(`
+		UPDATE recovery_codes SET used_at = ?
+		WHERE user_id = ? AND code_hash = ? AND used_at IS NULL`,
+		time.Now().UTC(), userID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n == 1, nil
+}
+
+func remainingRecoveryCodes(userID string) (int, error) {
+	var n int
+	err := database.DB.QueryRow(`SELECT COUNT(*) FROM recovery_codes WHERE user_id = ? AND used_at IS NULL`, userID).Scan(&n)
+	return n, err
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// issueMFAToken signs a short-lived challenge that only the second login
+// step accepts; it has no session, so AuthMiddleware refuses it
+func issueMFAToken(userID, purpose string) (string, error) {
+	return keys.Sign(jwt.MapClaims{
+		"user_id": userID,
+		"typ":     "mfa",
+		"purpose": purpose,
+		"jti":     uuid.New().String(),
+		"exp":     time.Now().Add(mfaTokenTTL).Unix(),
+		"iat":     time.Now().Unix(),
+	})
+}
+
+// mfaChallenges tracks challenges in use, so a token cannot be used to
+// guess codes for its whole lifetime, nor be used again after it succeeded
+var mfaChallenges = struct {
+	sync.Mutex
+	m map[string]*mfaChallenge // by jti
+}{m: map[string]*mfaChallenge{}}
+
+type mfaChallenge struct {
+	failures int
+	expires  time.Time
+}
+
+// parseMFAToken returns the user and challenge ID of a valid, unspent token
+func parseMFAToken(token, purpose string) (string, string, error) {
+	claims, err := keys.Parse(token)
+	if err != nil {
+		return "", "", ErrMFATokenInvalid
+	}
+	userID, _ := claims["user_id"].(string)
+	jti, _ := claims["jti"].(string)
+	if claims["typ"] != "mfa" || claims["purpose"] != purpose || userID == "" || jti == "" {
+		return "", "", ErrMFATokenInvalid
+	}
+
+	mfaChallenges.Lock()
+	defer mfaChallenges.Unlock()
+	if ch := mfaChallenges.m[jti]; ch != nil && ch.failures >= maxMFAAttempts {
+		return "", "", ErrMFATokenInvalid
+	}
+	return userID, jti, nil
+}
+
+// recordMFAFailure counts a wrong code against the challenge
+func recordMFAFailure(jti string) {
+	trackChallenge(jti, 1)
+}
+
+// spendMFAToken stops a challenge from being used again
+func spendMFAToken(jti string) {
+	trackChallenge(jti, maxMFAAttempts)
+}
+
+func trackChallenge(jti string, failures int) {
+	mfaChallenges.Lock()
+	defer mfaChallenges.Unlock()
+	now := time.Now()
+	for id, ch := range mfaChallenges.m {
+		if now.After(ch.expires) {
+			delete(mfaChallenges.m, id)
+		}
+	}
+	ch := mfaChallenges.m[jti]
+	if ch == nil {
+		ch = &mfaChallenge{expires: now.Add(mfaTokenTTL)}
+		mfaChallenges.m[jti] = ch
+	}
+	ch.failures += failures
+}
+
+// ResetTwoFactor removes a user's second factor for account recovery by an
+// operator and signs out their sessions. Roles that require 2FA enroll again
+// at their next login.
+func ResetTwoFactor(userID string) error {
+	if err := disableTwoFactor(userID); err != nil {
+		return err
+	}
+	_, err := RevokeUserSessions(userID)
+	return err
+}
@@ -0,0 +1,372 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"sems-backend/internal/users"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type LoginTwoFactorRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// TwoFactorSetupRequest needs mfa_token only when enrolling during login
+type TwoFactorSetupRequest struct {
+	MFAToken string `json:"mfa_token"`
+}
+
+type TwoFactorSetupResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type EnableTwoFactorRequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// EnableTwoFactorResponse carries a session as well when enrolling during login
+type EnableTwoFactorResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+	*LoginResponse
+}
+
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// @Summary Complete login with a second factor
+// @Description Exchange the mfa_token from /auth/login and a TOTP or recovery code for a session
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param body body LoginTwoFactorRequest true "Challenge and code"
+// @Success 200 {object} LoginResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 429 {object} map[string]interface{}
+// @Failure 500 {object} map[string]string
+// @Router /auth/login/2fa [post]
+func LoginTwoFactor(c *gin.Context) {
+	var req LoginTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mfa_token and code are required"})
+		return
+	}
+
+	userID, jti, err := parseMFAToken(req.MFAToken, mfaPurposeLogin)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	user, err := users.GetUserByID(userID)
+	if err != nil || !user.IsActive {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Account is deactivated"})
+		return
+	}
+	if wait, locked := loginWait(user.Email, c.ClientIP()); wait > 0 {
+		tooManyAttempts(c, wait, locked)
+		return
+	}
+
+	ok, err := checkSecondFactor(user.ID, req.Code)
+	if err != nil {
+		log.Printf("Second factor check error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check code"})
+		return
+	}
+	if !ok {
+		recordMFAFailure(jti)
+		loginFailed(c, user.Email, user)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+	spendMFAToken(jti)
+
+	respondWithSession(c, user, nil)
+}
+
+// @Summary Start two-factor enrollment
+// @Description Generate a new TOTP secret to add to an authenticator app. Signed-in users call /auth/2fa/setup; users whose role requires 2FA call /auth/login/2fa/setup with the mfa_token from login.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param body body TwoFactorSetupRequest false "Enrollment challenge when not signed in"
+// @Success 200 {object} TwoFactorSetupResponse
+// @Failure 401 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /auth/2fa/setup [post]
+func SetupTwoFactor(c *gin.Context) {
+	var req TwoFactorSetupRequest
+	c.ShouldBindJSON(&req)
+
+	user, _, ok := enrollingUser(c, req.MFAToken)
+	if !ok {
+		return
+	}
+
+	secret, err := newTOTPSecret()
+	if err == nil {
+		err = savePendingSecret(user.ID, secret)
+	}
+	if errors.Is(err, ErrTwoFactorEnabled) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if err != nil {
+		log.Printf("Two-factor setup error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start enrollment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, TwoFactorSetupResponse{
+		Secret:     base32NoPad.EncodeToString(secret),
+		OTPAuthURI: provisioningURI(secret, user.Email),
+	})
+}
+
+// @Summary Finish two-factor enrollment
+// @Description Confirm the authenticator app with a current code. Returns single-use recovery codes, shown only once, and a session when enrolling during login.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param body body EnableTwoFactorRequest true "Code from the authenticator app"
+// @Success 200 {object} EnableTwoFactorResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /auth/2fa/enable [post]
+func EnableTwoFactor(c *gin.Context) {
+	var req EnableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code is required"})
+		return
+	}
+
+	user, jti, ok := enrollingUser(c, req.MFAToken)
+	if !ok {
+		return
+	}
+
+	tf, err := getTwoFactor(user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Start enrollment first"})
+		return
+	}
+	if err != nil {
+		log.Printf("Two-factor lookup error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+	if tf.enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	step, ok := matchTOTP(tf.secret, req.Code, time.Now())
+	if !ok {
+		if jti != "" {
+			recordMFAFailure(jti)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	if err := enableTwoFactor(user.ID, step); err != nil {
+		if errors.Is(err, ErrTwoFactorEnabled) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+			return
+		}
+		log.Printf("Enable two-factor error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+	codes, err := newRecoveryCodes(user.ID)
+	if err != nil {
+		log.Printf("Recovery codes error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+	sendTwoFactorChangedEmail(user, true)
+
+	if jti == "" {
+		c.JSON(http.StatusOK, EnableTwoFactorResponse{RecoveryCodes: codes})
+		return
+	}
+	spendMFAToken(jti)
+	respondWithSession(c, user, codes)
+}
+
+// @Summary Disable two-factor authentication
+// @Description Turn off 2FA with the account password and a current code. Not allowed for roles that require 2FA.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param body body DisableTwoFactorRequest true "Password and code"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /auth/2fa/disable [post]
+func DisableTwoFactor(c *gin.Context) {
+	var req DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "password and code are required"})
+		return
+	}
+
+	user, err := users.GetUserByID(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+	if twoFactorRequired(user.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is required for your role"})
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)) != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password or code"})
+		return
+	}
+	if ok, err := checkSecondFactor(user.ID, req.Code); err != nil || !ok {
+		if err != nil {
+			log.Printf("Second factor check error: %v", err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password or code"})
+		return
+	}
+
+	if err := disableTwoFactor(user.ID); err != nil {
+		log.Printf("Disable two-factor error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+	sendTwoFactorChangedEmail(user, false)
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// @Summary Regenerate recovery codes
+// @Description Replace all recovery codes after confirming a current code. The old codes stop working.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param body body TwoFactorCodeRequest true "Current code"
+// @Success 200 {object} EnableTwoFactorResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /auth/2fa/recovery-codes [post]
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code is required"})
+		return
+	}
+
+	userID := c.GetString("user_id")
+	ok, err := checkSecondFactor(userID, req.Code)
+	if err != nil {
+		log.Printf("Second factor check error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check code"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	codes, err := newRecoveryCodes(userID)
+	if err != nil {
+		log.Printf("Recovery codes error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+	c.JSON(http.StatusOK, EnableTwoFactorResponse{RecoveryCodes: codes})
+}
+
+// @Summary Two-factor status
+// @Description Whether 2FA is enabled or required for the signed-in user, and how many recovery codes are left
+// @Tags Auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /auth/2fa [get]
+func TwoFactorStatus(c *gin.Context) {
+	userID := c.GetString("user_id")
+	enabled, err := twoFactorEnabled(userID)
+	if err != nil {
+		log.Printf("Two-factor lookup error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load two-factor status"})
+		return
+	}
+	remaining := 0
+	if enabled {
+		if remaining, err = remainingRecoveryCodes(userID); err != nil {
+			log.Printf("Recovery code count error: %v", err)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":                  enabled,
+		"required":                 twoFactorRequired(c.GetString("role")),
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// enrollingUser resolves who is enrolling: the signed-in user, or the holder
+// of an enrollment challenge from login. The challenge ID is empty for
+// signed-in users.
+func enrollingUser(c *gin.Context, mfaToken string) (*users.User, string, bool) {
+	userID, jti := c.GetString("user_id"), ""
+	if userID == "" {
+		var err error
+		if userID, jti, err = parseMFAToken(mfaToken, mfaPurposeEnroll); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return nil, "", false
+		}
+	}
+	user, err := users.GetUserByID(userID)
+	if err != nil || !user.IsActive {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Account is deactivated"})
+		return nil, "", false
+	}
+	return user, jti, true
+}
+
+// respondWithSession finishes a two-step login
+func respondWithSession(c *gin.Context, user *users.User, recoveryCodes []string) {
+	verified, err := users.IsEmailVerified(user.ID)
+	if err != nil {
+		log.Printf("Email verification lookup error: %v", err)
+	}
+	resp, err := startSession(c, user, verified)
+	if err != nil {
+		log.Printf("Start session error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start session"})
+		return
+	}
+	if recoveryCodes != nil {
+		c.JSON(http.StatusOK, EnableTwoFactorResponse{RecoveryCodes: recoveryCodes, LoginResponse: resp})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTOTPMatchesRFC6238(t *testing.T) {
+	// SHA1 test vector from RFC 6238 appendix B, truncated to six digits
+	secret := []byte("12345678901234567890")
+	if code := totpCode(secret, 59/totpPeriod); code != "287082" {
+		t.Fatalf("code at T=59: %s", code)
+	}
+	if step, ok := matchTOTP(secret, "287082", time.Unix(59+totpPeriod, 0)); !ok || step != 1 {
+		t.Fatalf("previous period within skew: %d, %v", step, ok)
+	}
+	if _, ok := matchTOTP(secret, "287082", time.Unix(59+3*totpPeriod, 0)); ok {
+		t.Fatal("code accepted outside the skew window")
+	}
+}
+
+func TestSecondFactorIsSingleUse(t *testing.T) {
+	user := openTestDB(t)
+
+	secret, err := newTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := savePendingSecret(user.ID, secret); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := checkSecondFactor(user.ID, totpCode(secret, time.Now().Unix()/totpPeriod)); ok {
+		t.Fatal("code accepted before enrollment was confirmed")
+	}
+	if err := enableTwoFactor(user.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := savePendingSecret(user.ID, secret); err != ErrTwoFactorEnabled {
+		t.Fatalf("enabled secret replaced: %v", err)
+	}
+
+	code := totpCode(secret, time.Now().Unix()/totpPeriod)
+	if ok, err := checkSecondFactor(user.ID, code); err != nil || !ok {
+		t.Fatalf("current code: %v, %v", ok, err)
+	}
+	if ok, _ := checkSecondFactor(user.ID, code); ok {
+		t.Fatal("code replayed")
+	}
+
+	codes, err := newRecoveryCodes(user.ID)
+	if err != nil || len(codes) != recoveryCodeCount {
+		t.Fatalf("recovery codes: %v, %v", codes, err)
+	}
+	if ok, err := checkSecondFactor(user.ID, " "+codes[0]+" "); err != nil || !ok {
+		t.Fatalf("recovery code: %v, %v", ok, err)
+	}
+	if ok, _ := checkSecondFactor(user.ID, codes[0]); ok {
+		t.Fatal("recovery code used twice")
+	}
+	if n, _ := remainingRecoveryCodes(user.ID); n != recoveryCodeCount-1 {
+		t.Fatalf("remaining recovery codes: %d", n)
+	}
+}
@@ -0,0 +1,293 @@
+// Package authz decides what the caller may do. Roles grant permissions and a
+// scope; every device, ticket and notification belongs to a user account, and
+// access to it follows from that owner: everyone reaches their own, and a role
+// holding the matching permission reaches others' through assignments or its
+// scope (the customers in the account's plant, region or admin_id, or all).
+// An account that belongs to an organisation is confined to it: its scope,
+// even a global one, ends at the organisation's accounts and resources.
+package authz
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"sems-backend/internal/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Kind names a resource type; each has its own rule in Can
+type Kind string
+
+const (
+	Device       Kind = "device"
+	Ticket       Kind = "ticket"
+	Notification Kind = "notification"
+	Account      Kind = "user"
+	Installation Kind = "installation"
+)
+
+// Resource is what a handler is about to touch
+type Resource struct {
+	Kind     Kind
+	OwnerID  string // user the resource belongs to, empty when unassigned
+	Assignee string // installer a ticket or installation is assigned to
+	OrgID    string // organisation of a resource without an owner, such as a plant
+}
+
+// Subject is the caller, loaded fresh from the users table so a role or scope
+// change takes effect without waiting for the token to expire
+type Subject struct {
+	ID      string
+	Role    string
+	Scope   Scope
+	PlantID string
+	Region  string
+	AdminID string
+	OrgID   string // empty for the platform's own accounts
+
+	role      *Role
+	suspended bool // the organisation is inactive
+}
+
+var ErrUnauthenticated = errors.New("not authenticated")
+
+const subjectKey = "authz_subject"
+
+// Caller returns the authenticated subject, cached on the request
+func Caller(c *gin.Context) (*Subject, error) {
+	if s, ok := c.Get(subjectKey); ok {
+		return s.(*Subject), nil
+	}
+	id := c.GetString("user_id")
+	if id == "" {
+		return nil, ErrUnauthenticated
+	}
+	s, err := Lookup(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUnauthenticated
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.Set(subjectKey, s)
+	return s, nil
+}
+
+// Lookup loads the account with the given ID and its role as a subject
+func Lookup(userID string) (*Subject, error) {
+	s, err := lookupAccount(userID)
+	if err != nil {
+		return nil, err
+	}
+	s.role, err = GetRole(s.Role)
+	if errors.Is(err, ErrUnknownRole) {
+		// A role that no longer exists grants nothing
+		log.Printf("authz: account %s has unknown role %s", userID, s.Role)
+		s.role, err = &Role{Name: s.Role, Scope: Own}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.suspended {
+		// Neither does any role in a suspended organisation
+		s.role = &Role{Name: s.Role, Scope: Own}
+	}
+	s.Scope = s.role.Scope
+	// Running an organisation reaches nothing beyond one's own account
+	// until the account belongs to one
+	if s.OrgID == "" && s.role.Has(OrgManage) && !s.role.Has(OrgsManage) {
+		s.Scope = Own
+	}
+	return s, nil
+}
+
+func lookupAccount(userID string) (*Subject, error) {
+	s := &Subject{ID: userID}
+	var active bool
+	err := database.DB.QueryRow(`
+		SELECT u.role, COALESCE(u.plant_id, ''), COALESCE(u.region, ''), COALESCE(u.admin_id, ''), COALESCE(u.org_id, ''),
+		       COALESCE(o.is_active, true)
+		FROM users u LEFT JOIN organizations o ON o.id = u.org_id
+		WHERE u.id = ?`, userID).Scan(&s.Role, &s.PlantID, &s.Region, &s.AdminID, &s.OrgID, &active)
+	if err != nil {
+		return nil, err
+	}
+	s.suspended = !active
+	return s, nil
+}
+
+// Has reports whether the subject's role grants p. Platform permissions are
+// withheld from accounts in an organisation.
+func (s *Subject) Has(p Permission) bool {
+	if s.OrgID != "" && platform[p] {
+		return false
+	}
+	return s.role != nil && s.role.Has(p)
+}
+
+// Permissions lists what the subject's role grants
+func (s *Subject) Permissions() []Permission {
+	if s.role == nil {
+		return nil
+	}
+	if s.OrgID == "" {
+		return s.role.Permissions
+	}
+	perms := []Permission{}
+	for _, p := range s.role.Permissions {
+		if !platform[p] {
+			perms = append(perms, p)
+		}
+	}
+	return perms
+}
+
+// Can reports whether s may act on r. Owners always may; anyone else needs
+// perm and must reach the owner through an assignment or the role's scope.
+func Can(s *Subject, perm Permission, r Resource) (bool, error) {
+	// Notifications are personal; nobody else reads or clears them
+	if r.Kind == Notification {
+		return r.OwnerID != "" && r.OwnerID == s.ID, nil
+	}
+	if r.OwnerID != "" && r.OwnerID == s.ID {
+		return true, nil
+	}
+	if !s.Has(perm) {
+		return false, nil
+	}
+	if s.OrgID != "" {
+		org, err := resourceOrg(r)
+		if err != nil {
+			return false, err
+		}
+		if org != s.OrgID {
+			return false, nil
+		}
+	}
+	if s.Scope == Global {
+		return true, nil
+	}
+	if (r.Kind == Ticket || r.Kind == Installation) && r.Assignee != "" && r.Assignee == s.ID {
+		return true, nil
+	}
+	// Unassigned installations are open to anyone who installs
+	if r.Kind == Installation && r.Assignee == "" {
+		return true, nil
+	}
+	if s.Scope != Scoped || r.OwnerID == "" {
+		return false, nil
+	}
+
+	owner, err := lookupAccount(r.OwnerID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return s.covers(owner), nil
+}
+
+// resourceOrg is the organisation r belongs to: its own, else its owner's
+func resourceOrg(r Resource) (string, error) {
+	if r.OrgID != "" || r.OwnerID == "" {
+		return r.OrgID, nil
+	}
+	var org string
+	err := database.DB.QueryRow(`SELECT COALESCE(org_id, '') FROM users WHERE id = ?`, r.OwnerID).Scan(&org)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return org, err
+}
+
+// covers reports whether owner falls inside a scoped role's reach. Scoped
+// roles manage customer accounts only, never other staff.
+func (s *Subject) covers(owner *Subject) bool {
+	if owner.Role != "USER" {
+		return false
+	}
+	switch {
+	case s.PlantID != "":
+		return owner.PlantID == s.PlantID
+	case s.Region != "":
+		return owner.Region == s.Region
+	default:
+		return owner.AdminID == s.ID
+	}
+}
+
+// Has reports whether the caller holds p
+func Has(c *gin.Context, p Permission) bool {
+	s, err := Caller(c)
+	if err != nil {
+		if !errors.Is(err, ErrUnauthenticated) {
+			log.Printf("authz: loading caller: %v", err)
+		}
+		return false
+	}
+	return s.Has(p)
+}
+
+// Allowed checks r for the caller, who needs perm unless they own it. Lookup
+// failures are logged and deny.
+func Allowed(c *gin.Context, perm Permission, r Resource) bool {
+	s, err := Caller(c)
+	if err != nil {
+		if !errors.Is(err, ErrUnauthenticated) {
+			log.Printf("authz: loading caller: %v", err)
+		}
+		return false
+	}
+	ok, err := Can(s, perm, r)
+	if err != nil {
+		log.Printf("authz: %s owned by %s: %v", r.Kind, r.OwnerID, err)
+		return false
+	}
+	return ok
+}
+
+// Filter narrows a list query to owners within the subject's scope and
+// organisation. alias names the owner's row in the users table; rows without
+// an owner are visible to global platform roles only. The clause starts with
+// " AND ".
+func (s *Subject) Filter(alias string) (string, []interface{}) {
+	tenant, args := TenantFilter(s.OrgID, alias+".org_id")
+	switch s.Scope {
+	case Global:
+		return tenant, args
+	case Scoped:
+		scope, arg := alias+".admin_id = ?", s.ID
+		if s.PlantID != "" {
+			scope, arg = alias+".plant_id = ?", s.PlantID
+		} else if s.Region != "" {
+			scope, arg = alias+".region = ?", s.Region
+		}
+		return " AND (" + alias + ".id = ? OR (" + alias + ".role = 'USER' AND " + scope + "))" + tenant,
+			append([]interface{}{s.ID, arg}, args...)
+	default:
+		return " AND " + alias + ".id = ?", []interface{}{s.ID}
+	}
+}
+
+// TenantFilter narrows a list query to the rows of one organisation, given
+// the column holding their org_id. An empty orgID, a platform account's,
+// leaves the query as it is.
+func TenantFilter(orgID, column string) (string, []interface{}) {
+	if orgID == "" {
+		return "", nil
+	}
+	return " AND " + column + " = ?", []interface{}{orgID}
+}
+
+// InTenant reports whether a resource of organisation orgID is within the
+// caller's reach: platform accounts reach every organisation, members only
+// their own
+func InTenant(c *gin.Context, orgID string) bool {
+	s, err := Caller(c)
+	if err != nil {
+		return false
+	}
+	return s.OrgID == "" || s.OrgID == orgID
+}
@@ -0,0 +1,366 @@
+package authz_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"sems-backend/internal/authz"
+	"sems-backend/internal/config"
+	"sems-backend/internal/database"
+	"sems-backend/internal/devices"
+	"sems-backend/internal/middleware"
+	"sems-backend/internal/notifications"
+	"sems-backend/internal/orgs"
+	"sems-backend/internal/tickets"
+	"sems-backend/internal/users"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func openTestDB(t *testing.T) {
+	t.Helper()
+	if err := database.InitDB(config.DatabaseConfig{Driver: "sqlite", Path: filepath.Join(t.TempDir(), "authz.db"), MaxOpenConns: 1}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(database.CloseDB)
+	if err := database.RunMigrations(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newAccount(t *testing.T, email, role, region, plant, installer string) *users.User {
+	t.Helper()
+	u, err := users.CreateUser("Test", role, email, "x", role, "", "", "", "", "", "", "", region, 0, 0, "", installer, plant)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+// testRouter authenticates requests as the account named in X-Test-User
+func testRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		u, err := users.GetUserByID(c.GetHeader("X-Test-User"))
+		if err != nil {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Set("user_id", u.ID)
+		c.Set("role", u.Role)
+	})
+	return r
+}
+
+func call(r *gin.Engine, caller *users.User, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("X-Test-User", caller.ID)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestCrossTenantAccessIsDenied(t *testing.T) {
+	openTestDB(t)
+	account := func(email, role, region, plant, installer string) *users.User {
+		t.Helper()
+		return newAccount(t, email, role, region, plant, installer)
+	}
+	installer := account("installer@test", "INSTALLER", "", "", "")
+	otherInstaller := account("installer2@test", "INSTALLER", "", "", "")
+	alice := account("alice@test", "USER", "north", "plant-1", installer.ID)
+	bob := account("bob@test", "USER", "south", "plant-2", "")
+	plantAdmin := account("admin1@test", "ADMIN", "", "plant-1", "")
+	otherPlantAdmin := account("admin2@test", "ADMIN", "", "plant-2", "")
+	regionAdmin := account("admin3@test", "ADMIN", "north", "", "")
+	superAdmin, err := users.GetUserByEmail("superadmin@solar.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aliceID, _ := uuid.Parse(alice.ID)
+	device, err := devices.CreateDevice(aliceID, "Roof", "esp32", "Home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ticket, err := tickets.CreateTicket(aliceID, "Inverter", "No output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	note, err := notifications.CreateNotification(aliceID, notifications.NotificationTypeInfo, "Hi", "Hello", notifications.SeverityLow, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := testRouter()
+	r.GET("/devices", devices.GetAllDevicesHandler)
+	r.GET("/devices/:id", devices.GetDeviceHandler)
+	r.PUT("/devices/:id", devices.UpdateDeviceHandler)
+	r.DELETE("/devices/:id", devices.DeleteDeviceHandler)
+	r.POST("/devices/:id/regenerate-key", devices.RegenerateAPIKeyHandler)
+	r.GET("/devices/:id/power", devices.GetDevicePowerHandler)
+	r.PUT("/tickets/:id/status", tickets.UpdateTicketStatusHandler)
+	r.PUT("/notifications/:id/read", notifications.MarkAsReadHandler)
+	r.DELETE("/notifications/:id", notifications.DeleteNotificationHandler)
+	r.GET("/users/:id", users.GetUserHandler)
+	r.DELETE("/users/:id", users.DeleteUserHandler)
+
+	do := func(caller *users.User, method, path, body string) *httptest.ResponseRecorder {
+		return call(r, caller, method, path, body)
+	}
+
+	dev := "/devices/" + device.ID.String()
+	status := "/tickets/" + ticket.ID + "/status"
+	read := "/notifications/" + note.ID.String() + "/read"
+	cases := []struct {
+		name   string
+		caller *users.User
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"other user reads device", bob, "GET", dev, "", http.StatusNotFound},
+		{"other user renames device", bob, "PUT", dev, `{"name":"mine"}`, http.StatusNotFound},
+		{"other user deletes device", bob, "DELETE", dev, "", http.StatusNotFound},
+		{"other user rotates key", bob, "POST", dev + "/regenerate-key", "", http.StatusNotFound},
+		{"other user reads power", bob, "GET", dev + "/power", "", http.StatusNotFound},
+		{"admin of another plant", otherPlantAdmin, "GET", dev, "", http.StatusNotFound},
+		{"admin of another plant deletes", otherPlantAdmin, "DELETE", dev, "", http.StatusNotFound},
+		{"installer not assigned", otherInstaller, "PUT", status, `{"status":"RESOLVED"}`, http.StatusNotFound},
+		{"other user's notification", bob, "PUT", read, "", http.StatusNotFound},
+		{"super admin on a notification", superAdmin, "DELETE", "/notifications/" + note.ID.String(), "", http.StatusNotFound},
+		{"admin reads another admin", plantAdmin, "GET", "/users/" + otherPlantAdmin.ID, "", http.StatusForbidden},
+		{"admin deletes user outside scope", plantAdmin, "DELETE", "/users/" + bob.ID, "", http.StatusForbidden},
+
+		{"owner reads device", alice, "GET", dev, "", http.StatusOK},
+		{"plant admin reads device", plantAdmin, "GET", dev + "/power", "", http.StatusOK},
+		{"region admin renames device", regionAdmin, "PUT", dev, `{"name":"Roof east"}`, http.StatusOK},
+		{"super admin reads device", superAdmin, "GET", dev, "", http.StatusOK},
+		{"assigned installer", installer, "PUT", status, `{"status":"IN_PROGRESS"}`, http.StatusOK},
+		{"owner reads notification", alice, "PUT", read, "", http.StatusOK},
+		{"plant admin reads user", plantAdmin, "GET", "/users/" + alice.ID, "", http.StatusOK},
+	}
+	for _, tc := range cases {
+		if w := do(tc.caller, tc.method, tc.path, tc.body); w.Code != tc.want {
+			t.Errorf("%s: %s %s = %d, want %d (%s)", tc.name, tc.method, tc.path, w.Code, tc.want, w.Body)
+		}
+	}
+
+	// Denied deletes left the device in place
+	if _, err := devices.GetDeviceByID(device.ID); err != nil {
+		t.Fatalf("device gone: %v", err)
+	}
+
+	// Lists are narrowed to the same scope
+	listed := func(caller *users.User) bool {
+		var resp struct {
+			Devices []devices.Device `json:"devices"`
+		}
+		if err := json.Unmarshal(do(caller, "GET", "/devices", "").Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		for _, d := range resp.Devices {
+			if d.ID == device.ID {
+				return true
+			}
+		}
+		return false
+	}
+	if listed(otherPlantAdmin) || listed(bob) {
+		t.Error("device listed outside its owner's scope")
+	}
+	if !listed(plantAdmin) || !listed(superAdmin) {
+		t.Error("device missing from its admins' lists")
+	}
+}
+
+func TestCustomRoles(t *testing.T) {
+	openTestDB(t)
+	auditorRole := &authz.Role{Name: "AUDITOR", Scope: authz.Global,
+		Permissions: []authz.Permission{authz.DevicesRead, authz.UsersRead, authz.AnalyticsGlobal}}
+	if err := authz.CreateRole(auditorRole); err != nil {
+		t.Fatal(err)
+	}
+	if err := authz.CreateRole(&authz.Role{Name: "AUDITOR", Scope: authz.Own}); !errors.Is(err, authz.ErrRoleExists) {
+		t.Fatalf("duplicate role: %v", err)
+	}
+	if err := authz.CreateRole(&authz.Role{Name: "ESCALATE", Scope: authz.Own, Permissions: []authz.Permission{authz.StaffManage}}); err == nil {
+		t.Fatal("custom role granted staff:manage")
+	}
+	if err := authz.UpdateRole(&authz.Role{Name: "ADMIN", Scope: authz.Global}); !errors.Is(err, authz.ErrBuiltInRole) {
+		t.Fatalf("built-in role changed: %v", err)
+	}
+	// Configuration may require 2FA of built-in and custom roles alike
+	if err := authz.CheckRoles([]string{"ORG_ADMIN", "AUDITOR", "SUPER_ADMIN"}); err != nil {
+		t.Errorf("check roles: %v", err)
+	}
+	if err := authz.CheckRoles([]string{"ADMIN", "AUDITORS"}); !errors.Is(err, authz.ErrUnknownRole) {
+		t.Errorf("unknown role passed the check: %v", err)
+	}
+
+	auditor := newAccount(t, "auditor@test", "AUDITOR", "", "", "")
+	owner := newAccount(t, "owner@test", "USER", "", "", "")
+	ownerID, _ := uuid.Parse(owner.ID)
+	device, err := devices.CreateDevice(ownerID, "Roof", "esp32", "Home")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := testRouter()
+	r.GET("/admin/devices/:id", middleware.RequirePermission(authz.DevicesRead), devices.GetDeviceHandler)
+	r.PUT("/admin/devices/:id", middleware.RequirePermission(authz.DevicesWrite), devices.UpdateDeviceHandler)
+	r.PUT("/user/devices/:id", middleware.RequirePermission(authz.PortalAccess), devices.UpdateDeviceHandler)
+
+	dev := "/devices/" + device.ID.String()
+	if w := call(r, auditor, "GET", "/admin"+dev, ""); w.Code != http.StatusOK {
+		t.Fatalf("auditor read: %d %s", w.Code, w.Body)
+	}
+	if w := call(r, auditor, "PUT", "/admin"+dev, `{"name":"x"}`); w.Code != http.StatusForbidden {
+		t.Fatalf("auditor write through admin route: %d", w.Code)
+	}
+	if w := call(r, auditor, "PUT", "/user"+dev, `{"name":"x"}`); w.Code != http.StatusForbidden {
+		t.Fatalf("auditor write through portal route: %d", w.Code)
+	}
+
+	// A portal account without devices:write still cannot touch others' devices
+	auditorRole.Permissions = append(auditorRole.Permissions, authz.PortalAccess)
+	if err := authz.UpdateRole(auditorRole); err != nil {
+		t.Fatal(err)
+	}
+	if w := call(r, auditor, "PUT", "/user"+dev, `{"name":"x"}`); w.Code != http.StatusNotFound {
+		t.Fatalf("portal write without devices:write: %d", w.Code)
+	}
+	// Changes to the role apply on the next request
+	auditorRole.Permissions = append(auditorRole.Permissions, authz.DevicesWrite)
+	if err := authz.UpdateRole(auditorRole); err != nil {
+		t.Fatal(err)
+	}
+	if w := call(r, auditor, "PUT", "/admin"+dev, `{"name":"Audited"}`); w.Code != http.StatusOK {
+		t.Fatalf("after granting devices:write: %d %s", w.Code, w.Body)
+	}
+
+	if err := authz.DeleteRole("AUDITOR"); !errors.Is(err, authz.ErrRoleInUse) {
+		t.Fatalf("deleted a role in use: %v", err)
+	}
+	if err := users.SetRole(auditor.ID, "USER"); err != nil {
+		t.Fatal(err)
+	}
+	if err := authz.DeleteRole("AUDITOR"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOrganizationsIsolateTenants(t *testing.T) {
+	openTestDB(t)
+	sunco := &orgs.Organization{Name: "SunCo EPC"}
+	brightway := &orgs.Organization{Name: "Brightway Solar"}
+	for _, o := range []*orgs.Organization{sunco, brightway} {
+		if err := orgs.Create(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+	member := func(email, role string, o *orgs.Organization) *users.User {
+		t.Helper()
+		u := newAccount(t, email, role, "", "", "")
+		if err := orgs.AddMember(o.ID, u.ID); err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	suncoSuper := member("super@sunco.test", "SUPER_ADMIN", sunco)
+	suncoCustomer := member("alice@sunco.test", "USER", sunco)
+	brightAdmin := member("admin@brightway.test", "ORG_ADMIN", brightway)
+	brightCustomer := member("bob@brightway.test", "USER", brightway)
+	platform, err := users.GetUserByEmail("superadmin@solar.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Devices follow their owner's organisation
+	bobID, _ := uuid.Parse(brightCustomer.ID)
+	device, err := devices.CreateDevice(bobID, "Roof", "esp32", "Home")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := testRouter()
+	r.GET("/users", middleware.RequirePermission(authz.UsersRead), users.GetUsersHandler)
+	r.GET("/users/:id", middleware.RequirePermission(authz.UsersRead), users.GetUserHandler)
+	r.GET("/devices/:id", middleware.RequirePermission(authz.DevicesRead), devices.GetDeviceHandler)
+	r.GET("/audit", middleware.RequirePermission(authz.AuditRead), func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.POST("/org/members", middleware.RequirePermission(authz.OrgManage), users.CreateMemberHandler)
+	r.PUT("/org/members/:id", middleware.RequirePermission(authz.OrgManage), users.UpdateMemberHandler)
+
+	dev := "/devices/" + device.ID.String()
+	cases := []struct {
+		name   string
+		caller *users.User
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"super admin of another org reads customer", suncoSuper, "GET", "/users/" + brightCustomer.ID, "", http.StatusForbidden},
+		{"super admin of another org reads device", suncoSuper, "GET", dev, "", http.StatusNotFound},
+		{"org member uses a platform permission", suncoSuper, "GET", "/audit", "", http.StatusForbidden},
+		{"org admin changes another org's member", brightAdmin, "PUT", "/org/members/" + suncoCustomer.ID, `{"is_active":false}`, http.StatusNotFound},
+		{"org admin hands out a platform role", brightAdmin, "POST", "/org/members", `{"first_name":"E","last_name":"V","email":"eve@brightway.test","password":"secret1","role":"SUPER_ADMIN"}`, http.StatusForbidden},
+
+		{"super admin reads own org's customer", suncoSuper, "GET", "/users/" + suncoCustomer.ID, "", http.StatusOK},
+		{"org admin reads own org's device", brightAdmin, "GET", dev, "", http.StatusOK},
+		{"platform reads any org", platform, "GET", dev, "", http.StatusOK},
+		{"platform keeps platform permissions", platform, "GET", "/audit", "", http.StatusOK},
+		{"org admin adds an installer", brightAdmin, "POST", "/org/members", `{"first_name":"I","last_name":"N","email":"ian@brightway.test","password":"secret1","role":"INSTALLER"}`, http.StatusCreated},
+	}
+	for _, tc := range cases {
+		if w := call(r, tc.caller, tc.method, tc.path, tc.body); w.Code != tc.want {
+			t.Errorf("%s: %s %s = %d, want %d (%s)", tc.name, tc.method, tc.path, w.Code, tc.want, w.Body)
+		}
+	}
+
+	// Lists stop at the organisation
+	var resp struct {
+		Users []users.User `json:"users"`
+	}
+	if err := json.Unmarshal(call(r, suncoSuper, "GET", "/users", "").Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range resp.Users {
+		if u.ID != suncoSuper.ID && u.ID != suncoCustomer.ID {
+			t.Errorf("%s listed to another organisation", u.Email)
+		}
+	}
+	if len(resp.Users) != 2 {
+		t.Errorf("listed %d accounts, want 2", len(resp.Users))
+	}
+	ian, err := users.GetUserByEmail("ian@brightway.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := authz.Lookup(ian.ID); s.OrgID != brightway.ID {
+		t.Errorf("new member in organisation %q", s.OrgID)
+	}
+
+	// An organisation admin outside any organisation reaches nobody else
+	loose := newAccount(t, "loose@test", "ORG_ADMIN", "", "", "")
+	if s, _ := authz.Lookup(loose.ID); s.Scope != authz.Own {
+		t.Errorf("org admin without an organisation has scope %s", s.Scope)
+	}
+
+	// Suspending an organisation withdraws its members' permissions
+	brightway.IsActive = false
+	if err := orgs.Update(brightway); err != nil {
+		t.Fatal(err)
+	}
+	if w := call(r, brightAdmin, "GET", dev, ""); w.Code != http.StatusForbidden {
+		t.Errorf("member of a suspended organisation: %d", w.Code)
+	}
+}
@@ -0,0 +1,154 @@
+package authz
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RoleRequest struct {
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Scope       Scope        `json:"scope" binding:"required"`
+	Permissions []Permission `json:"permissions"`
+}
+
+// @Summary List permissions
+// @Description Every permission a role can grant
+// @Tags Roles
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /superadmin/permissions [get]
+func ListPermissionsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"permissions": Permissions})
+}
+
+// @Summary List roles
+// @Description Built-in and custom roles with their scope and permissions
+// @Tags Roles
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 500 {object} map[string]string
+// @Security BearerAuth
+// @Router /superadmin/roles [get]
+func ListRolesHandler(c *gin.Context) {
+	roles, err := ListRoles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch roles"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"roles": roles})
+}
+
+// @Summary Create role
+// @Description Define a custom role. staff:manage and roles:manage stay with SUPER_ADMIN.
+// @Tags Roles
+// @Accept json
+// @Produce json
+// @Param role body RoleRequest true "Role"
+// @Success 201 {object} Role
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security BearerAuth
+// @Router /superadmin/roles [post]
+func CreateRoleHandler(c *gin.Context) {
+	var req RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	role := &Role{Name: req.Name, Description: req.Description, Scope: req.Scope, Permissions: req.Permissions}
+	if err := CreateRole(role); err != nil {
+		roleError(c, err)
+		return
+	}
+	log.Printf("🛡️ Role %s created by %s", role.Name, c.GetString("user_id"))
+	c.JSON(http.StatusCreated, role)
+}
+
+// @Summary Update role
+// @Description Replace the description, scope and permissions of a custom role. Holders are affected on their next request.
+// @Tags Roles
+// @Accept json
+// @Produce json
+// @Param name path string true "Role name"
+// @Param role body RoleRequest true "Role"
+// @Success 200 {object} Role
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /superadmin/roles/{name} [put]
+func UpdateRoleHandler(c *gin.Context) {
+	var req RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	role := &Role{Name: c.Param("name"), Description: req.Description, Scope: req.Scope, Permissions: req.Permissions}
+	if err := UpdateRole(role); err != nil {
+		roleError(c, err)
+		return
+	}
+	log.Printf("🛡️ Role %s updated by %s", role.Name, c.GetString("user_id"))
+	updated, err := GetRole(role.Name)
+	if err != nil {
+		roleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// @Summary Delete role
+// @Description Delete a custom role that no account holds
+// @Tags Roles
+// @Produce json
+// @Param name path string true "Role name"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security BearerAuth
+// @Router /superadmin/roles/{name} [delete]
+func DeleteRoleHandler(c *gin.Context) {
+	if err := DeleteRole(c.Param("name")); err != nil {
+		roleError(c, err)
+		return
+	}
+	log.Printf("🛡️ Role %s deleted by %s", c.Param("name"), c.GetString("user_id"))
+	c.JSON(http.StatusOK, gin.H{"message": "Role deleted"})
+}
+
+// @Summary My permissions
+// @Description The signed-in account's role, scope and permissions
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]string
+// @Security BearerAuth
+// @Router /auth/permissions [get]
+func MyPermissionsHandler(c *gin.Context) {
+	s, err := Caller(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"role": s.Role, "scope": s.Scope, "permissions": s.Permissions(), "org_id": s.OrgID})
+}
+
+func roleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrUnknownRole):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+	case errors.Is(err, ErrRoleExists), errors.Is(err, ErrRoleInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrBuiltInRole):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, errInvalidRole):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Role change failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save role"})
+	}
+}
@@ -0,0 +1,82 @@
+package authz
+
+// Permission is a capability a role grants
+type Permission string
+
+const (
+	PortalAccess        Permission = "portal:access"        // own profile, devices, energy, tickets and notifications
+	UsersRead           Permission = "users:read"           // customer accounts in scope
+	UsersWrite          Permission = "users:write"          // create, change and delete customer accounts in scope
+	UsersImpersonate    Permission = "users:impersonate"    // view the app as a customer in scope
+	StaffManage         Permission = "staff:manage"         // create and change staff accounts and their roles
+	DevicesRead         Permission = "devices:read"         // devices of others in scope
+	DevicesWrite        Permission = "devices:write"        // change and delete devices of others in scope
+	DevicesProvision    Permission = "devices:provision"    // register devices for customers
+	InstallationsManage Permission = "installations:manage" // installation jobs
+	TicketsWork         Permission = "tickets:work"         // work on assigned tickets
+	InventoryManage     Permission = "inventory:manage"     // change inventory items
+	AnalyticsRead       Permission = "analytics:read"       // statistics and energy queries in scope
+	AnalyticsGlobal     Permission = "analytics:global"     // system-wide statistics, trends and hierarchy
+	SubsidyRead         Permission = "subsidy:read"         // subsidy applications and reports
+	SubsidyApprove      Permission = "subsidy:approve"      // decide subsidy applications
+	PlantsManage        Permission = "plants:manage"        // solar plants
+	RegionsManage       Permission = "regions:manage"       // regions
+	ReportsExport       Permission = "reports:export"       // system-wide exports
+	SecurityManage      Permission = "security:manage"      // login lockouts
+	SystemConfig        Permission = "system:config"        // running configuration
+	AuditRead           Permission = "audit:read"           // audit log
+	RolesManage         Permission = "roles:manage"         // custom roles
+	OrgsManage          Permission = "orgs:manage"          // create and change organisations
+	OrgManage           Permission = "org:manage"           // members, branding and settings of one's own organisation
+)
+
+// Permissions lists every permission with what it allows
+var Permissions = []struct {
+	Name        Permission `json:"name"`
+	Description string     `json:"description"`
+}{
+	{PortalAccess, "Use the customer portal for one's own account"},
+	{UsersRead, "View customer accounts in scope"},
+	{UsersWrite, "Create, change and delete customer accounts in scope"},
+	{UsersImpersonate, "View the app as a customer in scope, read-only unless users:write is also held"},
+	{StaffManage, "Create and change staff accounts and assign roles"},
+	{DevicesRead, "View other accounts' devices in scope"},
+	{DevicesWrite, "Change and delete other accounts' devices in scope"},
+	{DevicesProvision, "Register devices for customers"},
+	{InstallationsManage, "View and complete installation jobs"},
+	{TicketsWork, "Work on support tickets assigned to the account"},
+	{InventoryManage, "Add, change and remove inventory items"},
+	{AnalyticsRead, "View statistics and energy data in scope"},
+	{AnalyticsGlobal, "View system-wide statistics, trends and hierarchy"},
+	{SubsidyRead, "View subsidy applications and reports"},
+	{SubsidyApprove, "Approve or reject subsidy applications"},
+	{PlantsManage, "Manage solar plants"},
+	{RegionsManage, "Manage regions"},
+	{ReportsExport, "Export system-wide reports"},
+	{SecurityManage, "View and clear login lockouts"},
+	{SystemConfig, "View the running configuration"},
+	{AuditRead, "Query, export and verify the audit log"},
+	{RolesManage, "Define custom roles"},
+	{OrgsManage, "Create and change organisations and move accounts between them"},
+	{OrgManage, "Manage the members, branding and settings of one's own organisation"},
+}
+
+// reserved permissions let an account raise its own privileges, so only the
+// built-in SUPER_ADMIN role holds them
+var reserved = map[Permission]bool{StaffManage: true, RolesManage: true, OrgsManage: true}
+
+// platform permissions act on the whole deployment, so accounts that belong
+// to an organisation never hold them, whatever their role
+var platform = map[Permission]bool{
+	StaffManage: true, RolesManage: true, OrgsManage: true, RegionsManage: true, SystemConfig: true,
+	SecurityManage: true, AuditRead: true, AnalyticsGlobal: true, ReportsExport: true,
+}
+
+func knownPermission(p Permission) bool {
+	for _, d := range Permissions {
+		if d.Name == p {
+			return true
+		}
+	}
+	return false
+}
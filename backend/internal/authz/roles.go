@@ -0,0 +1,264 @@
+package authz
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"sems-backend/internal/database"
+	"strings"
+	"time"
+)
+
+// Scope is how far a role reaches beyond the account's own resources
+type Scope string
+
+const (
+	Own    Scope = "own"
+	Scoped Scope = "scoped" // customers in the account's plant, else region, else admin_id
+	Global Scope = "global"
+)
+
+// Role is a named permission set
+type Role struct {
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Scope       Scope        `json:"scope"`
+	Permissions []Permission `json:"permissions"`
+	BuiltIn     bool         `json:"built_in"`
+	CreatedAt   *time.Time   `json:"created_at,omitempty"`
+	UpdatedAt   *time.Time   `json:"updated_at,omitempty"`
+}
+
+var (
+	ErrUnknownRole = errors.New("role does not exist")
+	ErrRoleExists  = errors.New("role already exists")
+	ErrRoleInUse   = errors.New("role is assigned to accounts")
+	ErrBuiltInRole = errors.New("built-in roles cannot be changed")
+	errInvalidRole = errors.New("invalid role")
+
+	roleName = regexp.MustCompile(`^[A-Z][A-Z0-9_]{1,31}$`)
+)
+
+var builtInRoles = []*Role{
+	{Name: "USER", Description: "Customer", Scope: Own, Permissions: []Permission{PortalAccess}},
+	{Name: "INSTALLER", Description: "Field installer", Scope: Own, Permissions: []Permission{
+		DevicesProvision, InstallationsManage, TicketsWork}},
+	{Name: "GOVT", Description: "Government officer", Scope: Own, Permissions: []Permission{
+		SubsidyRead, SubsidyApprove}},
+	{Name: "ADMIN", Description: "Plant or regional administrator", Scope: Scoped, Permissions: []Permission{
+		PortalAccess, UsersRead, UsersWrite, UsersImpersonate, DevicesRead, DevicesWrite, AnalyticsRead, InventoryManage}},
+	{Name: "ORG_ADMIN", Description: "Organisation administrator", Scope: Global, Permissions: []Permission{
+		PortalAccess, UsersRead, UsersWrite, DevicesRead, DevicesWrite, DevicesProvision, AnalyticsRead,
+		InventoryManage, PlantsManage, OrgManage}},
+	{Name: "SUPER_ADMIN", Description: "System administrator", Scope: Global},
+}
+
+func init() {
+	superAdmin := builtInRoles[len(builtInRoles)-1]
+	for _, p := range Permissions {
+		superAdmin.Permissions = append(superAdmin.Permissions, p.Name)
+	}
+	for _, r := range builtInRoles {
+		r.BuiltIn = true
+	}
+}
+
+func builtInRole(name string) *Role {
+	for _, r := range builtInRoles {
+		if r.Name == name {
+			return r
+		}
+	}
+	return nil
+}
+
+// Has reports whether the role grants p
+func (r *Role) Has(p Permission) bool {
+	for _, have := range r.Permissions {
+		if have == p {
+			return true
+		}
+	}
+	return false
+}
+
+// ForTenants reports whether the role grants no platform permission, so that
+// organisation admins may hand it to their members
+func (r *Role) ForTenants() bool {
+	for _, p := range r.Permissions {
+		if platform[p] {
+			return false
+		}
+	}
+	return true
+}
+
+// GetRole returns a built-in or custom role
+func GetRole(name string) (*Role, error) {
+	if r := builtInRole(name); r != nil {
+		return r, nil
+	}
+	r, err := scanRole(database.DB.QueryRow(`
+		SELECT name, description, scope, permissions, created_at, updated_at
+		FROM roles WHERE name = ?`, name))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUnknownRole
+	}
+	return r, err
+}
+
+// CheckRoles returns an error naming the first of names that is neither a
+// built-in nor a custom role. Without a database only built-in roles exist.
+func CheckRoles(names []string) error {
+	for _, name := range names {
+		if builtInRole(name) != nil {
+			continue
+		}
+		if database.DB == nil {
+			return fmt.Errorf("%q: %w", name, ErrUnknownRole)
+		}
+		if _, err := GetRole(name); err != nil {
+			return fmt.Errorf("%q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// ListRoles returns the built-in roles followed by custom roles by name
+func ListRoles() ([]*Role, error) {
+	roles := append([]*Role{}, builtInRoles...)
+	rows, err := database.DB.Query(`
+		SELECT name, description, scope, permissions, created_at, updated_at
+		FROM roles ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		r, err := scanRole(rows)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, r)
+	}
+	return roles, rows.Err()
+}
+
+// CreateRole stores a new custom role
+func CreateRole(r *Role) error {
+	if err := r.validate(); err != nil {
+		return err
+	}
+	if _, err := GetRole(r.Name); err == nil {
+		return ErrRoleExists
+	} else if !errors.Is(err, ErrUnknownRole) {
+		return err
+	}
+	now := time.Now().UTC()
+	r.CreatedAt, r.UpdatedAt = &now, &now
+	_, err := database.DB.Exec(`
+		INSERT INTO roles (name, description, scope, permissions, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		r.Name, r.Description, r.Scope, joinPermissions(r.Permissions), now, now)
+	return err
+}
+
+// UpdateRole replaces the description, scope and permissions of a custom role
+func UpdateRole(r *Role) error {
+	if builtInRole(r.Name) != nil {
+		return ErrBuiltInRole
+	}
+	if err := r.validate(); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	result, err := database.DB.Exec(`
+		UPDATE roles SET description = ?, scope = ?, permissions = ?, updated_at = ?
+		WHERE name = ?`,
+		r.Description, r.Scope, joinPermissions(r.Permissions), now, r.Name)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrUnknownRole
+	}
+	return nil
+}
+
+// DeleteRole removes a custom role no account holds
+func DeleteRole(name string) error {
+	if builtInRole(name) != nil {
+		return ErrBuiltInRole
+	}
+	var holders int
+	if err := database.DB.QueryRow(`SELECT COUNT(*) FROM users WHERE role = ?`, name).Scan(&holders); err != nil {
+		return err
+	}
+	if holders > 0 {
+		return ErrRoleInUse
+	}
+	result, err := database.DB.Exec(`DELETE FROM roles WHERE name = ?`, name)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrUnknownRole
+	}
+	return nil
+}
+
+func (r *Role) validate() error {
+	if !roleName.MatchString(r.Name) {
+		return fmt.Errorf("%w: name must be 2-32 upper-case letters, digits or underscores", errInvalidRole)
+	}
+	switch r.Scope {
+	case Own, Scoped, Global:
+	default:
+		return fmt.Errorf("%w: scope must be own, scoped or global", errInvalidRole)
+	}
+	seen := map[Permission]bool{}
+	perms := []Permission{}
+	for _, p := range r.Permissions {
+		if !knownPermission(p) {
+			return fmt.Errorf("%w: unknown permission %q", errInvalidRole, p)
+		}
+		if reserved[p] {
+			return fmt.Errorf("%w: %s is reserved to SUPER_ADMIN", errInvalidRole, p)
+		}
+		if !seen[p] {
+			seen[p] = true
+			perms = append(perms, p)
+		}
+	}
+	r.Permissions = perms
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRole(row rowScanner) (*Role, error) {
+	r := &Role{Permissions: []Permission{}}
+	var perms string
+	var created, updated time.Time
+	if err := row.Scan(&r.Name, &r.Description, &r.Scope, &perms, &created, &updated); err != nil {
+		return nil, err
+	}
+	for _, p := range strings.Split(perms, ",") {
+		if p != "" {
+			r.Permissions = append(r.Permissions, Permission(p))
+		}
+	}
+	r.CreatedAt, r.UpdatedAt = &created, &updated
+	return r, nil
+}
+
+func joinPermissions(perms []Permission) string {
+	s := make([]string, len(perms))
+	for i, p := range perms {
+		s[i] = string(p)
+	}
+	return strings.Join(s, ",")
+}
@@ -0,0 +1,605 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultPath is read when SEMS_CONFIG is not set; a missing file is not an error
+const DefaultPath = "config.json"
+
+// insecureDefaultSecret is what the service shipped with; production refuses it
+const insecureDefaultSecret = "SEMS_SECRET"
+
+// Config is the full runtime configuration. Values come from built-in defaults,
+// then the JSON config file, then environment variables.
+type Config struct {
+	Environment string          `json:"environment"` // development or production
+	Server      ServerConfig    `json:"server"`
+	Database    DatabaseConfig  `json:"database"`
+	Auth        AuthConfig      `json:"auth"`
+	OIDC        OIDCConfig      `json:"oidc"`
+	AI          AIConfig        `json:"ai"`
+	Workers     WorkersConfig   `json:"workers"`
+	Devices     DevicesConfig   `json:"devices"`
+	RateLimit   RateLimitConfig `json:"rate_limit"`
+	Energy      EnergyConfig    `json:"energy"`
+	Metrics     MetricsConfig   `json:"metrics"`
+	Email       EmailConfig     `json:"email"`
+	Weather     WeatherConfig   `json:"weather"`
+}
+
+type ServerConfig struct {
+	Port            int      `json:"port"`
+	CORSOrigins     []string `json:"cors_origins"`
+	ShutdownTimeout Duration `json:"shutdown_timeout"`
+	DrainDelay      Duration `json:"drain_delay"`     // how long readiness fails before connections close on shutdown
+	TrustedProxies  []string `json:"trusted_proxies"` // addresses or CIDRs allowed to set X-Forwarded-For
+}
+
+type DatabaseConfig struct {
+	Driver       string `json:"driver"` // sqlite or postgres
+	Path         string `json:"path"`   // SQLite file
+	URL          string `json:"url"`    // PostgreSQL connection string
+	MaxOpenConns int    `json:"max_open_conns"`
+}
+
+type AuthConfig struct {
+	JWTSecret        string   `json:"jwt_secret"`        // seals the signing keys stored in the database
+	SigningAlgorithm string   `json:"signing_algorithm"` // RS256, EdDSA or HS256
+	KeyRotation      Duration `json:"key_rotation"`      // how long a key signs new tokens
+	KeyOverlap       Duration `json:"key_overlap"`       // how long a retired key still verifies
+	TokenTTL         Duration `json:"token_ttl"`         // access token lifetime
+	RefreshTTL       Duration `json:"refresh_ttl"`       // session lifetime without a refresh
+
+	AppURL            string   `json:"app_url"`            // web app base URL for links in emails
+	UnverifiedLogin   string   `json:"unverified_login"`   // allow, grace or deny
+	VerificationGrace Duration `json:"verification_grace"` // how long "grace" lets new accounts in unverified
+
+	Require2FARoles []string `json:"require_2fa_roles"` // roles that must sign in with a second factor
+
+	MaxLoginFailures int      `json:"max_login_failures"` // failed logins before an account is locked
+	MaxIPFailures    int      `json:"max_ip_failures"`    // failed logins before an address is locked
+	LockoutDuration  Duration `json:"lockout_duration"`   // how long a lockout lasts
+
+	ImpersonationTTL Duration `json:"impersonation_ttl"` // how long an admin may view the app as a customer
+}
+
+// OIDCConfig lists identity providers staff can sign in with
+type OIDCConfig struct {
+	APIURL    string         `json:"api_url"` // public base URL of this API, for redirect URIs
+	Providers []OIDCProvider `json:"providers"`
+}
+
+type OIDCProvider struct {
+	Name         string            `json:"name"` // URL slug, e.g. "gov"
+	DisplayName  string            `json:"display_name"`
+	Issuer       string            `json:"issuer"` // discovery document is read from here
+	ClientID     string            `json:"client_id"`
+	ClientSecret string            `json:"client_secret"` // or SEMS_OIDC_<NAME>_CLIENT_SECRET
+	Scopes       []string          `json:"scopes"`
+	RoleClaim    string            `json:"role_claim"`   // claim holding the user's groups or roles
+	RoleMapping  map[string]string `json:"role_mapping"` // claim value to GOVT, INSTALLER or ADMIN
+	DefaultRole  string            `json:"default_role"` // for users no mapping matches; empty refuses them
+}
+
+// SSORoles are the roles identity providers may grant
+var SSORoles = []string{"ADMIN", "GOVT", "INSTALLER"}
+
+type AIConfig struct {
+	URL string `json:"url"`
+}
+
+type WorkersConfig struct {
+	AnomalyInterval Duration `json:"anomaly_interval"`
+}
+
+type DevicesConfig struct {
+	KeyOverlap Duration `json:"key_overlap"`  // how long a replaced API key keeps working after rotation
+	KeyMaxIdle Duration `json:"key_max_idle"` // API keys unused this long expire; 0 keeps them
+
+	SignatureSkew Duration `json:"signature_skew"` // how far a signed request's timestamp may be from server time
+	DemoIngestion bool     `json:"demo_ingestion"` // accept sim_ and demo_ keys for the demo device
+}
+
+// RateLimitConfig throttles requests with token buckets. Routes pick a policy
+// by "METHOD /path", "/path" or a "/prefix/*" pattern, the most specific
+// match first; unlisted routes use the default policy.
+type RateLimitConfig struct {
+	Enabled  bool                       `json:"enabled"`
+	Policies map[string]RateLimitPolicy `json:"policies"`
+	Routes   map[string]string          `json:"routes"`  // route pattern to policy name
+	Default  string                     `json:"default"` // policy for other routes; empty leaves them unlimited
+}
+
+type RateLimitPolicy struct {
+	Requests int      `json:"requests"` // sustained requests per period
+	Per      Duration `json:"per"`
+	Burst    int      `json:"burst"` // requests allowed at once after a quiet spell
+	Key      string   `json:"key"`   // device, ip or user
+}
+
+// RateLimitKeys are what a policy can count requests by
+var RateLimitKeys = []string{"device", "ip", "user"}
+
+type EnergyConfig struct {
+	DefaultTariff   float64 `json:"default_tariff"`    // currency per kWh when a user has none
+	CO2FactorKgKWh  float64 `json:"co2_factor_kg_kwh"` // grid emission avoided per kWh generated
+	DefaultTimezone string  `json:"default_timezone"`
+}
+
+type MetricsConfig struct {
+	Token        string `json:"token"`
+	AllowPrivate bool   `json:"allow_private"`
+}
+
+type EmailConfig struct {
+	SMTPHost     string `json:"smtp_host"`
+	SMTPPort     string `json:"smtp_port"`
+	SMTPUsername string `json:"smtp_username"`
+	SMTPPassword string `json:"smtp_password"`
+	FromEmail    string `json:"from_email"`
+	FromName     string `json:"from_name"`
+}
+
+type WeatherConfig struct {
+	APIKey string `json:"api_key"`
+}
+
+// Duration is a time.Duration written as "15m", "30s" in config files
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"15m\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// Default returns the values the service used before configuration existed
+func Default() *Config {
+	return &Config{
+		Environment: "development",
+		Server: ServerConfig{
+			Port:            8080,
+			CORSOrigins:     []string{"http://localhost:5173", "http://127.0.0.1:5173"},
+			ShutdownTimeout: Duration{30 * time.Second},
+			DrainDelay:      Duration{5 * time.Second},
+			TrustedProxies:  []string{"127.0.0.1", "::1"},
+		},
+		Database: DatabaseConfig{Driver: "sqlite", Path: "./sems.db", MaxOpenConns: 25},
+		Auth: AuthConfig{
+			JWTSecret:        insecureDefaultSecret,
+			SigningAlgorithm: "RS256",
+			KeyRotation:      Duration{30 * 24 * time.Hour},
+			KeyOverlap:       Duration{24 * time.Hour},
+			TokenTTL:         Duration{15 * time.Minute},
+			RefreshTTL:       Duration{30 * 24 * time.Hour},
+
+			AppURL:            "http://localhost:5173",
+			UnverifiedLogin:   "allow",
+			VerificationGrace: Duration{72 * time.Hour},
+
+			MaxLoginFailures: 10,
+			MaxIPFailures:    50,
+			LockoutDuration:  Duration{15 * time.Minute},
+
+			ImpersonationTTL: Duration{30 * time.Minute},
+		},
+		OIDC:    OIDCConfig{APIURL: "http://localhost:8080"},
+		AI:      AIConfig{URL: "http://localhost:5000"},
+		Workers: WorkersConfig{AnomalyInterval: Duration{15 * time.Minute}},
+		Devices: DevicesConfig{
+			KeyOverlap:    Duration{24 * time.Hour},
+			KeyMaxIdle:    Duration{90 * 24 * time.Hour},
+			SignatureSkew: Duration{5 * time.Minute},
+		},
+		RateLimit: RateLimitConfig{
+			Enabled: true,
+			Policies: map[string]RateLimitPolicy{
+				"ingest": {Requests: 120, Per: Duration{time.Minute}, Burst: 30, Key: "device"},
+				"auth":   {Requests: 60, Per: Duration{time.Minute}, Burst: 20, Key: "ip"},
+				"public": {Requests: 60, Per: Duration{time.Minute}, Burst: 30, Key: "ip"},
+				"api":    {Requests: 600, Per: Duration{time.Minute}, Burst: 120, Key: "user"},
+			},
+			Routes: map[string]string{
+				"POST /iot/data": "ingest",
+				"/auth/*":        "auth",
+				"/public/*":      "public",
+			},
+			Default: "api",
+		},
+		Energy: EnergyConfig{
+			DefaultTariff:   8.0,
+			CO2FactorKgKWh:  0.7,
+			DefaultTimezone: "Asia/Kolkata",
+		},
+		Metrics: MetricsConfig{AllowPrivate: true},
+		Email: EmailConfig{
+			SMTPHost:  "smtp.gmail.com",
+			SMTPPort:  "587",
+			FromEmail: "noreply@solarenergy.com",
+			FromName:  "Solar Energy Management System",
+		},
+	}
+}
+
+// Load builds the configuration from defaults, the file at SEMS_CONFIG (or
+// config.json) and environment overrides, then validates it.
+func Load() (*Config, error) {
+	cfg := Default()
+
+	path := os.Getenv("SEMS_CONFIG")
+	explicit := path != ""
+	if !explicit {
+		path = DefaultPath
+	}
+	if err := cfg.loadFile(path, explicit); err != nil {
+		return nil, err
+	}
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string, required bool) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read config %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("parse config %s: %w", path, err)
+	}
+	log.Printf("⚙️  Loaded configuration from %s", path)
+	return nil
+}
+
+// applyEnv overrides file values. SMTP_* and OPENWEATHER_API_KEY keep the names
+// deployments already use.
+func (c *Config) applyEnv() error {
+	var errs []error
+	setString := func(key string, dst *string) {
+		if v := os.Getenv(key); v != "" {
+			*dst = v
+		}
+	}
+	setInt := func(key string, dst *int) {
+		if v := os.Getenv(key); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+				return
+			}
+			*dst = n
+		}
+	}
+	setFloat := func(key string, dst *float64) {
+		if v := os.Getenv(key); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+				return
+			}
+			*dst = f
+		}
+	}
+	setBool := func(key string, dst *bool) {
+		if v := os.Getenv(key); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+				return
+			}
+			*dst = b
+		}
+	}
+	setDuration := func(key string, dst *Duration) {
+		if v := os.Getenv(key); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+				return
+			}
+			dst.Duration = d
+		}
+	}
+
+	setString("SEMS_ENV", &c.Environment)
+	setInt("SEMS_PORT", &c.Server.Port)
+	if v := os.Getenv("SEMS_CORS_ORIGINS"); v != "" {
+		c.Server.CORSOrigins = splitList(v)
+	}
+	setDuration("SEMS_SHUTDOWN_TIMEOUT", &c.Server.ShutdownTimeout)
+	setDuration("SEMS_DRAIN_DELAY", &c.Server.DrainDelay)
+	if v := os.Getenv("SEMS_TRUSTED_PROXIES"); v != "" {
+		c.Server.TrustedProxies = splitList(v)
+	}
+	setString("SEMS_DB_DRIVER", &c.Database.Driver)
+	setString("SEMS_DB_PATH", &c.Database.Path)
+	setString("SEMS_DB_URL", &c.Database.URL)
+	setInt("SEMS_DB_MAX_OPEN_CONNS", &c.Database.MaxOpenConns)
+	setString("SEMS_JWT_SECRET", &c.Auth.JWTSecret)
+	setString("SEMS_JWT_ALGORITHM", &c.Auth.SigningAlgorithm)
+	setDuration("SEMS_KEY_ROTATION", &c.Auth.KeyRotation)
+	setDuration("SEMS_KEY_OVERLAP", &c.Auth.KeyOverlap)
+	setDuration("SEMS_TOKEN_TTL", &c.Auth.TokenTTL)
+	setDuration("SEMS_REFRESH_TTL", &c.Auth.RefreshTTL)
+	setString("SEMS_APP_URL", &c.Auth.AppURL)
+	setString("SEMS_UNVERIFIED_LOGIN", &c.Auth.UnverifiedLogin)
+	setDuration("SEMS_VERIFICATION_GRACE", &c.Auth.VerificationGrace)
+	if v := os.Getenv("SEMS_REQUIRE_2FA_ROLES"); v != "" {
+		c.Auth.Require2FARoles = splitList(v)
+	}
+	setInt("SEMS_MAX_LOGIN_FAILURES", &c.Auth.MaxLoginFailures)
+	setInt("SEMS_MAX_IP_FAILURES", &c.Auth.MaxIPFailures)
+	setDuration("SEMS_LOCKOUT_DURATION", &c.Auth.LockoutDuration)
+	setDuration("SEMS_IMPERSONATION_TTL", &c.Auth.ImpersonationTTL)
+	setString("SEMS_OIDC_API_URL", &c.OIDC.APIURL)
+	for i := range c.OIDC.Providers {
+		p := &c.OIDC.Providers[i]
+		setString("SEMS_OIDC_"+strings.ToUpper(strings.ReplaceAll(p.Name, "-", "_"))+"_CLIENT_SECRET", &p.ClientSecret)
+	}
+	setString("SEMS_AI_URL", &c.AI.URL)
+	setDuration("SEMS_ANOMALY_INTERVAL", &c.Workers.AnomalyInterval)
+	setDuration("SEMS_DEVICE_KEY_OVERLAP", &c.Devices.KeyOverlap)
+	setDuration("SEMS_DEVICE_KEY_MAX_IDLE", &c.Devices.KeyMaxIdle)
+	setDuration("SEMS_DEVICE_SIGNATURE_SKEW", &c.Devices.SignatureSkew)
+	setBool("SEMS_DEVICE_DEMO_INGESTION", &c.Devices.DemoIngestion)
+	setBool("SEMS_RATE_LIMIT_ENABLED", &c.RateLimit.Enabled)
+	setFloat("SEMS_DEFAULT_TARIFF", &c.Energy.DefaultTariff)
+	setFloat("SEMS_CO2_FACTOR", &c.Energy.CO2FactorKgKWh)
+	setString("SEMS_DEFAULT_TIMEZONE", &c.Energy.DefaultTimezone)
+	setString("SEMS_METRICS_TOKEN", &c.Metrics.Token)
+	setBool("SEMS_METRICS_ALLOW_PRIVATE", &c.Metrics.AllowPrivate)
+	setString("SMTP_HOST", &c.Email.SMTPHost)
+	setString("SMTP_PORT", &c.Email.SMTPPort)
+	setString("SMTP_USERNAME", &c.Email.SMTPUsername)
+	setString("SMTP_PASSWORD", &c.Email.SMTPPassword)
+	setString("FROM_EMAIL", &c.Email.FromEmail)
+	setString("FROM_NAME", &c.Email.FromName)
+	setString("OPENWEATHER_API_KEY", &c.Weather.APIKey)
+
+	return errors.Join(errs...)
+}
+
+// Validate rejects configurations the service cannot run with
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Environment != "development" && c.Environment != "production" {
+		errs = append(errs, fmt.Errorf("environment must be development or production, got %q", c.Environment))
+	}
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		errs = append(errs, fmt.Errorf("server.port %d out of range", c.Server.Port))
+	}
+	if c.Server.ShutdownTimeout.Duration <= 0 {
+		errs = append(errs, errors.New("server.shutdown_timeout must be positive"))
+	}
+	if c.Server.DrainDelay.Duration < 0 {
+		errs = append(errs, errors.New("server.drain_delay must not be negative"))
+	}
+	switch c.Database.Driver {
+	case "sqlite":
+		if c.Database.Path == "" {
+			errs = append(errs, errors.New("database.path is required for sqlite"))
+		}
+	case "postgres":
+		if c.Database.URL == "" {
+			errs = append(errs, errors.New("database.url is required for postgres"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("database.driver must be sqlite or postgres, got %q", c.Database.Driver))
+	}
+	if c.Database.MaxOpenConns < 1 {
+		errs = append(errs, errors.New("database.max_open_conns must be at least 1"))
+	}
+	if c.Auth.JWTSecret == "" {
+		errs = append(errs, errors.New("auth.jwt_secret is required"))
+	}
+	if c.IsProduction() && (c.Auth.JWTSecret == insecureDefaultSecret || len(c.Auth.JWTSecret) < 32) {
+		errs = append(errs, errors.New("auth.jwt_secret must be a random value of at least 32 characters in production"))
+	}
+	if c.IsProduction() && c.Metrics.Token == "" {
+		errs = append(errs, errors.New("metrics.token is required in production"))
+	}
+	if c.Auth.TokenTTL.Duration <= 0 {
+		errs = append(errs, errors.New("auth.token_ttl must be positive"))
+	}
+	switch c.Auth.SigningAlgorithm {
+	case "RS256", "EdDSA", "HS256":
+	default:
+		errs = append(errs, fmt.Errorf("auth.signing_algorithm must be RS256, EdDSA or HS256, got %q", c.Auth.SigningAlgorithm))
+	}
+	if c.Auth.KeyRotation.Duration < time.Hour {
+		errs = append(errs, errors.New("auth.key_rotation must be at least 1h"))
+	}
+	if c.Auth.KeyOverlap.Duration < c.Auth.TokenTTL.Duration {
+		errs = append(errs, errors.New("auth.key_overlap must be at least auth.token_ttl so issued tokens stay verifiable"))
+	}
+	if c.Auth.RefreshTTL.Duration <= c.Auth.TokenTTL.Duration {
+		errs = append(errs, errors.New("auth.refresh_ttl must be longer than auth.token_ttl"))
+	}
+	if !strings.HasPrefix(c.Auth.AppURL, "http://") && !strings.HasPrefix(c.Auth.AppURL, "https://") {
+		errs = append(errs, fmt.Errorf("auth.app_url %q must be an http(s) URL", c.Auth.AppURL))
+	}
+	switch c.Auth.UnverifiedLogin {
+	case "allow", "deny":
+	case "grace":
+		if c.Auth.VerificationGrace.Duration <= 0 {
+			errs = append(errs, errors.New("auth.verification_grace must be positive with unverified_login \"grace\""))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("auth.unverified_login must be allow, grace or deny, got %q", c.Auth.UnverifiedLogin))
+	}
+	if c.Auth.MaxLoginFailures < 1 || c.Auth.MaxIPFailures < 1 {
+		errs = append(errs, errors.New("auth.max_login_failures and auth.max_ip_failures must be at least 1"))
+	}
+	if c.Auth.LockoutDuration.Duration < time.Minute {
+		errs = append(errs, errors.New("auth.lockout_duration must be at least 1m"))
+	}
+	if c.Auth.ImpersonationTTL.Duration < time.Minute || c.Auth.ImpersonationTTL.Duration > 4*time.Hour {
+		errs = append(errs, errors.New("auth.impersonation_ttl must be between 1m and 4h"))
+	}
+	errs = append(errs, c.OIDC.validate()...)
+	errs = append(errs, c.RateLimit.validate()...)
+	if !strings.HasPrefix(c.AI.URL, "http://") && !strings.HasPrefix(c.AI.URL, "https://") {
+		errs = append(errs, fmt.Errorf("ai.url %q must be an http(s) URL", c.AI.URL))
+	}
+	if c.Workers.AnomalyInterval.Duration < time.Minute {
+		errs = append(errs, errors.New("workers.anomaly_interval must be at least 1m"))
+	}
+	if c.Devices.KeyOverlap.Duration < 0 {
+		errs = append(errs, errors.New("devices.key_overlap cannot be negative"))
+	}
+	if c.Devices.KeyMaxIdle.Duration != 0 && c.Devices.KeyMaxIdle.Duration < 24*time.Hour {
+		errs = append(errs, errors.New("devices.key_max_idle must be 0 or at least 24h"))
+	}
+	if c.Devices.SignatureSkew.Duration < 30*time.Second || c.Devices.SignatureSkew.Duration > time.Hour {
+		errs = append(errs, errors.New("devices.signature_skew must be between 30s and 1h"))
+	}
+	if c.Devices.DemoIngestion && c.Environment == "production" {
+		errs = append(errs, errors.New("devices.demo_ingestion cannot be enabled in production"))
+	}
+	if c.Energy.DefaultTariff < 0 {
+		errs = append(errs, errors.New("energy.default_tariff cannot be negative"))
+	}
+	if c.Energy.CO2FactorKgKWh < 0 {
+		errs = append(errs, errors.New("energy.co2_factor_kg_kwh cannot be negative"))
+	}
+	if _, err := time.LoadLocation(c.Energy.DefaultTimezone); err != nil {
+		errs = append(errs, fmt.Errorf("energy.default_timezone: %w", err))
+	}
+
+	if len(errs) == 0 && c.Auth.JWTSecret == insecureDefaultSecret {
+		log.Println("⚠️  Using the built-in JWT secret; set SEMS_JWT_SECRET before deploying")
+	}
+	return errors.Join(errs...)
+}
+
+func (r *RateLimitConfig) validate() []error {
+	var errs []error
+	for name, p := range r.Policies {
+		if p.Requests < 1 || p.Burst < 1 || p.Per.Duration < time.Second {
+			errs = append(errs, fmt.Errorf("rate_limit policy %s: requests and burst must be at least 1 and per at least 1s", name))
+		}
+		if !isRateLimitKey(p.Key) {
+			errs = append(errs, fmt.Errorf("rate_limit policy %s: key %q must be one of %s", name, p.Key, strings.Join(RateLimitKeys, ", ")))
+		}
+	}
+	for route, policy := range r.Routes {
+		if _, ok := r.Policies[policy]; !ok {
+			errs = append(errs, fmt.Errorf("rate_limit route %q uses unknown policy %q", route, policy))
+		}
+	}
+	if _, ok := r.Policies[r.Default]; r.Default != "" && !ok {
+		errs = append(errs, fmt.Errorf("rate_limit default policy %q is not defined", r.Default))
+	}
+	return errs
+}
+
+func isRateLimitKey(key string) bool {
+	for _, k := range RateLimitKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *OIDCConfig) validate() []error {
+	var errs []error
+	if len(o.Providers) > 0 && !strings.HasPrefix(o.APIURL, "http://") && !strings.HasPrefix(o.APIURL, "https://") {
+		errs = append(errs, fmt.Errorf("oidc.api_url %q must be an http(s) URL", o.APIURL))
+	}
+	seen := map[string]bool{}
+	for _, p := range o.Providers {
+		if !validSlug(p.Name) || seen[p.Name] {
+			errs = append(errs, fmt.Errorf("oidc provider name %q must be a unique lowercase slug", p.Name))
+		}
+		seen[p.Name] = true
+		if !strings.HasPrefix(p.Issuer, "http://") && !strings.HasPrefix(p.Issuer, "https://") {
+			errs = append(errs, fmt.Errorf("oidc provider %s: issuer %q must be an http(s) URL", p.Name, p.Issuer))
+		}
+		if p.ClientID == "" {
+			errs = append(errs, fmt.Errorf("oidc provider %s: client_id is required", p.Name))
+		}
+		for value, role := range p.RoleMapping {
+			if !isSSORole(role) {
+				errs = append(errs, fmt.Errorf("oidc provider %s: role_mapping %q maps to %q; allowed roles are %s", p.Name, value, role, strings.Join(SSORoles, ", ")))
+			}
+		}
+		if p.DefaultRole != "" && !isSSORole(p.DefaultRole) {
+			errs = append(errs, fmt.Errorf("oidc provider %s: default_role %q is not one of %s", p.Name, p.DefaultRole, strings.Join(SSORoles, ", ")))
+		}
+		if len(p.RoleMapping) == 0 && p.DefaultRole == "" {
+			errs = append(errs, fmt.Errorf("oidc provider %s: role_mapping or default_role is required", p.Name))
+		}
+	}
+	return errs
+}
+
+func isSSORole(role string) bool {
+	for _, r := range SSORoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func validSlug(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// IsProduction reports whether production safety checks apply
+func (c *Config) IsProduction() bool {
+	return c.Environment == "production"
+}
+
+// Addr is the listen address for the HTTP server
+func (c *Config) Addr() string {
+	return fmt.Sprintf(":%d", c.Server.Port)
+}
+
+func splitList(raw string) []string {
+	var out []string
+	for _, part := range strings.Split(raw, ",") {
+		if p := strings.TrimSpace(part); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadAppliesFileThenEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sems.json")
+	file := `{"server": {"port": 9090}, "workers": {"anomaly_interval": "5m"}, "energy": {"default_tariff": 6.5}}`
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SEMS_CONFIG", path)
+	t.Setenv("SEMS_DEFAULT_TARIFF", "7.25")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Server.Port != 9090 {
+		t.Errorf("port = %d, want 9090 from file", cfg.Server.Port)
+	}
+	if cfg.Workers.AnomalyInterval.Duration != 5*time.Minute {
+		t.Errorf("anomaly interval = %s, want 5m", cfg.Workers.AnomalyInterval)
+	}
+	if cfg.Energy.DefaultTariff != 7.25 {
+		t.Errorf("tariff = %v, want env override 7.25", cfg.Energy.DefaultTariff)
+	}
+	if cfg.Energy.CO2FactorKgKWh != 0.7 {
+		t.Errorf("CO2 factor = %v, want default 0.7", cfg.Energy.CO2FactorKgKWh)
+	}
+}
+
+func TestProductionRejectsDefaultSecret(t *testing.T) {
+	cfg := Default()
+	cfg.Environment = "production"
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected production config with built-in JWT secret to be rejected")
+	}
+
+	cfg.Auth.JWTSecret = "a-sufficiently-long-random-secret-value"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "metrics.token") {
+		t.Fatalf("expected production config without a metrics token to be rejected, got %v", err)
+	}
+
+	cfg.Metrics.Token = "scraper-token"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestRedactedMasksSecrets(t *testing.T) {
+	cfg := Default()
+	cfg.Email.SMTPPassword = "hunter2"
+
+	out := cfg.Redacted()
+	if out.Auth.JWTSecret != redactedValue || out.Email.SMTPPassword != redactedValue {
+		t.Errorf("secrets not redacted: %+v", out)
+	}
+	if out.Weather.APIKey != "" {
+		t.Error("unset secrets should stay empty")
+	}
+	if cfg.Auth.JWTSecret == redactedValue {
+		t.Error("Redacted must not modify the running config")
+	}
+}
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const redactedValue = "[REDACTED]"
+
+// Redacted returns a copy safe to show operators: secrets are masked, but an
+// empty secret stays empty so a missing value is still visible.
+func (c *Config) Redacted() Config {
+	out := *c
+	out.Server.CORSOrigins = append([]string(nil), c.Server.CORSOrigins...)
+	out.OIDC.Providers = append([]OIDCProvider(nil), c.OIDC.Providers...)
+	for i := range out.OIDC.Providers {
+		if out.OIDC.Providers[i].ClientSecret != "" {
+			out.OIDC.Providers[i].ClientSecret = redactedValue
+		}
+	}
+	for _, secret := range []*string{
+		&out.Auth.JWTSecret,
+		&out.Metrics.Token,
+		&out.Email.SMTPPassword,
+		&out.Weather.APIKey,
+		&out.Database.URL,
+	} {
+		if *secret != "" {
+			*secret = redactedValue
+		}
+	}
+	return out
+}
+
+// Handler serves the running configuration with secrets redacted
+// @Summary Get running configuration
+// @Description Returns the effective configuration with secrets redacted
+// @Tags SuperAdmin
+// @Produce json
+// @Success 200 {object} Config
+// @Security BearerAuth
+// @Router /superadmin/config [get]
+func Handler(cfg *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, cfg.Redacted())
+	}
+}
@@ -1,10 +1,12 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
-	"os"
+	"sems-backend/internal/config"
+	"sems-backend/internal/metrics"
 	"time"
 
 	_ "github.com/lib/pq"
@@ -13,31 +15,42 @@ import (
 
 var DB *sql.DB
 
-// InitDB initializes the SQLite database connection
-func InitDB() error {
-	connStr := "./sems.db"
+// InitDB opens the configured database (SQLite by default, or PostgreSQL)
+func InitDB(cfg config.DatabaseConfig) error {
+	dialect, err := DialectFor(cfg.Driver)
+	if err != nil {
+		return err
+	}
+
+	connStr := cfg.URL
+	if dialect.Name() == "sqlite" {
+		// _time_format=sqlite writes time.Time values in a layout SQLite's date
+		// functions understand, so strftime bucketing works on stored timestamps
+		connStr = cfg.Path + "?_time_format=sqlite"
+	}
 
-	var err error
-	DB, err = sql.Open("sqlite", connStr)
+	DB, err = sql.Open(instrumentedDriverName(dialect), connStr)
 	if err != nil {
 		return fmt.Errorf("failed to open database: %w", err)
 	}
+	Current = dialect
 
-	// Optimize connection pool for SQLite
-	// Increased to 25 to allow concurrent reads/writes in WAL mode
-	DB.SetMaxOpenConns(25)
-	DB.SetMaxIdleConns(25)
+	// Sized for concurrent reads/writes (WAL mode on SQLite)
+	DB.SetMaxOpenConns(cfg.MaxOpenConns)
+	DB.SetMaxIdleConns(cfg.MaxOpenConns)
 	DB.SetConnMaxLifetime(time.Hour)
 
-	// Enable WAL mode and Busy Timeout
-	// This helps prevent "database is locked" errors
-	_, err = DB.Exec("PRAGMA journal_mode=WAL;")
-	if err != nil {
-		return fmt.Errorf("failed to set WAL mode: %w", err)
-	}
-	_, err = DB.Exec("PRAGMA busy_timeout=5000;")
-	if err != nil {
-		return fmt.Errorf("failed to set busy timeout: %w", err)
+	if dialect.Name() == "sqlite" {
+		// Enable WAL mode and Busy Timeout
+		// This helps prevent "database is locked" errors
+		_, err = DB.Exec("PRAGMA journal_mode=WAL;")
+		if err != nil {
+			return fmt.Errorf("failed to set WAL mode: %w", err)
+		}
+		_, err = DB.Exec("PRAGMA busy_timeout=5000;")
+		if err != nil {
+			return fmt.Errorf("failed to set busy timeout: %w", err)
+		}
 	}
 
 	// Test the connection
@@ -45,10 +58,20 @@ func InitDB() error {
 		return fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	log.Println("✅ Database connection established (WAL mode & Busy Timeout optimized)")
+	metrics.RegisterDB(DB, "sems")
+
+	log.Printf("✅ Database connection established (%s)", dialect.Name())
 	return nil
 }
 
+// Ping is a readiness check for the database connection
+func Ping(ctx context.Context) error {
+	if DB == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	return DB.PingContext(ctx)
+}
+
 // CloseDB closes the database connection
 func CloseDB() {
 	if DB != nil {
@@ -56,11 +79,3 @@ func CloseDB() {
 		log.Println("Database connection closed")
 	}
 }
-
-// getEnv gets an environment variable or returns a default value
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	return defaultValue
-}
@@ -0,0 +1,156 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Dialect hides the SQL differences between SQLite and PostgreSQL. Repositories
+// keep writing "?" placeholders; Rebind is applied by the driver wrapper.
+type Dialect interface {
+	// Name is "sqlite" or "postgres"
+	Name() string
+	// Rebind converts "?" placeholders to the dialect's style
+	Rebind(query string) string
+	// UnixEpoch is column as integer seconds since the epoch
+	UnixEpoch(column string) string
+	// LocalDate formats column, shifted by offsetSeconds, as YYYY-MM-DD ("day") or YYYY-MM ("month")
+	LocalDate(column, unit string, offsetSeconds int) string
+	// Time wraps a timestamp column or placeholder so comparisons are chronological
+	Time(expr string) string
+	// TableExistsQuery returns a query yielding one row if the table exists
+	TableExistsQuery() string
+}
+
+// Current is the dialect of DB; set by InitDB
+var Current Dialect = SQLite{}
+
+// DialectFor returns the dialect for a configured driver name
+func DialectFor(driver string) (Dialect, error) {
+	switch driver {
+	case "", "sqlite":
+		return SQLite{}, nil
+	case "postgres":
+		return Postgres{}, nil
+	}
+	return nil, fmt.Errorf("unsupported database driver %q", driver)
+}
+
+// EpochBucket truncates column to buckets of sizeSeconds aligned to a zone with
+// the given UTC offset; the result is the bucket start in unix seconds.
+func EpochBucket(d Dialect, column string, sizeSeconds int64, offsetSeconds int) string {
+	return fmt.Sprintf("((%s + %d) / %d) * %d - %d",
+		d.UnixEpoch(column), offsetSeconds, sizeSeconds, sizeSeconds, offsetSeconds)
+}
+
+// SQLite is the embedded default
+type SQLite struct{}
+
+func (SQLite) Name() string { return "sqlite" }
+
+func (SQLite) Rebind(query string) string { return query }
+
+func (SQLite) UnixEpoch(column string) string {
+	return "CAST(strftime('%s', " + column + ") AS INTEGER)"
+}
+
+func (SQLite) LocalDate(column, unit string, offsetSeconds int) string {
+	layout := "%Y-%m-%d"
+	if unit == "month" {
+		layout = "%Y-%m"
+	}
+	return fmt.Sprintf("strftime('%s', %s, '%+d seconds')", layout, column, offsetSeconds)
+}
+
+// Time uses julianday so stored values with different UTC offsets compare correctly
+func (SQLite) Time(expr string) string { return "julianday(" + expr + ")" }
+
+func (SQLite) TableExistsQuery() string {
+	return "SELECT name FROM sqlite_master WHERE type = 'table' AND name = ?"
+}
+
+// Postgres is for larger deployments
+type Postgres struct{}
+
+func (Postgres) Name() string { return "postgres" }
+
+// Rebind rewrites ? to $1, $2, ... outside string literals, quoted identifiers and comments
+func (Postgres) Rebind(query string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case ch == '\'' || ch == '"':
+			end := i + 1
+			for end < len(query) {
+				if query[end] == ch {
+					if end+1 < len(query) && query[end+1] == ch { // escaped quote
+						end += 2
+						continue
+					}
+					break
+				}
+				end++
+			}
+			if end >= len(query) {
+				end = len(query) - 1
+			}
+			b.WriteString(query[i : end+1])
+			i = end
+		case ch == '-' && i+1 < len(query) && query[i+1] == '-':
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				b.WriteString(query[i:])
+				return b.String()
+			}
+			b.WriteString(query[i : i+end])
+			i += end - 1
+		case ch == '?':
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return b.String()
+}
+
+func (Postgres) UnixEpoch(column string) string {
+	return "CAST(EXTRACT(EPOCH FROM " + column + ") AS BIGINT)"
+}
+
+func (Postgres) LocalDate(column, unit string, offsetSeconds int) string {
+	layout := "YYYY-MM-DD"
+	if unit == "month" {
+		layout = "YYYY-MM"
+	}
+	return fmt.Sprintf("to_char((%s AT TIME ZONE 'UTC') + interval '%d seconds', '%s')", column, offsetSeconds, layout)
+}
+
+func (Postgres) Time(expr string) string {
+	if expr == "?" {
+		return "CAST(? AS TIMESTAMPTZ)"
+	}
+	return expr
+}
+
+func (Postgres) TableExistsQuery() string {
+	return "SELECT table_name FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?"
+}
+
+// TableExists reports whether a table is present in the current database
+func TableExists(name string) bool {
+	if DB == nil {
+		return false
+	}
+	var found string
+	return DB.QueryRow(Current.TableExistsQuery(), name).Scan(&found) == nil
+}
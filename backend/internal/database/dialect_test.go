@@ -0,0 +1,29 @@
+package database
+
+import "testing"
+
+func TestPostgresRebind(t *testing.T) {
+	cases := map[string]string{
+		"SELECT * FROM users WHERE id = ? AND role = ?":     "SELECT * FROM users WHERE id = $1 AND role = $2",
+		"SELECT '?' , \"a?\" FROM t WHERE x = ?":            "SELECT '?' , \"a?\" FROM t WHERE x = $1",
+		"SELECT 'it''s ?' FROM t WHERE x = ?":               "SELECT 'it''s ?' FROM t WHERE x = $1",
+		"SELECT x -- why?\nFROM t WHERE y = ?":              "SELECT x -- why?\nFROM t WHERE y = $1",
+		"UPDATE notifications SET read = true WHERE id = 1": "UPDATE notifications SET read = true WHERE id = 1",
+	}
+	for in, want := range cases {
+		if got := (Postgres{}).Rebind(in); got != want {
+			t.Errorf("Rebind(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestEpochBucket(t *testing.T) {
+	want := "((CAST(strftime('%s', timestamp) AS INTEGER) + 19800) / 3600) * 3600 - 19800"
+	if got := EpochBucket(SQLite{}, "timestamp", 3600, 19800); got != want {
+		t.Errorf("sqlite bucket = %q", got)
+	}
+	want = "((CAST(EXTRACT(EPOCH FROM timestamp) AS BIGINT) + 19800) / 3600) * 3600 - 19800"
+	if got := EpochBucket(Postgres{}, "timestamp", 3600, 19800); got != want {
+		t.Errorf("postgres bucket = %q", got)
+	}
+}
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"sems-backend/internal/metrics"
+	"time"
+)
+
+// The SQL drivers are wrapped so every query and exec made through DB is timed
+// and its placeholders rebound for the dialect, without touching repositories.
+func init() {
+	for _, d := range []Dialect{SQLite{}, Postgres{}} {
+		probe, err := sql.Open(d.Name(), "")
+		if err != nil {
+			continue
+		}
+		sql.Register(instrumentedDriverName(d), &instrumentedDriver{parent: probe.Driver(), dialect: d})
+		probe.Close()
+	}
+}
+
+func instrumentedDriverName(d Dialect) string {
+	return d.Name() + "-instrumented"
+}
+
+type instrumentedDriver struct {
+	parent  driver.Driver
+	dialect Dialect
+}
+
+func (d *instrumentedDriver) Open(name string) (driver.Conn, error) {
+	c, err := d.parent.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedConn{Conn: c, dialect: d.dialect}, nil
+}
+
+// instrumentedConn forwards the optional driver interfaces database/sql looks for
+type instrumentedConn struct {
+	driver.Conn
+	dialect Dialect
+}
+
+func (c *instrumentedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.Conn.Prepare(c.dialect.Rebind(query))
+}
+
+func observe(operation string, start time.Time, err error) {
+	metrics.DBQueryDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err != nil && err != driver.ErrSkip {
+		metrics.DBErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+func (c *instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	rows, err := q.QueryContext(ctx, c.dialect.Rebind(query), args)
+	observe("query", start, err)
+	return rows, err
+}
+
+func (c *instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	result, err := e.ExecContext(ctx, c.dialect.Rebind(query), args)
+	observe("exec", start, err)
+	return result, err
+}
+
+func (c *instrumentedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, c.dialect.Rebind(query))
+	}
+	return c.Prepare(query)
+}
+
+func (c *instrumentedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *instrumentedConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *instrumentedConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *instrumentedConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
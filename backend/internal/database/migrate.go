@@ -1,249 +1,320 @@
 package database
 
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 )
 
-// RunMigrations executes all database migrations
+// Migration is one numbered schema change. Up and Down run inside a single
+// transaction each; statements must not rely on autocommit.
+type Migration struct {
+	Version int
+	Name    string
+	Up      []string
+	Down    []string
+	// Data runs after Up in the same transaction, for rewrites that depend on
+	// the tables and columns the database actually has
+	Data func(ctx context.Context, tx *sql.Tx) error
+}
+
+// Checksum identifies the migration's SQL so edits after release are detected
+func (m Migration) Checksum() string {
+	h := sha256.New()
+	for _, stmt := range m.Up {
+		h.Write([]byte(strings.TrimSpace(stmt)))
+		h.Write([]byte{0})
+	}
+	h.Write([]byte("--down"))
+	for _, stmt := range m.Down {
+		h.Write([]byte(strings.TrimSpace(stmt)))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// MigrationRecord is the status of one migration in this build or the database
+type MigrationRecord struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	State     string     `json:"state"` // applied, pending, modified, or unknown (applied but not in this build)
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+// MigrationState records the outcome of the last RunMigrations call
+type MigrationState struct {
+	Completed  bool      `json:"completed"`
+	Version    int       `json:"version"`
+	Applied    int       `json:"applied"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+var (
+	migrationMu    sync.RWMutex
+	migrationState MigrationState
+)
+
+// pgMigrationLock is the advisory lock key serialising migrations across instances
+const pgMigrationLock = 727465
+
+// GetMigrationState returns the outcome of the last migration run
+func GetMigrationState() MigrationState {
+	migrationMu.RLock()
+	defer migrationMu.RUnlock()
+	return migrationState
+}
+
+// CheckMigrations is a readiness check failing until migrations have run
+func CheckMigrations(ctx context.Context) error {
+	if !GetMigrationState().Completed {
+		return errors.New("migrations have not completed")
+	}
+	return nil
+}
+
+// migrations returns the ordered migration list for the active dialect
+func migrations() []Migration {
+	list := sqliteMigrations
+	if Current.Name() == "postgres" {
+		list = postgresMigrations
+	}
+	sorted := append([]Migration(nil), list...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	return sorted
+}
+
+type appliedMigration struct {
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+func ensureMigrationTable(ctx context.Context) error {
+	_, err := DB.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		checksum TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`)
+	return err
+}
+
+func appliedMigrations(ctx context.Context) (map[int]appliedMigration, error) {
+	rows, err := DB.QueryContext(ctx, `SELECT version, name, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]appliedMigration{}
+	for rows.Next() {
+		var version int
+		var a appliedMigration
+		if err := rows.Scan(&version, &a.name, &a.checksum, &a.appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = a
+	}
+	return applied, rows.Err()
+}
+
+// RunMigrations applies every pending migration in order, each in its own
+// transaction. It refuses to run if an applied migration has been edited.
 func RunMigrations() error {
-	migrations := []string{
-		`CREATE TABLE IF NOT EXISTS users (
-			id TEXT PRIMARY KEY,
-			email TEXT UNIQUE NOT NULL,
-			password_hash TEXT NOT NULL,
-			role TEXT NOT NULL DEFAULT 'USER',
-			first_name TEXT,
-			last_name TEXT,
-			phone TEXT,
-			organization TEXT,
-			is_active INTEGER DEFAULT 1,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			profile_image TEXT,
-			address_line1 TEXT,
-			address_line2 TEXT,
-			city TEXT,
-			state TEXT,
-			pincode TEXT,
-			region TEXT,
-			latitude REAL,
-			longitude REAL,
-			admin_id TEXT REFERENCES users(id),
-			installation_status TEXT DEFAULT 'NOT_INSTALLED',
-			property_type TEXT,
-			avg_monthly_bill REAL,
-			roof_area_sqft REAL,
-			connection_type TEXT,
-			subsidy_interest INTEGER DEFAULT 0,
-			plant_capacity_kw REAL,
-			net_metering INTEGER DEFAULT 0,
-			inverter_brand TEXT,
-			discom_name TEXT,
-			consumer_number TEXT,
-			device_linked INTEGER DEFAULT 0,
-			device_id TEXT,
-			subsidy_applied INTEGER DEFAULT 0,
-			subsidy_status TEXT,
-			scheme_name TEXT,
-			application_id TEXT,
-			installation_date DATETIME,
-			last_data_received DATETIME,
-			project_cost REAL,
-			plant_id TEXT REFERENCES solar_plants(id)
-		);`,
-		`CREATE TABLE IF NOT EXISTS devices (
-			id TEXT PRIMARY KEY,
-			user_id TEXT REFERENCES users(id) ON DELETE CASCADE,
-			device_name TEXT NOT NULL,
-			device_type TEXT NOT NULL,
-			api_key TEXT UNIQUE NOT NULL,
-			status TEXT DEFAULT 'ACTIVE',
-			location_lat REAL,
-			location_lng REAL,
-			installation_date DATETIME,
-			last_seen DATETIME,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			device_id TEXT,
-			name TEXT,
-			location TEXT,
-			is_active INTEGER DEFAULT 1
-		);`,
-		`CREATE TABLE IF NOT EXISTS energy_data (
-			id TEXT PRIMARY KEY,
-			device_id TEXT REFERENCES devices(id) ON DELETE CASCADE,
-			timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
-			voltage REAL,
-			current REAL,
-			solar_power REAL,
-			load_power REAL,
-			grid_power REAL,
-			battery_level REAL,
-			temperature REAL,
-			humidity REAL,
-			solar_irradiance REAL,
-			grid_status INTEGER DEFAULT 0,
-			weather_condition TEXT,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		);`,
-		`CREATE INDEX IF NOT EXISTS idx_energy_data_device_timestamp ON energy_data(device_id, timestamp);`,
-		`CREATE INDEX IF NOT EXISTS idx_energy_data_timestamp ON energy_data(timestamp);`,
-		`CREATE INDEX IF NOT EXISTS idx_devices_user_id ON devices(user_id);`,
-		`CREATE INDEX IF NOT EXISTS idx_devices_api_key ON devices(api_key);`,
-		// Solar plants table
-		`CREATE TABLE IF NOT EXISTS solar_plants (
-			id TEXT PRIMARY KEY,
-			name TEXT NOT NULL,
-			location TEXT NOT NULL,
-			region_id TEXT,
-			region TEXT NOT NULL,
-			capacity_kw REAL NOT NULL,
-			current_output_kw REAL DEFAULT 0,
-			efficiency REAL DEFAULT 85.00,
-			latitude REAL,
-			longitude REAL,
-			status TEXT DEFAULT 'ACTIVE',
-			description TEXT,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		);`,
-		// Create demo device for simulator
-		`INSERT OR REPLACE INTO devices (id, user_id, device_name, device_type, api_key, status, location_lat, location_lng) VALUES ('00000000-0000-0000-0000-000000000001', NULL, 'Demo Device', 'SIMULATOR', 'demo_api_key', 'ACTIVE', 28.6139, 77.2090);`,
-		// Create alerts table
-		`CREATE TABLE IF NOT EXISTS alerts (
-			id TEXT PRIMARY KEY,
-			plant_id TEXT,
-			device_id TEXT,
-			severity TEXT NOT NULL,
-			message TEXT NOT NULL,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			resolved BOOLEAN DEFAULT 0
-		);`,
-		// Add installer_id to users
-		`ALTER TABLE users ADD COLUMN installer_id TEXT REFERENCES users(id);`,
-		// Add project_cost to users if not exists
-		`ALTER TABLE users ADD COLUMN project_cost REAL;`,
-		// Add plant_id to users if not exists
-		`ALTER TABLE users ADD COLUMN plant_id TEXT REFERENCES solar_plants(id);`,
-		// Create solar_profiles table if not exists
-		`CREATE TABLE IF NOT EXISTS solar_profiles (
-			id TEXT PRIMARY KEY,
-			user_id TEXT REFERENCES users(id) ON DELETE CASCADE,
-			installation_status TEXT,
-			property_type TEXT,
-			admin_id TEXT,
-			installer_id TEXT,
-			avg_monthly_bill REAL,
-			roof_area_sqft REAL,
-			connection_type TEXT,
-			subsidy_interest INTEGER,
-			project_cost REAL,
-			plant_capacity_kw REAL,
-			installation_date DATETIME,
-			net_metering INTEGER,
-			inverter_brand TEXT,
-			discom_name TEXT,
-			consumer_number TEXT,
-			device_linked INTEGER,
-			device_id TEXT,
-			last_data_received DATETIME,
-			subsidy_applied INTEGER,
-			subsidy_status TEXT,
-			scheme_name TEXT,
-			application_id TEXT,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		);`,
-		// Create notifications table
-		`CREATE TABLE IF NOT EXISTS notifications (
-			id TEXT PRIMARY KEY,
-			user_id TEXT REFERENCES users(id) ON DELETE CASCADE,
-			type TEXT NOT NULL,
-			title TEXT NOT NULL,
-			message TEXT NOT NULL,
-			severity TEXT DEFAULT 'MEDIUM',
-			read INTEGER DEFAULT 0,
-			action_url TEXT,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		);`,
-		// Create notification preferences table
-		`CREATE TABLE IF NOT EXISTS notification_preferences (
-			user_id TEXT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
-			email_enabled INTEGER DEFAULT 1,
-			sms_enabled INTEGER DEFAULT 0,
-			push_enabled INTEGER DEFAULT 1,
-			alert_types TEXT DEFAULT '["ALERT","WARNING","CRITICAL"]'
-		);`,
-		// Create index for notifications
-		`CREATE INDEX IF NOT EXISTS idx_notifications_user_id ON notifications(user_id, created_at DESC);`,
-		// Cleanup invalid seed data from previous version
-		`DELETE FROM solar_plants WHERE id IN ('p1', 'p2', 'p3', 'p4');`,
-		// Seed initial plants with valid UUIDs
-		`INSERT OR IGNORE INTO solar_plants (id, name, location, region, capacity_kw, current_output_kw, efficiency, latitude, longitude, status, description)
-		VALUES 
-		('550e8400-e29b-41d4-a716-446655440001', 'Delhi North Plant', 'Rohini, Delhi', 'Delhi', 500.0, 320.5, 92.0, 28.7041, 77.1025, 'ACTIVE', 'Primary plant for North Delhi'),
-		('550e8400-e29b-41d4-a716-446655440002', 'Mumbai Coastal Solar', 'Marine Drive, Mumbai', 'Maharashtra', 750.0, 410.2, 88.0, 19.0760, 72.8777, 'ACTIVE', 'Coastal deployment with high humidity tolerance'),
-		('550e8400-e29b-41d4-a716-446655440003', 'Bangalore Tech Park', 'Electronic City, Bangalore', 'Karnataka', 1200.0, 850.0, 95.0, 12.9716, 77.5946, 'ACTIVE', 'Integration with IT hub micro-grid'),
-		('550e8400-e29b-41d4-a716-446655440004', 'Rajasthan Desert Solar', 'Jaisalmer', 'Rajasthan', 5000.0, 4200.0, 96.0, 26.9157, 70.9083, 'ACTIVE', 'Utility scale desert deployment');`,
-		// Create tickets table
-		`CREATE TABLE IF NOT EXISTS tickets (
-			id TEXT PRIMARY KEY,
-			user_id TEXT REFERENCES users(id) ON DELETE CASCADE,
-			installer_id TEXT,
-			subject TEXT NOT NULL,
-			description TEXT,
-			status TEXT DEFAULT 'OPEN',
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		);`,
-		// Fix Schema Mismatch: Rename power to solar_power if exists
-		`ALTER TABLE energy_data RENAME COLUMN power TO solar_power;`,
-		// Add missing columns if table was created with old schema
-		`ALTER TABLE energy_data ADD COLUMN load_power REAL DEFAULT 0;`,
-		`ALTER TABLE energy_data ADD COLUMN grid_power REAL DEFAULT 0;`,
-		`ALTER TABLE energy_data ADD COLUMN weather_condition TEXT;`,
-		// Seed super admin if not exists
-		`INSERT OR IGNORE INTO users (id, email, password_hash, first_name, last_name, role)
-		VALUES ('00000000-0000-4000-a000-000000000001', 'superadmin@solar.com', '$2a$10$92IXUNpkjO0rOQ5byMi.Ye4oKoEa3Ro9llC/.og/at2.uheWG/igi', 'Super', 'Admin', 'SUPER_ADMIN');`,
-		// Create inventory table
-		`CREATE TABLE IF NOT EXISTS inventory_items (
-			id TEXT PRIMARY KEY,
-			name TEXT NOT NULL,
-			category TEXT NOT NULL,
-			brand TEXT,
-			model TEXT,
-			description TEXT,
-			price REAL,
-			stock_qty INTEGER DEFAULT 0,
-			image_url TEXT,
-			gallery TEXT,
-			specs TEXT,
-			is_active INTEGER DEFAULT 1,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		);`,
-		// Update super admin password
-		`UPDATE users SET password_hash = '$2a$10$vHv/WKOEYBysAKs4NKNA..GLvVuBi.1vAxvF3Dr5iHBSlJsNOaL1G' WHERE email = 'superadmin@solar.com';`,
-		// Add Personnel Nexus ID
-		`ALTER TABLE users ADD COLUMN personnel_nexus_id TEXT;`,
-	}
-
-	for i, migration := range migrations {
-		if err := executeMigration(DB, migration); err != nil {
-			// Log warning but continue - some migrations may fail due to existing columns
-			log.Printf("⚠️  Migration %d warning: %v", i+1, err)
-		} else {
-			log.Printf("✅ Migration %d executed successfully", i+1)
+	ctx := context.Background()
+	if DB == nil {
+		return errors.New("database not initialized")
+	}
+	if err := ensureMigrationTable(ctx); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	applied, err := appliedMigrations(ctx)
+	if err != nil {
+		return fmt.Errorf("read schema_migrations: %w", err)
+	}
+
+	list := migrations()
+	for _, m := range list {
+		if a, ok := applied[m.Version]; ok && a.checksum != m.Checksum() {
+			return fmt.Errorf("migration %d (%s) was modified after it was applied; add a new migration instead", m.Version, m.Name)
+		}
+	}
+
+	if len(applied) == 0 && Current.Name() == "sqlite" && TableExists("users") {
+		log.Println("🔧 Adopting database created before versioned migrations")
+		if err := adoptLegacySQLite(ctx); err != nil {
+			return fmt.Errorf("adopt legacy schema: %w", err)
+		}
+	}
+
+	count := 0
+	version := 0
+	for _, m := range list {
+		if _, ok := applied[m.Version]; ok {
+			version = m.Version
+			continue
+		}
+		ran, err := applyMigration(ctx, m)
+		if err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		if ran {
+			log.Printf("✅ Migration %d %s applied", m.Version, m.Name)
+			count++
 		}
+		version = m.Version
 	}
 
-	log.Println("🎉 All database migrations completed successfully")
+	migrationMu.Lock()
+	migrationState = MigrationState{Completed: true, Version: version, Applied: count, FinishedAt: time.Now()}
+	migrationMu.Unlock()
+
+	log.Printf("🎉 Database schema at version %d (%d applied)", version, count)
 	return nil
 }
 
-// executeMigration runs a single SQL migration
-func executeMigration(db *sql.DB, query string) error {
-	_, err := db.Exec(query)
-	return err
+// applyMigration runs m inside a transaction; it reports false if another
+// instance applied it first.
+func applyMigration(ctx context.Context, m Migration) (bool, error) {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if Current.Name() == "postgres" {
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(?)`, pgMigrationLock); err != nil {
+			return false, err
+		}
+	}
+	var exists int
+	err = tx.QueryRowContext(ctx, `SELECT 1 FROM schema_migrations WHERE version = ?`, m.Version).Scan(&exists)
+	if err == nil {
+		return false, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+
+	for i, stmt := range m.Up {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return false, fmt.Errorf("statement %d: %w", i+1, err)
+		}
+	}
+	if m.Data != nil {
+		if err := m.Data(ctx, tx); err != nil {
+			return false, err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)`,
+		m.Version, m.Name, m.Checksum(), time.Now().UTC()); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// RollbackMigrations reverts the most recent steps applied migrations
+func RollbackMigrations(steps int) error {
+	ctx := context.Background()
+	if DB == nil {
+		return errors.New("database not initialized")
+	}
+	if err := ensureMigrationTable(ctx); err != nil {
+		return err
+	}
+	applied, err := appliedMigrations(ctx)
+	if err != nil {
+		return err
+	}
+
+	known := map[int]Migration{}
+	for _, m := range migrations() {
+		known[m.Version] = m
+	}
+	versions := make([]int, 0, len(applied))
+	for v := range applied {
+		versions = append(versions, v)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+
+	if steps > len(versions) {
+		steps = len(versions)
+	}
+	for _, v := range versions[:steps] {
+		m, ok := known[v]
+		if !ok {
+			return fmt.Errorf("migration %d (%s) is not part of this build and cannot be rolled back", v, applied[v].name)
+		}
+		if applied[v].checksum != m.Checksum() {
+			return fmt.Errorf("migration %d (%s) was modified after it was applied", m.Version, m.Name)
+		}
+		if err := revertMigration(ctx, m); err != nil {
+			return fmt.Errorf("rollback %d (%s): %w", m.Version, m.Name, err)
+		}
+		log.Printf("↩️  Migration %d %s rolled back", m.Version, m.Name)
+	}
+	return nil
+}
+
+func revertMigration(ctx context.Context, m Migration) error {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i, stmt := range m.Down {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("statement %d: %w", i+1, err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = ?`, m.Version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// MigrationStatus lists every known migration plus any applied ones missing from this build
+func MigrationStatus() ([]MigrationRecord, error) {
+	ctx := context.Background()
+	if DB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	if err := ensureMigrationTable(ctx); err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []MigrationRecord
+	for _, m := range migrations() {
+		rec := MigrationRecord{Version: m.Version, Name: m.Name, State: "pending"}
+		if a, ok := applied[m.Version]; ok {
+			at := a.appliedAt
+			rec.AppliedAt = &at
+			rec.State = "applied"
+			if a.checksum != m.Checksum() {
+				rec.State = "modified"
+			}
+			delete(applied, m.Version)
+		}
+		records = append(records, rec)
+	}
+	for v, a := range applied {
+		at := a.appliedAt
+		records = append(records, MigrationRecord{Version: v, Name: a.name, State: "unknown", AppliedAt: &at})
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Version < records[j].Version })
+	return records, nil
 }
@@ -0,0 +1,594 @@
+package database
+
+// postgresMigrations mirror sqliteMigrations version for version. IDs stay TEXT
+// so repositories can bind and scan them as strings, and SQLite's 0/1 flag
+// columns are BOOLEAN.
+var postgresMigrations = []Migration{
+	{
+		Version: 1,
+		Name:    "baseline_schema",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS regions (
+				id TEXT PRIMARY KEY,
+				name TEXT NOT NULL,
+				state TEXT NOT NULL,
+				country TEXT NOT NULL,
+				timezone TEXT NOT NULL,
+				description TEXT,
+				status TEXT DEFAULT 'ACTIVE',
+				latitude DOUBLE PRECISION,
+				longitude DOUBLE PRECISION,
+				expected_users INTEGER DEFAULT 0,
+				expected_plants INTEGER DEFAULT 0,
+				capacity_mw DOUBLE PRECISION DEFAULT 0,
+				created_at TEXT,
+				updated_at TEXT
+			)`,
+			`CREATE TABLE IF NOT EXISTS solar_plants (
+				id TEXT PRIMARY KEY,
+				name TEXT NOT NULL,
+				location TEXT NOT NULL,
+				region_id TEXT,
+				region TEXT NOT NULL,
+				capacity_kw DOUBLE PRECISION NOT NULL,
+				current_output_kw DOUBLE PRECISION DEFAULT 0,
+				efficiency DOUBLE PRECISION DEFAULT 85.00,
+				latitude DOUBLE PRECISION,
+				longitude DOUBLE PRECISION,
+				status TEXT DEFAULT 'ACTIVE',
+				description TEXT,
+				created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+			)`,
+			`CREATE TABLE IF NOT EXISTS users (
+				id TEXT PRIMARY KEY,
+				email TEXT UNIQUE NOT NULL,
+				password_hash TEXT NOT NULL,
+				role TEXT NOT NULL DEFAULT 'USER',
+				first_name TEXT,
+				last_name TEXT,
+				phone TEXT,
+				organization TEXT,
+				is_active BOOLEAN DEFAULT TRUE,
+				created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+				profile_image TEXT,
+				address_line1 TEXT,
+				address_line2 TEXT,
+				city TEXT,
+				state TEXT,
+				pincode TEXT,
+				region TEXT,
+				latitude DOUBLE PRECISION,
+				longitude DOUBLE PRECISION,
+				admin_id TEXT REFERENCES users(id),
+				installer_id TEXT REFERENCES users(id),
+				plant_id TEXT REFERENCES solar_plants(id),
+				installation_status TEXT DEFAULT 'NOT_INSTALLED',
+				property_type TEXT,
+				avg_monthly_bill DOUBLE PRECISION,
+				roof_area_sqft DOUBLE PRECISION,
+				connection_type TEXT,
+				subsidy_interest BOOLEAN DEFAULT FALSE,
+				plant_capacity_kw DOUBLE PRECISION,
+				net_metering BOOLEAN DEFAULT FALSE,
+				inverter_brand TEXT,
+				discom_name TEXT,
+				consumer_number TEXT,
+				device_linked BOOLEAN DEFAULT FALSE,
+				device_id TEXT,
+				subsidy_applied BOOLEAN DEFAULT FALSE,
+				subsidy_status TEXT,
+				scheme_name TEXT,
+				application_id TEXT,
+				installation_date TIMESTAMPTZ,
+				last_data_received TIMESTAMPTZ,
+				project_cost DOUBLE PRECISION,
+				personnel_nexus_id TEXT
+			)`,
+			`CREATE TABLE IF NOT EXISTS devices (
+				id TEXT PRIMARY KEY,
+				user_id TEXT REFERENCES users(id) ON DELETE CASCADE,
+				device_name TEXT NOT NULL,
+				device_type TEXT NOT NULL,
+				api_key TEXT UNIQUE NOT NULL,
+				status TEXT DEFAULT 'ACTIVE',
+				location_lat DOUBLE PRECISION,
+				location_lng DOUBLE PRECISION,
+				installation_date TIMESTAMPTZ,
+				last_seen TIMESTAMPTZ,
+				created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+				device_id TEXT,
+				name TEXT,
+				location TEXT,
+				is_active BOOLEAN DEFAULT TRUE
+			)`,
+			`CREATE TABLE IF NOT EXISTS energy_data (
+				id TEXT PRIMARY KEY,
+				device_id TEXT REFERENCES devices(id) ON DELETE CASCADE,
+				timestamp TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+				voltage DOUBLE PRECISION,
+				current DOUBLE PRECISION,
+				solar_power DOUBLE PRECISION,
+				load_power DOUBLE PRECISION DEFAULT 0,
+				grid_power DOUBLE PRECISION DEFAULT 0,
+				battery_level DOUBLE PRECISION,
+				temperature DOUBLE PRECISION,
+				humidity DOUBLE PRECISION,
+				solar_irradiance DOUBLE PRECISION,
+				grid_status BOOLEAN DEFAULT FALSE,
+				weather_condition TEXT,
+				created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_energy_data_device_timestamp ON energy_data(device_id, timestamp)`,
+			`CREATE INDEX IF NOT EXISTS idx_energy_data_timestamp ON energy_data(timestamp)`,
+			`CREATE INDEX IF NOT EXISTS idx_devices_user_id ON devices(user_id)`,
+			`CREATE TABLE IF NOT EXISTS alerts (
+				id TEXT PRIMARY KEY,
+				plant_id TEXT,
+				device_id TEXT,
+				severity TEXT NOT NULL,
+				message TEXT NOT NULL,
+				created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+				resolved BOOLEAN DEFAULT FALSE
+			)`,
+			`CREATE TABLE IF NOT EXISTS solar_profiles (
+				id TEXT PRIMARY KEY,
+				user_id TEXT REFERENCES users(id) ON DELETE CASCADE,
+				installation_status TEXT,
+				property_type TEXT,
+				admin_id TEXT,
+				installer_id TEXT,
+				avg_monthly_bill DOUBLE PRECISION,
+				roof_area_sqft DOUBLE PRECISION,
+				connection_type TEXT,
+				subsidy_interest BOOLEAN,
+				project_cost DOUBLE PRECISION,
+				plant_capacity_kw DOUBLE PRECISION,
+				installation_date TIMESTAMPTZ,
+				net_metering BOOLEAN,
+				inverter_brand TEXT,
+				discom_name TEXT,
+				consumer_number TEXT,
+				device_linked BOOLEAN,
+				device_id TEXT,
+				last_data_received TIMESTAMPTZ,
+				subsidy_applied BOOLEAN,
+				subsidy_status TEXT,
+				scheme_name TEXT,
+				application_id TEXT,
+				created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+			)`,
+			`CREATE TABLE IF NOT EXISTS notifications (
+				id TEXT PRIMARY KEY,
+				user_id TEXT REFERENCES users(id) ON DELETE CASCADE,
+				type TEXT NOT NULL,
+				title TEXT NOT NULL,
+				message TEXT NOT NULL,
+				severity TEXT DEFAULT 'MEDIUM',
+				read BOOLEAN DEFAULT FALSE,
+				action_url TEXT,
+				created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+			)`,
+			`CREATE TABLE IF NOT EXISTS notification_preferences (
+				user_id TEXT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+				email_enabled BOOLEAN DEFAULT TRUE,
+				sms_enabled BOOLEAN DEFAULT FALSE,
+				push_enabled BOOLEAN DEFAULT TRUE,
+				alert_types TEXT DEFAULT '["ALERT","WARNING","CRITICAL"]'
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_notifications_user_id ON notifications(user_id, created_at DESC)`,
+			`CREATE TABLE IF NOT EXISTS tickets (
+				id TEXT PRIMARY KEY,
+				user_id TEXT REFERENCES users(id) ON DELETE CASCADE,
+				installer_id TEXT,
+				subject TEXT NOT NULL,
+				description TEXT,
+				status TEXT DEFAULT 'OPEN',
+				created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+			)`,
+			`CREATE TABLE IF NOT EXISTS inventory_items (
+				id TEXT PRIMARY KEY,
+				name TEXT NOT NULL,
+				category TEXT NOT NULL,
+				brand TEXT,
+				model TEXT,
+				description TEXT,
+				price DOUBLE PRECISION,
+				stock_qty INTEGER DEFAULT 0,
+				image_url TEXT,
+				gallery TEXT,
+				specs TEXT,
+				is_active BOOLEAN DEFAULT TRUE,
+				created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+			)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS inventory_items`,
+			`DROP TABLE IF EXISTS tickets`,
+			`DROP TABLE IF EXISTS notification_preferences`,
+			`DROP TABLE IF EXISTS notifications`,
+			`DROP TABLE IF EXISTS solar_profiles`,
+			`DROP TABLE IF EXISTS alerts`,
+			`DROP TABLE IF EXISTS energy_data`,
+			`DROP TABLE IF EXISTS devices`,
+			`DROP TABLE IF EXISTS users`,
+			`DROP TABLE IF EXISTS solar_plants`,
+			`DROP TABLE IF EXISTS regions`,
+		},
+	},
+	{
+		Version: 2,
+		Name:    "seed_data",
+		Up: []string{
+			`INSERT INTO devices (id, user_id, device_name, device_type, api_key, status, location_lat, location_lng)
+			VALUES ('00000000-0000-0000-0000-000000000001', NULL, 'Demo Device', 'SIMULATOR', 'demo_api_key', 'ACTIVE', 28.6139, 77.2090)
+			ON CONFLICT (id) DO NOTHING`,
+			`INSERT INTO solar_plants (id, name, location, region, capacity_kw, current_output_kw, efficiency, latitude, longitude, status, description)
+			VALUES
+			('550e8400-e29b-41d4-a716-446655440001', 'Delhi North Plant', 'Rohini, Delhi', 'Delhi', 500.0, 320.5, 92.0, 28.7041, 77.1025, 'ACTIVE', 'Primary plant for North Delhi'),
+			('550e8400-e29b-41d4-a716-446655440002', 'Mumbai Coastal Solar', 'Marine Drive, Mumbai', 'Maharashtra', 750.0, 410.2, 88.0, 19.0760, 72.8777, 'ACTIVE', 'Coastal deployment with high humidity tolerance'),
+			('550e8400-e29b-41d4-a716-446655440003', 'Bangalore Tech Park', 'Electronic City, Bangalore', 'Karnataka', 1200.0, 850.0, 95.0, 12.9716, 77.5946, 'ACTIVE', 'Integration with IT hub micro-grid'),
+			('550e8400-e29b-41d4-a716-446655440004', 'Rajasthan Desert Solar', 'Jaisalmer', 'Rajasthan', 5000.0, 4200.0, 96.0, 26.9157, 70.9083, 'ACTIVE', 'Utility scale desert deployment')
+			ON CONFLICT (id) DO NOTHING`,
+			`INSERT INTO users (id, email, password_hash, first_name, last_name, role)
+			VALUES ('00000000-0000-4000-a000-000000000001', 'superadmin@solar.com', '$2a$10$vHv/WKOEYBysAKs4NKNA..GLvVuBi.1vAxvF3Dr5iHBSlJsNOaL1G', 'Super', 'Admin', 'SUPER_ADMIN')
+			ON CONFLICT (email) DO NOTHING`,
+		},
+		// The super admin is kept on rollback; other users reference it as their admin
+		Down: []string{
+			`DELETE FROM devices WHERE id = '00000000-0000-0000-0000-000000000001'`,
+			`DELETE FROM solar_plants WHERE id IN ('550e8400-e29b-41d4-a716-446655440001', '550e8400-e29b-41d4-a716-446655440002', '550e8400-e29b-41d4-a716-446655440003', '550e8400-e29b-41d4-a716-446655440004')`,
+		},
+	},
+	{
+		Version: 3,
+		Name:    "grafana_tokens",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS grafana_tokens (
+				id TEXT PRIMARY KEY,
+				user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				name TEXT NOT NULL,
+				token_prefix TEXT NOT NULL,
+				token_hash TEXT UNIQUE NOT NULL,
+				scope TEXT NOT NULL DEFAULT 'grafana:read',
+				last_used_at TIMESTAMPTZ,
+				revoked_at TIMESTAMPTZ,
+				created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+			)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS grafana_tokens`,
+		},
+	},
+	{
+		Version: 4,
+		Name:    "auth_sessions",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS auth_sessions (
+				id TEXT PRIMARY KEY,
+				user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				refresh_hash TEXT UNIQUE NOT NULL,
+				previous_hash TEXT,
+				user_agent TEXT,
+				ip_address TEXT,
+				created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+				last_used_at TIMESTAMPTZ,
+				expires_at TIMESTAMPTZ NOT NULL,
+				revoked_at TIMESTAMPTZ
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_auth_sessions_user ON auth_sessions(user_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_auth_sessions_previous ON auth_sessions(previous_hash)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS auth_sessions`,
+		},
+	},
+	{
+		Version: 5,
+		Name:    "signing_keys",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS signing_keys (
+				kid TEXT PRIMARY KEY,
+				algorithm TEXT NOT NULL,
+				sealed_key TEXT NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL,
+				retires_at TIMESTAMPTZ NOT NULL,
+				expires_at TIMESTAMPTZ NOT NULL
+			)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS signing_keys`,
+		},
+	},
+	{
+		Version: 6,
+		Name:    "account_tokens",
+		Up: []string{
+			`ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMPTZ`,
+			// Accounts from before verification existed are trusted as they are
+			`UPDATE users SET email_verified_at = CURRENT_TIMESTAMP`,
+			`CREATE TABLE IF NOT EXISTS account_tokens (
+				id TEXT PRIMARY KEY,
+				user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				purpose TEXT NOT NULL,
+				token_hash TEXT UNIQUE NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL,
+				expires_at TIMESTAMPTZ NOT NULL,
+				used_at TIMESTAMPTZ
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_account_tokens_user ON account_tokens(user_id, purpose)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS account_tokens`,
+			`ALTER TABLE users DROP COLUMN email_verified_at`,
+		},
+	},
+	{
+		Version: 7,
+		Name:    "two_factor",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS user_two_factor (
+				user_id TEXT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+				sealed_secret TEXT NOT NULL,
+				enabled_at TIMESTAMPTZ,
+				last_used_step BIGINT NOT NULL DEFAULT 0,
+				created_at TIMESTAMPTZ NOT NULL
+			)`,
+			`CREATE TABLE IF NOT EXISTS recovery_codes (
+				id TEXT PRIMARY KEY,
+				user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				code_hash TEXT NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL,
+				used_at TIMESTAMPTZ
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_recovery_codes_user ON recovery_codes(user_id)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS recovery_codes`,
+			`DROP TABLE IF EXISTS user_two_factor`,
+		},
+	},
+	{
+		Version: 8,
+		Name:    "user_identities",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS user_identities (
+				id TEXT PRIMARY KEY,
+				provider TEXT NOT NULL,
+				subject TEXT NOT NULL,
+				user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				email TEXT NOT NULL,
+				provisioned BOOLEAN NOT NULL DEFAULT false,
+				created_at TIMESTAMPTZ NOT NULL,
+				last_login_at TIMESTAMPTZ,
+				UNIQUE (provider, subject)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_user_identities_user ON user_identities(user_id)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS user_identities`,
+		},
+	},
+	{
+		Version: 9,
+		Name:    "roles",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS roles (
+				name TEXT PRIMARY KEY,
+				description TEXT NOT NULL DEFAULT '',
+				scope TEXT NOT NULL,
+				permissions TEXT NOT NULL DEFAULT '',
+				created_at TIMESTAMPTZ NOT NULL,
+				updated_at TIMESTAMPTZ NOT NULL
+			)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS roles`,
+		},
+	},
+	{
+		Version: 10,
+		Name:    "api_tokens",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS api_tokens (
+				id TEXT PRIMARY KEY,
+				user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				name TEXT NOT NULL,
+				token_prefix TEXT NOT NULL,
+				token_hash TEXT UNIQUE NOT NULL,
+				scopes TEXT NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL,
+				expires_at TIMESTAMPTZ NOT NULL,
+				last_used_at TIMESTAMPTZ,
+				last_used_ip TEXT,
+				revoked_at TIMESTAMPTZ
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_api_tokens_user ON api_tokens(user_id)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS api_tokens`,
+		},
+	},
+	{
+		Version: 11,
+		Name:    "audit_log",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS audit_log (
+				id TEXT PRIMARY KEY,
+				seq BIGINT UNIQUE NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL,
+				actor_id TEXT NOT NULL,
+				actor_role TEXT NOT NULL,
+				action TEXT NOT NULL,
+				resource_type TEXT NOT NULL,
+				resource_id TEXT NOT NULL DEFAULT '',
+				changes TEXT NOT NULL DEFAULT '',
+				ip_address TEXT NOT NULL DEFAULT '',
+				prev_hash TEXT NOT NULL,
+				hash TEXT NOT NULL
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log(actor_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_audit_log_resource ON audit_log(resource_type, resource_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_audit_log_created ON audit_log(created_at)`,
+			`CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+			BEGIN RAISE EXCEPTION 'audit_log is append-only'; END;
+			$$ LANGUAGE plpgsql`,
+			`CREATE TRIGGER audit_log_append_only BEFORE UPDATE OR DELETE ON audit_log
+			FOR EACH ROW EXECUTE FUNCTION audit_log_append_only()`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS audit_log`,
+			`DROP FUNCTION IF EXISTS audit_log_append_only()`,
+		},
+	},
+	{
+		Version: 12,
+		Name:    "device_keys",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS device_keys (
+				id TEXT PRIMARY KEY,
+				device_id TEXT NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+				key_prefix TEXT NOT NULL,
+				key_hash TEXT UNIQUE NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL,
+				expires_at TIMESTAMPTZ,
+				last_used_at TIMESTAMPTZ,
+				last_used_ip TEXT,
+				revoked_at TIMESTAMPTZ
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_device_keys_device ON device_keys(device_id)`,
+			`ALTER TABLE devices ADD COLUMN key_prefix TEXT NOT NULL DEFAULT ''`,
+		},
+		Down: []string{
+			`ALTER TABLE devices DROP COLUMN key_prefix`,
+			`DROP TABLE IF EXISTS device_keys`,
+		},
+	},
+	{
+		Version: 13,
+		Name:    "device_signing",
+		Up: []string{
+			`ALTER TABLE devices ADD COLUMN signing_secret TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE devices ADD COLUMN require_signature BOOLEAN NOT NULL DEFAULT false`,
+		},
+		Down: []string{
+			`ALTER TABLE devices DROP COLUMN require_signature`,
+			`ALTER TABLE devices DROP COLUMN signing_secret`,
+		},
+	},
+	{
+		Version: 14,
+		Name:    "organizations",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS organizations (
+				id TEXT PRIMARY KEY,
+				name TEXT NOT NULL,
+				slug TEXT UNIQUE NOT NULL,
+				branding TEXT NOT NULL DEFAULT '{}',
+				settings TEXT NOT NULL DEFAULT '{}',
+				is_active BOOLEAN NOT NULL DEFAULT true,
+				created_at TIMESTAMPTZ NOT NULL,
+				updated_at TIMESTAMPTZ NOT NULL
+			)`,
+			`ALTER TABLE users ADD COLUMN org_id TEXT REFERENCES organizations(id)`,
+			`CREATE INDEX IF NOT EXISTS idx_users_org ON users(org_id)`,
+			`ALTER TABLE solar_plants ADD COLUMN org_id TEXT REFERENCES organizations(id)`,
+			`CREATE INDEX IF NOT EXISTS idx_solar_plants_org ON solar_plants(org_id)`,
+			`ALTER TABLE devices ADD COLUMN org_id TEXT REFERENCES organizations(id)`,
+			`CREATE INDEX IF NOT EXISTS idx_devices_org ON devices(org_id)`,
+			`ALTER TABLE inventory_items ADD COLUMN org_id TEXT REFERENCES organizations(id)`,
+			`CREATE INDEX IF NOT EXISTS idx_inventory_items_org ON inventory_items(org_id)`,
+			`ALTER TABLE tickets ADD COLUMN org_id TEXT REFERENCES organizations(id)`,
+			`CREATE INDEX IF NOT EXISTS idx_tickets_org ON tickets(org_id)`,
+		},
+		Down: []string{
+			`DROP INDEX IF EXISTS idx_tickets_org`,
+			`ALTER TABLE tickets DROP COLUMN org_id`,
+			`DROP INDEX IF EXISTS idx_inventory_items_org`,
+			`ALTER TABLE inventory_items DROP COLUMN org_id`,
+			`DROP INDEX IF EXISTS idx_devices_org`,
+			`ALTER TABLE devices DROP COLUMN org_id`,
+			`DROP INDEX IF EXISTS idx_solar_plants_org`,
+			`ALTER TABLE solar_plants DROP COLUMN org_id`,
+			`DROP INDEX IF EXISTS idx_users_org`,
+			`ALTER TABLE users DROP COLUMN org_id`,
+			`DROP TABLE IF EXISTS organizations`,
+		},
+	},
+	{
+		Version: 15,
+		Name:    "impersonations",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS impersonations (
+				id TEXT PRIMARY KEY,
+				admin_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				admin_role TEXT NOT NULL,
+				admin_session_id TEXT NOT NULL,
+				user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				reason TEXT NOT NULL,
+				read_only BOOLEAN NOT NULL DEFAULT true,
+				ip_address TEXT NOT NULL DEFAULT '',
+				started_at TIMESTAMPTZ NOT NULL,
+				expires_at TIMESTAMPTZ NOT NULL,
+				ended_at TIMESTAMPTZ,
+				end_reason TEXT NOT NULL DEFAULT ''
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_impersonations_user ON impersonations(user_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_impersonations_open ON impersonations(ended_at, expires_at)`,
+			`ALTER TABLE audit_log ADD COLUMN on_behalf_of TEXT NOT NULL DEFAULT ''`,
+			`CREATE INDEX IF NOT EXISTS idx_audit_log_on_behalf_of ON audit_log(on_behalf_of)`,
+		},
+		Down: []string{
+			`DROP INDEX IF EXISTS idx_audit_log_on_behalf_of`,
+			`ALTER TABLE audit_log DROP COLUMN on_behalf_of`,
+			`DROP TABLE IF EXISTS impersonations`,
+		},
+	},
+	{
+		Version: 16,
+		Name:    "retired_refresh_tokens",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS retired_refresh_tokens (
+				hash TEXT PRIMARY KEY,
+				session_id TEXT NOT NULL REFERENCES auth_sessions(id) ON DELETE CASCADE,
+				retired_at TIMESTAMPTZ NOT NULL
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_retired_refresh_tokens_session ON retired_refresh_tokens(session_id)`,
+			`INSERT INTO retired_refresh_tokens (hash, session_id, retired_at)
+				SELECT previous_hash, id, COALESCE(last_used_at, expires_at) FROM auth_sessions WHERE previous_hash IS NOT NULL`,
+			`DROP INDEX IF EXISTS idx_auth_sessions_previous`,
+			`ALTER TABLE auth_sessions DROP COLUMN previous_hash`,
+		},
+		Down: []string{
+			`ALTER TABLE auth_sessions ADD COLUMN previous_hash TEXT`,
+			`UPDATE auth_sessions SET previous_hash = (
+				SELECT hash FROM retired_refresh_tokens r
+				WHERE r.session_id = auth_sessions.id
+				ORDER BY r.retired_at DESC LIMIT 1)`,
+			`CREATE INDEX IF NOT EXISTS idx_auth_sessions_previous ON auth_sessions(previous_hash)`,
+			`DROP TABLE IF EXISTS retired_refresh_tokens`,
+		},
+	},
+	{
+		// SQLite only: PostgreSQL stores timestamps natively. Kept so both
+		// dialects share version numbers.
+		Version: 17,
+		Name:    "sqlite_time_format",
+	},
+	{
+		// The seeded super admin's password was public. It can no longer sign in
+		// until an operator sets a password with semsctl; the first real super
+		// admin comes from semsctl admin create. Not restored on rollback.
+		Version: 18,
+		Name:    "disable_seed_admin_password",
+		Up: []string{
+			`UPDATE users SET password_hash = '!'
+			WHERE email = 'superadmin@solar.com' AND password_hash = '$2a$10$vHv/WKOEYBysAKs4NKNA..GLvVuBi.1vAxvF3Dr5iHBSlJsNOaL1G'`,
+		},
+	},
+}
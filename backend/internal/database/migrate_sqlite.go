@@ -0,0 +1,717 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// sqliteMigrations are applied in version order and never edited once released
+var sqliteMigrations = []Migration{
+	{
+		Version: 1,
+		Name:    "baseline_schema",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS regions (
+				id TEXT PRIMARY KEY,
+				name TEXT NOT NULL,
+				state TEXT NOT NULL,
+				country TEXT NOT NULL,
+				timezone TEXT NOT NULL,
+				description TEXT,
+				status TEXT DEFAULT 'ACTIVE',
+				latitude REAL,
+				longitude REAL,
+				expected_users INTEGER DEFAULT 0,
+				expected_plants INTEGER DEFAULT 0,
+				capacity_mw REAL DEFAULT 0,
+				created_at TEXT,
+				updated_at TEXT
+			)`,
+			`CREATE TABLE IF NOT EXISTS users (
+				id TEXT PRIMARY KEY,
+				email TEXT UNIQUE NOT NULL,
+				password_hash TEXT NOT NULL,
+				role TEXT NOT NULL DEFAULT 'USER',
+				first_name TEXT,
+				last_name TEXT,
+				phone TEXT,
+				organization TEXT,
+				is_active INTEGER DEFAULT 1,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				profile_image TEXT,
+				address_line1 TEXT,
+				address_line2 TEXT,
+				city TEXT,
+				state TEXT,
+				pincode TEXT,
+				region TEXT,
+				latitude REAL,
+				longitude REAL,
+				admin_id TEXT REFERENCES users(id),
+				installer_id TEXT REFERENCES users(id),
+				plant_id TEXT REFERENCES solar_plants(id),
+				installation_status TEXT DEFAULT 'NOT_INSTALLED',
+				property_type TEXT,
+				avg_monthly_bill REAL,
+				roof_area_sqft REAL,
+				connection_type TEXT,
+				subsidy_interest INTEGER DEFAULT 0,
+				plant_capacity_kw REAL,
+				net_metering INTEGER DEFAULT 0,
+				inverter_brand TEXT,
+				discom_name TEXT,
+				consumer_number TEXT,
+				device_linked INTEGER DEFAULT 0,
+				device_id TEXT,
+				subsidy_applied INTEGER DEFAULT 0,
+				subsidy_status TEXT,
+				scheme_name TEXT,
+				application_id TEXT,
+				installation_date DATETIME,
+				last_data_received DATETIME,
+				project_cost REAL,
+				personnel_nexus_id TEXT
+			)`,
+			`CREATE TABLE IF NOT EXISTS devices (
+				id TEXT PRIMARY KEY,
+				user_id TEXT REFERENCES users(id) ON DELETE CASCADE,
+				device_name TEXT NOT NULL,
+				device_type TEXT NOT NULL,
+				api_key TEXT UNIQUE NOT NULL,
+				status TEXT DEFAULT 'ACTIVE',
+				location_lat REAL,
+				location_lng REAL,
+				installation_date DATETIME,
+				last_seen DATETIME,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				device_id TEXT,
+				name TEXT,
+				location TEXT,
+				is_active INTEGER DEFAULT 1
+			)`,
+			`CREATE TABLE IF NOT EXISTS energy_data (
+				id TEXT PRIMARY KEY,
+				device_id TEXT REFERENCES devices(id) ON DELETE CASCADE,
+				timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+				voltage REAL,
+				current REAL,
+				solar_power REAL,
+				load_power REAL DEFAULT 0,
+				grid_power REAL DEFAULT 0,
+				battery_level REAL,
+				temperature REAL,
+				humidity REAL,
+				solar_irradiance REAL,
+				grid_status INTEGER DEFAULT 0,
+				weather_condition TEXT,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_energy_data_device_timestamp ON energy_data(device_id, timestamp)`,
+			`CREATE INDEX IF NOT EXISTS idx_energy_data_timestamp ON energy_data(timestamp)`,
+			`CREATE INDEX IF NOT EXISTS idx_devices_user_id ON devices(user_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_devices_api_key ON devices(api_key)`,
+			`CREATE TABLE IF NOT EXISTS solar_plants (
+				id TEXT PRIMARY KEY,
+				name TEXT NOT NULL,
+				location TEXT NOT NULL,
+				region_id TEXT,
+				region TEXT NOT NULL,
+				capacity_kw REAL NOT NULL,
+				current_output_kw REAL DEFAULT 0,
+				efficiency REAL DEFAULT 85.00,
+				latitude REAL,
+				longitude REAL,
+				status TEXT DEFAULT 'ACTIVE',
+				description TEXT,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			)`,
+			`CREATE TABLE IF NOT EXISTS alerts (
+				id TEXT PRIMARY KEY,
+				plant_id TEXT,
+				device_id TEXT,
+				severity TEXT NOT NULL,
+				message TEXT NOT NULL,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				resolved BOOLEAN DEFAULT 0
+			)`,
+			`CREATE TABLE IF NOT EXISTS solar_profiles (
+				id TEXT PRIMARY KEY,
+				user_id TEXT REFERENCES users(id) ON DELETE CASCADE,
+				installation_status TEXT,
+				property_type TEXT,
+				admin_id TEXT,
+				installer_id TEXT,
+				avg_monthly_bill REAL,
+				roof_area_sqft REAL,
+				connection_type TEXT,
+				subsidy_interest INTEGER,
+				project_cost REAL,
+				plant_capacity_kw REAL,
+				installation_date DATETIME,
+				net_metering INTEGER,
+				inverter_brand TEXT,
+				discom_name TEXT,
+				consumer_number TEXT,
+				device_linked INTEGER,
+				device_id TEXT,
+				last_data_received DATETIME,
+				subsidy_applied INTEGER,
+				subsidy_status TEXT,
+				scheme_name TEXT,
+				application_id TEXT,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			)`,
+			`CREATE TABLE IF NOT EXISTS notifications (
+				id TEXT PRIMARY KEY,
+				user_id TEXT REFERENCES users(id) ON DELETE CASCADE,
+				type TEXT NOT NULL,
+				title TEXT NOT NULL,
+				message TEXT NOT NULL,
+				severity TEXT DEFAULT 'MEDIUM',
+				read INTEGER DEFAULT 0,
+				action_url TEXT,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			)`,
+			`CREATE TABLE IF NOT EXISTS notification_preferences (
+				user_id TEXT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+				email_enabled INTEGER DEFAULT 1,
+				sms_enabled INTEGER DEFAULT 0,
+				push_enabled INTEGER DEFAULT 1,
+				alert_types TEXT DEFAULT '["ALERT","WARNING","CRITICAL"]'
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_notifications_user_id ON notifications(user_id, created_at DESC)`,
+			`CREATE TABLE IF NOT EXISTS tickets (
+				id TEXT PRIMARY KEY,
+				user_id TEXT REFERENCES users(id) ON DELETE CASCADE,
+				installer_id TEXT,
+				subject TEXT NOT NULL,
+				description TEXT,
+				status TEXT DEFAULT 'OPEN',
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			)`,
+			`CREATE TABLE IF NOT EXISTS inventory_items (
+				id TEXT PRIMARY KEY,
+				name TEXT NOT NULL,
+				category TEXT NOT NULL,
+				brand TEXT,
+				model TEXT,
+				description TEXT,
+				price REAL,
+				stock_qty INTEGER DEFAULT 0,
+				image_url TEXT,
+				gallery TEXT,
+				specs TEXT,
+				is_active INTEGER DEFAULT 1,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS inventory_items`,
+			`DROP TABLE IF EXISTS tickets`,
+			`DROP TABLE IF EXISTS notification_preferences`,
+			`DROP TABLE IF EXISTS notifications`,
+			`DROP TABLE IF EXISTS solar_profiles`,
+			`DROP TABLE IF EXISTS alerts`,
+			`DROP TABLE IF EXISTS energy_data`,
+			`DROP TABLE IF EXISTS devices`,
+			`DROP TABLE IF EXISTS users`,
+			`DROP TABLE IF EXISTS solar_plants`,
+			`DROP TABLE IF EXISTS regions`,
+		},
+	},
+	{
+		Version: 2,
+		Name:    "seed_data",
+		Up: []string{
+			// Demo device for the simulator
+			`INSERT OR IGNORE INTO devices (id, user_id, device_name, device_type, api_key, status, location_lat, location_lng)
+			VALUES ('00000000-0000-0000-0000-000000000001', NULL, 'Demo Device', 'SIMULATOR', 'demo_api_key', 'ACTIVE', 28.6139, 77.2090)`,
+			`INSERT OR IGNORE INTO solar_plants (id, name, location, region, capacity_kw, current_output_kw, efficiency, latitude, longitude, status, description)
+			VALUES
+			('550e8400-e29b-41d4-a716-446655440001', 'Delhi North Plant', 'Rohini, Delhi', 'Delhi', 500.0, 320.5, 92.0, 28.7041, 77.1025, 'ACTIVE', 'Primary plant for North Delhi'),
+			('550e8400-e29b-41d4-a716-446655440002', 'Mumbai Coastal Solar', 'Marine Drive, Mumbai', 'Maharashtra', 750.0, 410.2, 88.0, 19.0760, 72.8777, 'ACTIVE', 'Coastal deployment with high humidity tolerance'),
+			('550e8400-e29b-41d4-a716-446655440003', 'Bangalore Tech Park', 'Electronic City, Bangalore', 'Karnataka', 1200.0, 850.0, 95.0, 12.9716, 77.5946, 'ACTIVE', 'Integration with IT hub micro-grid'),
+			('550e8400-e29b-41d4-a716-446655440004', 'Rajasthan Desert Solar', 'Jaisalmer', 'Rajasthan', 5000.0, 4200.0, 96.0, 26.9157, 70.9083, 'ACTIVE', 'Utility scale desert deployment')`,
+			// Initial super admin; the password is set once here and never reset by later boots
+			`INSERT OR IGNORE INTO users (id, email, password_hash, first_name, last_name, role)
+			VALUES ('00000000-0000-4000-a000-000000000001', 'superadmin@solar.com', '$2a$10$vHv/WKOEYBysAKs4NKNA..GLvVuBi.1vAxvF3Dr5iHBSlJsNOaL1G', 'Super', 'Admin', 'SUPER_ADMIN')`,
+		},
+		// The super admin is kept on rollback; other users reference it as their admin
+		Down: []string{
+			`DELETE FROM devices WHERE id = '00000000-0000-0000-0000-000000000001'`,
+			`DELETE FROM solar_plants WHERE id IN ('550e8400-e29b-41d4-a716-446655440001', '550e8400-e29b-41d4-a716-446655440002', '550e8400-e29b-41d4-a716-446655440003', '550e8400-e29b-41d4-a716-446655440004')`,
+		},
+	},
+	{
+		Version: 3,
+		Name:    "grafana_tokens",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS grafana_tokens (
+				id TEXT PRIMARY KEY,
+				user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				name TEXT NOT NULL,
+				token_prefix TEXT NOT NULL,
+				token_hash TEXT UNIQUE NOT NULL,
+				scope TEXT NOT NULL DEFAULT 'grafana:read',
+				last_used_at DATETIME,
+				revoked_at DATETIME,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS grafana_tokens`,
+		},
+	},
+	{
+		Version: 4,
+		Name:    "auth_sessions",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS auth_sessions (
+				id TEXT PRIMARY KEY,
+				user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				refresh_hash TEXT UNIQUE NOT NULL,
+				previous_hash TEXT,
+				user_agent TEXT,
+				ip_address TEXT,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				last_used_at DATETIME,
+				expires_at DATETIME NOT NULL,
+				revoked_at DATETIME
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_auth_sessions_user ON auth_sessions(user_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_auth_sessions_previous ON auth_sessions(previous_hash)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS auth_sessions`,
+		},
+	},
+	{
+		Version: 5,
+		Name:    "signing_keys",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS signing_keys (
+				kid TEXT PRIMARY KEY,
+				algorithm TEXT NOT NULL,
+				sealed_key TEXT NOT NULL,
+				created_at DATETIME NOT NULL,
+				retires_at DATETIME NOT NULL,
+				expires_at DATETIME NOT NULL
+			)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS signing_keys`,
+		},
+	},
+	{
+		Version: 6,
+		Name:    "account_tokens",
+		Up: []string{
+			`ALTER TABLE users ADD COLUMN email_verified_at DATETIME`,
+			// Accounts from before verification existed are trusted as they are
+			`UPDATE users SET email_verified_at = CURRENT_TIMESTAMP`,
+			`CREATE TABLE IF NOT EXISTS account_tokens (
+				id TEXT PRIMARY KEY,
+				user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				purpose TEXT NOT NULL,
+				token_hash TEXT UNIQUE NOT NULL,
+				created_at DATETIME NOT NULL,
+				expires_at DATETIME NOT NULL,
+				used_at DATETIME
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_account_tokens_user ON account_tokens(user_id, purpose)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS account_tokens`,
+			`ALTER TABLE users DROP COLUMN email_verified_at`,
+		},
+	},
+	{
+		Version: 7,
+		Name:    "two_factor",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS user_two_factor (
+				user_id TEXT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+				sealed_secret TEXT NOT NULL,
+				enabled_at DATETIME,
+				last_used_step INTEGER NOT NULL DEFAULT 0,
+				created_at DATETIME NOT NULL
+			)`,
+			`CREATE TABLE IF NOT EXISTS recovery_codes (
+				id TEXT PRIMARY KEY,
+				user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				code_hash TEXT NOT NULL,
+				created_at DATETIME NOT NULL,
+				used_at DATETIME
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_recovery_codes_user ON recovery_codes(user_id)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS recovery_codes`,
+			`DROP TABLE IF EXISTS user_two_factor`,
+		},
+	},
+	{
+		Version: 8,
+		Name:    "user_identities",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS user_identities (
+				id TEXT PRIMARY KEY,
+				provider TEXT NOT NULL,
+				subject TEXT NOT NULL,
+				user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				email TEXT NOT NULL,
+				provisioned BOOLEAN NOT NULL DEFAULT false,
+				created_at DATETIME NOT NULL,
+				last_login_at DATETIME,
+				UNIQUE (provider, subject)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_user_identities_user ON user_identities(user_id)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS user_identities`,
+		},
+	},
+	{
+		Version: 9,
+		Name:    "roles",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS roles (
+				name TEXT PRIMARY KEY,
+				description TEXT NOT NULL DEFAULT '',
+				scope TEXT NOT NULL,
+				permissions TEXT NOT NULL DEFAULT '',
+				created_at DATETIME NOT NULL,
+				updated_at DATETIME NOT NULL
+			)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS roles`,
+		},
+	},
+	{
+		Version: 10,
+		Name:    "api_tokens",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS api_tokens (
+				id TEXT PRIMARY KEY,
+				user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				name TEXT NOT NULL,
+				token_prefix TEXT NOT NULL,
+				token_hash TEXT UNIQUE NOT NULL,
+				scopes TEXT NOT NULL,
+				created_at DATETIME NOT NULL,
+				expires_at DATETIME NOT NULL,
+				last_used_at DATETIME,
+				last_used_ip TEXT,
+				revoked_at DATETIME
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_api_tokens_user ON api_tokens(user_id)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS api_tokens`,
+		},
+	},
+	{
+		Version: 11,
+		Name:    "audit_log",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS audit_log (
+				id TEXT PRIMARY KEY,
+				seq INTEGER UNIQUE NOT NULL,
+				created_at DATETIME NOT NULL,
+				actor_id TEXT NOT NULL,
+				actor_role TEXT NOT NULL,
+				action TEXT NOT NULL,
+				resource_type TEXT NOT NULL,
+				resource_id TEXT NOT NULL DEFAULT '',
+				changes TEXT NOT NULL DEFAULT '',
+				ip_address TEXT NOT NULL DEFAULT '',
+				prev_hash TEXT NOT NULL,
+				hash TEXT NOT NULL
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log(actor_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_audit_log_resource ON audit_log(resource_type, resource_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_audit_log_created ON audit_log(created_at)`,
+			`CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+			BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END`,
+			`CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+			BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS audit_log`,
+		},
+	},
+	{
+		Version: 12,
+		Name:    "device_keys",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS device_keys (
+				id TEXT PRIMARY KEY,
+				device_id TEXT NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+				key_prefix TEXT NOT NULL,
+				key_hash TEXT UNIQUE NOT NULL,
+				created_at DATETIME NOT NULL,
+				expires_at DATETIME,
+				last_used_at DATETIME,
+				last_used_ip TEXT,
+				revoked_at DATETIME
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_device_keys_device ON device_keys(device_id)`,
+			`ALTER TABLE devices ADD COLUMN key_prefix TEXT NOT NULL DEFAULT ''`,
+		},
+		Down: []string{
+			`ALTER TABLE devices DROP COLUMN key_prefix`,
+			`DROP TABLE IF EXISTS device_keys`,
+		},
+	},
+	{
+		Version: 13,
+		Name:    "device_signing",
+		Up: []string{
+			`ALTER TABLE devices ADD COLUMN signing_secret TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE devices ADD COLUMN require_signature BOOLEAN NOT NULL DEFAULT false`,
+		},
+		Down: []string{
+			`ALTER TABLE devices DROP COLUMN require_signature`,
+			`ALTER TABLE devices DROP COLUMN signing_secret`,
+		},
+	},
+	{
+		Version: 14,
+		Name:    "organizations",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS organizations (
+				id TEXT PRIMARY KEY,
+				name TEXT NOT NULL,
+				slug TEXT UNIQUE NOT NULL,
+				branding TEXT NOT NULL DEFAULT '{}',
+				settings TEXT NOT NULL DEFAULT '{}',
+				is_active BOOLEAN NOT NULL DEFAULT true,
+				created_at DATETIME NOT NULL,
+				updated_at DATETIME NOT NULL
+			)`,
+			`ALTER TABLE users ADD COLUMN org_id TEXT`,
+			`CREATE INDEX IF NOT EXISTS idx_users_org ON users(org_id)`,
+			`ALTER TABLE solar_plants ADD COLUMN org_id TEXT`,
+			`CREATE INDEX IF NOT EXISTS idx_solar_plants_org ON solar_plants(org_id)`,
+			`ALTER TABLE devices ADD COLUMN org_id TEXT`,
+			`CREATE INDEX IF NOT EXISTS idx_devices_org ON devices(org_id)`,
+			`ALTER TABLE inventory_items ADD COLUMN org_id TEXT`,
+			`CREATE INDEX IF NOT EXISTS idx_inventory_items_org ON inventory_items(org_id)`,
+			`ALTER TABLE tickets ADD COLUMN org_id TEXT`,
+			`CREATE INDEX IF NOT EXISTS idx_tickets_org ON tickets(org_id)`,
+		},
+		Down: []string{
+			`DROP INDEX IF EXISTS idx_tickets_org`,
+			`ALTER TABLE tickets DROP COLUMN org_id`,
+			`DROP INDEX IF EXISTS idx_inventory_items_org`,
+			`ALTER TABLE inventory_items DROP COLUMN org_id`,
+			`DROP INDEX IF EXISTS idx_devices_org`,
+			`ALTER TABLE devices DROP COLUMN org_id`,
+			`DROP INDEX IF EXISTS idx_solar_plants_org`,
+			`ALTER TABLE solar_plants DROP COLUMN org_id`,
+			`DROP INDEX IF EXISTS idx_users_org`,
+			`ALTER TABLE users DROP COLUMN org_id`,
+			`DROP TABLE IF EXISTS organizations`,
+		},
+	},
+	{
+		Version: 15,
+		Name:    "impersonations",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS impersonations (
+				id TEXT PRIMARY KEY,
+				admin_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				admin_role TEXT NOT NULL,
+				admin_session_id TEXT NOT NULL,
+				user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				reason TEXT NOT NULL,
+				read_only BOOLEAN NOT NULL DEFAULT true,
+				ip_address TEXT NOT NULL DEFAULT '',
+				started_at DATETIME NOT NULL,
+				expires_at DATETIME NOT NULL,
+				ended_at DATETIME,
+				end_reason TEXT NOT NULL DEFAULT ''
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_impersonations_user ON impersonations(user_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_impersonations_open ON impersonations(ended_at, expires_at)`,
+			`ALTER TABLE audit_log ADD COLUMN on_behalf_of TEXT NOT NULL DEFAULT ''`,
+			`CREATE INDEX IF NOT EXISTS idx_audit_log_on_behalf_of ON audit_log(on_behalf_of)`,
+		},
+		Down: []string{
+			`DROP INDEX IF EXISTS idx_audit_log_on_behalf_of`,
+			`ALTER TABLE audit_log DROP COLUMN on_behalf_of`,
+			`DROP TABLE IF EXISTS impersonations`,
+		},
+	},
+	{
+		Version: 16,
+		Name:    "retired_refresh_tokens",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS retired_refresh_tokens (
+				hash TEXT PRIMARY KEY,
+				session_id TEXT NOT NULL REFERENCES auth_sessions(id) ON DELETE CASCADE,
+				retired_at DATETIME NOT NULL
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_retired_refresh_tokens_session ON retired_refresh_tokens(session_id)`,
+			`INSERT INTO retired_refresh_tokens (hash, session_id, retired_at)
+				SELECT previous_hash, id, COALESCE(last_used_at, expires_at) FROM auth_sessions WHERE previous_hash IS NOT NULL`,
+			`DROP INDEX IF EXISTS idx_auth_sessions_previous`,
+			`ALTER TABLE auth_sessions DROP COLUMN previous_hash`,
+		},
+		Down: []string{
+			`ALTER TABLE auth_sessions ADD COLUMN previous_hash TEXT`,
+			`UPDATE auth_sessions SET previous_hash = (
+				SELECT hash FROM retired_refresh_tokens r
+				WHERE r.session_id = auth_sessions.id
+				ORDER BY r.retired_at DESC LIMIT 1)`,
+			`CREATE INDEX IF NOT EXISTS idx_auth_sessions_previous ON auth_sessions(previous_hash)`,
+			`DROP TABLE IF EXISTS retired_refresh_tokens`,
+		},
+	},
+	{
+		Version: 17,
+		Name:    "sqlite_time_format",
+		Data:    rewriteLegacyTimes,
+	},
+	{
+		// The seeded super admin's password was public. It can no longer sign in
+		// until an operator sets a password with semsctl; the first real super
+		// admin comes from semsctl admin create. Not restored on rollback.
+		Version: 18,
+		Name:    "disable_seed_admin_password",
+		Up: []string{
+			`UPDATE users SET password_hash = '!'
+			WHERE email = 'superadmin@solar.com' AND password_hash = '$2a$10$vHv/WKOEYBysAKs4NKNA..GLvVuBi.1vAxvF3Dr5iHBSlJsNOaL1G'`,
+		},
+	},
+}
+
+// legacyColumns were added by ALTERs in the unversioned migration list; a
+// database created before one of them may still lack it.
+var legacyColumns = []struct{ table, column, ddl string }{
+	{"users", "installer_id", "TEXT REFERENCES users(id)"},
+	{"users", "project_cost", "REAL"},
+	{"users", "plant_id", "TEXT REFERENCES solar_plants(id)"},
+	{"users", "personnel_nexus_id", "TEXT"},
+	{"energy_data", "load_power", "REAL DEFAULT 0"},
+	{"energy_data", "grid_power", "REAL DEFAULT 0"},
+	{"energy_data", "weather_condition", "TEXT"},
+}
+
+// rewriteLegacyTimes converts timestamps written before the driver was set to
+// _time_format=sqlite. Those use Go's time.String() layout, "2006-01-02
+// 15:04:05.999 -0700 MST m=+0.1", which strftime rejects; they become
+// "2006-01-02 15:04:05.999-07:00", the layout the driver now writes.
+func rewriteLegacyTimes(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT m.name, c.name FROM sqlite_master m, pragma_table_info(m.name) c
+		WHERE m.type = 'table' AND upper(c.type) IN ('DATETIME', 'TIMESTAMP')`)
+	if err != nil {
+		return err
+	}
+	var columns [][2]string
+	for rows.Next() {
+		var table, column string
+		if err := rows.Scan(&table, &column); err != nil {
+			rows.Close()
+			return err
+		}
+		columns = append(columns, [2]string{table, column})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	const legacy = `'[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9] [0-9][0-9]:[0-9][0-9]:[0-9][0-9]* [+-][0-9][0-9][0-9][0-9] *'`
+	for _, tc := range columns {
+		table, col := tc[0], `"`+tc[1]+`"`
+		// Drop the monotonic clock reading, then move the offset next to the
+		// time: the time ends at the first space after the date
+		for _, stmt := range []string{
+			fmt.Sprintf(`UPDATE %s SET %s = substr(%s, 1, instr(%s, ' m=') - 1) WHERE %s GLOB '* m=*'`,
+				table, col, col, col, col),
+			fmt.Sprintf(`UPDATE %s SET %s = substr(%s, 1, 10 + instr(substr(%s, 12), ' '))
+				|| substr(%s, 12 + instr(substr(%s, 12), ' '), 3) || ':'
+				|| substr(%s, 15 + instr(substr(%s, 12), ' '), 2)
+				WHERE %s GLOB %s`,
+				table, col, col, col, col, col, col, col, col, legacy),
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("%s.%s: %w", table, tc[1], err)
+			}
+		}
+	}
+	return nil
+}
+
+// adoptLegacySQLite brings a database built by the old statement list up to
+// the baseline schema so migration 1 only has to create what is missing.
+func adoptLegacySQLite(ctx context.Context) error {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Everything goes through tx: with a single-connection pool DB would block
+	hasTable := func(table string) bool {
+		var name string
+		return tx.QueryRowContext(ctx, Current.TableExistsQuery(), table).Scan(&name) == nil
+	}
+	hasColumn := func(table, column string) (bool, error) {
+		var n int
+		err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&n)
+		return n > 0, err
+	}
+
+	if hasTable("energy_data") {
+		oldPower, err := hasColumn("energy_data", "power")
+		if err != nil {
+			return err
+		}
+		solarPower, err := hasColumn("energy_data", "solar_power")
+		if err != nil {
+			return err
+		}
+		if oldPower && !solarPower {
+			if _, err := tx.ExecContext(ctx, `ALTER TABLE energy_data RENAME COLUMN power TO solar_power`); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, c := range legacyColumns {
+		if !hasTable(c.table) {
+			continue
+		}
+		ok, err := hasColumn(c.table, c.column)
+		if err != nil {
+			return err
+		}
+		if ok {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.table, c.column, c.ddl)); err != nil {
+			return fmt.Errorf("add %s.%s: %w", c.table, c.column, err)
+		}
+		log.Printf("🔧 Added missing column %s.%s", c.table, c.column)
+	}
+
+	// Seed rows from the first release used non-UUID ids
+	if hasTable("solar_plants") {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM solar_plants WHERE id IN ('p1', 'p2', 'p3', 'p4')`); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
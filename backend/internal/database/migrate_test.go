@@ -0,0 +1,158 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"sems-backend/internal/config"
+)
+
+func openTestDB(t *testing.T) {
+	t.Helper()
+	cfg := config.DatabaseConfig{Driver: "sqlite", Path: filepath.Join(t.TempDir(), "test.db"), MaxOpenConns: 1}
+	if err := InitDB(cfg); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(CloseDB)
+}
+
+func TestMigrateRollbackAndReapply(t *testing.T) {
+	openTestDB(t)
+	latest := sqliteMigrations[len(sqliteMigrations)-1]
+
+	if err := RunMigrations(); err != nil {
+		t.Fatal(err)
+	}
+	if v := GetMigrationState().Version; v != latest.Version {
+		t.Fatalf("version = %d, want %d", v, latest.Version)
+	}
+	// A second run applies nothing
+	if err := RunMigrations(); err != nil || GetMigrationState().Applied != 0 {
+		t.Fatalf("rerun: err=%v applied=%d", err, GetMigrationState().Applied)
+	}
+
+	if err := RollbackMigrations(1); err != nil {
+		t.Fatal(err)
+	}
+	records, err := MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := records[len(records)-1]; last.State != "pending" {
+		t.Fatalf("rolled back migration state = %q", last.State)
+	}
+
+	if err := RunMigrations(); err != nil || GetMigrationState().Applied != 1 {
+		t.Fatalf("reapply: err=%v applied=%d", err, GetMigrationState().Applied)
+	}
+}
+
+func TestEditedMigrationIsRejected(t *testing.T) {
+	openTestDB(t)
+	if err := RunMigrations(); err != nil {
+		t.Fatal(err)
+	}
+
+	original := sqliteMigrations
+	t.Cleanup(func() { sqliteMigrations = original })
+	edited := append([]Migration(nil), original...)
+	edited[0].Up = append([]string{"SELECT 1"}, edited[0].Up...)
+	sqliteMigrations = edited
+
+	err := RunMigrations()
+	if err == nil || !strings.Contains(err.Error(), "modified") {
+		t.Fatalf("expected checksum error, got %v", err)
+	}
+}
+
+func TestLegacyDatabaseIsAdopted(t *testing.T) {
+	openTestDB(t)
+	// Shape of a database created before installer_id and load_power existed
+	for _, stmt := range []string{
+		`CREATE TABLE users (id TEXT PRIMARY KEY, email TEXT UNIQUE NOT NULL, password_hash TEXT NOT NULL, role TEXT NOT NULL DEFAULT 'USER', first_name TEXT, last_name TEXT)`,
+		`CREATE TABLE energy_data (id TEXT PRIMARY KEY, device_id TEXT, timestamp DATETIME, power REAL)`,
+	} {
+		if _, err := DB.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := RunMigrations(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DB.Exec(`SELECT installer_id, personnel_nexus_id FROM users`); err != nil {
+		t.Errorf("users not upgraded: %v", err)
+	}
+	if _, err := DB.Exec(`SELECT solar_power, load_power FROM energy_data`); err != nil {
+		t.Errorf("energy_data not upgraded: %v", err)
+	}
+}
+
+func TestLegacyTimestampsAreRewritten(t *testing.T) {
+	openTestDB(t)
+	if err := RunMigrations(); err != nil {
+		t.Fatal(err)
+	}
+	// Roll back to just before the rewrite
+	steps := 0
+	for _, m := range sqliteMigrations {
+		if m.Name == "sqlite_time_format" || steps > 0 {
+			steps++
+		}
+	}
+	if err := RollbackMigrations(steps); err != nil {
+		t.Fatal(err)
+	}
+
+	// What the driver wrote before _time_format=sqlite, plus a current value
+	for i, stored := range []string{
+		"2026-03-01 10:00:00.123456789 +0530 IST m=+0.000123",
+		"2026-03-01 04:30:00.123456789 +0000 UTC",
+		"2026-02-28 23:30:00.123456789 -0500 -0500",
+		"2026-03-01 04:30:00.123456789+00:00",
+	} {
+		if _, err := DB.Exec(`INSERT INTO alerts (id, severity, message, created_at) VALUES (?, 'INFO', 'legacy', ?)`, i, stored); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := RunMigrations(); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := DB.Query(`SELECT id, strftime('%Y-%m-%d %H:%M:%f', created_at) FROM alerts WHERE message = 'legacy'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	n := 0
+	for rows.Next() {
+		var id string
+		var utc sql.NullString
+		if err := rows.Scan(&id, &utc); err != nil {
+			t.Fatal(err)
+		}
+		if utc.String != "2026-03-01 04:30:00.123" {
+			t.Errorf("row %s reads as %q in UTC", id, utc.String)
+		}
+		n++
+	}
+	if n != 4 {
+		t.Fatalf("read %d rows", n)
+	}
+}
+
+func TestSeededSuperAdminCannotSignIn(t *testing.T) {
+	openTestDB(t)
+	if err := RunMigrations(); err != nil {
+		t.Fatal(err)
+	}
+	var hash string
+	if err := DB.QueryRow(`SELECT password_hash FROM users WHERE email = 'superadmin@solar.com'`).Scan(&hash); err != nil {
+		t.Fatal(err)
+	}
+	if hash != "!" {
+		t.Errorf("seeded super admin keeps password hash %q", hash)
+	}
+}
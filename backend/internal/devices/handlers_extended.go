@@ -1,8 +1,12 @@
 package devices
 
 import (
+	"errors"
 	"net/http"
+	"sems-backend/internal/audit"
+	"sems-backend/internal/authz"
 	"sems-backend/internal/database"
+	"sems-backend/internal/timectx"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -69,16 +73,8 @@ func GetDevicesHandler(c *gin.Context) {
 // @Router /admin/devices/{id} [get]
 // @Router /superadmin/devices/{id} [get]
 func GetDeviceHandler(c *gin.Context) {
-	deviceID := c.Param("id")
-	id, err := uuid.Parse(deviceID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid device ID"})
-		return
-	}
-
-	device, err := GetDeviceByID(id)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+	device, ok := authorizedDevice(c, authz.DevicesRead)
+	if !ok {
 		return
 	}
 
@@ -99,10 +95,8 @@ func GetDeviceHandler(c *gin.Context) {
 // @Router /user/devices/{id} [put]
 // @Router /admin/devices/{id} [put]
 func UpdateDeviceHandler(c *gin.Context) {
-	deviceID := c.Param("id")
-	id, err := uuid.Parse(deviceID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid device ID"})
+	device, ok := authorizedDevice(c, authz.DevicesWrite)
+	if !ok {
 		return
 	}
 
@@ -111,12 +105,7 @@ func UpdateDeviceHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
 		return
 	}
-
-	device, err := GetDeviceByID(id)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
-		return
-	}
+	before := *device
 
 	// Update fields
 	if req.Name != "" {
@@ -129,11 +118,11 @@ func UpdateDeviceHandler(c *gin.Context) {
 		device.IsActive = *req.IsActive
 	}
 
-	err = UpdateDevice(device)
-	if err != nil {
+	if err := UpdateDevice(device); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update device"})
 		return
 	}
+	audit.Record(c, "device.update", "device", device.ID.String(), before, device)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Device updated successfully",
@@ -153,18 +142,16 @@ func UpdateDeviceHandler(c *gin.Context) {
 // @Router /user/devices/{id} [delete]
 // @Router /admin/devices/{id} [delete]
 func DeleteDeviceHandler(c *gin.Context) {
-	deviceID := c.Param("id")
-	id, err := uuid.Parse(deviceID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid device ID"})
+	device, ok := authorizedDevice(c, authz.DevicesWrite)
+	if !ok {
 		return
 	}
 
-	err = DeleteDevice(id)
-	if err != nil {
+	if err := DeleteDevice(device.ID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete device"})
 		return
 	}
+	audit.Record(c, "device.delete", "device", device.ID.String(), device, nil)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Device deleted successfully"})
 }
@@ -180,35 +167,193 @@ func DeleteDeviceHandler(c *gin.Context) {
 // @Security BearerAuth
 // @Router /user/devices/{id}/regenerate-key [post]
 func RegenerateAPIKeyHandler(c *gin.Context) {
-	deviceID := c.Param("id")
-	id, err := uuid.Parse(deviceID)
+	device, ok := authorizedDevice(c, authz.DevicesWrite)
+	if !ok {
+		return
+	}
+
+	apiKey, err := RotateAPIKey(device.ID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid device ID"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to regenerate API key"})
 		return
 	}
+	audit.Record(c, "device.regenerate_key", "device", device.ID.String(),
+		gin.H{"key_prefix": device.KeyPrefix}, gin.H{"key_prefix": keyPrefix(apiKey)})
 
-	device, err := GetDeviceByID(id)
+	response := gin.H{
+		"message":    "API key regenerated successfully",
+		"api_key":    apiKey,
+		"key_prefix": keyPrefix(apiKey),
+	}
+	if keyOverlap > 0 {
+		response["previous_key_expires_at"] = time.Now().UTC().Add(keyOverlap)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary List device API keys
+// @Description The device's current and earlier keys with their status and last use; keys are shown by prefix only
+// @Tags Devices
+// @Produce json
+// @Param id path string true "Device ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /user/devices/{id}/keys [get]
+// @Router /admin/devices/{id}/keys [get]
+// @Router /superadmin/devices/{id}/keys [get]
+func ListAPIKeysHandler(c *gin.Context) {
+	device, ok := authorizedDevice(c, authz.DevicesRead)
+	if !ok {
+		return
+	}
+
+	keys, err := ListAPIKeys(device.ID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch API keys"})
 		return
 	}
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
 
-	// Generate new API key
-	device.APIKey = generateAPIKey()
-	device.UpdatedAt = time.Now()
+// @Summary Revoke device API key
+// @Description End a replaced key's rotation overlap early. The current key can only be replaced by regenerating it.
+// @Tags Devices
+// @Produce json
+// @Param id path string true "Device ID"
+// @Param keyId path string true "Key ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security BearerAuth
+// @Router /user/devices/{id}/keys/{keyId} [delete]
+// @Router /admin/devices/{id}/keys/{keyId} [delete]
+func RevokeAPIKeyHandler(c *gin.Context) {
+	device, ok := authorizedDevice(c, authz.DevicesWrite)
+	if !ok {
+		return
+	}
+
+	err := RevokeAPIKey(device.ID, c.Param("keyId"))
+	switch {
+	case errors.Is(err, ErrKeyNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	case errors.Is(err, ErrCurrentKey):
+		c.JSON(http.StatusConflict, gin.H{"error": "The current key can only be replaced by regenerating it"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+		return
+	}
+	audit.Record(c, "device.revoke_key", "device", device.ID.String(), nil, gin.H{"key_id": c.Param("keyId")})
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
 
-	err = UpdateDevice(device)
+// @Summary Create device signing secret
+// @Description Issue a new secret for signing ingestion requests, replacing any earlier one. The secret is shown once.
+// @Tags Devices
+// @Produce json
+// @Param id path string true "Device ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /user/devices/{id}/signing-secret [post]
+// @Router /admin/devices/{id}/signing-secret [post]
+func CreateSigningSecretHandler(c *gin.Context) {
+	device, ok := authorizedDevice(c, authz.DevicesWrite)
+	if !ok {
+		return
+	}
+
+	secret, err := CreateSigningSecret(device.ID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to regenerate API key"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create signing secret"})
 		return
 	}
+	audit.Record(c, "device.signing_secret", "device", device.ID.String(),
+		gin.H{"signing_enabled": device.SigningEnabled}, gin.H{"signing_enabled": true})
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "API key regenerated successfully",
-		"api_key": device.APIKey,
+		"message":           "Signing secret created",
+		"signing_secret":    secret,
+		"require_signature": device.RequireSignature,
 	})
 }
 
+// @Summary Remove device signing secret
+// @Description Stop signature checks for a device; its unsigned requests are accepted again
+// @Tags Devices
+// @Produce json
+// @Param id path string true "Device ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /user/devices/{id}/signing-secret [delete]
+// @Router /admin/devices/{id}/signing-secret [delete]
+func DeleteSigningSecretHandler(c *gin.Context) {
+	device, ok := authorizedDevice(c, authz.DevicesWrite)
+	if !ok {
+		return
+	}
+
+	if err := RemoveSigningSecret(device.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove signing secret"})
+		return
+	}
+	audit.Record(c, "device.signing_secret", "device", device.ID.String(),
+		gin.H{"signing_enabled": device.SigningEnabled, "require_signature": device.RequireSignature},
+		gin.H{"signing_enabled": false, "require_signature": false})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Signing secret removed"})
+}
+
+type SignaturePolicyRequest struct {
+	RequireSignature *bool `json:"require_signature" binding:"required"`
+}
+
+// @Summary Set device signature policy
+// @Description Decide whether the device's unsigned ingestion requests are still accepted
+// @Tags Devices
+// @Accept json
+// @Produce json
+// @Param id path string true "Device ID"
+// @Param policy body SignaturePolicyRequest true "Signature policy"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security BearerAuth
+// @Router /user/devices/{id}/signing-policy [put]
+// @Router /admin/devices/{id}/signing-policy [put]
+func SetSignaturePolicyHandler(c *gin.Context) {
+	device, ok := authorizedDevice(c, authz.DevicesWrite)
+	if !ok {
+		return
+	}
+
+	var req SignaturePolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "require_signature is required"})
+		return
+	}
+
+	err := SetSignaturePolicy(device.ID, *req.RequireSignature)
+	if errors.Is(err, ErrNoSigningSecret) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Create a signing secret before requiring signatures"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update signature policy"})
+		return
+	}
+	audit.Record(c, "device.signature_policy", "device", device.ID.String(),
+		gin.H{"require_signature": device.RequireSignature}, gin.H{"require_signature": *req.RequireSignature})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Signature policy updated", "require_signature": *req.RequireSignature})
+}
+
 // CreateUserDeviceHandler - Allows users to create their own devices
 // @Summary Create user device
 // @Description Create a new device for the current user
@@ -279,21 +424,15 @@ func CreateUserDeviceHandler(c *gin.Context) {
 // @Router /admin/devices/{id}/power [get]
 // @Router /superadmin/devices/{id}/power [get]
 func GetDevicePowerHandler(c *gin.Context) {
-	deviceID := c.Param("id")
-	id, err := uuid.Parse(deviceID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid device ID"})
+	device, ok := authorizedDevice(c, authz.DevicesRead)
+	if !ok {
 		return
 	}
 
-	device, err := GetDeviceByID(id)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
-		return
-	}
+	id := device.ID
 
-	// Get power data for the last 24 hours
-	startDate := time.Now().AddDate(0, 0, -1)
+	// Get power data for the current day in the device's local timezone
+	startDate := timectx.StartOfDay(time.Now(), timectx.ForDevice(id.String())).UTC()
 
 	query := `
 		SELECT 
@@ -315,7 +454,7 @@ func GetDevicePowerHandler(c *gin.Context) {
 		TotalConsumption float64 `db:"total_consumption"`
 	}
 
-	err = database.DB.QueryRow(query, id, startDate).Scan(
+	err := database.DB.QueryRow(query, id, startDate).Scan(
 		&powerData.CurrentPower,
 		&powerData.TodayEnergy,
 		&powerData.AvgPower,
@@ -363,7 +502,7 @@ func GetDevicePowerHandler(c *gin.Context) {
 
 // GetAllDevicesHandler - Returns all devices across all users (for admin)
 // @Summary Get all devices (Admin)
-// @Description Get all devices in the system
+// @Description Get all devices in the caller's scope
 // @Tags SuperAdmin
 // @Accept json
 // @Produce json
@@ -379,7 +518,13 @@ func GetAllDevicesHandler(c *gin.Context) {
 	searchTerm := c.Query("search")
 	statusFilter := c.Query("status")
 
-	devices, err := GetAllDevices(searchTerm, statusFilter)
+	scope, err := authz.Caller(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	devices, err := GetAllDevices(scope, searchTerm, statusFilter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch devices", "details": err.Error()})
 		return
@@ -390,3 +535,19 @@ func GetAllDevicesHandler(c *gin.Context) {
 		"count":   len(devices),
 	})
 }
+
+// authorizedDevice loads the device named in the path if the caller owns it or
+// holds perm over its owner. Devices out of reach are reported as not found.
+func authorizedDevice(c *gin.Context, perm authz.Permission) (*Device, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid device ID"})
+		return nil, false
+	}
+	device, err := GetDeviceByID(id)
+	if err != nil || !authz.Allowed(c, perm, authz.Resource{Kind: authz.Device, OwnerID: uuidToString(device.UserID)}) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return nil, false
+	}
+	return device, true
+}
@@ -0,0 +1,314 @@
+package devices
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"sems-backend/internal/config"
+	"sems-backend/internal/database"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const apiKeyPrefix = "sdk_"
+
+var (
+	keyOverlap = 24 * time.Hour
+	keyMaxIdle = 90 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidAPIKey = errors.New("invalid api key")
+	ErrKeyNotFound   = errors.New("api key not found")
+	ErrCurrentKey    = errors.New("the current key can only be replaced by rotation")
+)
+
+// Configure applies the device key and signing settings
+func Configure(cfg config.DevicesConfig) {
+	keyOverlap = cfg.KeyOverlap.Duration
+	keyMaxIdle = cfg.KeyMaxIdle.Duration
+	signatureSkew = cfg.SignatureSkew.Duration
+	demoIngestion = cfg.DemoIngestion
+}
+
+// APIKey describes one of a device's keys; only its prefix is kept in the clear
+type APIKey struct {
+	ID         string     `json:"id"`
+	Prefix     string     `json:"prefix"`
+	Status     string     `json:"status"` // active, expiring, expired or revoked
+	Current    bool       `json:"current"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+func newAPIKey() string {
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		// crypto/rand does not fail on supported platforms
+		panic(err)
+	}
+	return apiKeyPrefix + hex.EncodeToString(secret)
+}
+
+// keyPrefix is the part of a key shown to identify it
+func keyPrefix(plain string) string {
+	n := len(apiKeyPrefix) + 8
+	if len(plain) < len(apiKeyPrefix) || plain[:len(apiKeyPrefix)] != apiKeyPrefix {
+		n = 8 // keys issued before hashing were bare UUIDs
+	}
+	if len(plain) < n {
+		return plain
+	}
+	return plain[:n]
+}
+
+func hashKey(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// storeKey records plain as the device's current key
+func storeKey(db execer, deviceID uuid.UUID, plain string, now time.Time) error {
+	if _, err := db.Exec(`
+		INSERT INTO device_keys (id, device_id, key_prefix, key_hash, created_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		uuid.New().String(), deviceID, keyPrefix(plain), hashKey(plain), now); err != nil {
+		return err
+	}
+	// devices.api_key holds the current key's hash
+	_, err := db.Exec(`UPDATE devices SET api_key = ?, key_prefix = ?, updated_at = ? WHERE id = ?`,
+		hashKey(plain), keyPrefix(plain), now, deviceID)
+	return err
+}
+
+// RotateAPIKey issues a new API key for a device. Earlier keys keep working
+// for the configured overlap so devices in the field can be updated.
+func RotateAPIKey(id uuid.UUID) (string, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var exists int
+	if err := tx.QueryRow(`SELECT 1 FROM devices WHERE id = ?`, id).Scan(&exists); err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	if keyOverlap > 0 {
+		until := now.Add(keyOverlap)
+		_, err = tx.Exec(`
+			UPDATE device_keys SET expires_at = ?
+			WHERE device_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)`, until, id, until)
+	} else {
+		_, err = tx.Exec(`
+			UPDATE device_keys SET revoked_at = ?
+			WHERE device_id = ? AND revoked_at IS NULL`, now, id)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	key := newAPIKey()
+	if err := storeKey(tx, id, key, now); err != nil {
+		return "", err
+	}
+	return key, tx.Commit()
+}
+
+// keyUse is what AuthenticateAPIKey read about the presented key
+type keyUse struct {
+	id       string
+	lastUsed sql.NullTime
+	lastIP   string
+}
+
+// AuthenticateAPIKey resolves a key presented by a device. Revoked keys, keys
+// past their overlap and keys idle for longer than the configured limit are
+// refused. Use is not recorded until the request is accepted; see RecordKeyUse.
+func AuthenticateAPIKey(plain string) (*Device, error) {
+	var keyID string
+	var createdAt time.Time
+	var expiresAt, lastUsed, revokedAt sql.NullTime
+	var lastIP, userID sql.NullString
+	device := &Device{}
+	err := database.DB.QueryRow(`
+		SELECT k.id, k.created_at, k.expires_at, k.last_used_at, k.last_used_ip, k.revoked_at,
+		       d.id, d.user_id, d.device_type, d.is_active, d.signing_secret, d.require_signature
+		FROM device_keys k
+		JOIN devices d ON d.id = k.device_id
+		WHERE k.key_hash = ?`, hashKey(plain)).Scan(
+		&keyID, &createdAt, &expiresAt, &lastUsed, &lastIP, &revokedAt,
+		&device.ID, &userID, &device.DeviceType, &device.IsActive, &device.signingSecret, &device.RequireSignature)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	device.UserID = stringToUUID(userID.String)
+	device.SigningEnabled = device.signingSecret != ""
+
+	now := time.Now().UTC()
+	if status := keyStatus(now, createdAt, expiresAt, lastUsed, revokedAt); status == "expired" || status == "revoked" {
+		return nil, ErrInvalidAPIKey
+	}
+
+	device.key = keyUse{id: keyID, lastUsed: lastUsed, lastIP: lastIP.String}
+	return device, nil
+}
+
+// RecordKeyUse notes when and from where the device's key was last used. Call
+// it once a request has passed every check, so rejected requests neither keep
+// an idle key alive nor overwrite its address.
+func RecordKeyUse(device *Device, ip string) {
+	k := device.key
+	if k.id == "" {
+		return
+	}
+	// One write a minute is enough unless the device moved
+	now := time.Now().UTC()
+	if k.lastUsed.Valid && now.Sub(k.lastUsed.Time) < time.Minute && k.lastIP == ip {
+		return
+	}
+	if _, err := database.DB.Exec(`
+		UPDATE device_keys SET last_used_at = ?, last_used_ip = ? WHERE id = ?`, now, ip, k.id); err != nil {
+		log.Printf("Recording use of device key %s: %v", k.id, err)
+	}
+}
+
+func keyStatus(now, createdAt time.Time, expiresAt, lastUsed, revokedAt sql.NullTime) string {
+	switch {
+	case revokedAt.Valid:
+		return "revoked"
+	case expiresAt.Valid && !now.Before(expiresAt.Time):
+		return "expired"
+	}
+	if keyMaxIdle > 0 {
+		since := createdAt
+		if lastUsed.Valid {
+			since = lastUsed.Time
+		}
+		if now.Sub(since) >= keyMaxIdle {
+			return "expired"
+		}
+	}
+	if expiresAt.Valid {
+		return "expiring"
+	}
+	return "active"
+}
+
+// ListAPIKeys returns a device's keys, newest first
+func ListAPIKeys(deviceID uuid.UUID) ([]APIKey, error) {
+	var current string
+	if err := database.DB.QueryRow(`SELECT api_key FROM devices WHERE id = ?`, deviceID).Scan(&current); err != nil {
+		return nil, err
+	}
+	rows, err := database.DB.Query(`
+		SELECT id, key_prefix, key_hash, created_at, expires_at, last_used_at, last_used_ip, revoked_at
+		FROM device_keys
+		WHERE device_id = ?
+		ORDER BY created_at DESC`, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now().UTC()
+	keys := []APIKey{}
+	for rows.Next() {
+		var k APIKey
+		var hash string
+		var expiresAt, lastUsed, revokedAt sql.NullTime
+		var lastIP sql.NullString
+		if err := rows.Scan(&k.ID, &k.Prefix, &hash, &k.CreatedAt, &expiresAt, &lastUsed, &lastIP, &revokedAt); err != nil {
+			return nil, err
+		}
+		k.Status = keyStatus(now, k.CreatedAt, expiresAt, lastUsed, revokedAt)
+		k.Current = hash == current
+		k.ExpiresAt = nullTimeToTime(expiresAt)
+		k.LastUsedAt = nullTimeToTime(lastUsed)
+		k.LastUsedIP = lastIP.String
+		k.RevokedAt = nullTimeToTime(revokedAt)
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey ends a replaced key's overlap early
+func RevokeAPIKey(deviceID uuid.UUID, keyID string) error {
+	var hash, current string
+	err := database.DB.QueryRow(`
+		SELECT k.key_hash, d.api_key FROM device_keys k
+		JOIN devices d ON d.id = k.device_id
+		WHERE k.id = ? AND k.device_id = ? AND k.revoked_at IS NULL`, keyID, deviceID).Scan(&hash, &current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrKeyNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if hash == current {
+		return ErrCurrentKey
+	}
+	_, err = database.DB.Exec(`UPDATE device_keys SET revoked_at = ? WHERE id = ?`, time.Now().UTC(), keyID)
+	return err
+}
+
+// SecureLegacyKeys moves keys stored in plain text before key hashing into
+// device_keys. It only touches devices whose api_key is not yet a key hash,
+// so running it again does nothing.
+func SecureLegacyKeys() (int, error) {
+	rows, err := database.DB.Query(`
+		SELECT d.id, d.api_key FROM devices d
+		WHERE NOT EXISTS (SELECT 1 FROM device_keys k WHERE k.key_hash = d.api_key)`)
+	if err != nil {
+		return 0, err
+	}
+	type legacy struct {
+		id  uuid.UUID
+		key string
+	}
+	var pending []legacy
+	for rows.Next() {
+		var l legacy
+		if err := rows.Scan(&l.id, &l.key); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		pending = append(pending, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(pending) == 0 {
+		return 0, nil
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	now := time.Now().UTC()
+	for _, l := range pending {
+		if err := storeKey(tx, l.id, l.key, now); err != nil {
+			return 0, err
+		}
+	}
+	return len(pending), tx.Commit()
+}
@@ -0,0 +1,108 @@
+package devices
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"sems-backend/internal/config"
+	"sems-backend/internal/database"
+
+	"github.com/google/uuid"
+)
+
+func openTestDB(t *testing.T) {
+	t.Helper()
+	if err := database.InitDB(config.DatabaseConfig{Driver: "sqlite", Path: filepath.Join(t.TempDir(), "devices.db"), MaxOpenConns: 1}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(database.CloseDB)
+	if err := database.RunMigrations(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAPIKeyRotationAndExpiry(t *testing.T) {
+	openTestDB(t)
+	Configure(config.DevicesConfig{KeyOverlap: config.Duration{Duration: time.Hour}, KeyMaxIdle: config.Duration{Duration: 30 * 24 * time.Hour}})
+
+	device, err := CreateDevice(uuid.New(), "Roof", "INVERTER", "Pune")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := device.APIKey
+
+	// Only the hash is stored
+	var stored int
+	database.DB.QueryRow(`SELECT COUNT(*) FROM devices WHERE api_key = ?`, first).Scan(&stored)
+	if stored != 0 {
+		t.Fatal("plaintext key stored")
+	}
+
+	if got, err := AuthenticateAPIKey(first); err != nil || got.ID != device.ID {
+		t.Fatalf("authenticate: %v", err)
+	}
+	// Authenticating alone records nothing; the request may still be refused
+	if keys, _ := ListAPIKeys(device.ID); len(keys) != 1 || keys[0].LastUsedAt != nil {
+		t.Fatalf("use recorded before the request was accepted: %+v", keys)
+	}
+
+	second, err := RotateAPIKey(device.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Both keys work during the overlap
+	for _, key := range []string{first, second} {
+		got, err := AuthenticateAPIKey(key)
+		if err != nil {
+			t.Fatalf("key %s during overlap: %v", keyPrefix(key), err)
+		}
+		RecordKeyUse(got, "10.0.0.9")
+	}
+
+	keys, err := ListAPIKeys(device.ID)
+	if err != nil || len(keys) != 2 {
+		t.Fatalf("keys: %+v %v", keys, err)
+	}
+	var current, old APIKey
+	for _, k := range keys {
+		if k.Current {
+			current = k
+		} else {
+			old = k
+		}
+	}
+	if old.Status != "expiring" || old.LastUsedIP != "10.0.0.9" || old.LastUsedAt == nil {
+		t.Fatalf("previous key: %+v", old)
+	}
+
+	if err := RevokeAPIKey(device.ID, current.ID); !errors.Is(err, ErrCurrentKey) {
+		t.Fatalf("current key revoked: %v", err)
+	}
+	if err := RevokeAPIKey(device.ID, old.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AuthenticateAPIKey(first); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Fatalf("revoked key accepted: %v", err)
+	}
+
+	// A key unused for longer than the idle limit expires
+	database.DB.Exec(`UPDATE device_keys SET last_used_at = ? WHERE key_hash = ?`, time.Now().UTC().Add(-31*24*time.Hour), hashKey(second))
+	if _, err := AuthenticateAPIKey(second); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Fatalf("idle key accepted: %v", err)
+	}
+
+	// Keys from before hashing keep working once converted
+	legacy := uuid.New().String()
+	database.DB.Exec(`INSERT INTO devices (id, device_name, device_type, api_key) VALUES (?, 'Old', 'INVERTER', ?)`, uuid.New().String(), legacy)
+	if n, err := SecureLegacyKeys(); err != nil || n != 2 { // the seeded demo device too
+		t.Fatalf("legacy keys secured: %d %v", n, err)
+	}
+	if n, _ := SecureLegacyKeys(); n != 0 {
+		t.Fatalf("second run converted %d keys", n)
+	}
+	if _, err := AuthenticateAPIKey(legacy); err != nil {
+		t.Fatalf("legacy key: %v", err)
+	}
+}
@@ -2,7 +2,10 @@ package devices
 
 import (
 	"database/sql"
+	"sems-backend/internal/authz"
 	"sems-backend/internal/database"
+	"sems-backend/internal/metrics"
+	"sems-backend/internal/timectx"
 	"time"
 
 	"github.com/google/uuid"
@@ -33,29 +36,44 @@ func CreateDevice(userID uuid.UUID, name, deviceType, location string) (*Device,
 	namePtr := &name
 	locationPtr := &location
 	now := time.Now()
+	key := newAPIKey()
 	device := &Device{
 		ID:         uuid.New(),
 		UserID:     &userID,
 		Name:       namePtr,
 		DeviceType: deviceType,
 		Location:   locationPtr,
-		APIKey:     generateAPIKey(),
+		APIKey:     key,
+		KeyPrefix:  keyPrefix(key),
 		IsActive:   true,
 		CreatedAt:  now,
 		UpdatedAt:  now,
 	}
 
-	query := `
-		INSERT INTO devices (id, user_id, name, device_type, location, api_key, is_active, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
 
-	_, err := database.DB.Exec(query,
-		device.ID, uuidToString(device.UserID), device.Name, device.DeviceType,
-		device.Location, device.APIKey, device.IsActive, device.CreatedAt, device.UpdatedAt)
+	// api_key is unique, so it starts as the key's hash before storeKey sets it
+	query := `
+		INSERT INTO devices (id, user_id, device_name, name, device_type, location, api_key, is_active, created_at, updated_at, org_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, (SELECT org_id FROM users WHERE id = ?))`
 
+	// The device belongs to its owner's organisation
+	_, err = tx.Exec(query,
+		device.ID, uuidToString(device.UserID), name, device.Name, device.DeviceType,
+		device.Location, hashKey(key), device.IsActive, device.CreatedAt, device.UpdatedAt, uuidToString(device.UserID))
 	if err != nil {
 		return nil, err
 	}
+	if err := storeKey(tx, device.ID, key, now.UTC()); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
 
 	return device, nil
 }
@@ -80,20 +98,22 @@ func stringToUUID(s string) *uuid.UUID {
 
 func GetDevicesByUserID(userID uuid.UUID, deviceType string, activeOnly bool) ([]*Device, error) {
 	query := `
-		SELECT d.id, d.device_id, d.user_id, d.name, d.device_type, d.location, d.api_key, d.is_active, d.last_seen, d.created_at, d.updated_at,
+		SELECT d.id, d.device_id, d.user_id, d.name, d.device_type, d.location, d.key_prefix, d.signing_secret <> '', d.require_signature, d.is_active, d.last_seen, d.created_at, d.updated_at,
 			   COALESCE(u.first_name || ' ' || u.last_name, 'Unassigned') as user_name,
-			   COALESCE((SELECT MAX(solar_power) FROM energy_data WHERE device_id = d.id AND timestamp >= datetime('now', '-1 day')), 0) as current_power,
-			   COALESCE((SELECT SUM(solar_power) FROM energy_data WHERE device_id = d.id AND timestamp >= datetime('now', '-1 day')), 0) as today_energy,
-			   COALESCE((SELECT MAX(solar_power) FROM energy_data WHERE device_id = d.id AND timestamp >= datetime('now', '-1 day')), 0) as peak_power,
-			   COALESCE((SELECT AVG(solar_power) FROM energy_data WHERE device_id = d.id AND timestamp >= datetime('now', '-1 day')), 0) as avg_power,
-			   COALESCE((SELECT AVG(battery_level) FROM energy_data WHERE device_id = d.id AND timestamp >= datetime('now', '-1 day')), 0) as avg_battery,
-			   COALESCE((SELECT SUM(load_power) FROM energy_data WHERE device_id = d.id AND timestamp >= datetime('now', '-1 day')), 0) as total_consumption,
+			   COALESCE((SELECT MAX(solar_power) FROM energy_data WHERE device_id = d.id AND timestamp >= ?), 0) as current_power,
+			   COALESCE((SELECT SUM(solar_power) FROM energy_data WHERE device_id = d.id AND timestamp >= ?), 0) as today_energy,
+			   COALESCE((SELECT MAX(solar_power) FROM energy_data WHERE device_id = d.id AND timestamp >= ?), 0) as peak_power,
+			   COALESCE((SELECT AVG(solar_power) FROM energy_data WHERE device_id = d.id AND timestamp >= ?), 0) as avg_power,
+			   COALESCE((SELECT AVG(battery_level) FROM energy_data WHERE device_id = d.id AND timestamp >= ?), 0) as avg_battery,
+			   COALESCE((SELECT SUM(load_power) FROM energy_data WHERE device_id = d.id AND timestamp >= ?), 0) as total_consumption,
 			   0 as efficiency
 		FROM devices d
 		LEFT JOIN users u ON d.user_id = u.id
 		WHERE d.user_id = ?`
 
-	args := []interface{}{userID}
+	// "Today" starts at the owner's local midnight rather than a rolling 24 hours
+	since := timectx.StartOfDay(time.Now(), timectx.ForUser(userID.String())).UTC()
+	args := []interface{}{since, since, since, since, since, since, userID}
 
 	if deviceType != "" {
 		query += " AND d.device_type = ?"
@@ -122,7 +142,7 @@ func GetDevicesByUserID(userID uuid.UUID, deviceType string, activeOnly bool) ([
 		var lastSeen sql.NullTime
 		err := rows.Scan(
 			&device.ID, &deviceID, &userIDStr, &name, &device.DeviceType,
-			&location, &device.APIKey, &device.IsActive, &lastSeen,
+			&location, &device.KeyPrefix, &device.SigningEnabled, &device.RequireSignature, &device.IsActive, &lastSeen,
 			&device.CreatedAt, &device.UpdatedAt, &device.UserName,
 			&device.CurrentPower, &device.TodayEnergy, &device.PeakPower,
 			&device.AvgPower, &device.AvgBattery, &device.TotalConsumption, &device.Efficiency,
@@ -141,26 +161,32 @@ func GetDevicesByUserID(userID uuid.UUID, deviceType string, activeOnly bool) ([
 	return devices, nil
 }
 
-func GetAllDevices(searchTerm string, statusFilter string) ([]*Device, error) {
+// GetAllDevices lists the devices whose owners scope may see
+func GetAllDevices(scope *authz.Subject, searchTerm string, statusFilter string) ([]*Device, error) {
 	if database.DB == nil {
 		return []*Device{}, nil
 	}
 
 	query := `
-		SELECT d.id, d.device_id, d.user_id, d.name, d.device_type, d.location, d.api_key, d.is_active, d.last_seen, d.created_at, d.updated_at,
+		SELECT d.id, d.device_id, d.user_id, d.name, d.device_type, d.location, d.key_prefix, d.signing_secret <> '', d.require_signature, d.is_active, d.last_seen, d.created_at, d.updated_at,
 			   COALESCE(u.first_name || ' ' || u.last_name, 'Unassigned') as user_name,
-			   COALESCE((SELECT MAX(solar_power) FROM energy_data WHERE device_id = d.id AND timestamp >= datetime('now', '-1 day')), 0) as current_power,
-			   COALESCE((SELECT SUM(solar_power) FROM energy_data WHERE device_id = d.id AND timestamp >= datetime('now', '-1 day')), 0) as today_energy,
-			   COALESCE((SELECT MAX(solar_power) FROM energy_data WHERE device_id = d.id AND timestamp >= datetime('now', '-1 day')), 0) as peak_power,
-			   COALESCE((SELECT AVG(solar_power) FROM energy_data WHERE device_id = d.id AND timestamp >= datetime('now', '-1 day')), 0) as avg_power,
-			   COALESCE((SELECT AVG(battery_level) FROM energy_data WHERE device_id = d.id AND timestamp >= datetime('now', '-1 day')), 0) as avg_battery,
-			   COALESCE((SELECT SUM(load_power) FROM energy_data WHERE device_id = d.id AND timestamp >= datetime('now', '-1 day')), 0) as total_consumption,
+			   COALESCE((SELECT MAX(solar_power) FROM energy_data WHERE device_id = d.id AND timestamp >= ?), 0) as current_power,
+			   COALESCE((SELECT SUM(solar_power) FROM energy_data WHERE device_id = d.id AND timestamp >= ?), 0) as today_energy,
+			   COALESCE((SELECT MAX(solar_power) FROM energy_data WHERE device_id = d.id AND timestamp >= ?), 0) as peak_power,
+			   COALESCE((SELECT AVG(solar_power) FROM energy_data WHERE device_id = d.id AND timestamp >= ?), 0) as avg_power,
+			   COALESCE((SELECT AVG(battery_level) FROM energy_data WHERE device_id = d.id AND timestamp >= ?), 0) as avg_battery,
+			   COALESCE((SELECT SUM(load_power) FROM energy_data WHERE device_id = d.id AND timestamp >= ?), 0) as total_consumption,
 			   0 as efficiency
 		FROM devices d
 		LEFT JOIN users u ON d.user_id = u.id
 		WHERE 1=1`
 
-	args := []interface{}{}
+	since := time.Now().Add(-24 * time.Hour).UTC()
+	args := []interface{}{since, since, since, since, since, since}
+
+	filter, filterArgs := scope.Filter("u")
+	query += filter
+	args = append(args, filterArgs...)
 
 	if searchTerm != "" {
 		query += " AND (d.name LIKE ? OR d.device_id LIKE ? OR d.location LIKE ?)"
@@ -193,7 +219,7 @@ func GetAllDevices(searchTerm string, statusFilter string) ([]*Device, error) {
 		var lastSeen sql.NullTime
 		err := rows.Scan(
 			&device.ID, &deviceID, &userIDStr, &name, &device.DeviceType,
-			&location, &device.APIKey, &device.IsActive, &lastSeen,
+			&location, &device.KeyPrefix, &device.SigningEnabled, &device.RequireSignature, &device.IsActive, &lastSeen,
 			&device.CreatedAt, &device.UpdatedAt, &device.UserName,
 			&device.CurrentPower, &device.TodayEnergy, &device.PeakPower,
 			&device.AvgPower, &device.AvgBattery, &device.TotalConsumption, &device.Efficiency,
@@ -215,7 +241,7 @@ func GetAllDevices(searchTerm string, statusFilter string) ([]*Device, error) {
 func GetDeviceByID(id uuid.UUID) (*Device, error) {
 	device := &Device{}
 	query := `
-		SELECT d.id, d.device_id, d.user_id, d.name, d.device_type, d.location, d.api_key, d.is_active, d.last_seen, d.created_at, d.updated_at,
+		SELECT d.id, d.device_id, d.user_id, d.name, d.device_type, d.location, d.key_prefix, d.signing_secret <> '', d.require_signature, d.is_active, d.last_seen, d.created_at, d.updated_at,
 			   COALESCE(u.first_name || ' ' || u.last_name, 'Unassigned') as user_name
 		FROM devices d
 		LEFT JOIN users u ON d.user_id = u.id
@@ -228,7 +254,7 @@ func GetDeviceByID(id uuid.UUID) (*Device, error) {
 	var lastSeen sql.NullTime
 	err := database.DB.QueryRow(query, id).Scan(
 		&device.ID, &deviceID, &userIDStr, &name, &device.DeviceType,
-		&location, &device.APIKey, &device.IsActive, &lastSeen,
+		&location, &device.KeyPrefix, &device.SigningEnabled, &device.RequireSignature, &device.IsActive, &lastSeen,
 		&device.CreatedAt, &device.UpdatedAt, &device.UserName,
 	)
 
@@ -263,38 +289,22 @@ func DeleteDevice(id uuid.UUID) error {
 	return err
 }
 
-func GetDeviceByAPIKey(apiKey string) (*Device, error) {
-	device := &Device{}
-	query := `
-		SELECT d.id, d.device_id, d.user_id, d.name, d.device_type, d.location, d.api_key, d.is_active, d.last_seen, d.created_at, d.updated_at,
-			   COALESCE(u.first_name || ' ' || u.last_name, 'Unassigned') as user_name
+// OnlineWindow is how recently a device must have reported to count as online
+const OnlineWindow = 15 * time.Minute
+
+// RecordStatusMetrics refreshes the online/offline device gauge; registered as a scrape hook
+func RecordStatusMetrics() {
+	var total, online float64
+	err := database.DB.QueryRow(`
+		SELECT COUNT(*),
+		       COUNT(CASE WHEN EXISTS (
+		           SELECT 1 FROM energy_data e WHERE e.device_id = d.id AND e.timestamp >= ?
+		       ) THEN 1 END)
 		FROM devices d
-		LEFT JOIN users u ON d.user_id = u.id
-		WHERE d.api_key = ? AND d.is_active = true`
-
-	var deviceID sql.NullString
-	var userIDStr sql.NullString
-	var name sql.NullString
-	var location sql.NullString
-	var lastSeen sql.NullTime
-	err := database.DB.QueryRow(query, apiKey).Scan(
-		&device.ID, &deviceID, &userIDStr, &name, &device.DeviceType,
-		&location, &device.APIKey, &device.IsActive, &lastSeen,
-		&device.CreatedAt, &device.UpdatedAt, &device.UserName,
-	)
-
+		WHERE d.is_active = true`, time.Now().Add(-OnlineWindow).UTC()).Scan(&total, &online)
 	if err != nil {
-		return nil, err
+		return
 	}
-
-	device.DeviceID = nullStringToString(deviceID)
-	device.UserID = stringToUUID(userIDStr.String)
-	device.Name = nullStringToString(name)
-	device.Location = nullStringToString(location)
-	device.LastSeen = nullTimeToTime(lastSeen)
-	return device, nil
-}
-
-func generateAPIKey() string {
-	return uuid.New().String()
+	metrics.Devices.WithLabelValues("online").Set(online)
+	metrics.Devices.WithLabelValues("offline").Set(total - online)
 }
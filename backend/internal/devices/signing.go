@@ -0,0 +1,156 @@
+package devices
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sems-backend/internal/database"
+	"sems-backend/internal/keys"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// A device with a signing secret may sign its requests. The signature is the
+// hex HMAC-SHA256, under the secret, of "<timestamp>.<nonce>.<body>", where
+// timestamp is in Unix seconds and nonce is a random string used only once.
+const (
+	TimestampHeader = "X-SEMS-Timestamp"
+	NonceHeader     = "X-SEMS-Nonce"
+	SignatureHeader = "X-SEMS-Signature"
+)
+
+var (
+	signatureSkew = 5 * time.Minute
+	demoIngestion = false
+)
+
+var (
+	ErrSignatureRequired = errors.New("device requires signed requests")
+	ErrInvalidSignature  = errors.New("invalid request signature")
+	ErrStaleRequest      = errors.New("request timestamp outside the allowed window")
+	ErrReplayedRequest   = errors.New("request nonce already used")
+	ErrNoSigningSecret   = errors.New("device has no signing secret")
+)
+
+// seenNonces remembers each device's nonces until their timestamps fall out
+// of the skew window, after which a replay is refused as stale anyway
+var seenNonces = struct {
+	sync.Mutex
+	expires map[string]time.Time
+}{expires: map[string]time.Time{}}
+
+// DemoIngestion reports whether sim_ and demo_ keys may write to the demo
+// device
+func DemoIngestion() bool {
+	return demoIngestion
+}
+
+func signingLabel(id uuid.UUID) string {
+	return "device-signing:" + id.String()
+}
+
+// VerifySignature checks the signature headers of a request from d against
+// its raw body. Unsigned requests pass unless the device requires signing.
+func VerifySignature(d *Device, body []byte, header http.Header, now time.Time) error {
+	ts, nonce, signature := header.Get(TimestampHeader), header.Get(NonceHeader), header.Get(SignatureHeader)
+	if ts == "" && nonce == "" && signature == "" {
+		if d.RequireSignature {
+			return ErrSignatureRequired
+		}
+		return nil
+	}
+	if d.signingSecret == "" || len(nonce) < 16 || len(nonce) > 64 {
+		return ErrInvalidSignature
+	}
+	seconds, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	at := time.Unix(seconds, 0)
+	if at.Before(now.Add(-signatureSkew)) || at.After(now.Add(signatureSkew)) {
+		return ErrStaleRequest
+	}
+
+	secret, err := keys.Unseal(d.signingSecret, signingLabel(d.ID))
+	if err != nil {
+		return err
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(ts + "." + nonce + "."))
+	mac.Write(body)
+	got, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(got, mac.Sum(nil)) {
+		return ErrInvalidSignature
+	}
+
+	// Only a valid signature spends its nonce, so forged requests cannot
+	// block a device's genuine ones
+	key := d.ID.String() + ":" + nonce
+	seenNonces.Lock()
+	defer seenNonces.Unlock()
+	if expires, ok := seenNonces.expires[key]; ok && now.Before(expires) {
+		return ErrReplayedRequest
+	}
+	seenNonces.expires[key] = at.Add(signatureSkew)
+	return nil
+}
+
+// PruneNonces forgets nonces whose requests can no longer be replayed; run it
+// periodically
+func PruneNonces(ctx context.Context) {
+	seenNonces.Lock()
+	defer seenNonces.Unlock()
+	now := time.Now()
+	for key, expires := range seenNonces.expires {
+		if !now.Before(expires) {
+			delete(seenNonces.expires, key)
+		}
+	}
+}
+
+// CreateSigningSecret gives a device a new signing secret, replacing any
+// earlier one. The secret is stored sealed and returned once.
+func CreateSigningSecret(id uuid.UUID) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	secret := hex.EncodeToString(raw)
+	sealed, err := keys.Seal([]byte(secret), signingLabel(id))
+	if err != nil {
+		return "", err
+	}
+	if _, err := database.DB.Exec(`UPDATE devices SET signing_secret = ?, updated_at = ? WHERE id = ?`,
+		sealed, time.Now(), id); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// RemoveSigningSecret turns signing off for a device
+func RemoveSigningSecret(id uuid.UUID) error {
+	_, err := database.DB.Exec(`UPDATE devices SET signing_secret = '', require_signature = false, updated_at = ? WHERE id = ?`,
+		time.Now(), id)
+	return err
+}
+
+// SetSignaturePolicy decides whether a device's unsigned requests are still
+// accepted
+func SetSignaturePolicy(id uuid.UUID, require bool) error {
+	var secret string
+	if err := database.DB.QueryRow(`SELECT signing_secret FROM devices WHERE id = ?`, id).Scan(&secret); err != nil {
+		return err
+	}
+	if require && secret == "" {
+		return ErrNoSigningSecret
+	}
+	_, err := database.DB.Exec(`UPDATE devices SET require_signature = ?, updated_at = ? WHERE id = ?`, require, time.Now(), id)
+	return err
+}
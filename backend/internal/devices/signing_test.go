@@ -0,0 +1,99 @@
+package devices
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"sems-backend/internal/config"
+
+	"github.com/google/uuid"
+)
+
+func signedHeader(secret string, at time.Time, nonce string, body []byte) http.Header {
+	ts := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "." + nonce + "."))
+	mac.Write(body)
+	h := http.Header{}
+	h.Set(TimestampHeader, ts)
+	h.Set(NonceHeader, nonce)
+	h.Set(SignatureHeader, hex.EncodeToString(mac.Sum(nil)))
+	return h
+}
+
+func TestSignedIngestion(t *testing.T) {
+	openTestDB(t)
+	Configure(config.DevicesConfig{SignatureSkew: config.Duration{Duration: 5 * time.Minute}})
+
+	created, err := CreateDevice(uuid.New(), "Roof", "INVERTER", "Pune")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetSignaturePolicy(created.ID, true); !errors.Is(err, ErrNoSigningSecret) {
+		t.Fatalf("signatures required without a secret: %v", err)
+	}
+	secret, err := CreateSigningSecret(created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	device, err := AuthenticateAPIKey(created.APIKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := []byte(`{"api_key":"k","solar_power":3}`)
+	now := time.Now()
+
+	// Optional until the policy says otherwise
+	if err := VerifySignature(device, body, http.Header{}, now); err != nil {
+		t.Fatalf("unsigned request refused: %v", err)
+	}
+	if err := VerifySignature(device, body, signedHeader(secret, now, "nonce-0000000001", body), now); err != nil {
+		t.Fatalf("signed request: %v", err)
+	}
+
+	cases := []struct {
+		name   string
+		header http.Header
+		want   error
+	}{
+		{"replayed nonce", signedHeader(secret, now, "nonce-0000000001", body), ErrReplayedRequest},
+		{"altered body", signedHeader(secret, now, "nonce-0000000002", []byte(`{"solar_power":9}`)), ErrInvalidSignature},
+		{"wrong secret", signedHeader("guess", now, "nonce-0000000003", body), ErrInvalidSignature},
+		{"old timestamp", signedHeader(secret, now.Add(-6*time.Minute), "nonce-0000000004", body), ErrStaleRequest},
+		{"future timestamp", signedHeader(secret, now.Add(6*time.Minute), "nonce-0000000005", body), ErrStaleRequest},
+		{"short nonce", signedHeader(secret, now, "n1", body), ErrInvalidSignature},
+	}
+	for _, tc := range cases {
+		if err := VerifySignature(device, body, tc.header, now); !errors.Is(err, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, err, tc.want)
+		}
+	}
+	// A refused request does not spend its nonce
+	if err := VerifySignature(device, body, signedHeader(secret, now, "nonce-0000000002", body), now); err != nil {
+		t.Fatalf("nonce of a refused request: %v", err)
+	}
+
+	if err := SetSignaturePolicy(created.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	device, _ = AuthenticateAPIKey(created.APIKey)
+	if err := VerifySignature(device, body, http.Header{}, now); !errors.Is(err, ErrSignatureRequired) {
+		t.Fatalf("unsigned request accepted: %v", err)
+	}
+
+	// Removing the secret also lifts the requirement
+	if err := RemoveSigningSecret(created.ID); err != nil {
+		t.Fatal(err)
+	}
+	device, _ = AuthenticateAPIKey(created.APIKey)
+	if device.SigningEnabled || device.RequireSignature || VerifySignature(device, body, http.Header{}, now) != nil {
+		t.Fatalf("signing still on: %+v", device)
+	}
+}
@@ -2,6 +2,8 @@ package energy
 
 import (
 	"sems-backend/internal/database"
+	"sems-backend/internal/metrics"
+	"sems-backend/internal/timectx"
 	"time"
 
 	"github.com/google/uuid"
@@ -31,8 +33,8 @@ type Alert struct {
 func CheckAlert(data *EnergyData) ([]Alert, error) {
 	var alerts []Alert
 
-	// Check for zero power output (during expected daylight hours)
-	hour := time.Now().Hour()
+	// Check for zero power output (during expected daylight hours at the device's location)
+	hour := timectx.Now(timectx.ForDevice(data.DeviceID.String())).Hour()
 	if hour >= 6 && hour <= 18 {
 		if data.SolarPower == 0 {
 			alert := Alert{
@@ -145,10 +147,32 @@ func saveAlert(alert *Alert) error {
 		alert.CreatedAt,
 		alert.Resolved,
 	)
+	if err == nil {
+		metrics.AlertsRaised.WithLabelValues(string(alert.Severity), "rules").Inc()
+	}
 
 	return err
 }
 
+// RecordAlertMetrics refreshes the open-alert gauge; registered as a scrape hook
+func RecordAlertMetrics() {
+	rows, err := database.DB.Query(`SELECT severity, COUNT(*) FROM alerts WHERE resolved = false GROUP BY severity`)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	metrics.OpenAlerts.Reset()
+	for rows.Next() {
+		var severity string
+		var count float64
+		if err := rows.Scan(&severity, &count); err != nil {
+			continue
+		}
+		metrics.OpenAlerts.WithLabelValues(severity).Set(count)
+	}
+}
+
 // GetAlerts retrieves alerts with optional filters
 func GetAlerts(plantID *uuid.UUID, resolved *bool, limit int) ([]Alert, error) {
 	query := `
@@ -1,35 +1,28 @@
 package energy
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"sems-backend/internal/database"
+	"sems-backend/internal/metrics"
 	"sems-backend/internal/notifications"
+	"sems-backend/internal/timectx"
 	"time"
 
 	"github.com/google/uuid"
 )
 
-// CheckAnomalies runs a periodic check on all active devices to detect issues.
-// In a real production system, this would be a separate worker service.
-func StartAnomalyDetectionWorker(interval time.Duration) {
-	ticker := time.NewTicker(interval)
-	go func() {
-		for range ticker.C {
-			checkAllDevices()
-		}
-	}()
+// RunAnomalyScan checks all active devices for issues. It is scheduled by the
+// lifecycle manager and stops early when ctx is cancelled during shutdown.
+func RunAnomalyScan(ctx context.Context) {
+	checkAllDevices(ctx)
 }
 
-func checkAllDevices() {
-	// Only check during sunlight hours (approx 9 AM to 4 PM)
-	now := time.Now()
-	hour := now.Hour()
-	if hour < 9 || hour > 16 {
-		return
-	}
-
+func checkAllDevices(ctx context.Context) {
 	log.Println("🔍 Running anomaly detection scan...")
+	start := time.Now()
+	defer func() { metrics.AnomalyRunDuration.Observe(time.Since(start).Seconds()) }()
 
 	// Fetch all active devices with their latest power reading
 	// Using a custom query to join with users for capacity info
@@ -40,10 +33,10 @@ func checkAllDevices() {
 			   u.email
 		FROM devices d
 		JOIN users u ON d.user_id = u.id
-		WHERE d.status = 'ACTIVE' AND d.is_active = 1
+		WHERE d.status = 'ACTIVE' AND d.is_active = true
 	`
 
-	rows, err := database.DB.Query(query)
+	rows, err := database.DB.QueryContext(ctx, query)
 	if err != nil {
 		log.Printf("Error querying devices for anomaly detection: %v", err)
 		return
@@ -51,6 +44,11 @@ func checkAllDevices() {
 	defer rows.Close()
 
 	for rows.Next() {
+		if ctx.Err() != nil {
+			log.Println("Anomaly scan interrupted by shutdown")
+			return
+		}
+
 		var deviceID, userIDStr, deviceName, email string
 		var currentPower, capacity float64
 
@@ -63,6 +61,12 @@ func checkAllDevices() {
 			continue
 		}
 
+		// Only check during sunlight hours (approx 9 AM to 4 PM) in the device's local time
+		hour := timectx.Now(timectx.ForUser(userIDStr)).Hour()
+		if hour < 9 || hour > 16 {
+			continue
+		}
+
 		// ANOMALY RULE 1: Severe Underperformance
 		// If current power is less than 10% of capacity during peak hours (11 AM - 2 PM)
 		if hour >= 11 && hour <= 14 {
@@ -73,6 +77,7 @@ func checkAllDevices() {
 				log.Printf("⚠️ Anomaly detected for %s (%s): Low power %.2f kW vs Cap %.2f kW", deviceName, email, currentPower, capacity)
 
 				// Create Notification
+				metrics.AlertsRaised.WithLabelValues("CRITICAL", "anomaly").Inc()
 				notifications.CreateNotification(
 					userID,
 					"ALERT",
@@ -86,6 +91,7 @@ func checkAllDevices() {
 
 		// ANOMALY RULE 2: Zero Generation during day
 		if currentPower == 0 {
+			metrics.AlertsRaised.WithLabelValues("HIGH", "anomaly").Inc()
 			notifications.CreateNotification(
 				userID,
 				"WARNING",
@@ -1,13 +1,27 @@
 package energy
 
 import (
+	"sems-backend/internal/config"
 	"sems-backend/internal/database"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
+var (
+	defaultTariff = 8.0 // currency per kWh
+	co2Factor     = 0.7 // kg CO2 avoided per kWh
+)
+
+// Configure applies energy economics and the AI service location
+func Configure(cfg config.EnergyConfig, ai config.AIConfig) {
+	defaultTariff = cfg.DefaultTariff
+	co2Factor = cfg.CO2FactorKgKWh
+	AIServiceURL = strings.TrimRight(ai.URL, "/")
+}
+
 type EnergyData struct {
 	ID           uuid.UUID `json:"id" db:"id"`
 	DeviceID     uuid.UUID `json:"device_id" db:"device_id"`
@@ -4,6 +4,8 @@ import (
 	"log"
 	"net/http"
 	"sems-backend/internal/devices"
+	"sems-backend/internal/orgs"
+	"sems-backend/internal/timectx"
 	"sems-backend/internal/users"
 	"time"
 
@@ -17,6 +19,9 @@ type FinancialStats struct {
 	ProjectCost     float64 `json:"project_cost"`
 	PaybackProgress float64 `json:"payback_progress"`
 	TariffRate      float64 `json:"tariff_rate"`
+	// Current billing period, aligned to the user's local calendar month
+	BillingPeriodStart time.Time `json:"billing_period_start"`
+	BillingPeriodEnd   time.Time `json:"billing_period_end"`
 }
 
 func GetFinancialStatsHandler(c *gin.Context) {
@@ -27,10 +32,10 @@ func GetFinancialStatsHandler(c *gin.Context) {
 	}
 	u := user.(*users.User)
 
-	// Default tariff if not set (e.g. 8 INR/kWh)
+	// Default tariff if not set, the organisation's before the deployment's
 	tariff := u.TariffRate
 	if tariff == 0 {
-		tariff = 8.0
+		tariff = orgs.Tariff(u.ID, defaultTariff)
 	}
 
 	// Calculate total energy generated
@@ -98,11 +103,15 @@ func GetFinancialStatsHandler(c *gin.Context) {
 		}
 	}
 
+	periodStart := timectx.StartOfMonth(time.Now(), timectx.ForUser(u.ID))
+
 	c.JSON(http.StatusOK, FinancialStats{
-		TotalSavings:    savings,
-		ROIPercentage:   roi,
-		ProjectCost:     projectCost,
-		PaybackProgress: progress,
-		TariffRate:      tariff,
+		TotalSavings:       savings,
+		ROIPercentage:      roi,
+		ProjectCost:        projectCost,
+		PaybackProgress:    progress,
+		TariffRate:         tariff,
+		BillingPeriodStart: periodStart,
+		BillingPeriodEnd:   periodStart.AddDate(0, 1, 0),
 	})
 }
@@ -3,9 +3,12 @@ package energy
 import (
 	"fmt"
 	"net/http"
+	"sems-backend/internal/authz"
 	"sems-backend/internal/database"
+	"sems-backend/internal/orgs"
+	"sems-backend/internal/timectx"
+	"sort"
 	"strconv"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -100,9 +103,10 @@ func GetEnergyAnalyticsHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"analytics": analytics})
 }
 
-// GetEnergyHistory retrieves historical energy data for a user
+// GetEnergyHistory retrieves historical energy data for a user.
+// The window covers whole days in the user's local timezone.
 func GetEnergyHistory(userID uuid.UUID, days int, deviceID string) ([]*EnergyData, error) {
-	startDate := time.Now().AddDate(0, 0, -days)
+	startDate := timectx.WindowStart(days, timectx.ForUser(userID.String())).UTC()
 
 	var query string
 	var args []interface{}
@@ -164,8 +168,8 @@ func GetEnergyAnalytics(userID uuid.UUID) (*EnergyAnalytics, error) {
 		Savings:    SavingsStats{},
 	}
 
-	// Get last 30 days data
-	startDate := time.Now().AddDate(0, 0, -30)
+	// Get last 30 days data, starting at the user's local midnight
+	startDate := timectx.WindowStart(30, timectx.ForUser(userID.String())).UTC()
 
 	query := `
 		SELECT
@@ -194,14 +198,14 @@ func GetEnergyAnalytics(userID uuid.UUID) (*EnergyAnalytics, error) {
 	netEnergy := analytics.Generated.Total - analytics.Consumed.Total
 	if netEnergy > 0 {
 		analytics.Savings.TotalEnergy = netEnergy
-		analytics.Savings.EstimatedSavings = netEnergy * 8 // ₹8 per kWh
+		analytics.Savings.EstimatedSavings = netEnergy * orgs.Tariff(userID.String(), defaultTariff)
 	} else {
 		analytics.Savings.TotalEnergy = 0
 		analytics.Savings.EstimatedSavings = 0
 	}
 
-	// CO2 reduction (0.7 kg per kWh)
-	analytics.Savings.CO2Reduction = analytics.Generated.Total * 0.7
+	// CO2 reduction (configured kg per kWh)
+	analytics.Savings.CO2Reduction = analytics.Generated.Total * co2Factor
 
 	return analytics, nil
 }
@@ -244,8 +248,7 @@ type SavingsStats struct {
 // @Security BearerAuth
 // @Router /superadmin/energy/trend [get]
 func GetGlobalEnergyTrendHandler(c *gin.Context) {
-	currentUserRole := c.GetString("role")
-	if currentUserRole != "SUPER_ADMIN" {
+	if !authz.Has(c, authz.AnalyticsGlobal) {
 		c.JSON(403, gin.H{"error": "Access denied"})
 		return
 	}
@@ -253,53 +256,92 @@ func GetGlobalEnergyTrendHandler(c *gin.Context) {
 	region := c.Query("region")
 	period := c.DefaultQuery("period", "month")
 
-	interval := "-30 days"
-	groupBy := "%Y-%m-%d"
+	days := 30
+	groupBy := "day"
 	switch period {
 	case "week":
-		interval = "-7 days"
-		groupBy = "%Y-%m-%d"
+		days = 7
+		groupBy = "day"
 	case "quarter":
-		interval = "-90 days"
-		groupBy = "%Y-%m-%d" // Aggregate daily but show more points
+		days = 90
+		groupBy = "day" // Aggregate daily but show more points
 	case "year":
-		interval = "-365 days"
-		groupBy = "%Y-%m"
+		days = 365
+		groupBy = "month"
 	}
 
+	// Buckets follow the region's local calendar; without a region filter the default timezone is used
+	loc := timectx.Default()
+	if region != "" {
+		loc = timectx.ForRegion(region)
+	}
+	startDate := timectx.WindowStart(days, loc)
+
+	window := &SeriesQuery{Start: startDate, End: startDate.AddDate(0, 0, days), Location: loc}
+	trend, err := globalTrend(region, groupBy, window)
+	if err != nil {
+		fmt.Printf("Error fetching energy trend: %v\n", err)
+		c.JSON(500, gin.H{"error": "Failed to fetch energy trend: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"trend": trend})
+}
+
+// globalTrend totals solar and load per local day or month of the window. Each
+// side of a DST change is bucketed with its own offset, then merged by label.
+func globalTrend(region, groupBy string, window *SeriesQuery) ([]AnalyticsPoint, error) {
+	totals := make(map[string]*AnalyticsPoint)
+	for _, seg := range zoneSegments(window) {
+		if err := addTrendSegment(totals, region, groupBy, seg); err != nil {
+			return nil, err
+		}
+	}
+
+	trend := make([]AnalyticsPoint, 0, len(totals))
+	for _, tp := range totals {
+		trend = append(trend, *tp)
+	}
+	sort.Slice(trend, func(i, j int) bool { return trend[i].Label < trend[j].Label })
+	return trend, nil
+}
+
+// addTrendSegment adds the local day or month totals of one offset segment
+func addTrendSegment(totals map[string]*AnalyticsPoint, region, groupBy string, seg zoneSegment) error {
 	query := `
 		SELECT 
-			strftime('` + groupBy + `', ed.timestamp) as time_bucket,
+			` + database.Current.LocalDate("ed.timestamp", groupBy, seg.offset) + ` as time_bucket,
 			COALESCE(SUM(ed.solar_power), 0) as total_solar,
 			COALESCE(SUM(ed.load_power), 0) as total_load
 		FROM energy_data ed
 		JOIN users u ON ed.device_id = u.device_id
-		WHERE ed.timestamp >= datetime('now', '` + interval + `')`
+		WHERE ed.timestamp >= ? AND ed.timestamp < ?`
 
-	params := []interface{}{}
+	params := []interface{}{seg.start.UTC(), seg.end.UTC()}
 	if region != "" {
 		query += " AND u.region = ?"
 		params = append(params, region)
 	}
 
-	query += ` GROUP BY time_bucket ORDER BY time_bucket ASC`
+	query += ` GROUP BY time_bucket`
 
 	rows, err := database.DB.Query(query, params...)
 	if err != nil {
-		fmt.Printf("Error fetching energy trend: %v\n", err)
-		c.JSON(500, gin.H{"error": "Failed to fetch energy trend: " + err.Error()})
-		return
+		return err
 	}
 	defer rows.Close()
 
-	var trend []AnalyticsPoint
 	for rows.Next() {
 		var tp AnalyticsPoint
 		if err := rows.Scan(&tp.Label, &tp.Solar, &tp.Load); err != nil {
 			continue
 		}
-		trend = append(trend, tp)
+		if total, ok := totals[tp.Label]; ok {
+			total.Solar += tp.Solar
+			total.Load += tp.Load
+		} else {
+			totals[tp.Label] = &tp
+		}
 	}
-
-	c.JSON(200, gin.H{"trend": trend})
+	return rows.Err()
 }
@@ -1,13 +1,18 @@
 package energy
 
 import (
+	"errors"
+	"io"
 	"net/http"
 	"sems-backend/internal/database"
 	"sems-backend/internal/devices"
+	"sems-backend/internal/metrics"
+	"sems-backend/internal/ratelimit"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/google/uuid"
 )
 
@@ -21,21 +26,49 @@ type DataIngestionRequest struct {
 	Humidity     float64 `json:"humidity"`
 }
 
+// maxIngestBody bounds a single reading's request body
+const maxIngestBody = 64 << 10
+
+// signatureRejections gives the metric reason and response for each
+// signature failure
+var signatureRejections = map[error]struct{ reason, message string }{
+	devices.ErrSignatureRequired: {"missing_signature", "This device must sign its requests"},
+	devices.ErrInvalidSignature:  {"invalid_signature", "Invalid request signature"},
+	devices.ErrStaleRequest:      {"stale_timestamp", "Request timestamp is outside the allowed window"},
+	devices.ErrReplayedRequest:   {"replayed_nonce", "Request nonce was already used"},
+}
+
 func IngestData(c *gin.Context) {
+	start := time.Now()
+
+	// Signatures cover the body exactly as sent
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxIngestBody))
+	if err != nil {
+		metrics.RejectedReadings.WithLabelValues("invalid_payload").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
 	var req DataIngestionRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := binding.JSON.BindBody(body, &req); err != nil {
+		metrics.RejectedReadings.WithLabelValues("invalid_payload").Inc()
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
 		return
 	}
 
-	// Demo mode: accept API keys starting with "sim_" or "demo_" for testing
+	// Demo mode: accept API keys starting with "sim_" or "demo_" for testing,
+	// only when the deployment enables it
 	if strings.HasPrefix(req.APIKey, "sim_") || strings.HasPrefix(req.APIKey, "demo_") {
+		if !devices.DemoIngestion() {
+			metrics.RejectedReadings.WithLabelValues("demo_disabled").Inc()
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Demo ingestion is disabled"})
+			return
+		}
 		// Insert energy data with demo device ID
 		demoDeviceID, _ := uuid.Parse("00000000-0000-0000-0000-000000000001")
 		energyData := &EnergyData{
 			ID:           uuid.New(),
 			DeviceID:     demoDeviceID,
-			Timestamp:    time.Now(),
+			Timestamp:    time.Now().UTC(),
 			SolarPower:   req.SolarPower,
 			LoadPower:    req.LoadPower,
 			BatteryLevel: req.BatteryLevel,
@@ -45,9 +78,11 @@ func IngestData(c *gin.Context) {
 		}
 
 		if err := insertEnergyData(energyData); err != nil {
+			metrics.RejectedReadings.WithLabelValues("storage_error").Inc()
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data: " + err.Error()})
 			return
 		}
+		recordIngestion("SIMULATOR", start)
 
 		// Demo mode power update
 		// demoUserID := "00000000-0000-0000-0000-000000000001"
@@ -63,22 +98,46 @@ func IngestData(c *gin.Context) {
 	}
 
 	// Find device by API key
-	device, err := getDeviceByAPIKey(req.APIKey)
-	if err != nil {
+	device, err := devices.AuthenticateAPIKey(req.APIKey)
+	if errors.Is(err, devices.ErrInvalidAPIKey) {
+		metrics.RejectedReadings.WithLabelValues("invalid_api_key").Inc()
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
 		return
 	}
+	if err != nil {
+		metrics.RejectedReadings.WithLabelValues("storage_error").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check API key"})
+		return
+	}
+	// The device's own bucket applies once its key is known to be genuine
+	if !ratelimit.Authenticated(c, device.ID.String()) {
+		return
+	}
 
 	if !device.IsActive {
+		metrics.RejectedReadings.WithLabelValues("inactive_device").Inc()
 		c.JSON(http.StatusForbidden, gin.H{"error": "Device is not active"})
 		return
 	}
 
+	if err := devices.VerifySignature(device, body, c.Request.Header, time.Now()); err != nil {
+		rejection, ok := signatureRejections[err]
+		if !ok {
+			metrics.RejectedReadings.WithLabelValues("storage_error").Inc()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check signature"})
+			return
+		}
+		metrics.RejectedReadings.WithLabelValues(rejection.reason).Inc()
+		c.JSON(http.StatusUnauthorized, gin.H{"error": rejection.message})
+		return
+	}
+	devices.RecordKeyUse(device, c.ClientIP())
+
 	// Insert energy data
 	energyData := &EnergyData{
 		ID:           uuid.New(),
 		DeviceID:     device.ID,
-		Timestamp:    time.Now(),
+		Timestamp:    time.Now().UTC(),
 		SolarPower:   req.SolarPower,
 		LoadPower:    req.LoadPower,
 		BatteryLevel: req.BatteryLevel,
@@ -89,9 +148,11 @@ func IngestData(c *gin.Context) {
 
 	err = insertEnergyData(energyData)
 	if err != nil {
+		metrics.RejectedReadings.WithLabelValues("storage_error").Inc()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data"})
 		return
 	}
+	recordIngestion(device.DeviceType, start)
 
 	// Update plant current output
 	var plantID string
@@ -105,31 +166,20 @@ func IngestData(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Data ingested successfully"})
 }
 
-func getDeviceByAPIKey(apiKey string) (*devices.Device, error) {
-	device := &devices.Device{}
-	query := `
-		SELECT id, user_id, name, device_type, location, api_key, is_active, created_at, updated_at
-		FROM devices
-		WHERE api_key = ?`
-
-	err := database.DB.QueryRow(query, apiKey).Scan(
-		&device.ID, &device.UserID, &device.Name, &device.DeviceType,
-		&device.Location, &device.APIKey, &device.IsActive,
-		&device.CreatedAt, &device.UpdatedAt,
-	)
-
-	if err != nil {
-		return nil, err
+// recordIngestion counts an accepted reading and its handling latency
+func recordIngestion(deviceType string, start time.Time) {
+	if deviceType == "" {
+		deviceType = "UNKNOWN"
 	}
-
-	return device, nil
+	metrics.IngestedReadings.WithLabelValues(deviceType).Inc()
+	metrics.IngestionDuration.WithLabelValues(deviceType).Observe(time.Since(start).Seconds())
 }
 
 func insertEnergyData(data *EnergyData) error {
 	// Map simulator fields to database columns
 	query := `
 		INSERT INTO energy_data (id, device_id, timestamp, solar_power, load_power, grid_power, battery_level, temperature, humidity, grid_status)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, 1)`
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, true)`
 
 	_, err := database.DB.Exec(query,
 		data.ID, data.DeviceID, data.Timestamp,
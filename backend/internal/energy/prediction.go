@@ -2,8 +2,11 @@ package energy
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"sems-backend/internal/metrics"
 	"sems-backend/internal/users"
 	"sems-backend/internal/weather"
 
@@ -67,8 +70,25 @@ func GetSolarPrediction(c *gin.Context) {
 	c.JSON(http.StatusOK, aiResponse)
 }
 
+// AIServiceURL is the base URL of the AI prediction service
+var AIServiceURL = "http://localhost:5000"
+
+// CheckAIService is a readiness check; any HTTP response counts as reachable
+func CheckAIService(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, AIServiceURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("AI service unreachable: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
 func callAIService(req AIPredictionRequest) (*AIPredictionResponse, error) {
-	aiServiceURL := "http://localhost:5000/ai/predict/solar"
+	aiServiceURL := AIServiceURL + "/ai/predict/solar"
 
 	// Prepare request body if weather data provided
 	var requestBody *bytes.Buffer
@@ -88,6 +108,7 @@ func callAIService(req AIPredictionRequest) (*AIPredictionResponse, error) {
 	}
 
 	if err != nil {
+		metrics.AIServiceFailures.WithLabelValues("unreachable").Inc()
 		return nil, err
 	}
 	defer resp.Body.Close()
@@ -95,10 +116,12 @@ func callAIService(req AIPredictionRequest) (*AIPredictionResponse, error) {
 	// Parse response
 	var aiResp AIPredictionResponse
 	if err := json.NewDecoder(resp.Body).Decode(&aiResp); err != nil {
+		metrics.AIServiceFailures.WithLabelValues("bad_response").Inc()
 		return nil, err
 	}
 
 	if !aiResp.Success {
+		metrics.AIServiceFailures.WithLabelValues("unsuccessful").Inc()
 		return nil, http.ErrNotSupported // Use as generic error
 	}
 
@@ -0,0 +1,659 @@
+package energy
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sems-backend/internal/authz"
+	"sems-backend/internal/database"
+	"sems-backend/internal/timectx"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Resolution sizes in seconds. "raw" and "month" are handled separately, and
+// "day" buckets follow local midnight so they last 23 or 25 hours across DST.
+var resolutionSeconds = map[string]int64{
+	"5m":   5 * 60,
+	"15m":  15 * 60,
+	"hour": 60 * 60,
+	"day":  24 * 60 * 60,
+}
+
+// queryMetrics whitelists energy_data columns that can be charted
+var queryMetrics = map[string]bool{
+	"solar_power":   true,
+	"load_power":    true,
+	"grid_power":    true,
+	"battery_level": true,
+	"temperature":   true,
+	"humidity":      true,
+}
+
+// powerMetrics can be integrated over time with the "energy" aggregation
+var powerMetrics = map[string]bool{
+	"solar_power": true,
+	"load_power":  true,
+	"grid_power":  true,
+}
+
+var queryAggregations = map[string]string{
+	"avg":    "AVG",
+	"max":    "MAX",
+	"min":    "MIN",
+	"sum":    "SUM",
+	"energy": "AVG", // average power x bucket duration
+}
+
+const (
+	maxQueryBuckets = 10000
+	maxRawRows      = 50000
+)
+
+// SeriesQuery describes a time-series request
+type SeriesQuery struct {
+	Start       time.Time
+	End         time.Time
+	Resolution  string
+	Aggregation string
+	Metrics     []string
+	DeviceIDs   []string
+	PlantIDs    []string
+	Regions     []string
+	GroupBy     string // "device" (default) or "none" for a single fleet series per metric
+	Location    *time.Location
+}
+
+// SeriesPoint is one value in a series; Value is nil for buckets without data
+type SeriesPoint struct {
+	Time  time.Time `json:"t"`
+	Value *float64  `json:"v"`
+}
+
+// Series is a single metric for a single device (or the whole selection)
+type Series struct {
+	DeviceID   string        `json:"device_id,omitempty"`
+	DeviceName string        `json:"device_name,omitempty"`
+	Metric     string        `json:"metric"`
+	Unit       string        `json:"unit"`
+	Points     []SeriesPoint `json:"points"`
+}
+
+// SeriesResult is the response of a time-series query
+type SeriesResult struct {
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	Resolution  string    `json:"resolution"`
+	Aggregation string    `json:"aggregation"`
+	Timezone    string    `json:"timezone"`
+	Timestamps  []int64   `json:"timestamps,omitempty"` // shared bucket starts (unix ms) for aligned series
+	Series      []Series  `json:"series"`
+	// Truncated is set when a raw query matched more than maxRawRows readings;
+	// LastTimestamp is the newest one returned, to continue from
+	Truncated     bool       `json:"truncated,omitempty"`
+	LastTimestamp *time.Time `json:"last_timestamp,omitempty"`
+}
+
+// ScopedDevice is a device visible to the caller
+type ScopedDevice struct {
+	ID      string
+	Name    string
+	PlantID string
+	Region  string
+}
+
+// QueryTimeSeriesHandler returns aligned series over an arbitrary range and resolution
+// @Summary Query energy time series
+// @Description Query energy telemetry with arbitrary range, resolution and aggregation, limited to the caller's scope
+// @Tags Energy
+// @Accept json
+// @Produce json
+// @Param start query string false "Start (RFC3339 or unix ms, default 24h before end)"
+// @Param end query string false "End (RFC3339 or unix ms, default now)"
+// @Param resolution query string false "raw (at most 50000 readings, then truncated is set), 5m, 15m, hour, day, month (default hour)"
+// @Param aggregation query string false "avg, max, min, sum, energy (default avg)"
+// @Param metrics query string false "Comma-separated metrics (default solar_power)"
+// @Param device_ids query string false "Comma-separated device IDs"
+// @Param plant_ids query string false "Comma-separated plant IDs"
+// @Param regions query string false "Comma-separated region names"
+// @Param group_by query string false "device (default) or none"
+// @Param timezone query string false "IANA timezone for bucket boundaries"
+// @Success 200 {object} SeriesResult
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security BearerAuth
+// @Router /user/energy/query [get]
+// @Router /admin/energy/query [get]
+// @Router /superadmin/energy/query [get]
+func QueryTimeSeriesHandler(c *gin.Context) {
+	scope, err := authz.Caller(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	q, err := ParseSeriesQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if q.Location == nil {
+		q.Location = timectx.ForUser(scope.ID)
+		if len(q.Regions) == 1 {
+			q.Location = timectx.ForRegion(q.Regions[0])
+		}
+	}
+
+	devices, err := ScopedDevices(scope, q.DeviceIDs, q.PlantIDs, q.Regions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve devices"})
+		return
+	}
+
+	result, err := QueryTimeSeries(devices, q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query time series"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// ParseSeriesQuery reads and validates query parameters
+func ParseSeriesQuery(c *gin.Context) (*SeriesQuery, error) {
+	q := &SeriesQuery{
+		Resolution:  c.DefaultQuery("resolution", "hour"),
+		Aggregation: c.DefaultQuery("aggregation", "avg"),
+		Metrics:     splitList(c.DefaultQuery("metrics", "solar_power")),
+		DeviceIDs:   splitList(c.Query("device_ids")),
+		PlantIDs:    splitList(c.Query("plant_ids")),
+		Regions:     splitList(c.Query("regions")),
+		GroupBy:     c.DefaultQuery("group_by", "device"),
+	}
+
+	var err error
+	q.End = time.Now()
+	if v := c.Query("end"); v != "" {
+		if q.End, err = parseQueryTime(v); err != nil {
+			return nil, fmt.Errorf("invalid end: %v", err)
+		}
+	}
+	q.Start = q.End.Add(-24 * time.Hour)
+	if v := c.Query("start"); v != "" {
+		if q.Start, err = parseQueryTime(v); err != nil {
+			return nil, fmt.Errorf("invalid start: %v", err)
+		}
+	}
+	if tz := c.Query("timezone"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone: %v", err)
+		}
+		q.Location = loc
+	}
+
+	return q, q.Validate()
+}
+
+// Validate checks the query against supported resolutions, aggregations and limits
+func (q *SeriesQuery) Validate() error {
+	if !q.End.After(q.Start) {
+		return fmt.Errorf("end must be after start")
+	}
+	// Raw queries are bounded by maxRawRows instead of a bucket count
+	if q.Resolution != "raw" {
+		var buckets int64
+		if q.Resolution == "month" {
+			start, end := q.Start.UTC(), q.End.UTC()
+			buckets = int64(end.Year()-start.Year())*12 + int64(end.Month()-start.Month()) + 1
+		} else {
+			size, ok := resolutionSeconds[q.Resolution]
+			if !ok {
+				return fmt.Errorf("unsupported resolution %q", q.Resolution)
+			}
+			buckets = int64(q.End.Sub(q.Start).Seconds()) / size
+		}
+		if buckets > maxQueryBuckets {
+			return fmt.Errorf("range too large for resolution %s (max %d buckets)", q.Resolution, maxQueryBuckets)
+		}
+	}
+	if _, ok := queryAggregations[q.Aggregation]; !ok {
+		return fmt.Errorf("unsupported aggregation %q", q.Aggregation)
+	}
+	if len(q.Metrics) == 0 {
+		return fmt.Errorf("at least one metric is required")
+	}
+	for _, m := range q.Metrics {
+		if !queryMetrics[m] {
+			return fmt.Errorf("unsupported metric %q", m)
+		}
+		if q.Aggregation == "energy" && !powerMetrics[m] {
+			return fmt.Errorf("energy aggregation only applies to power metrics, not %q", m)
+		}
+	}
+	if q.GroupBy != "device" && q.GroupBy != "none" {
+		return fmt.Errorf("group_by must be device or none")
+	}
+	return nil
+}
+
+// ScopedDevices returns devices the caller may read, narrowed by optional filters.
+// Visibility follows the owner of each device as decided by authz.
+func ScopedDevices(scope *authz.Subject, deviceIDs, plantIDs, regions []string) ([]ScopedDevice, error) {
+	filter, args := scope.Filter("u")
+	query := `
+		SELECT d.id, COALESCE(d.name, d.device_name, ''), COALESCE(u.plant_id, ''), COALESCE(u.region, '')
+		FROM devices d
+		LEFT JOIN users u ON d.user_id = u.id
+		WHERE 1=1` + filter
+
+	query, args = appendInFilter(query, args, "d.id", deviceIDs)
+	query, args = appendInFilter(query, args, "u.plant_id", plantIDs)
+	query, args = appendInFilter(query, args, "u.region", regions)
+	query += " ORDER BY d.created_at"
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var devices []ScopedDevice
+	for rows.Next() {
+		var d ScopedDevice
+		if err := rows.Scan(&d.ID, &d.Name, &d.PlantID, &d.Region); err != nil {
+			return nil, err
+		}
+		devices = append(devices, d)
+	}
+	return devices, nil
+}
+
+// QueryTimeSeries aggregates energy_data for the given devices
+func QueryTimeSeries(devices []ScopedDevice, q *SeriesQuery) (*SeriesResult, error) {
+	if q.Location == nil {
+		q.Location = timectx.Default()
+	}
+	result := &SeriesResult{
+		Start:       q.Start,
+		End:         q.End,
+		Resolution:  q.Resolution,
+		Aggregation: q.Aggregation,
+		Timezone:    q.Location.String(),
+		Series:      []Series{},
+	}
+	if len(devices) == 0 {
+		return result, nil
+	}
+
+	if q.Resolution == "raw" {
+		return result, queryRawSeries(devices, q, result)
+	}
+
+	buckets := bucketStarts(q)
+	for _, b := range buckets {
+		result.Timestamps = append(result.Timestamps, b.UnixMilli())
+	}
+
+	// bucket key -> per device -> per metric aggregate
+	aggs, err := queryBucketAggregates(devices, q)
+	if err != nil {
+		return nil, err
+	}
+
+	if q.GroupBy == "none" {
+		for _, metric := range q.Metrics {
+			s := Series{Metric: metric, Unit: metricUnit(metric, q.Aggregation)}
+			for _, b := range buckets {
+				var combined *bucketAggregate
+				for _, d := range devices {
+					if a, ok := aggs[bucketKey{device: d.ID, metric: metric, start: b.Unix()}]; ok {
+						combined = combineAggregates(combined, a, q.Aggregation)
+					}
+				}
+				s.Points = append(s.Points, SeriesPoint{Time: b, Value: finalValue(combined, q, b)})
+			}
+			result.Series = append(result.Series, s)
+		}
+		return result, nil
+	}
+
+	for _, d := range devices {
+		for _, metric := range q.Metrics {
+			s := Series{DeviceID: d.ID, DeviceName: d.Name, Metric: metric, Unit: metricUnit(metric, q.Aggregation)}
+			for _, b := range buckets {
+				var value *float64
+				if a, ok := aggs[bucketKey{device: d.ID, metric: metric, start: b.Unix()}]; ok {
+					value = finalValue(a, q, b)
+				}
+				s.Points = append(s.Points, SeriesPoint{Time: b, Value: value})
+			}
+			result.Series = append(result.Series, s)
+		}
+	}
+	return result, nil
+}
+
+type bucketKey struct {
+	device string
+	metric string
+	start  int64
+}
+
+type bucketAggregate struct {
+	value float64
+	count int64
+}
+
+// zoneSegment is a part of the query range over which the UTC offset is constant
+type zoneSegment struct {
+	start, end time.Time
+	offset     int
+}
+
+// zoneSegments splits [start, end) at the timezone's offset changes, so SQL
+// bucketing can use a fixed offset within each part
+func zoneSegments(q *SeriesQuery) []zoneSegment {
+	var segments []zoneSegment
+	for from := q.Start; from.Before(q.End); {
+		local := from.In(q.Location)
+		_, offset := local.Zone()
+		to := q.End
+		if _, zoneEnd := local.ZoneBounds(); !zoneEnd.IsZero() && zoneEnd.Before(q.End) {
+			to = zoneEnd
+		}
+		if n := len(segments); n > 0 && segments[n-1].offset == offset {
+			segments[n-1].end = to
+		} else {
+			segments = append(segments, zoneSegment{start: from, end: to, offset: offset})
+		}
+		from = to
+	}
+	return segments
+}
+
+func queryBucketAggregates(devices []ScopedDevice, q *SeriesQuery) (map[bucketKey]*bucketAggregate, error) {
+	aggs := make(map[bucketKey]*bucketAggregate)
+	for _, seg := range zoneSegments(q) {
+		if err := querySegmentAggregates(devices, q, seg, aggs); err != nil {
+			return nil, err
+		}
+	}
+	return aggs, nil
+}
+
+// querySegmentAggregates adds one offset segment's aggregates to aggs; a bucket
+// that spans an offset change is merged from both segments
+func querySegmentAggregates(devices []ScopedDevice, q *SeriesQuery, seg zoneSegment, aggs map[bucketKey]*bucketAggregate) error {
+	var bucketExpr string
+	switch q.Resolution {
+	case "month", "day":
+		bucketExpr = database.Current.LocalDate("timestamp", q.Resolution, seg.offset)
+	default:
+		bucketExpr = database.EpochBucket(database.Current, "timestamp", resolutionSeconds[q.Resolution], seg.offset)
+	}
+
+	fn := queryAggregations[q.Aggregation]
+	cols := []string{"device_id", bucketExpr + " AS bucket"}
+	for _, m := range q.Metrics {
+		cols = append(cols, fmt.Sprintf("%s(%s)", fn, m), fmt.Sprintf("COUNT(%s)", m))
+	}
+
+	query := "SELECT " + strings.Join(cols, ", ") + " FROM energy_data WHERE timestamp >= ? AND timestamp < ?"
+	args := []interface{}{seg.start.UTC(), seg.end.UTC()}
+	query, args = appendInFilter(query, args, "device_id", deviceIDs(devices))
+	query += " GROUP BY device_id, bucket"
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var deviceID string
+		var bucket sql.NullString
+		values := make([]sql.NullFloat64, len(q.Metrics))
+		counts := make([]int64, len(q.Metrics))
+		dest := []interface{}{&deviceID, &bucket}
+		for i := range q.Metrics {
+			dest = append(dest, &values[i], &counts[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		if !bucket.Valid {
+			continue // legacy rows whose timestamp SQLite cannot parse
+		}
+
+		start, ok := parseBucket(bucket.String, q)
+		if !ok {
+			continue
+		}
+		for i, m := range q.Metrics {
+			if !values[i].Valid {
+				continue
+			}
+			key := bucketKey{device: deviceID, metric: m, start: start}
+			aggs[key] = mergePartial(aggs[key], &bucketAggregate{value: values[i].Float64, count: counts[i]}, q.Aggregation)
+		}
+	}
+	return rows.Err()
+}
+
+func queryRawSeries(devices []ScopedDevice, q *SeriesQuery, result *SeriesResult) error {
+	cols := append([]string{"device_id", "timestamp"}, q.Metrics...)
+	query := "SELECT " + strings.Join(cols, ", ") + " FROM energy_data WHERE timestamp >= ? AND timestamp < ?"
+	args := []interface{}{q.Start.UTC(), q.End.UTC()}
+	query, args = appendInFilter(query, args, "device_id", deviceIDs(devices))
+	// One row past the limit tells a full result from a cut one
+	query += " ORDER BY timestamp ASC LIMIT " + strconv.Itoa(maxRawRows+1)
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	names := make(map[string]string, len(devices))
+	for _, d := range devices {
+		names[d.ID] = d.Name
+	}
+	index := make(map[string]int)
+	var last time.Time
+	for n := 0; rows.Next(); n++ {
+		if n == maxRawRows {
+			result.Truncated = true
+			result.LastTimestamp = &last
+			break
+		}
+		var deviceID string
+		var ts time.Time
+		values := make([]sql.NullFloat64, len(q.Metrics))
+		dest := []interface{}{&deviceID, &ts}
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		last = ts.In(q.Location)
+		for i, m := range q.Metrics {
+			key := deviceID + "|" + m
+			idx, ok := index[key]
+			if !ok {
+				idx = len(result.Series)
+				index[key] = idx
+				result.Series = append(result.Series, Series{DeviceID: deviceID, DeviceName: names[deviceID], Metric: m, Unit: metricUnit(m, "raw")})
+			}
+			var v *float64
+			if values[i].Valid {
+				f := values[i].Float64
+				v = &f
+			}
+			result.Series[idx].Points = append(result.Series[idx].Points, SeriesPoint{Time: ts.In(q.Location), Value: v})
+		}
+	}
+	sort.SliceStable(result.Series, func(i, j int) bool { return result.Series[i].DeviceID < result.Series[j].DeviceID })
+	return rows.Err()
+}
+
+// bucketStarts lists every bucket in [start, end) aligned to the query's timezone
+func bucketStarts(q *SeriesQuery) []time.Time {
+	var buckets []time.Time
+	switch q.Resolution {
+	case "month":
+		for b := timectx.StartOfMonth(q.Start, q.Location); b.Before(q.End); b = b.AddDate(0, 1, 0) {
+			buckets = append(buckets, b)
+		}
+		return buckets
+	case "day":
+		for b := timectx.StartOfDay(q.Start, q.Location); b.Before(q.End); b = timectx.StartOfDay(b.AddDate(0, 0, 1), q.Location) {
+			buckets = append(buckets, b)
+		}
+		return buckets
+	}
+
+	size := resolutionSeconds[q.Resolution]
+	_, offset := q.Start.In(q.Location).Zone()
+	first := (q.Start.Unix()+int64(offset))/size*size - int64(offset)
+	for b := first; b < q.End.Unix(); b += size {
+		buckets = append(buckets, time.Unix(b, 0).In(q.Location))
+	}
+	return buckets
+}
+
+func parseBucket(raw string, q *SeriesQuery) (int64, bool) {
+	var layout string
+	switch q.Resolution {
+	case "month":
+		layout = "2006-01"
+	case "day":
+		layout = "2006-01-02"
+	}
+	if layout != "" {
+		t, err := time.ParseInLocation(layout, raw, q.Location)
+		if err != nil {
+			return 0, false
+		}
+		return t.Unix(), true
+	}
+	v, err := strconv.ParseInt(raw, 10, 64)
+	return v, err == nil
+}
+
+// mergePartial joins two parts of the same device's bucket. Energy is computed
+// from average power, so its parts are averaged rather than summed.
+func mergePartial(acc, next *bucketAggregate, aggregation string) *bucketAggregate {
+	if aggregation == "energy" {
+		aggregation = "avg"
+	}
+	return combineAggregates(acc, next, aggregation)
+}
+
+func combineAggregates(acc, next *bucketAggregate, aggregation string) *bucketAggregate {
+	if acc == nil {
+		return &bucketAggregate{value: next.value, count: next.count}
+	}
+	switch aggregation {
+	case "max":
+		if next.value > acc.value {
+			acc.value = next.value
+		}
+	case "min":
+		if next.value < acc.value {
+			acc.value = next.value
+		}
+	case "sum", "energy":
+		// Fleet energy is the sum of each device's energy
+		acc.value += next.value
+	default:
+		total := acc.value*float64(acc.count) + next.value*float64(next.count)
+		acc.count += next.count
+		if acc.count > 0 {
+			acc.value = total / float64(acc.count)
+		}
+		return acc
+	}
+	acc.count += next.count
+	return acc
+}
+
+// finalValue converts an aggregate into the reported value; for "energy" the
+// average power is multiplied by the bucket length in hours (kW -> kWh)
+func finalValue(a *bucketAggregate, q *SeriesQuery, bucket time.Time) *float64 {
+	if a == nil {
+		return nil
+	}
+	v := a.value
+	if q.Aggregation == "energy" {
+		v *= bucketDuration(q, bucket).Hours()
+	}
+	return &v
+}
+
+func bucketDuration(q *SeriesQuery, bucket time.Time) time.Duration {
+	switch q.Resolution {
+	case "month":
+		return bucket.AddDate(0, 1, 0).Sub(bucket)
+	case "day":
+		return timectx.StartOfDay(bucket.AddDate(0, 0, 1), q.Location).Sub(bucket)
+	}
+	return time.Duration(resolutionSeconds[q.Resolution]) * time.Second
+}
+
+func metricUnit(metric, aggregation string) string {
+	switch metric {
+	case "battery_level", "humidity":
+		return "%"
+	case "temperature":
+		return "C"
+	}
+	if aggregation == "energy" {
+		return "kWh"
+	}
+	return "kW"
+}
+
+func deviceIDs(devices []ScopedDevice) []string {
+	ids := make([]string, len(devices))
+	for i, d := range devices {
+		ids[i] = d.ID
+	}
+	return ids
+}
+
+func appendInFilter(query string, args []interface{}, column string, values []string) (string, []interface{}) {
+	if len(values) == 0 {
+		return query, args
+	}
+	placeholders := make([]string, len(values))
+	for i, v := range values {
+		placeholders[i] = "?"
+		args = append(args, v)
+	}
+	return query + " AND " + column + " IN (" + strings.Join(placeholders, ", ") + ")", args
+}
+
+func splitList(raw string) []string {
+	var out []string
+	for _, part := range strings.Split(raw, ",") {
+		if p := strings.TrimSpace(part); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// parseQueryTime accepts RFC3339 or unix milliseconds
+func parseQueryTime(v string) (time.Time, error) {
+	if ms, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
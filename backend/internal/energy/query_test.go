@@ -0,0 +1,350 @@
+package energy
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"sems-backend/internal/config"
+	"sems-backend/internal/database"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func openTestDB(t *testing.T) {
+	t.Helper()
+	if err := database.InitDB(config.DatabaseConfig{Driver: "sqlite", Path: filepath.Join(t.TempDir(), "energy.db"), MaxOpenConns: 1}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(database.CloseDB)
+	if err := database.RunMigrations(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func parseQuery(t *testing.T, rawQuery string) (*SeriesQuery, error) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/user/energy/query?"+rawQuery, nil)
+	return ParseSeriesQuery(c)
+}
+
+func TestParseSeriesQueryRange(t *testing.T) {
+	q, err := parseQuery(t, "start=2026-03-01T00:00:00Z&end=1772582400000&timezone=Asia/Kolkata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !q.Start.Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("start = %v", q.Start)
+	}
+	if !q.End.Equal(time.UnixMilli(1772582400000)) {
+		t.Errorf("end = %v", q.End)
+	}
+	if q.Location.String() != "Asia/Kolkata" || q.Resolution != "hour" || q.Aggregation != "avg" {
+		t.Errorf("defaults: %s %s %s", q.Location, q.Resolution, q.Aggregation)
+	}
+
+	// Without start, the range is the 24 hours before end
+	q, err = parseQuery(t, "end=2026-03-02T12:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.End.Sub(q.Start) != 24*time.Hour {
+		t.Errorf("default range = %v", q.End.Sub(q.Start))
+	}
+
+	for _, bad := range []string{
+		"start=yesterday",
+		"end=2026-13-01T00:00:00Z",
+		"start=2026-03-02T00:00:00Z&end=2026-03-01T00:00:00Z",
+		"start=2026-03-01T00:00:00Z&end=2026-03-01T00:00:00Z",
+		"timezone=Mars/Olympus",
+	} {
+		if _, err := parseQuery(t, bad); err == nil {
+			t.Errorf("%s accepted", bad)
+		}
+	}
+}
+
+func TestValidateResolutionAndLimits(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	valid := func(resolution string, end time.Time) error {
+		q := &SeriesQuery{Start: start, End: end, Resolution: resolution, Aggregation: "avg", Metrics: []string{"solar_power"}, GroupBy: "device"}
+		return q.Validate()
+	}
+
+	for _, res := range []string{"raw", "5m", "15m", "hour", "day", "month"} {
+		if err := valid(res, start.AddDate(0, 0, 1)); err != nil {
+			t.Errorf("%s: %v", res, err)
+		}
+	}
+	if err := valid("week", start.AddDate(0, 0, 1)); err == nil {
+		t.Error("unsupported resolution accepted")
+	}
+
+	// Every bucketed resolution is capped, month included
+	if err := valid("5m", start.AddDate(0, 0, 34)); err != nil {
+		t.Errorf("5m over 34 days: %v", err)
+	}
+	if err := valid("5m", start.AddDate(0, 0, 35)); err == nil {
+		t.Error("5m over 35 days accepted")
+	}
+	if err := valid("hour", start.AddDate(2, 0, 0)); err == nil {
+		t.Error("hour over 2 years accepted")
+	}
+	if err := valid("month", start.AddDate(0, 9999, 0)); err != nil {
+		t.Errorf("9999 months: %v", err)
+	}
+	if err := valid("month", start.AddDate(0, 10000, 0)); err == nil {
+		t.Error("10001 month buckets accepted")
+	}
+
+	q := &SeriesQuery{Start: start, End: start.Add(time.Hour), Resolution: "hour", Aggregation: "energy", Metrics: []string{"temperature"}, GroupBy: "device"}
+	if err := q.Validate(); err == nil {
+		t.Error("energy aggregation of temperature accepted")
+	}
+	q = &SeriesQuery{Start: start, End: start.Add(time.Hour), Resolution: "hour", Aggregation: "avg", Metrics: []string{"api_key"}, GroupBy: "device"}
+	if err := q.Validate(); err == nil {
+		t.Error("non-whitelisted metric accepted")
+	}
+}
+
+func TestBucketStartsAtLocalMidnight(t *testing.T) {
+	kolkata, _ := time.LoadLocation("Asia/Kolkata")
+	q := &SeriesQuery{
+		Start:      time.Date(2026, 3, 10, 20, 0, 0, 0, time.UTC), // 01:30 on the 11th in Kolkata
+		End:        time.Date(2026, 3, 13, 0, 0, 0, 0, time.UTC),
+		Resolution: "day",
+		Location:   kolkata,
+	}
+	buckets := bucketStarts(q)
+	if len(buckets) != 3 {
+		t.Fatalf("got %d buckets: %v", len(buckets), buckets)
+	}
+	for i, b := range buckets {
+		want := time.Date(2026, 3, 11+i, 0, 0, 0, 0, kolkata)
+		if !b.Equal(want) {
+			t.Errorf("bucket %d = %v, want %v", i, b, want)
+		}
+	}
+
+	// Hour buckets in a half-hour zone start on the local hour
+	q.Resolution = "hour"
+	if b := bucketStarts(q)[0]; b.In(kolkata).Minute() != 0 || !b.Equal(time.Date(2026, 3, 11, 1, 0, 0, 0, kolkata)) {
+		t.Errorf("first hour bucket = %v", b.In(kolkata))
+	}
+}
+
+func TestBucketStartsAcrossDST(t *testing.T) {
+	ny, _ := time.LoadLocation("America/New_York")
+	// Clocks move forward at 02:00 on 8 March 2026 and back at 02:00 on 1 November
+	q := &SeriesQuery{
+		Start:      time.Date(2026, 3, 7, 0, 0, 0, 0, ny),
+		End:        time.Date(2026, 3, 10, 0, 0, 0, 0, ny),
+		Resolution: "day",
+		Location:   ny,
+	}
+	buckets := bucketStarts(q)
+	if len(buckets) != 3 {
+		t.Fatalf("got %d buckets: %v", len(buckets), buckets)
+	}
+	for i, b := range buckets {
+		local := b.In(ny)
+		if local.Hour() != 0 || local.Day() != 7+i {
+			t.Errorf("bucket %d = %v, want local midnight", i, local)
+		}
+	}
+	if d := bucketDuration(q, buckets[1]); d != 23*time.Hour {
+		t.Errorf("spring-forward day lasts %v", d)
+	}
+
+	q.Start = time.Date(2026, 10, 31, 0, 0, 0, 0, ny)
+	q.End = time.Date(2026, 11, 3, 0, 0, 0, 0, ny)
+	buckets = bucketStarts(q)
+	if len(buckets) != 3 || buckets[2].In(ny).Hour() != 0 {
+		t.Fatalf("fall-back buckets: %v", buckets)
+	}
+	if d := bucketDuration(q, buckets[1]); d != 25*time.Hour {
+		t.Errorf("fall-back day lasts %v", d)
+	}
+
+	// Hourly buckets follow elapsed time, so the short day has 23 of them
+	q.Start = time.Date(2026, 3, 8, 0, 0, 0, 0, ny)
+	q.End = time.Date(2026, 3, 9, 0, 0, 0, 0, ny)
+	q.Resolution = "hour"
+	if n := len(bucketStarts(q)); n != 23 {
+		t.Errorf("spring-forward day has %d hour buckets", n)
+	}
+
+	// Month buckets start at local midnight on the first, whatever the offset at start
+	q.Start = time.Date(2026, 1, 15, 0, 0, 0, 0, ny)
+	q.End = time.Date(2026, 8, 1, 0, 0, 0, 0, ny)
+	q.Resolution = "month"
+	for _, b := range bucketStarts(q) {
+		if local := b.In(ny); local.Hour() != 0 {
+			t.Errorf("month bucket %v is not local midnight", local)
+		}
+	}
+}
+
+func TestZoneSegmentsSplitAtOffsetChanges(t *testing.T) {
+	ny, _ := time.LoadLocation("America/New_York")
+	q := &SeriesQuery{Start: time.Date(2026, 1, 1, 0, 0, 0, 0, ny), End: time.Date(2027, 1, 1, 0, 0, 0, 0, ny), Location: ny}
+	segments := zoneSegments(q)
+	if len(segments) != 3 {
+		t.Fatalf("got %d segments: %+v", len(segments), segments)
+	}
+	if segments[0].offset != -5*3600 || segments[1].offset != -4*3600 || segments[2].offset != -5*3600 {
+		t.Errorf("offsets: %+v", segments)
+	}
+	if !segments[0].start.Equal(q.Start) || !segments[2].end.Equal(q.End) || !segments[0].end.Equal(segments[1].start) {
+		t.Errorf("segments do not cover the range: %+v", segments)
+	}
+
+	kolkata, _ := time.LoadLocation("Asia/Kolkata")
+	q.Location = kolkata
+	if n := len(zoneSegments(q)); n != 1 {
+		t.Errorf("fixed-offset zone split into %d segments", n)
+	}
+}
+
+func TestQueryTimeSeriesDailyAcrossDST(t *testing.T) {
+	openTestDB(t)
+	ny, _ := time.LoadLocation("America/New_York")
+	device := ScopedDevice{ID: uuid.New().String(), Name: "Roof"}
+
+	// One reading every hour from 7 to 9 March local time, solar power 1 kW,
+	// plus a late-evening reading that belongs to the local day, not the UTC one
+	insert := func(at time.Time, power float64) {
+		t.Helper()
+		_, err := database.DB.Exec(`INSERT INTO energy_data (id, device_id, timestamp, solar_power, load_power, grid_power, battery_level, temperature, humidity, grid_status)
+			VALUES (?, ?, ?, ?, 0, 0, 0, 0, 0, true)`, uuid.New().String(), device.ID, at.UTC(), power)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for at := time.Date(2026, 3, 7, 0, 0, 0, 0, ny); at.Before(time.Date(2026, 3, 10, 0, 0, 0, 0, ny)); at = at.Add(time.Hour) {
+		insert(at, 1)
+	}
+	insert(time.Date(2026, 3, 8, 23, 30, 0, 0, ny), 1)
+
+	q := &SeriesQuery{
+		Start:       time.Date(2026, 3, 7, 0, 0, 0, 0, ny),
+		End:         time.Date(2026, 3, 10, 0, 0, 0, 0, ny),
+		Resolution:  "day",
+		Aggregation: "energy",
+		Metrics:     []string{"solar_power"},
+		GroupBy:     "device",
+		Location:    ny,
+	}
+	result, err := QueryTimeSeries([]ScopedDevice{device}, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Series) != 1 || len(result.Series[0].Points) != 3 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	// kWh at a constant 1 kW; 8 March is 23 hours long
+	expectDaily(t, result, ny, []float64{24, 23, 24})
+
+	// 23 hourly readings on 8 March plus the late-evening one
+	q.Aggregation = "sum"
+	if result, err = QueryTimeSeries([]ScopedDevice{device}, q); err != nil {
+		t.Fatal(err)
+	}
+	expectDaily(t, result, ny, []float64{24, 24, 24})
+}
+
+func expectDaily(t *testing.T, result *SeriesResult, loc *time.Location, want []float64) {
+	t.Helper()
+	for i, p := range result.Series[0].Points {
+		if p.Value == nil || *p.Value != want[i] {
+			t.Errorf("%s: got %v, want %v", p.Time.In(loc).Format("2006-01-02"), p.Value, want[i])
+		}
+	}
+}
+
+func TestGlobalTrendAcrossDST(t *testing.T) {
+	openTestDB(t)
+	ny, _ := time.LoadLocation("America/New_York")
+	deviceID := uuid.New().String()
+	if _, err := database.DB.Exec(`INSERT INTO users (id, email, password_hash, role, region, device_id) VALUES (?, 'trend@test', 'x', 'USER', 'East', ?)`,
+		uuid.New().String(), deviceID); err != nil {
+		t.Fatal(err)
+	}
+	insert := func(at time.Time) {
+		t.Helper()
+		_, err := database.DB.Exec(`INSERT INTO energy_data (id, device_id, timestamp, solar_power, load_power, grid_power, battery_level, temperature, humidity, grid_status)
+			VALUES (?, ?, ?, 1, 2, 0, 0, 0, 0, true)`, uuid.New().String(), deviceID, at.UTC())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Late evenings on both sides of the spring change, in winter and summer time
+	insert(time.Date(2026, 2, 28, 23, 30, 0, 0, ny))
+	insert(time.Date(2026, 3, 31, 23, 30, 0, 0, ny))
+	insert(time.Date(2026, 4, 1, 0, 30, 0, 0, ny))
+
+	window := &SeriesQuery{Start: time.Date(2026, 2, 1, 0, 0, 0, 0, ny), End: time.Date(2026, 5, 1, 0, 0, 0, 0, ny), Location: ny}
+	trend, err := globalTrend("East", "month", window)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []AnalyticsPoint{{"2026-02", 1, 2}, {"2026-03", 1, 2}, {"2026-04", 1, 2}}
+	if len(trend) != len(want) {
+		t.Fatalf("trend = %+v, want %+v", trend, want)
+	}
+	for i := range want {
+		if trend[i] != want[i] {
+			t.Errorf("month %d = %+v, want %+v", i, trend[i], want[i])
+		}
+	}
+
+	trend, err = globalTrend("East", "day", window)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trend) != 3 || trend[0].Label != "2026-02-28" || trend[1].Label != "2026-03-31" || trend[2].Label != "2026-04-01" {
+		t.Errorf("daily trend = %+v", trend)
+	}
+}
+
+func TestRawSeriesReportsTruncation(t *testing.T) {
+	openTestDB(t)
+	device := ScopedDevice{ID: uuid.New().String(), Name: "Roof"}
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	// One reading a second, one more than a raw query returns
+	_, err := database.DB.Exec(`
+		WITH RECURSIVE seq(n) AS (SELECT 0 UNION ALL SELECT n + 1 FROM seq WHERE n < ?)
+		INSERT INTO energy_data (id, device_id, timestamp, solar_power, load_power, grid_power, battery_level, temperature, humidity, grid_status)
+		SELECT 'r' || n, ?, strftime('%Y-%m-%d %H:%M:%S+00:00', ?, '+' || n || ' seconds'), 1, 0, 0, 0, 0, 0, true FROM seq`,
+		maxRawRows, device.ID, start.Format("2006-01-02 15:04:05"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := &SeriesQuery{Start: start, End: start.Add(24 * time.Hour), Resolution: "raw", Aggregation: "avg", Metrics: []string{"solar_power"}, GroupBy: "device", Location: time.UTC}
+	result, err := QueryTimeSeries([]ScopedDevice{device}, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(result.Series[0].Points); n != maxRawRows {
+		t.Fatalf("got %d points", n)
+	}
+	last := start.Add((maxRawRows - 1) * time.Second)
+	if !result.Truncated || result.LastTimestamp == nil || !result.LastTimestamp.Equal(last) {
+		t.Errorf("truncated = %v, last = %v, want %v", result.Truncated, result.LastTimestamp, last)
+	}
+
+	// Continuing after the last timestamp returns the rest, complete
+	q.Start = last.Add(time.Second)
+	if result, err = QueryTimeSeries([]ScopedDevice{device}, q); err != nil {
+		t.Fatal(err)
+	}
+	if result.Truncated || len(result.Series[0].Points) != 1 {
+		t.Errorf("remainder: truncated = %v, %d points", result.Truncated, len(result.Series[0].Points))
+	}
+}
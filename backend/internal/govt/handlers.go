@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"sems-backend/internal/audit"
 	"sems-backend/internal/users"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -129,6 +131,10 @@ func UpdateSubsidyStatusHandler(c *gin.Context) {
 		return
 	}
 
+	audit.Record(c, "subsidy."+strings.ToLower(req.Status), "user", userID,
+		gin.H{"subsidy_status": user.SubsidyStatus, "application_id": user.ApplicationID},
+		gin.H{"subsidy_status": newStatus, "application_id": applicationID, "reason": req.Reason})
+
 	// TODO: Send email notification to user
 
 	c.JSON(http.StatusOK, gin.H{
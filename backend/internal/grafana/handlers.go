@@ -0,0 +1,461 @@
+package grafana
+
+import (
+	"database/sql"
+	"net/http"
+	"sems-backend/internal/authz"
+	"sems-backend/internal/database"
+	"sems-backend/internal/energy"
+	"sems-backend/internal/timectx"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Metrics offered to the Grafana query editor
+var metrics = []string{"solar_power", "load_power", "grid_power", "battery_level", "temperature", "humidity"}
+
+// Resolutions in ascending order, used to pick one from Grafana's interval
+var resolutions = []struct {
+	name string
+	size time.Duration
+}{
+	{"5m", 5 * time.Minute},
+	{"15m", 15 * time.Minute},
+	{"hour", time.Hour},
+	{"day", 24 * time.Hour},
+	{"month", 31 * 24 * time.Hour},
+}
+
+type timeRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// SearchRequest is the body Grafana sends to /search
+type SearchRequest struct {
+	Target string `json:"target"`
+}
+
+// SearchResult is one option in a Grafana dropdown
+type SearchResult struct {
+	Text  string `json:"text"`
+	Value string `json:"value"`
+}
+
+// QueryTarget is one query row in a Grafana panel. Target is the metric name;
+// Data carries optional selectors set through the panel's payload editor.
+type QueryTarget struct {
+	RefID  string `json:"refId"`
+	Target string `json:"target"`
+	Type   string `json:"type"`
+	Hide   bool   `json:"hide"`
+	Data   struct {
+		DeviceIDs   []string `json:"device_ids"`
+		PlantIDs    []string `json:"plant_ids"`
+		Regions     []string `json:"regions"`
+		Aggregation string   `json:"aggregation"`
+		Resolution  string   `json:"resolution"`
+		GroupBy     string   `json:"group_by"`
+	} `json:"data"`
+}
+
+// QueryRequest is the body Grafana sends to /query
+type QueryRequest struct {
+	Range      timeRange     `json:"range"`
+	IntervalMs int64         `json:"intervalMs"`
+	Targets    []QueryTarget `json:"targets"`
+}
+
+// TimeSerie is a Grafana time series; datapoints are [value, unix ms] pairs
+type TimeSerie struct {
+	Target     string           `json:"target"`
+	RefID      string           `json:"refId,omitempty"`
+	Datapoints [][2]interface{} `json:"datapoints"`
+}
+
+// AnnotationRequest is the body Grafana sends to /annotations
+type AnnotationRequest struct {
+	Range      timeRange              `json:"range"`
+	Annotation map[string]interface{} `json:"annotation"`
+}
+
+// Annotation is an alert rendered as a Grafana annotation
+type Annotation struct {
+	Annotation map[string]interface{} `json:"annotation,omitempty"`
+	Time       int64                  `json:"time"`
+	Title      string                 `json:"title"`
+	Text       string                 `json:"text"`
+	Tags       []string               `json:"tags"`
+}
+
+// TestHandler answers Grafana's "Save & test" connectivity check
+// @Summary Grafana datasource health check
+// @Tags Grafana
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Security BearerAuth
+// @Router /grafana [get]
+func TestHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// SearchHandler lists metrics, devices or plants for the query editor.
+// Target "devices" or "plants" lists those in the caller's scope; anything else lists metrics.
+// @Summary Grafana search
+// @Tags Grafana
+// @Accept json
+// @Produce json
+// @Param request body SearchRequest true "Search target"
+// @Success 200 {array} SearchResult
+// @Failure 500 {object} map[string]string
+// @Security BearerAuth
+// @Router /grafana/search [post]
+func SearchHandler(c *gin.Context) {
+	var req SearchRequest
+	c.ShouldBindJSON(&req)
+
+	scope, err := authz.Caller(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	results := []SearchResult{}
+
+	switch strings.ToLower(strings.TrimSpace(req.Target)) {
+	case "devices":
+		devices, err := energy.ScopedDevices(scope, nil, nil, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list devices"})
+			return
+		}
+		for _, d := range devices {
+			results = append(results, SearchResult{Text: d.Name, Value: d.ID})
+		}
+	case "plants":
+		plants, err := scopedPlants(scope)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list plants"})
+			return
+		}
+		results = plants
+	default:
+		for _, m := range metrics {
+			results = append(results, SearchResult{Text: m, Value: m})
+		}
+	}
+
+	c.JSON(http.StatusOK, results)
+}
+
+// QueryHandler returns energy_data time series for each panel target
+// @Summary Grafana query
+// @Tags Grafana
+// @Accept json
+// @Produce json
+// @Param request body QueryRequest true "Grafana query"
+// @Success 200 {array} TimeSerie
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security BearerAuth
+// @Router /grafana/query [post]
+func QueryHandler(c *gin.Context) {
+	var req QueryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	scope, err := authz.Caller(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	loc := timectx.ForUser(scope.ID)
+
+	series := []TimeSerie{}
+	for _, target := range req.Targets {
+		if target.Hide || target.Target == "" {
+			continue
+		}
+
+		q := &energy.SeriesQuery{
+			Start:       req.Range.From,
+			End:         req.Range.To,
+			Resolution:  target.Data.Resolution,
+			Aggregation: target.Data.Aggregation,
+			Metrics:     []string{target.Target},
+			DeviceIDs:   target.Data.DeviceIDs,
+			PlantIDs:    target.Data.PlantIDs,
+			Regions:     target.Data.Regions,
+			GroupBy:     target.Data.GroupBy,
+			Location:    loc,
+		}
+		if q.Resolution == "" {
+			q.Resolution = resolutionFor(req.IntervalMs)
+		}
+		if q.Aggregation == "" {
+			q.Aggregation = "avg"
+		}
+		if q.GroupBy == "" {
+			q.GroupBy = "none"
+		}
+		if err := q.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": target.RefID + ": " + err.Error()})
+			return
+		}
+
+		devices, err := energy.ScopedDevices(scope, q.DeviceIDs, q.PlantIDs, q.Regions)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve devices"})
+			return
+		}
+		result, err := energy.QueryTimeSeries(devices, q)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query time series"})
+			return
+		}
+
+		for _, s := range result.Series {
+			name := s.Metric
+			if s.DeviceName != "" {
+				name = s.DeviceName + " " + s.Metric
+			}
+			ts := TimeSerie{Target: name, RefID: target.RefID, Datapoints: [][2]interface{}{}}
+			for _, p := range s.Points {
+				ts.Datapoints = append(ts.Datapoints, [2]interface{}{p.Value, p.Time.UnixMilli()})
+			}
+			series = append(series, ts)
+		}
+	}
+
+	c.JSON(http.StatusOK, series)
+}
+
+// AnnotationsHandler returns alerts in range for devices and plants in the caller's scope.
+// The annotation query may name a severity (INFO, WARN, CRITICAL) to filter on.
+// @Summary Grafana annotations
+// @Tags Grafana
+// @Accept json
+// @Produce json
+// @Param request body AnnotationRequest true "Grafana annotation query"
+// @Success 200 {array} Annotation
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security BearerAuth
+// @Router /grafana/annotations [post]
+func AnnotationsHandler(c *gin.Context) {
+	var req AnnotationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	scope, err := authz.Caller(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	createdAt := database.Current.Time("created_at")
+	query := `
+		SELECT id, COALESCE(plant_id, ''), COALESCE(device_id, ''), severity, message, created_at, resolved
+		FROM alerts
+		WHERE ` + createdAt + ` >= ` + database.Current.Time("?") + ` AND ` + createdAt + ` < ` + database.Current.Time("?")
+	args := []interface{}{req.Range.From.UTC(), req.Range.To.UTC()}
+
+	if severity, ok := req.Annotation["query"].(string); ok && strings.TrimSpace(severity) != "" {
+		query += " AND severity = ?"
+		args = append(args, strings.ToUpper(strings.TrimSpace(severity)))
+	}
+
+	var allowedDevices, allowedPlants map[string]bool
+	if scope.Scope == authz.Global {
+		// Global roles bound to an organisation see alerts of its devices and plants only
+		if deviceTenant, deviceArgs := authz.TenantFilter(scope.OrgID, "u.org_id"); deviceTenant != "" {
+			plantTenant, plantArgs := authz.TenantFilter(scope.OrgID, "p.org_id")
+			query += ` AND (device_id IN (SELECT d.id FROM devices d JOIN users u ON u.id = d.user_id WHERE 1=1` + deviceTenant + `)
+				OR plant_id IN (SELECT p.id FROM solar_plants p WHERE 1=1` + plantTenant + `))`
+			args = append(append(args, deviceArgs...), plantArgs...)
+		}
+	} else {
+		devices, err := energy.ScopedDevices(scope, nil, nil, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve devices"})
+			return
+		}
+		allowedDevices = make(map[string]bool)
+		allowedPlants = make(map[string]bool)
+		for _, d := range devices {
+			allowedDevices[d.ID] = true
+		}
+		// Plant-wide alerts are only visible to admins whose scope covers the plant
+		if scope.Scope == authz.Scoped {
+			for _, d := range devices {
+				if d.PlantID != "" {
+					allowedPlants[d.PlantID] = true
+				}
+			}
+		}
+	}
+	query += " ORDER BY created_at ASC LIMIT 1000"
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch alerts"})
+		return
+	}
+	defer rows.Close()
+
+	annotations := []Annotation{}
+	for rows.Next() {
+		var id, plantID, deviceID, severity, message string
+		var createdAt time.Time
+		var resolved sql.NullBool
+		if err := rows.Scan(&id, &plantID, &deviceID, &severity, &message, &createdAt, &resolved); err != nil {
+			continue
+		}
+		if allowedDevices != nil && !allowedDevices[deviceID] && !allowedPlants[plantID] {
+			continue
+		}
+
+		tags := []string{strings.ToLower(severity)}
+		if resolved.Bool {
+			tags = append(tags, "resolved")
+		}
+		if deviceID != "" {
+			tags = append(tags, "device:"+deviceID)
+		}
+		annotations = append(annotations, Annotation{
+			Annotation: req.Annotation,
+			Time:       createdAt.UnixMilli(),
+			Title:      severity,
+			Text:       message,
+			Tags:       tags,
+		})
+	}
+
+	c.JSON(http.StatusOK, annotations)
+}
+
+// CreateTokenRequest names a new datasource token
+type CreateTokenRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// CreateTokenHandler issues a datasource token for the current user
+// @Summary Create Grafana datasource token
+// @Description The plaintext token is only returned once
+// @Tags Grafana
+// @Accept json
+// @Produce json
+// @Param request body CreateTokenRequest true "Token name"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security BearerAuth
+// @Router /user/grafana/tokens [post]
+func CreateTokenHandler(c *gin.Context) {
+	var req CreateTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	plain, token, err := CreateToken(c.GetString("user_id"), req.Name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"token": plain, "details": token})
+}
+
+// GetTokensHandler lists the current user's datasource tokens
+// @Summary List Grafana datasource tokens
+// @Tags Grafana
+// @Produce json
+// @Success 200 {array} Token
+// @Failure 500 {object} map[string]string
+// @Security BearerAuth
+// @Router /user/grafana/tokens [get]
+func GetTokensHandler(c *gin.Context) {
+	tokens, err := GetTokensByUserID(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tokens"})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// RevokeTokenHandler revokes one of the current user's datasource tokens
+// @Summary Revoke Grafana datasource token
+// @Tags Grafana
+// @Produce json
+// @Param id path string true "Token ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /user/grafana/tokens/{id} [delete]
+func RevokeTokenHandler(c *gin.Context) {
+	if err := RevokeToken(c.GetString("user_id"), c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Token revoked"})
+}
+
+// scopedPlants lists plants visible to the caller; global roles see every plant
+// of their organisation, or every plant at all on the platform
+func scopedPlants(scope *authz.Subject) ([]SearchResult, error) {
+	results := []SearchResult{}
+
+	if scope.Scope == authz.Global {
+		tenant, args := authz.TenantFilter(scope.OrgID, "org_id")
+		rows, err := database.DB.Query(`SELECT id, name FROM solar_plants WHERE 1=1`+tenant+` ORDER BY name`, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var r SearchResult
+			if err := rows.Scan(&r.Value, &r.Text); err != nil {
+				return nil, err
+			}
+			results = append(results, r)
+		}
+		return results, nil
+	}
+
+	devices, err := energy.ScopedDevices(scope, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for _, d := range devices {
+		if d.PlantID == "" || seen[d.PlantID] {
+			continue
+		}
+		seen[d.PlantID] = true
+		var name string
+		if err := database.DB.QueryRow(`SELECT name FROM solar_plants WHERE id = ?`, d.PlantID).Scan(&name); err != nil {
+			name = d.PlantID
+		}
+		results = append(results, SearchResult{Text: name, Value: d.PlantID})
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Text < results[j].Text })
+	return results, nil
+}
+
+// resolutionFor picks the finest resolution at least as coarse as Grafana's interval
+func resolutionFor(intervalMs int64) string {
+	interval := time.Duration(intervalMs) * time.Millisecond
+	for _, r := range resolutions {
+		if interval <= r.size {
+			return r.name
+		}
+	}
+	return "month"
+}
@@ -0,0 +1,291 @@
+package grafana_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"sems-backend/internal/config"
+	"sems-backend/internal/database"
+	"sems-backend/internal/devices"
+	"sems-backend/internal/grafana"
+	"sems-backend/internal/orgs"
+	"sems-backend/internal/users"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	delhiPlant  = "550e8400-e29b-41d4-a716-446655440001"
+	mumbaiPlant = "550e8400-e29b-41d4-a716-446655440002"
+)
+
+func openTestDB(t *testing.T) {
+	t.Helper()
+	if err := database.InitDB(config.DatabaseConfig{Driver: "sqlite", Path: filepath.Join(t.TempDir(), "grafana.db"), MaxOpenConns: 1}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(database.CloseDB)
+	if err := database.RunMigrations(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newAccount(t *testing.T, email, role, plant string) *users.User {
+	t.Helper()
+	u, err := users.CreateUser("Test", role, email, "x", role, "", "", "", "", "", "", "", "", 0, 0, "", "", plant)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+// newDevice registers a device for owner with one reading and one alert at the given time
+func newDevice(t *testing.T, owner *users.User, name string, at time.Time) string {
+	t.Helper()
+	ownerID, _ := uuid.Parse(owner.ID)
+	d, err := devices.CreateDevice(ownerID, name, "esp32", "Home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := d.ID.String()
+	if _, err := database.DB.Exec(`INSERT INTO energy_data (id, device_id, timestamp, solar_power, load_power, grid_power, battery_level, temperature, humidity, grid_status)
+		VALUES (?, ?, ?, 2.5, 1, 0, 80, 30, 40, true)`, uuid.New().String(), id, at.UTC()); err != nil {
+		t.Fatal(err)
+	}
+	newAlert(t, "", id, name+" offline", at)
+	return id
+}
+
+func newAlert(t *testing.T, plantID, deviceID, message string, at time.Time) {
+	t.Helper()
+	var plant, device interface{}
+	if plantID != "" {
+		plant = plantID
+	}
+	if deviceID != "" {
+		device = deviceID
+	}
+	if _, err := database.DB.Exec(`INSERT INTO alerts (id, plant_id, device_id, severity, message, created_at) VALUES (?, ?, ?, 'WARN', ?, ?)`,
+		uuid.New().String(), plant, device, message, at.UTC()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testRouter mounts the datasource endpoints for the account named in X-Test-User
+func testRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		u, err := users.GetUserByID(c.GetHeader("X-Test-User"))
+		if err != nil {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Set("user_id", u.ID)
+		c.Set("role", u.Role)
+	})
+	r.POST("/grafana/search", grafana.SearchHandler)
+	r.POST("/grafana/query", grafana.QueryHandler)
+	r.POST("/grafana/annotations", grafana.AnnotationsHandler)
+	return r
+}
+
+func post(t *testing.T, r *gin.Engine, caller *users.User, path, body string, out interface{}) {
+	t.Helper()
+	req := httptest.NewRequest("POST", path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Test-User", caller.ID)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s as %s = %d (%s)", path, caller.Email, w.Code, w.Body)
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// datasource collects what one caller sees through each endpoint
+type datasource struct {
+	devices, plants, series, annotations []string
+}
+
+func browse(t *testing.T, r *gin.Engine, caller *users.User, from, to time.Time) datasource {
+	t.Helper()
+	var ds datasource
+	var found []grafana.SearchResult
+	post(t, r, caller, "/grafana/search", `{"target":"devices"}`, &found)
+	for _, f := range found {
+		ds.devices = append(ds.devices, f.Text)
+	}
+	found = nil
+	post(t, r, caller, "/grafana/search", `{"target":"plants"}`, &found)
+	for _, f := range found {
+		ds.plants = append(ds.plants, f.Value)
+	}
+
+	rng := `"range":{"from":"` + from.Format(time.RFC3339) + `","to":"` + to.Format(time.RFC3339) + `"}`
+	var series []grafana.TimeSerie
+	post(t, r, caller, "/grafana/query", `{`+rng+`,"intervalMs":3600000,"targets":[{"refId":"A","target":"solar_power","data":{"group_by":"device"}}]}`, &series)
+	for _, s := range series {
+		for _, p := range s.Datapoints {
+			if p[0] != nil {
+				ds.series = append(ds.series, strings.TrimSuffix(s.Target, " solar_power"))
+				break
+			}
+		}
+	}
+
+	var annotations []grafana.Annotation
+	post(t, r, caller, "/grafana/annotations", `{`+rng+`,"annotation":{"name":"alerts"}}`, &annotations)
+	for _, a := range annotations {
+		ds.annotations = append(ds.annotations, a.Text)
+	}
+
+	for _, list := range [][]string{ds.devices, ds.plants, ds.series, ds.annotations} {
+		sort.Strings(list)
+	}
+	return ds
+}
+
+func expect(t *testing.T, who, what string, got, want []string) {
+	t.Helper()
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("%s %s = %v, want %v", who, what, got, want)
+	}
+}
+
+// expectIncludes checks a global view, which also holds the seeded demo data
+func expectIncludes(t *testing.T, who, what string, got, want []string) {
+	t.Helper()
+	seen := make(map[string]bool)
+	for _, g := range got {
+		seen[g] = true
+	}
+	for _, w := range want {
+		if !seen[w] {
+			t.Errorf("%s %s = %v, missing %s", who, what, got, w)
+		}
+	}
+}
+
+func TestDatasourceFollowsRoleScope(t *testing.T) {
+	openTestDB(t)
+	at := time.Now().UTC().Truncate(time.Hour).Add(-2 * time.Hour)
+	from, to := at.Add(-time.Hour), at.Add(time.Hour)
+
+	alice := newAccount(t, "alice@test", "USER", delhiPlant)
+	bob := newAccount(t, "bob@test", "USER", mumbaiPlant)
+	delhiAdmin := newAccount(t, "admin@test", "ADMIN", delhiPlant)
+	superAdmin, err := users.GetUserByEmail("superadmin@solar.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newDevice(t, alice, "Alice Roof", at)
+	newDevice(t, bob, "Bob Roof", at)
+	newAlert(t, delhiPlant, "", "Delhi inverter fault", at)
+	newAlert(t, mumbaiPlant, "", "Mumbai inverter fault", at)
+
+	r := testRouter()
+
+	// A customer sees their own device only; plant-wide alerts are for admins
+	ds := browse(t, r, alice, from, to)
+	expect(t, "user", "devices", ds.devices, []string{"Alice Roof"})
+	expect(t, "user", "plants", ds.plants, []string{delhiPlant})
+	expect(t, "user", "series", ds.series, []string{"Alice Roof"})
+	expect(t, "user", "annotations", ds.annotations, []string{"Alice Roof offline"})
+
+	// A plant admin sees the customers and alerts of their plant
+	ds = browse(t, r, delhiAdmin, from, to)
+	expect(t, "scoped admin", "devices", ds.devices, []string{"Alice Roof"})
+	expect(t, "scoped admin", "plants", ds.plants, []string{delhiPlant})
+	expect(t, "scoped admin", "series", ds.series, []string{"Alice Roof"})
+	expect(t, "scoped admin", "annotations", ds.annotations, []string{"Alice Roof offline", "Delhi inverter fault"})
+
+	// The super admin sees the whole fleet
+	ds = browse(t, r, superAdmin, from, to)
+	expectIncludes(t, "super admin", "devices", ds.devices, []string{"Alice Roof", "Bob Roof"})
+	expectIncludes(t, "super admin", "plants", ds.plants, []string{delhiPlant, mumbaiPlant})
+	expect(t, "super admin", "series", ds.series, []string{"Alice Roof", "Bob Roof"})
+	expect(t, "super admin", "annotations", ds.annotations, []string{"Alice Roof offline", "Bob Roof offline", "Delhi inverter fault", "Mumbai inverter fault"})
+}
+
+func TestDatasourceStopsAtTheOrganisation(t *testing.T) {
+	openTestDB(t)
+	at := time.Now().UTC().Truncate(time.Hour).Add(-2 * time.Hour)
+	from, to := at.Add(-time.Hour), at.Add(time.Hour)
+
+	sunco := &orgs.Organization{Name: "SunCo EPC"}
+	brightway := &orgs.Organization{Name: "Brightway Solar"}
+	for _, o := range []*orgs.Organization{sunco, brightway} {
+		if err := orgs.Create(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+	member := func(email, role string, o *orgs.Organization) *users.User {
+		t.Helper()
+		u := newAccount(t, email, role, "")
+		if err := orgs.AddMember(o.ID, u.ID); err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	plant := func(name string, o *orgs.Organization) string {
+		t.Helper()
+		id := uuid.New().String()
+		if _, err := database.DB.Exec(`INSERT INTO solar_plants (id, name, location, region, capacity_kw, org_id) VALUES (?, ?, 'Site', 'Delhi', 100, ?)`, id, name, o.ID); err != nil {
+			t.Fatal(err)
+		}
+		newAlert(t, id, "", name+" fault", at)
+		return id
+	}
+
+	suncoAdmin := member("admin@sunco.test", "ORG_ADMIN", sunco)
+	brightAdmin := member("admin@brightway.test", "ORG_ADMIN", brightway)
+	newDevice(t, member("alice@sunco.test", "USER", sunco), "SunCo Roof", at)
+	newDevice(t, member("bob@brightway.test", "USER", brightway), "Brightway Roof", at)
+	suncoPlant := plant("SunCo Farm", sunco)
+	brightPlant := plant("Brightway Farm", brightway)
+	platform, err := users.GetUserByEmail("superadmin@solar.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := testRouter()
+	for _, tc := range []struct {
+		who    string
+		caller *users.User
+		want   datasource
+	}{
+		{"sunco admin", suncoAdmin, datasource{
+			devices:     []string{"SunCo Roof"},
+			plants:      []string{suncoPlant},
+			series:      []string{"SunCo Roof"},
+			annotations: []string{"SunCo Farm fault", "SunCo Roof offline"},
+		}},
+		{"brightway admin", brightAdmin, datasource{
+			devices:     []string{"Brightway Roof"},
+			plants:      []string{brightPlant},
+			series:      []string{"Brightway Roof"},
+			annotations: []string{"Brightway Farm fault", "Brightway Roof offline"},
+		}},
+	} {
+		ds := browse(t, r, tc.caller, from, to)
+		expect(t, tc.who, "devices", ds.devices, tc.want.devices)
+		expect(t, tc.who, "plants", ds.plants, tc.want.plants)
+		expect(t, tc.who, "series", ds.series, tc.want.series)
+		expect(t, tc.who, "annotations", ds.annotations, tc.want.annotations)
+	}
+
+	// The platform still sees both organisations
+	ds := browse(t, r, platform, from, to)
+	expectIncludes(t, "platform", "plants", ds.plants, []string{suncoPlant, brightPlant})
+	expect(t, "platform", "annotations", ds.annotations, []string{"Brightway Farm fault", "Brightway Roof offline", "SunCo Farm fault", "SunCo Roof offline"})
+}
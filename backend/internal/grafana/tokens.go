@@ -0,0 +1,162 @@
+package grafana
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sems-backend/internal/database"
+	"sems-backend/internal/users"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ScopeRead is the only scope a datasource token can carry
+const ScopeRead = "grafana:read"
+
+const tokenPrefix = "sgt_"
+
+var ErrInvalidToken = errors.New("invalid datasource token")
+
+// Token is a datasource token as shown to its owner; the secret is only returned on creation
+type Token struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scope      string     `json:"scope"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// CreateToken issues a new token for the user and returns the plaintext once
+func CreateToken(userID, name string) (string, *Token, error) {
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+	plain := tokenPrefix + hex.EncodeToString(secret)
+
+	token := &Token{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Name:      name,
+		Prefix:    plain[:len(tokenPrefix)+8],
+		Scope:     ScopeRead,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	_, err := database.DB.Exec(`
+		INSERT INTO grafana_tokens (id, user_id, name, token_prefix, token_hash, scope, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		token.ID, token.UserID, token.Name, token.Prefix, hashToken(plain), token.Scope, token.CreatedAt)
+	if err != nil {
+		return "", nil, err
+	}
+	return plain, token, nil
+}
+
+// GetTokensByUserID lists a user's tokens, newest first
+func GetTokensByUserID(userID string) ([]Token, error) {
+	rows, err := database.DB.Query(`
+		SELECT id, user_id, name, token_prefix, scope, last_used_at, revoked_at, created_at
+		FROM grafana_tokens
+		WHERE user_id = ?
+		ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []Token{}
+	for rows.Next() {
+		var t Token
+		var lastUsed, revoked sql.NullTime
+		if err := rows.Scan(&t.ID, &t.UserID, &t.Name, &t.Prefix, &t.Scope, &lastUsed, &revoked, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		if lastUsed.Valid {
+			t.LastUsedAt = &lastUsed.Time
+		}
+		if revoked.Valid {
+			t.RevokedAt = &revoked.Time
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, nil
+}
+
+// RevokeToken revokes one of the user's tokens
+func RevokeToken(userID, tokenID string) error {
+	result, err := database.DB.Exec(`
+		UPDATE grafana_tokens SET revoked_at = ?
+		WHERE id = ? AND user_id = ? AND revoked_at IS NULL`,
+		time.Now().UTC(), tokenID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Authenticate resolves a plaintext token to its owner
+func Authenticate(plain string) (*users.User, error) {
+	if !strings.HasPrefix(plain, tokenPrefix) {
+		return nil, ErrInvalidToken
+	}
+
+	var id, userID string
+	err := database.DB.QueryRow(`
+		SELECT id, user_id FROM grafana_tokens
+		WHERE token_hash = ? AND revoked_at IS NULL`, hashToken(plain)).Scan(&id, &userID)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	user, err := users.GetUserByID(userID)
+	if err != nil || !user.IsActive {
+		return nil, ErrInvalidToken
+	}
+
+	database.DB.Exec(`UPDATE grafana_tokens SET last_used_at = ? WHERE id = ?`, time.Now().UTC(), id)
+	return user, nil
+}
+
+// TokenAuth authenticates Grafana requests with a datasource token. The token
+// acts with its owner's role, so the usual user/admin/super admin scoping applies.
+func TokenAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		plain := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if plain == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Datasource token required"})
+			c.Abort()
+			return
+		}
+
+		user, err := Authenticate(plain)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid datasource token"})
+			c.Abort()
+			return
+		}
+
+		c.Set("user_id", user.ID)
+		c.Set("email", user.Email)
+		c.Set("role", user.Role)
+		c.Set("token_scope", ScopeRead)
+		c.Next()
+	}
+}
+
+func hashToken(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
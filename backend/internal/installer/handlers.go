@@ -2,6 +2,7 @@ package installer
 
 import (
 	"net/http"
+	"sems-backend/internal/authz"
 	"sems-backend/internal/users"
 	"time"
 
@@ -25,7 +26,13 @@ type CompleteInstallationRequest struct {
 // @Security BearerAuth
 // @Router /installer/jobs [get]
 func GetAvailableJobsHandler(c *gin.Context) {
-	jobs, err := users.GetUsersByInstallationStatus(users.InstallationStatusPlanned)
+	caller, err := authz.Caller(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	// Installers in an organisation only see its customers' jobs
+	jobs, err := users.GetUsersByInstallationStatus(users.InstallationStatusPlanned, caller.OrgID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch installation jobs"})
 		return
@@ -60,7 +67,7 @@ func CompleteInstallationHandler(c *gin.Context) {
 	}
 
 	user, err := users.GetUserByID(userID)
-	if err != nil {
+	if err != nil || !authz.Allowed(c, authz.InstallationsManage, authz.Resource{Kind: authz.Installation, OwnerID: user.ID, Assignee: user.InstallerID}) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
@@ -2,6 +2,8 @@ package inventory
 
 import (
 	"net/http"
+	"sems-backend/internal/audit"
+	"sems-backend/internal/authz"
 
 	"github.com/gin-gonic/gin"
 )
@@ -31,11 +33,18 @@ func (h *Handler) CreateItem(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input format"})
 		return
 	}
+	caller, err := authz.Caller(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	item.OrgID = caller.OrgID
 
 	if err := h.Repo.CreateItem(c.Request.Context(), &item); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create item"})
 		return
 	}
+	audit.Record(c, "inventory.create", "inventory_item", item.ID, nil, item)
 
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Item created successfully",
@@ -53,7 +62,12 @@ func (h *Handler) CreateItem(c *gin.Context) {
 // @Security BearerAuth
 // @Router /inventory [get]
 func (h *Handler) GetAllItems(c *gin.Context) {
-	items, err := h.Repo.GetAllItems(c.Request.Context())
+	caller, err := authz.Caller(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	items, err := h.Repo.GetAllItems(c.Request.Context(), caller.OrgID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch items"})
 		return
@@ -75,7 +89,7 @@ func (h *Handler) GetAllItems(c *gin.Context) {
 func (h *Handler) GetItem(c *gin.Context) {
 	id := c.Param("id")
 	item, err := h.Repo.GetItemByID(c.Request.Context(), id)
-	if err != nil {
+	if err != nil || !authz.InTenant(c, item.OrgID) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
 		return
 	}
@@ -92,6 +106,7 @@ func (h *Handler) GetItem(c *gin.Context) {
 // @Param item body InventoryItem true "Item update data"
 // @Success 200 {object} map[string]string
 // @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Security BearerAuth
 // @Router /inventory/{id} [put]
@@ -104,10 +119,18 @@ func (h *Handler) UpdateItem(c *gin.Context) {
 	}
 	item.ID = id
 
+	before, err := h.Repo.GetItemByID(c.Request.Context(), id)
+	if err != nil || !authz.InTenant(c, before.OrgID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	}
+	item.OrgID = before.OrgID
+
 	if err := h.Repo.UpdateItem(c.Request.Context(), &item); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update item"})
 		return
 	}
+	audit.Record(c, "inventory.update", "inventory_item", id, before, item)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Item updated successfully"})
 }
@@ -119,15 +142,23 @@ func (h *Handler) UpdateItem(c *gin.Context) {
 // @Produce json
 // @Param id path string true "Item ID"
 // @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Security BearerAuth
 // @Router /inventory/{id} [delete]
 func (h *Handler) DeleteItem(c *gin.Context) {
 	id := c.Param("id")
+	before, err := h.Repo.GetItemByID(c.Request.Context(), id)
+	if err != nil || !authz.InTenant(c, before.OrgID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	}
+
 	if err := h.Repo.DeleteItem(c.Request.Context(), id); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete item"})
 		return
 	}
+	audit.Record(c, "inventory.delete", "inventory_item", id, before, nil)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Item deleted successfully"})
 }
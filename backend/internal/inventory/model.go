@@ -17,6 +17,7 @@ type InventoryItem struct {
 	Gallery     string    `json:"gallery" db:"gallery"`             // JSON string of additional image URLs
 	Specs       string    `json:"specs" db:"specs"`                 // JSON string of technical specifications
 	IsActive    bool      `json:"is_active" db:"is_active"`
+	OrgID       string    `json:"org_id,omitempty" db:"org_id"` // set from the creator's organisation
 	CreatedAt   time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"sems-backend/internal/authz"
 	"time"
 
 	"github.com/google/uuid"
@@ -26,25 +27,29 @@ func (r *Repository) CreateItem(ctx context.Context, item *InventoryItem) error
 	query := `
 		INSERT INTO inventory_items (
 			id, name, category, brand, model, description, price, stock_qty, 
-			image_url, gallery, specs, is_active, created_at, updated_at
+			image_url, gallery, specs, is_active, created_at, updated_at, org_id
 		) VALUES (
 			?, ?, ?, ?, ?, ?, ?, ?, 
-			?, ?, ?, ?, ?, ?
+			?, ?, ?, ?, ?, ?, ?
 		)
 	`
+	var orgID interface{}
+	if item.OrgID != "" {
+		orgID = item.OrgID
+	}
 	_, err := r.db.ExecContext(ctx, query,
 		item.ID, item.Name, item.Category, item.Brand, item.Model, item.Description, item.Price, item.StockQty,
-		item.ImageURL, item.Gallery, item.Specs, item.IsActive, item.CreatedAt, item.UpdatedAt,
+		item.ImageURL, item.Gallery, item.Specs, item.IsActive, item.CreatedAt, item.UpdatedAt, orgID,
 	)
 	return err
 }
 
 func (r *Repository) GetItemByID(ctx context.Context, id string) (*InventoryItem, error) {
 	item := &InventoryItem{}
-	query := `SELECT id, name, category, brand, model, description, price, stock_qty, image_url, gallery, specs, is_active, created_at, updated_at FROM inventory_items WHERE id = ?`
+	query := `SELECT id, name, category, brand, model, description, price, stock_qty, image_url, gallery, specs, is_active, created_at, updated_at, COALESCE(org_id, '') FROM inventory_items WHERE id = ?`
 	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&item.ID, &item.Name, &item.Category, &item.Brand, &item.Model, &item.Description, &item.Price, &item.StockQty,
-		&item.ImageURL, &item.Gallery, &item.Specs, &item.IsActive, &item.CreatedAt, &item.UpdatedAt,
+		&item.ImageURL, &item.Gallery, &item.Specs, &item.IsActive, &item.CreatedAt, &item.UpdatedAt, &item.OrgID,
 	)
 	if err != nil {
 		return nil, err
@@ -52,9 +57,11 @@ func (r *Repository) GetItemByID(ctx context.Context, id string) (*InventoryItem
 	return item, nil
 }
 
-func (r *Repository) GetAllItems(ctx context.Context) ([]InventoryItem, error) {
-	query := `SELECT id, name, category, brand, model, description, price, stock_qty, image_url, gallery, specs, is_active, created_at, updated_at FROM inventory_items ORDER BY created_at DESC`
-	rows, err := r.db.QueryContext(ctx, query)
+// GetAllItems lists the inventory, of one organisation when orgID is set
+func (r *Repository) GetAllItems(ctx context.Context, orgID string) ([]InventoryItem, error) {
+	tenant, args := authz.TenantFilter(orgID, "org_id")
+	query := `SELECT id, name, category, brand, model, description, price, stock_qty, image_url, gallery, specs, is_active, created_at, updated_at, COALESCE(org_id, '') FROM inventory_items WHERE 1=1` + tenant + ` ORDER BY created_at DESC`
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -65,7 +72,7 @@ func (r *Repository) GetAllItems(ctx context.Context) ([]InventoryItem, error) {
 		var i InventoryItem
 		if err := rows.Scan(
 			&i.ID, &i.Name, &i.Category, &i.Brand, &i.Model, &i.Description, &i.Price, &i.StockQty,
-			&i.ImageURL, &i.Gallery, &i.Specs, &i.IsActive, &i.CreatedAt, &i.UpdatedAt,
+			&i.ImageURL, &i.Gallery, &i.Specs, &i.IsActive, &i.CreatedAt, &i.UpdatedAt, &i.OrgID,
 		); err != nil {
 			return nil, err
 		}
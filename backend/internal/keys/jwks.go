@@ -0,0 +1,66 @@
+package keys
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JWK is one public key in RFC 7517 form
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// PublicKeys lists every key that can still verify tokens. HS256 keys are
+// shared secrets and never published.
+func PublicKeys() []JWK {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	t := now()
+	set := []JWK{}
+	for _, k := range loaded {
+		if !t.Before(k.expiresAt) {
+			continue
+		}
+		switch pub := k.verifier.(type) {
+		case *rsa.PublicKey:
+			set = append(set, JWK{
+				Kty: "RSA", Kid: k.id, Alg: k.algorithm, Use: "sig",
+				N: b64(pub.N.Bytes()),
+				E: b64(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			set = append(set, JWK{Kty: "OKP", Kid: k.id, Alg: k.algorithm, Use: "sig", Crv: "Ed25519", X: b64(pub)})
+		}
+	}
+	return set
+}
+
+// JWKSHandler publishes the verification keys so other services can check SEMS tokens
+// @Summary JSON Web Key Set
+// @Description Public keys for verifying SEMS access tokens; pick the key by the token's kid header
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /.well-known/jwks.json [get]
+func JWKSHandler(c *gin.Context) {
+	// Short enough that a new key is picked up well within the overlap period
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": PublicKeys()})
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,268 @@
+// Package keys manages the keys that sign and verify SEMS access tokens.
+// Several keys can be valid at once, each identified by the kid header of the
+// tokens it signed. A key signs new tokens until it retires, then keeps
+// verifying for an overlap period so tokens issued just before a rotation
+// stay usable. Keys live in the database, sealed with the configured secret,
+// so every instance signs and verifies with the same set.
+package keys
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sems-backend/internal/config"
+	"sems-backend/internal/database"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrNoSigningKey      = errors.New("no signing key available")
+	ErrUnknownKey        = errors.New("token signed by an unknown key")
+	ErrAlgorithmMismatch = errors.New("token algorithm does not match its key")
+)
+
+// reloadInterval limits how often an unknown kid triggers a database reload;
+// another instance may have rotated since this one last looked
+const reloadInterval = 10 * time.Second
+
+type signingKey struct {
+	id        string
+	algorithm string
+	signer    interface{} // []byte, *rsa.PrivateKey or ed25519.PrivateKey
+	verifier  interface{} // []byte, *rsa.PublicKey or ed25519.PublicKey
+	createdAt time.Time
+	retiresAt time.Time
+	expiresAt time.Time
+}
+
+var (
+	algorithm = "RS256"
+	rotation  = 30 * 24 * time.Hour
+	overlap   = 24 * time.Hour
+	sealKey   = sha256.Sum256([]byte("SEMS_SECRET"))
+
+	mu         sync.RWMutex
+	loaded     []*signingKey // newest first
+	lastReload time.Time
+
+	// now is replaced in tests to move through rotations
+	now = time.Now
+)
+
+// Configure sets the signing algorithm, rotation schedule and sealing secret
+func Configure(cfg config.AuthConfig) {
+	algorithm = cfg.SigningAlgorithm
+	rotation = cfg.KeyRotation.Duration
+	overlap = cfg.KeyOverlap.Duration
+	sealKey = sha256.Sum256([]byte(cfg.JWTSecret))
+}
+
+// Init loads the key set and creates the first key if there is none. Without
+// a database the keys only live in memory.
+func Init() error {
+	return reload(context.Background())
+}
+
+// Maintain reloads the key set and rotates the signing key when it is due;
+// run it on a schedule much shorter than the rotation period
+func Maintain(ctx context.Context) {
+	if err := reload(ctx); err != nil {
+		log.Printf("❌ Signing key maintenance failed: %v", err)
+	}
+}
+
+// Check reports whether a signing key is available, for readiness probes
+func Check(ctx context.Context) error {
+	if current() == nil {
+		return ErrNoSigningKey
+	}
+	return nil
+}
+
+// Sign issues a token with the current key, naming it in the kid header
+func Sign(claims jwt.Claims) (string, error) {
+	k := current()
+	if k != nil && !now().Before(k.retiresAt) {
+		// Maintenance has not run since the key retired; rotate now
+		if err := reload(context.Background()); err != nil {
+			return "", err
+		}
+		k = current()
+	}
+	if k == nil {
+		return "", ErrNoSigningKey
+	}
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(k.algorithm), claims)
+	token.Header["kid"] = k.id
+	return token.SignedString(k.signer)
+}
+
+// Parse verifies a token against the key named by its kid header. The key
+// fixes the algorithm, so a token cannot pick a weaker one (e.g. HS256 with
+// an RSA public key as the secret).
+func Parse(tokenString string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, verificationKey,
+		jwt.WithValidMethods([]string{"RS256", "EdDSA", "HS256"}),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(now),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func verificationKey(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	k := lookup(kid)
+	if k == nil && kid != "" && reloadDue() {
+		if err := reload(context.Background()); err != nil {
+			log.Printf("❌ Signing key reload failed: %v", err)
+		}
+		k = lookup(kid)
+	}
+	if k == nil {
+		return nil, ErrUnknownKey
+	}
+	if t.Method.Alg() != k.algorithm {
+		return nil, ErrAlgorithmMismatch
+	}
+	return k.verifier, nil
+}
+
+// current is the newest unexpired key of the configured algorithm
+func current() *signingKey {
+	mu.RLock()
+	defer mu.RUnlock()
+	t := now()
+	for _, k := range loaded {
+		if k.algorithm == algorithm && t.Before(k.expiresAt) {
+			return k
+		}
+	}
+	return nil
+}
+
+func lookup(kid string) *signingKey {
+	mu.RLock()
+	defer mu.RUnlock()
+	t := now()
+	for _, k := range loaded {
+		if k.id == kid && t.Before(k.expiresAt) {
+			return k
+		}
+	}
+	return nil
+}
+
+func reloadDue() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return now().Sub(lastReload) >= reloadInterval
+}
+
+// reload replaces the key set with the stored one, adding a key when no
+// unretired key of the configured algorithm exists
+func reload(ctx context.Context) error {
+	t := now()
+
+	var set []*signingKey
+	if database.DB != nil {
+		stored, err := loadKeys(ctx, t)
+		if err != nil {
+			return err
+		}
+		set = stored
+	} else {
+		mu.RLock()
+		for _, k := range loaded {
+			if t.Before(k.expiresAt) {
+				set = append(set, k)
+			}
+		}
+		mu.RUnlock()
+	}
+
+	if !hasSigner(set, t) {
+		k, err := generate(algorithm, t)
+		if err != nil {
+			return err
+		}
+		if database.DB != nil {
+			if err := storeKey(ctx, k); err != nil {
+				return err
+			}
+		}
+		set = append([]*signingKey{k}, set...)
+		log.Printf("🔑 New %s signing key %s, retires %s", k.algorithm, k.id, k.retiresAt.UTC().Format(time.RFC3339))
+	}
+
+	if database.DB != nil {
+		if err := deleteExpired(ctx, t); err != nil {
+			return err
+		}
+	}
+
+	mu.Lock()
+	loaded = set
+	lastReload = t
+	mu.Unlock()
+	return nil
+}
+
+func hasSigner(set []*signingKey, t time.Time) bool {
+	for _, k := range set {
+		if k.algorithm == algorithm && t.Before(k.retiresAt) {
+			return true
+		}
+	}
+	return false
+}
+
+func generate(alg string, t time.Time) (*signingKey, error) {
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	k := &signingKey{
+		id:        t.UTC().Format("20060102") + "-" + hex.EncodeToString(id),
+		algorithm: alg,
+		createdAt: t,
+		retiresAt: t.Add(rotation),
+		expiresAt: t.Add(rotation + overlap),
+	}
+
+	switch alg {
+	case "RS256":
+		priv, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		k.signer, k.verifier = priv, &priv.PublicKey
+	case "EdDSA":
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		k.signer, k.verifier = priv, pub
+	case "HS256":
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		k.signer, k.verifier = secret, secret
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	return k, nil
+}
@@ -0,0 +1,123 @@
+package keys
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"sems-backend/internal/config"
+	"sems-backend/internal/database"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func useClock(t *testing.T, start time.Time) *time.Time {
+	t.Helper()
+	clock := start
+	now = func() time.Time { return clock }
+	t.Cleanup(func() { now = time.Now; loaded = nil; lastReload = time.Time{} })
+	return &clock
+}
+
+func claimsAt(t time.Time) jwt.MapClaims {
+	return jwt.MapClaims{"user_id": "u1", "exp": t.Add(15 * time.Minute).Unix()}
+}
+
+func TestRotationKeepsOverlapAndRejectsAlgorithmSwap(t *testing.T) {
+	algorithm, rotation, overlap = "RS256", 24*time.Hour, time.Hour
+	clock := useClock(t, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err := Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := Sign(claimsAt(*clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Parse(first); err != nil {
+		t.Fatalf("fresh token: %v", err)
+	}
+
+	// A token re-signed as HS256 with the public key as secret must not verify
+	k := current()
+	der, _ := x509.MarshalPKIXPublicKey(k.verifier)
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, claimsAt(*clock))
+	forged.Header["kid"] = k.id
+	forgedString, _ := forged.SignedString(der)
+	if _, err := Parse(forgedString); !errors.Is(err, ErrAlgorithmMismatch) {
+		t.Fatalf("algorithm swap: got %v", err)
+	}
+
+	// After retirement a new key signs; the old one verifies until the overlap ends
+	*clock = clock.Add(24*time.Hour + time.Minute)
+	Maintain(context.Background())
+	if _, err := Sign(claimsAt(*clock)); err != nil {
+		t.Fatal(err)
+	}
+	if current().id == k.id {
+		t.Fatal("signing key was not rotated")
+	}
+	if len(PublicKeys()) != 2 {
+		t.Fatalf("JWKS should publish both keys during the overlap, got %d", len(PublicKeys()))
+	}
+	oldDuringOverlap := jwt.NewWithClaims(jwt.SigningMethodRS256, claimsAt(*clock))
+	oldDuringOverlap.Header["kid"] = k.id
+	oldString, _ := oldDuringOverlap.SignedString(k.signer)
+	if _, err := Parse(oldString); err != nil {
+		t.Fatalf("retired key inside overlap: %v", err)
+	}
+
+	*clock = clock.Add(time.Hour)
+	second, _ := Sign(claimsAt(*clock))
+	if _, err := Parse(second); err != nil {
+		t.Fatalf("current key: %v", err)
+	}
+	refreshed := jwt.NewWithClaims(jwt.SigningMethodRS256, claimsAt(*clock))
+	refreshed.Header["kid"] = k.id
+	expiredKeyString, _ := refreshed.SignedString(k.signer)
+	if _, err := Parse(expiredKeyString); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("key past overlap: got %v", err)
+	}
+}
+
+func TestKeysPersistSealed(t *testing.T) {
+	algorithm, rotation, overlap = "EdDSA", 24*time.Hour, time.Hour
+	sealKey = [32]byte{1}
+	useClock(t, time.Now())
+	if err := database.InitDB(config.DatabaseConfig{Driver: "sqlite", Path: filepath.Join(t.TempDir(), "keys.db"), MaxOpenConns: 1}); err != nil {
+		t.Fatal(err)
+	}
+	defer database.CloseDB()
+	if err := database.RunMigrations(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Init(); err != nil {
+		t.Fatal(err)
+	}
+	token, err := Sign(claimsAt(now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another instance with the same secret loads the key from the database
+	loaded = nil
+	if err := Init(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Parse(token); err != nil {
+		t.Fatalf("reloaded key: %v", err)
+	}
+
+	// With a different secret the stored key cannot be unsealed and is replaced
+	sealKey = [32]byte{2}
+	if err := Init(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Parse(token); err == nil {
+		t.Fatal("token verified with a key sealed under another secret")
+	}
+}
@@ -0,0 +1,154 @@
+package keys
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"sems-backend/internal/database"
+	"time"
+)
+
+func loadKeys(ctx context.Context, t time.Time) ([]*signingKey, error) {
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT kid, algorithm, sealed_key, created_at, retires_at, expires_at
+		FROM signing_keys
+		WHERE expires_at > ?
+		ORDER BY created_at DESC`, t.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var set []*signingKey
+	for rows.Next() {
+		k := &signingKey{}
+		var sealed string
+		if err := rows.Scan(&k.id, &k.algorithm, &sealed, &k.createdAt, &k.retiresAt, &k.expiresAt); err != nil {
+			return nil, err
+		}
+		if err := k.unseal(sealed); err != nil {
+			// Usually a changed auth.jwt_secret; tokens from this key fail and a new key takes over
+			log.Printf("⚠️  Skipping signing key %s: %v", k.id, err)
+			continue
+		}
+		set = append(set, k)
+	}
+	return set, rows.Err()
+}
+
+func storeKey(ctx context.Context, k *signingKey) error {
+	sealed, err := k.seal()
+	if err != nil {
+		return err
+	}
+	_, err = database.DB.ExecContext(ctx, `
+		INSERT INTO signing_keys (kid, algorithm, sealed_key, created_at, retires_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		k.id, k.algorithm, sealed, k.createdAt.UTC(), k.retiresAt.UTC(), k.expiresAt.UTC())
+	return err
+}
+
+func deleteExpired(ctx context.Context, t time.Time) error {
+	_, err := database.DB.ExecContext(ctx, `DELETE FROM signing_keys WHERE expires_at <= ?`, t.UTC())
+	return err
+}
+
+// seal encrypts the private key material under the configured secret
+func (k *signingKey) seal() (string, error) {
+	var plain []byte
+	switch key := k.signer.(type) {
+	case []byte:
+		plain = key
+	default:
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return "", err
+		}
+		plain = der
+	}
+	// The kid is authenticated so a sealed key cannot be moved to another row
+	return Seal(plain, k.id)
+}
+
+func (k *signingKey) unseal(encoded string) error {
+	plain, err := Unseal(encoded, k.id)
+	if err != nil {
+		return err
+	}
+
+	if k.algorithm == "HS256" {
+		k.signer, k.verifier = plain, plain
+		return nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(plain)
+	if err != nil {
+		return err
+	}
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		if k.algorithm != "RS256" {
+			return fmt.Errorf("RSA key stored as %s", k.algorithm)
+		}
+		k.signer, k.verifier = key, &key.PublicKey
+	case ed25519.PrivateKey:
+		if k.algorithm != "EdDSA" {
+			return fmt.Errorf("Ed25519 key stored as %s", k.algorithm)
+		}
+		k.signer, k.verifier = key, key.Public().(ed25519.PublicKey)
+	default:
+		return fmt.Errorf("unsupported key type %T", parsed)
+	}
+	return nil
+}
+
+// Seal encrypts a secret with AES-GCM under the configured auth secret. The
+// label is authenticated too, so a sealed value only opens for the record it
+// was sealed for.
+func Seal(plain []byte, label string) (string, error) {
+	gcm, err := newGCM()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, plain, []byte(label))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Unseal reverses Seal
+func Unseal(encoded, label string) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM()
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("sealed value too short")
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(label))
+	if err != nil {
+		return nil, errors.New("cannot unseal with the configured secret")
+	}
+	return plain, nil
+}
+
+func newGCM() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(sealKey[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
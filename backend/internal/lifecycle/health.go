@@ -0,0 +1,103 @@
+package lifecycle
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const checkTimeout = 2 * time.Second
+
+type check struct {
+	name     string
+	critical bool
+	fn       func(ctx context.Context) error
+}
+
+// CheckResult is the outcome of one readiness check. Failure details are
+// logged rather than returned, since the probe is public.
+type CheckResult struct {
+	Status   string `json:"status"` // "ok" or "fail"
+	Critical bool   `json:"critical"`
+}
+
+// AddCheck registers a readiness check. Failing critical checks make the service
+// unready; non-critical ones (e.g. the AI service) only mark it degraded.
+func (m *Manager) AddCheck(name string, critical bool, fn func(ctx context.Context) error) {
+	m.checks = append(m.checks, check{name: name, critical: critical, fn: fn})
+}
+
+// LiveHandler reports that the process is up and serving requests
+// @Summary Liveness probe
+// @Tags Health
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /health/live [get]
+func (m *Manager) LiveHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": "alive",
+		"uptime": time.Since(m.started).Round(time.Second).String(),
+	})
+}
+
+// ReadyHandler runs readiness checks and reports worker heartbeats
+// @Summary Readiness probe
+// @Description Reports DB, migration state, worker heartbeats and AI service reachability. Returns 503 when not ready.
+// @Tags Health
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 503 {object} map[string]interface{}
+// @Router /health/ready [get]
+func (m *Manager) ReadyHandler(c *gin.Context) {
+	ready := !m.Draining()
+	degraded := false
+
+	results := make(map[string]CheckResult, len(m.checks))
+	for _, chk := range m.checks {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), checkTimeout)
+		err := chk.fn(ctx)
+		cancel()
+
+		result := CheckResult{Status: "ok", Critical: chk.critical}
+		if err != nil {
+			result.Status = "fail"
+			log.Printf("⚠️  Readiness check %s failed: %v", chk.name, err)
+			if chk.critical {
+				ready = false
+			} else {
+				degraded = true
+			}
+		}
+		results[chk.name] = result
+	}
+
+	workers := m.Heartbeats()
+	for _, hb := range workers {
+		if !hb.Healthy {
+			degraded = true
+		}
+	}
+
+	status := "ready"
+	switch {
+	case m.Draining():
+		status = "draining"
+	case !ready:
+		status = "not_ready"
+	case degraded:
+		status = "degraded"
+	}
+
+	code := http.StatusOK
+	if !ready {
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, gin.H{
+		"status":  status,
+		"checks":  results,
+		"workers": workers,
+	})
+}
@@ -0,0 +1,197 @@
+package lifecycle
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Worker is a background job run on a fixed interval until the manager stops
+type Worker struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context)
+
+	mu        sync.Mutex
+	lastStart time.Time
+	lastEnd   time.Time
+	running   bool
+}
+
+// Heartbeat describes the last activity of a worker
+type Heartbeat struct {
+	Name     string     `json:"name"`
+	Interval string     `json:"interval"`
+	Running  bool       `json:"running"`
+	LastRun  *time.Time `json:"last_run,omitempty"`
+	LastDone *time.Time `json:"last_done,omitempty"`
+	Healthy  bool       `json:"healthy"`
+}
+
+// Manager owns background workers, readiness checks and the HTTP server's lifetime
+type Manager struct {
+	workers  []*Worker
+	checks   []check
+	started  time.Time
+	draining atomic.Bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New creates a manager; workers registered on it start with Start
+func New() *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{ctx: ctx, cancel: cancel}
+}
+
+// Every registers a worker that runs fn once per interval
+func (m *Manager) Every(name string, interval time.Duration, fn func(ctx context.Context)) {
+	m.workers = append(m.workers, &Worker{Name: name, Interval: interval, Run: fn})
+}
+
+// Start launches all registered workers
+func (m *Manager) Start() {
+	m.started = time.Now()
+	for _, w := range m.workers {
+		m.wg.Add(1)
+		go m.loop(w)
+		log.Printf("▶️  Worker %s started (every %s)", w.Name, w.Interval)
+	}
+}
+
+func (m *Manager) loop(w *Worker) {
+	defer m.wg.Done()
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+			m.runOnce(w)
+		}
+	}
+}
+
+func (m *Manager) runOnce(w *Worker) {
+	w.mu.Lock()
+	w.lastStart = time.Now()
+	w.running = true
+	w.mu.Unlock()
+
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("❌ Worker %s panicked: %v", w.Name, r)
+		}
+		w.mu.Lock()
+		w.lastEnd = time.Now()
+		w.running = false
+		w.mu.Unlock()
+	}()
+
+	w.Run(m.ctx)
+}
+
+// Heartbeats reports each worker's last run. A worker is healthy while it has
+// completed a run within two intervals (or was started less than that ago).
+func (m *Manager) Heartbeats() []Heartbeat {
+	now := time.Now()
+	beats := make([]Heartbeat, 0, len(m.workers))
+	for _, w := range m.workers {
+		w.mu.Lock()
+		hb := Heartbeat{Name: w.Name, Interval: w.Interval.String(), Running: w.running}
+		if !w.lastStart.IsZero() {
+			t := w.lastStart
+			hb.LastRun = &t
+		}
+		if !w.lastEnd.IsZero() {
+			t := w.lastEnd
+			hb.LastDone = &t
+		}
+		reference := m.started
+		if !w.lastEnd.IsZero() {
+			reference = w.lastEnd
+		}
+		hb.Healthy = !m.started.IsZero() && now.Sub(reference) <= 2*w.Interval
+		w.mu.Unlock()
+		beats = append(beats, hb)
+	}
+	return beats
+}
+
+// Stop cancels workers and waits for in-progress runs up to the context deadline
+func (m *Manager) Stop(ctx context.Context) {
+	m.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Println("⏹️  All workers stopped")
+	case <-ctx.Done():
+		log.Println("⚠️  Timed out waiting for workers to stop")
+	}
+}
+
+// Draining reports whether shutdown has begun
+func (m *Manager) Draining() bool {
+	return m.draining.Load()
+}
+
+// Serve runs srv until SIGINT/SIGTERM, then marks the service not ready, keeps
+// serving for drainDelay so load balancers see readiness fail, drains
+// in-flight requests, stops workers and runs cleanup (e.g. closing the DB).
+func (m *Manager) Serve(srv *http.Server, drainDelay, drainTimeout time.Duration, cleanup ...func()) error {
+	m.Start()
+
+	errCh := make(chan error, 1)
+	go func() {
+		log.Printf("Server starting on %s", srv.Addr)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			errCh <- err
+		}
+		close(errCh)
+	}()
+
+	sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var serveErr error
+	select {
+	case serveErr = <-errCh:
+	case <-sigCtx.Done():
+		log.Println("🛑 Shutdown signal received, draining...")
+	}
+
+	m.draining.Store(true)
+	if serveErr == nil && drainDelay > 0 {
+		log.Printf("⏳ Reporting not ready for %s before closing connections", drainDelay)
+		time.Sleep(drainDelay)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("⚠️  HTTP drain incomplete: %v", err)
+	}
+	m.Stop(ctx)
+
+	for _, fn := range cleanup {
+		fn()
+	}
+	log.Println("👋 Shutdown complete")
+	return serveErr
+}
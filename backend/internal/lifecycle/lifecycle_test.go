@@ -0,0 +1,150 @@
+package lifecycle
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestWorkersRunAndStopOnCancel(t *testing.T) {
+	m := New()
+
+	var runs atomic.Int32
+	m.Every("test", 10*time.Millisecond, func(ctx context.Context) {
+		runs.Add(1)
+	})
+	m.Every("blocking", 10*time.Millisecond, func(ctx context.Context) {
+		<-ctx.Done()
+	})
+
+	m.Start()
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	m.Stop(ctx)
+	if ctx.Err() != nil {
+		t.Fatal("Stop timed out; a worker ignored cancellation")
+	}
+
+	if runs.Load() == 0 {
+		t.Fatal("worker never ran")
+	}
+
+	beats := m.Heartbeats()
+	if len(beats) != 2 || beats[0].LastDone == nil {
+		t.Fatalf("expected heartbeat for completed run, got %+v", beats)
+	}
+	if !beats[0].Healthy {
+		t.Error("recently completed worker should be healthy")
+	}
+}
+
+func TestHeartbeatUnhealthyWhenOverdue(t *testing.T) {
+	m := New()
+	m.Every("slow", time.Minute, func(ctx context.Context) {})
+	m.started = time.Now().Add(-5 * time.Minute)
+
+	if beats := m.Heartbeats(); beats[0].Healthy {
+		t.Error("worker that never ran within two intervals should be unhealthy")
+	}
+}
+
+func TestReadinessHidesCheckErrors(t *testing.T) {
+	m := New()
+	m.AddCheck("database", true, func(ctx context.Context) error {
+		return errors.New("dial tcp 10.0.0.5:5432: connection refused")
+	})
+	m.AddCheck("ai_service", false, func(ctx context.Context) error { return nil })
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/health", m.ReadyHandler)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "10.0.0.5") || strings.Contains(w.Body.String(), "refused") {
+		t.Errorf("check error leaked: %s", w.Body)
+	}
+	var body struct {
+		Checks map[string]CheckResult `json:"checks"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if body.Checks["database"].Status != "fail" || body.Checks["ai_service"].Status != "ok" {
+		t.Errorf("checks = %+v", body.Checks)
+	}
+}
+
+func TestServeReportsDrainingBeforeClosing(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	m := New()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/health", m.ReadyHandler)
+	srv := &http.Server{Addr: addr, Handler: r}
+
+	done := make(chan struct{})
+	go func() {
+		m.Serve(srv, 300*time.Millisecond, time.Second)
+		close(done)
+	}()
+	probe := func() (int, error) {
+		resp, err := http.Get("http://" + addr + "/health")
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+	for i := 0; ; i++ {
+		if code, err := probe(); err == nil && code == http.StatusOK {
+			break
+		}
+		if i == 50 {
+			t.Fatal("server never became ready")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	deadline := time.Now().Add(200 * time.Millisecond)
+	for !m.Draining() {
+		if time.Now().After(deadline) {
+			t.Fatal("shutdown signal not handled")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Still accepting connections, but no longer ready
+	if code, err := probe(); err != nil || code != http.StatusServiceUnavailable {
+		t.Fatalf("probe while draining: %d %v", code, err)
+	}
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Serve did not return after the drain delay")
+	}
+	if _, err := probe(); err == nil {
+		t.Error("server still accepting after shutdown")
+	}
+}
@@ -0,0 +1,164 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"net"
+	"net/http"
+	"sems-backend/internal/config"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds every SEMS metric; we don't use the global default registry so
+// tests and tools that import packages don't pick up stray collectors.
+var Registry = prometheus.NewRegistry()
+
+var (
+	IngestedReadings = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sems_ingested_readings_total",
+		Help: "Telemetry readings accepted, by device type.",
+	}, []string{"device_type"})
+
+	IngestionDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "sems_ingestion_duration_seconds",
+		Help:    "Time spent handling an ingestion request, by device type.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"device_type"})
+
+	RejectedReadings = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sems_rejected_readings_total",
+		Help: "Telemetry readings rejected, by reason.",
+	}, []string{"reason"})
+
+	AlertsRaised = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sems_alerts_raised_total",
+		Help: "Alerts raised since start, by severity and source.",
+	}, []string{"severity", "source"})
+
+	OpenAlerts = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sems_alerts_open",
+		Help: "Unresolved alerts, by severity.",
+	}, []string{"severity"})
+
+	AnomalyRunDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "sems_anomaly_worker_run_duration_seconds",
+		Help:    "Duration of one anomaly detection scan.",
+		Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	})
+
+	DBQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "sems_db_query_duration_seconds",
+		Help:    "Database call latency, by operation (query, exec).",
+		Buckets: []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5},
+	}, []string{"operation"})
+
+	DBErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sems_db_errors_total",
+		Help: "Database calls that returned an error, by operation.",
+	}, []string{"operation"})
+
+	AIServiceFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sems_ai_service_failures_total",
+		Help: "Failed calls to the AI prediction service, by reason.",
+	}, []string{"reason"})
+
+	ThrottledRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sems_throttled_requests_total",
+		Help: "Requests refused by rate limiting, by policy and what the caller was counted by (device, ip, user).",
+	}, []string{"policy", "key"})
+
+	Devices = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sems_devices",
+		Help: "Active devices by connectivity status (online, offline).",
+	}, []string{"status"})
+)
+
+var (
+	hooksMu sync.Mutex
+	hooks   []func()
+
+	scrapeToken  string
+	allowPrivate = true
+)
+
+// Configure sets how scrapers are authorized
+func Configure(cfg config.MetricsConfig) {
+	scrapeToken = cfg.Token
+	allowPrivate = cfg.AllowPrivate
+}
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		IngestedReadings, IngestionDuration, RejectedReadings,
+		AlertsRaised, OpenAlerts, AnomalyRunDuration,
+		DBQueryDuration, DBErrors, AIServiceFailures, Devices, ThrottledRequests,
+	)
+}
+
+// RegisterDB exposes connection-pool statistics for db
+func RegisterDB(db *sql.DB, name string) {
+	collector := collectors.NewDBStatsCollector(db, name)
+	err := Registry.Register(collector)
+	var existing prometheus.AlreadyRegisteredError
+	if errors.As(err, &existing) {
+		// Reopening the database replaces the stale pool's collector
+		Registry.Unregister(existing.ExistingCollector)
+		err = Registry.Register(collector)
+	}
+	if err != nil {
+		panic(err)
+	}
+}
+
+// OnScrape registers a function that refreshes gauges read from the database.
+// Hooks run before every scrape, so they should be cheap aggregate queries.
+func OnScrape(fn func()) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	hooks = append(hooks, fn)
+}
+
+// Handler serves the Prometheus exposition format
+func Handler() gin.HandlerFunc {
+	h := promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+	return func(c *gin.Context) {
+		hooksMu.Lock()
+		for _, fn := range hooks {
+			fn()
+		}
+		hooksMu.Unlock()
+		h.ServeHTTP(c.Writer, c.Request)
+	}
+}
+
+// RequireScraper lets through scrapers from loopback/private networks, or any
+// client presenting the configured metrics token as a bearer token. Disable
+// metrics.allow_private to require the token everywhere.
+func RequireScraper() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		presented := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if scrapeToken != "" && subtle.ConstantTimeCompare([]byte(presented), []byte(scrapeToken)) == 1 {
+			c.Next()
+			return
+		}
+		if allowPrivate {
+			// ClientIP only believes X-Forwarded-For from trusted proxies, so a
+			// request relayed by a same-host proxy is not mistaken for loopback
+			if ip := net.ParseIP(c.ClientIP()); ip != nil && (ip.IsLoopback() || ip.IsPrivate()) {
+				c.Next()
+				return
+			}
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": "Metrics are restricted to authorized scrapers"})
+		c.Abort()
+	}
+}
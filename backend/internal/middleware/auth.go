@@ -1,15 +1,17 @@
 package middleware
 
 import (
+	"errors"
+	"log"
 	"net/http"
+	"sems-backend/internal/auth"
+	"sems-backend/internal/keys"
+	"sems-backend/internal/ratelimit"
 	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtSecret = []byte("SEMS_SECRET") // TODO: Move to env
-
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
@@ -27,23 +29,127 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
-			return jwtSecret, nil
-		})
+		if auth.IsAPIToken(tokenString) {
+			if apiTokenAuth(c, tokenString) {
+				c.Next()
+			}
+			return
+		}
 
-		if err != nil || !token.Valid {
+		claims, err := keys.Parse(tokenString)
+		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
 
-		claims := token.Claims.(jwt.MapClaims)
+		userID, _ := claims["user_id"].(string)
+		if impersonation, _ := claims[auth.ImpersonationClaim].(string); impersonation != "" && userID != "" {
+			if impersonationAuth(c, impersonation, userID) {
+				c.Next()
+			}
+			return
+		}
+		sessionID, _ := claims["sid"].(string)
+		if userID == "" || sessionID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			c.Abort()
+			return
+		}
+
+		// The session decides: logout, deactivation and role changes apply at once
+		current, err := auth.ValidateSession(sessionID, userID)
+		switch {
+		case errors.Is(err, auth.ErrSessionInvalid):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session expired"})
+			c.Abort()
+			return
+		case errors.Is(err, auth.ErrAccountDeactivated):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Account is deactivated"})
+			c.Abort()
+			return
+		case err != nil:
+			log.Printf("Session check error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify session"})
+			c.Abort()
+			return
+		}
 
 		// Store values in context
-		c.Set("user_id", claims["user_id"])
-		c.Set("email", claims["email"])
-		c.Set("role", claims["role"])
+		c.Set("user_id", userID)
+		c.Set("session_id", sessionID)
+		c.Set("email", current.Email)
+		c.Set("role", current.Role)
 
+		if !ratelimit.Authenticated(c, userID) {
+			return
+		}
 		c.Next()
 	}
 }
+
+// apiTokenAuth authenticates a personal access token. It acts as its owner,
+// but only on routes one of its scopes covers.
+func apiTokenAuth(c *gin.Context, plain string) bool {
+	token, current, err := auth.AuthenticateAPIToken(plain, c.ClientIP())
+	switch {
+	case errors.Is(err, auth.ErrAPITokenInvalid):
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return false
+	case errors.Is(err, auth.ErrAccountDeactivated):
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Account is deactivated"})
+		return false
+	case err != nil:
+		log.Printf("API token check error: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify token"})
+		return false
+	}
+
+	if !token.Allows(c.Request.Method, c.FullPath()) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error":  "Token scope does not cover this request",
+			"scopes": token.Scopes,
+		})
+		return false
+	}
+
+	c.Set("user_id", token.UserID)
+	c.Set("token_id", token.ID)
+	c.Set("email", current.Email)
+	c.Set("role", current.Role)
+	return ratelimit.Authenticated(c, token.UserID)
+}
+
+// impersonationAuth authenticates an admin's token for acting as a customer.
+// Handlers see the customer; audit entries name the admin as actor.
+func impersonationAuth(c *gin.Context, id, userID string) bool {
+	imp, current, err := auth.ValidateImpersonation(id, userID)
+	switch {
+	case errors.Is(err, auth.ErrSessionInvalid):
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Impersonation ended"})
+		return false
+	case errors.Is(err, auth.ErrAccountDeactivated):
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Account is deactivated"})
+		return false
+	case err != nil:
+		log.Printf("Impersonation check error: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify session"})
+		return false
+	}
+
+	if !imp.Allows(c.Request.Method, c.FullPath()) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error":     "Not available while impersonating",
+			"read_only": imp.ReadOnly,
+		})
+		return false
+	}
+
+	c.Set("user_id", userID)
+	c.Set("impersonation_id", imp.ID)
+	c.Set("impersonator_id", imp.AdminID)
+	c.Set("impersonator_role", imp.AdminRole)
+	c.Set("email", current.Email)
+	c.Set("role", current.Role)
+	return ratelimit.Authenticated(c, userID)
+}
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"sems-backend/internal/authz"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequirePermission lets the request through when the caller's role grants p
+func RequirePermission(p authz.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s, err := authz.Caller(c)
+		if err != nil {
+			if err == authz.ErrUnauthenticated {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+				return
+			}
+			log.Printf("Permission check failed: %v", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+			return
+		}
+
+		if !s.Has(p) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":      "Access denied",
+				"permission": p,
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
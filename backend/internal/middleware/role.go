@@ -1,34 +0,0 @@
-package middleware
-
-import (
-	"net/http"
-
-	"github.com/gin-gonic/gin"
-)
-
-func RequireRole(allowedRoles ...string) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		userRole, exists := c.Get("role")
-		if !exists {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Role not found"})
-			return
-		}
-
-		roleStr := userRole.(string)
-		if roleStr == "SUPER_ADMIN" {
-			c.Next()
-			return
-		}
-
-		for _, role := range allowedRoles {
-			if roleStr == role {
-				c.Next()
-				return
-			}
-		}
-
-		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
-			"error": "Access denied",
-		})
-	}
-}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/smtp"
 	"os"
+	"sems-backend/internal/config"
 	"strings"
 )
 
@@ -17,8 +18,27 @@ type EmailConfig struct {
 	FromName     string
 }
 
-// GetEmailConfig returns email configuration from environment variables
+var configured *EmailConfig
+
+// Configure sets SMTP settings from the service configuration
+func Configure(cfg config.EmailConfig) {
+	configured = &EmailConfig{
+		SMTPHost:     cfg.SMTPHost,
+		SMTPPort:     cfg.SMTPPort,
+		SMTPUsername: cfg.SMTPUsername,
+		SMTPPassword: cfg.SMTPPassword,
+		FromEmail:    cfg.FromEmail,
+		FromName:     cfg.FromName,
+	}
+}
+
+// GetEmailConfig returns the configured email settings, falling back to
+// environment variables for tools that don't load the service configuration
 func GetEmailConfig() *EmailConfig {
+	if configured != nil {
+		c := *configured
+		return &c
+	}
 	return &EmailConfig{
 		SMTPHost:     getEnv("SMTP_HOST", "smtp.gmail.com"),
 		SMTPPort:     getEnv("SMTP_PORT", "587"),
@@ -2,6 +2,7 @@ package notifications
 
 import (
 	"net/http"
+	"sems-backend/internal/authz"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
@@ -85,6 +86,7 @@ func GetUnreadCountHandler(c *gin.Context) {
 // @Param id path string true "Notification ID"
 // @Success 200 {object} map[string]string
 // @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
 // @Security BearerAuth
 // @Router /user/notifications/{id}/read [put]
 func MarkAsReadHandler(c *gin.Context) {
@@ -102,6 +104,12 @@ func MarkAsReadHandler(c *gin.Context) {
 		return
 	}
 
+	owner, err := GetNotificationOwner(notificationID)
+	if err != nil || !authz.Allowed(c, authz.PortalAccess, authz.Resource{Kind: authz.Notification, OwnerID: owner}) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return
+	}
+
 	err = MarkAsRead(notificationID, userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark as read"})
@@ -153,6 +161,12 @@ func DeleteNotificationHandler(c *gin.Context) {
 		return
 	}
 
+	owner, err := GetNotificationOwner(notificationID)
+	if err != nil || !authz.Allowed(c, authz.PortalAccess, authz.Resource{Kind: authz.Notification, OwnerID: owner}) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return
+	}
+
 	err = DeleteNotification(notificationID, userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete notification"})
@@ -93,7 +93,7 @@ func GetUserNotifications(userID uuid.UUID, limit int, offset int) ([]*Notificat
 
 // GetUnreadCount returns the count of unread notifications for a user
 func GetUnreadCount(userID uuid.UUID) (int, error) {
-	query := `SELECT COUNT(*) FROM notifications WHERE user_id = ? AND read = 0`
+	query := `SELECT COUNT(*) FROM notifications WHERE user_id = ? AND read = false`
 
 	var count int
 	err := database.DB.QueryRow(query, userID.String()).Scan(&count)
@@ -104,9 +104,16 @@ func GetUnreadCount(userID uuid.UUID) (int, error) {
 	return count, nil
 }
 
+// GetNotificationOwner returns the ID of the user a notification belongs to
+func GetNotificationOwner(notificationID uuid.UUID) (string, error) {
+	var userID string
+	err := database.DB.QueryRow(`SELECT user_id FROM notifications WHERE id = ?`, notificationID.String()).Scan(&userID)
+	return userID, err
+}
+
 // MarkAsRead marks a notification as read
 func MarkAsRead(notificationID uuid.UUID, userID uuid.UUID) error {
-	query := `UPDATE notifications SET read = 1 WHERE id = ? AND user_id = ?`
+	query := `UPDATE notifications SET read = true WHERE id = ? AND user_id = ?`
 
 	_, err := database.DB.Exec(query, notificationID.String(), userID.String())
 	return err
@@ -114,7 +121,7 @@ func MarkAsRead(notificationID uuid.UUID, userID uuid.UUID) error {
 
 // MarkAllAsRead marks all notifications as read for a user
 func MarkAllAsRead(userID uuid.UUID) error {
-	query := `UPDATE notifications SET read = 1 WHERE user_id = ? AND read = 0`
+	query := `UPDATE notifications SET read = true WHERE user_id = ? AND read = false`
 
 	_, err := database.DB.Exec(query, userID.String())
 	return err
@@ -0,0 +1,350 @@
+// Package oidc is a small OpenID Connect relying party: it reads a provider's
+// discovery document, builds authorization-code requests with PKCE, redeems
+// codes and verifies the returned ID tokens against the provider's keys.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sems-backend/internal/config"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	metadataTTL    = time.Hour
+	keysMinRefresh = time.Minute
+	clockLeeway    = time.Minute
+)
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// Provider is one configured identity provider
+type Provider struct {
+	cfg         config.OIDCProvider
+	redirectURL string
+
+	mu          sync.Mutex
+	meta        *metadata
+	metaFetched time.Time
+	keys        map[string]interface{} // by kid
+	keysFetched time.Time
+}
+
+type metadata struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	TokenAuthMethods      []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+// Identity is what a verified ID token says about the user
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+	Name          string
+	Claims        jwt.MapClaims
+}
+
+// New returns a provider whose callback is served under apiURL
+func New(cfg config.OIDCProvider, apiURL string) *Provider {
+	return &Provider{
+		cfg:         cfg,
+		redirectURL: strings.TrimRight(apiURL, "/") + "/auth/oidc/" + cfg.Name + "/callback",
+	}
+}
+
+func (p *Provider) Name() string { return p.cfg.Name }
+
+func (p *Provider) DisplayName() string {
+	if p.cfg.DisplayName != "" {
+		return p.cfg.DisplayName
+	}
+	return p.cfg.Name
+}
+
+// RedirectURL is the callback to register with the identity provider
+func (p *Provider) RedirectURL() string { return p.redirectURL }
+
+// NewVerifier returns a random PKCE code verifier, also usable for state and nonce values
+func NewVerifier() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Challenge is the S256 PKCE challenge of a verifier
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthURL is where to send the browser to sign in
+func (p *Provider) AuthURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+	scopes := p.cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", p.cfg.ClientID)
+	v.Set("redirect_uri", p.redirectURL)
+	v.Set("scope", strings.Join(scopes, " "))
+	v.Set("state", state)
+	v.Set("nonce", nonce)
+	v.Set("code_challenge", Challenge(verifier))
+	v.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return meta.AuthorizationEndpoint + sep + v.Encode(), nil
+}
+
+// Exchange redeems an authorization code and verifies the ID token it returns
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Identity, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.redirectURL)
+	form.Set("code_verifier", verifier)
+	form.Set("client_id", p.cfg.ClientID)
+	basicAuth := p.cfg.ClientSecret != "" && !onlyPostAuth(meta.TokenAuthMethods)
+	if p.cfg.ClientSecret != "" && !basicAuth {
+		form.Set("client_secret", p.cfg.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if basicAuth {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := doJSON(req, &tokens)
+	if err != nil {
+		return nil, fmt.Errorf("token endpoint: %w", err)
+	}
+	if status != http.StatusOK || tokens.IDToken == "" {
+		return nil, fmt.Errorf("token endpoint returned %d: %s %s", status, tokens.Error, tokens.ErrorDescription)
+	}
+	return p.verify(ctx, meta, tokens.IDToken, nonce)
+}
+
+func (p *Provider) verify(ctx context.Context, meta *metadata, idToken, nonce string) (*Identity, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, meta, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(meta.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(clockLeeway),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("id token: %w", err)
+	}
+	if got, _ := claims["nonce"].(string); got == "" || got != nonce {
+		return nil, errors.New("id token: nonce mismatch")
+	}
+
+	id := &Identity{Claims: claims}
+	id.Subject, _ = claims["sub"].(string)
+	id.Email, _ = claims["email"].(string)
+	id.GivenName, _ = claims["given_name"].(string)
+	id.FamilyName, _ = claims["family_name"].(string)
+	id.Name, _ = claims["name"].(string)
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		id.EmailVerified = v
+	case string: // some providers send "true"
+		id.EmailVerified = v == "true"
+	}
+	if id.Subject == "" {
+		return nil, errors.New("id token: missing sub")
+	}
+	return id, nil
+}
+
+// Role maps the identity's groups or roles to a SEMS role. When several
+// values match, the most privileged role wins.
+func (p *Provider) Role(id *Identity) (string, bool) {
+	claim := p.cfg.RoleClaim
+	if claim == "" {
+		claim = "groups"
+	}
+	var values []string
+	switch v := id.Claims[claim].(type) {
+	case string:
+		values = []string{v}
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+
+	best := -1
+	for _, value := range values {
+		role, ok := p.cfg.RoleMapping[value]
+		if !ok {
+			continue
+		}
+		for rank, r := range config.SSORoles {
+			if r == role && (best == -1 || rank < best) {
+				best = rank
+			}
+		}
+	}
+	if best >= 0 {
+		return config.SSORoles[best], true
+	}
+	return p.cfg.DefaultRole, p.cfg.DefaultRole != ""
+}
+
+func (p *Provider) metadata(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil && time.Since(p.metaFetched) < metadataTTL {
+		return p.meta, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(p.cfg.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	meta := &metadata{}
+	status, err := doJSON(req, meta)
+	if err == nil && status != http.StatusOK {
+		err = fmt.Errorf("status %d", status)
+	}
+	if err != nil {
+		if p.meta != nil {
+			return p.meta, nil // keep using the last good document
+		}
+		return nil, fmt.Errorf("discovery for %s: %w", p.cfg.Name, err)
+	}
+	// The issuer is what ID tokens are checked against, so it must be the configured one
+	if strings.TrimRight(meta.Issuer, "/") != strings.TrimRight(p.cfg.Issuer, "/") {
+		return nil, fmt.Errorf("discovery for %s: issuer %q does not match %q", p.cfg.Name, meta.Issuer, p.cfg.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery for %s: incomplete provider metadata", p.cfg.Name)
+	}
+	p.meta, p.metaFetched = meta, time.Now()
+	return meta, nil
+}
+
+// key returns the verification key for kid, refetching the key set when the
+// provider has rotated to a key we have not seen
+func (p *Provider) key(ctx context.Context, meta *metadata, kid string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if k := p.pick(kid); k != nil {
+		return k, nil
+	}
+	if time.Since(p.keysFetched) < keysMinRefresh {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, meta.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if _, err := doJSON(req, &set); err != nil {
+		return nil, fmt.Errorf("jwks: %w", err)
+	}
+	keys := map[string]interface{}{}
+	for _, raw := range set.Keys {
+		id, key, err := parseJWK(raw)
+		if err != nil {
+			continue // skip keys we cannot use, e.g. encryption keys
+		}
+		keys[id] = key
+	}
+	p.keys, p.keysFetched = keys, time.Now()
+
+	if k := p.pick(kid); k != nil {
+		return k, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// pick finds a key by kid; tokens without a kid may use a provider's only key
+func (p *Provider) pick(kid string) interface{} {
+	if kid == "" && len(p.keys) == 1 {
+		for _, k := range p.keys {
+			return k
+		}
+	}
+	return p.keys[kid]
+}
+
+func onlyPostAuth(methods []string) bool {
+	post := false
+	for _, m := range methods {
+		if m == "client_secret_basic" {
+			return false
+		}
+		post = post || m == "client_secret_post"
+	}
+	return post
+}
+
+func doJSON(req *http.Request, out interface{}) (int, error) {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return resp.StatusCode, fmt.Errorf("status %d: %w", resp.StatusCode, err)
+	}
+	return resp.StatusCode, nil
+}
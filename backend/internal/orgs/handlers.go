@@ -0,0 +1,319 @@
+package orgs
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"sems-backend/internal/audit"
+	"sems-backend/internal/authz"
+	"sems-backend/internal/timectx"
+
+	"github.com/gin-gonic/gin"
+)
+
+type OrganizationRequest struct {
+	Name     string    `json:"name"`
+	Slug     string    `json:"slug"`
+	Branding *Branding `json:"branding"`
+	Settings *Settings `json:"settings"`
+	IsActive *bool     `json:"is_active"`
+}
+
+// apply copies the fields present in the request onto o
+func (req *OrganizationRequest) apply(o *Organization) {
+	if req.Name != "" {
+		o.Name = req.Name
+	}
+	if req.Slug != "" {
+		o.Slug = req.Slug
+	}
+	if req.Branding != nil {
+		o.Branding = *req.Branding
+	}
+	if req.Settings != nil {
+		o.Settings = *req.Settings
+	}
+}
+
+// @Summary List organizations
+// @Description Every organization with its member count
+// @Tags Organizations
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 500 {object} map[string]string
+// @Security BearerAuth
+// @Router /superadmin/organizations [get]
+func ListHandler(c *gin.Context) {
+	list, err := List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch organizations"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"organizations": list})
+}
+
+// @Summary Create organization
+// @Description Create an organization. The slug is derived from the name when omitted.
+// @Tags Organizations
+// @Accept json
+// @Produce json
+// @Param organization body OrganizationRequest true "Organization"
+// @Success 201 {object} Organization
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security BearerAuth
+// @Router /superadmin/organizations [post]
+func CreateHandler(c *gin.Context) {
+	var req OrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	o := &Organization{}
+	req.apply(o)
+	if err := Create(o); err != nil {
+		orgError(c, err)
+		return
+	}
+	audit.Record(c, "org.create", "organization", o.ID, nil, o)
+	c.JSON(http.StatusCreated, o)
+}
+
+// @Summary Get organization
+// @Tags Organizations
+// @Produce json
+// @Param id path string true "Organization ID"
+// @Success 200 {object} Organization
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /superadmin/organizations/{id} [get]
+func GetHandler(c *gin.Context) {
+	o, err := Get(c.Param("id"))
+	if err != nil {
+		orgError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, o)
+}
+
+// @Summary Update organization
+// @Description Change the name, slug, branding, settings or status of an organization. Members of an inactive organization keep only their sign-in.
+// @Tags Organizations
+// @Accept json
+// @Produce json
+// @Param id path string true "Organization ID"
+// @Param organization body OrganizationRequest true "Fields to change"
+// @Success 200 {object} Organization
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security BearerAuth
+// @Router /superadmin/organizations/{id} [put]
+func UpdateHandler(c *gin.Context) {
+	var req OrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	o, err := Get(c.Param("id"))
+	if err != nil {
+		orgError(c, err)
+		return
+	}
+	before := *o
+	req.apply(o)
+	if req.IsActive != nil {
+		o.IsActive = *req.IsActive
+	}
+	if err := Update(o); err != nil {
+		orgError(c, err)
+		return
+	}
+	timectx.Invalidate()
+	audit.Record(c, "org.update", "organization", o.ID, before, o)
+	c.JSON(http.StatusOK, o)
+}
+
+// @Summary Delete organization
+// @Description Delete an organization without members; its plants and inventory pass to the platform
+// @Tags Organizations
+// @Produce json
+// @Param id path string true "Organization ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security BearerAuth
+// @Router /superadmin/organizations/{id} [delete]
+func DeleteHandler(c *gin.Context) {
+	o, err := Get(c.Param("id"))
+	if err != nil {
+		orgError(c, err)
+		return
+	}
+	if err := Delete(o.ID); err != nil {
+		orgError(c, err)
+		return
+	}
+	audit.Record(c, "org.delete", "organization", o.ID, o, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Organization deleted"})
+}
+
+// @Summary Move account into organization
+// @Description Move an existing account, with its devices and tickets, into the organization
+// @Tags Organizations
+// @Produce json
+// @Param id path string true "Organization ID"
+// @Param userId path string true "User ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /superadmin/organizations/{id}/members/{userId} [put]
+func AddMemberHandler(c *gin.Context) {
+	o, err := Get(c.Param("id"))
+	if err != nil {
+		orgError(c, err)
+		return
+	}
+	moveMember(c, o.ID, "org.member_add")
+}
+
+// @Summary Return account to the platform
+// @Description Take an account, with its devices and tickets, out of the organization
+// @Tags Organizations
+// @Produce json
+// @Param id path string true "Organization ID"
+// @Param userId path string true "User ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /superadmin/organizations/{id}/members/{userId} [delete]
+func RemoveMemberHandler(c *gin.Context) {
+	member, err := authz.Lookup(c.Param("userId"))
+	if err != nil || member.OrgID != c.Param("id") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+		return
+	}
+	moveMember(c, "", "org.member_remove")
+}
+
+func moveMember(c *gin.Context, orgID, action string) {
+	userID := c.Param("userId")
+	// Platform operators would lose the right to undo it
+	if userID == c.GetString("user_id") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot move your own account"})
+		return
+	}
+	if err := AddMember(orgID, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		log.Printf("Moving account %s to organization %q failed: %v", userID, orgID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move account"})
+		return
+	}
+	timectx.Invalidate()
+	audit.Record(c, action, "user", userID, nil, gin.H{"org_id": orgID})
+	c.JSON(http.StatusOK, gin.H{"message": "Account moved"})
+}
+
+// @Summary My organization
+// @Description The caller's organization with its branding and settings
+// @Tags Organizations
+// @Produce json
+// @Success 200 {object} Organization
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /org [get]
+func MineHandler(c *gin.Context) {
+	o, ok := callerOrganization(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, o)
+}
+
+// @Summary Update my organization
+// @Description Change the name, branding and settings of the caller's organization
+// @Tags Organizations
+// @Accept json
+// @Produce json
+// @Param organization body OrganizationRequest true "Fields to change; slug and is_active are ignored"
+// @Success 200 {object} Organization
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /org [put]
+func UpdateMineHandler(c *gin.Context) {
+	var req OrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	o, ok := callerOrganization(c)
+	if !ok {
+		return
+	}
+	before := *o
+	req.Slug = ""
+	req.apply(o)
+	if err := Update(o); err != nil {
+		orgError(c, err)
+		return
+	}
+	timectx.Invalidate()
+	audit.Record(c, "org.update", "organization", o.ID, before, o)
+	c.JSON(http.StatusOK, o)
+}
+
+// @Summary Organization branding
+// @Description Public branding of an active organization, for its login page
+// @Tags Organizations
+// @Produce json
+// @Param slug path string true "Organization slug"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string
+// @Router /public/organizations/{slug}/branding [get]
+func BrandingHandler(c *gin.Context) {
+	o, err := GetBySlug(c.Param("slug"))
+	if err != nil || !o.IsActive {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"name": o.Name, "slug": o.Slug, "branding": o.Branding})
+}
+
+func callerOrganization(c *gin.Context) (*Organization, bool) {
+	s, err := authz.Caller(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return nil, false
+	}
+	if s.OrgID == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account does not belong to an organization"})
+		return nil, false
+	}
+	o, err := Get(s.OrgID)
+	if err != nil {
+		orgError(c, err)
+		return nil, false
+	}
+	return o, true
+}
+
+func orgError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+	case errors.Is(err, ErrSlugTaken), errors.Is(err, ErrHasMembers):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, errInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Organization change failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save organization"})
+	}
+}
@@ -0,0 +1,103 @@
+// Package orgs hosts several installer and EPC companies on one deployment.
+// An organisation owns its member accounts and, through them, their devices
+// and tickets, as well as the plants and inventory its members create; authz
+// confines every member to their own organisation. Platform accounts, those in
+// no organisation, run the deployment and see across organisations.
+package orgs
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+// Organization is a tenant of the deployment
+type Organization struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Slug      string    `json:"slug"` // stable public handle, e.g. for a branded login page
+	Branding  Branding  `json:"branding"`
+	Settings  Settings  `json:"settings"`
+	IsActive  bool      `json:"is_active"`
+	Members   int       `json:"members"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Branding is what the frontend shows in place of the platform's own look.
+// It is public, so it must not hold anything private.
+type Branding struct {
+	DisplayName  string `json:"display_name,omitempty"`
+	LogoURL      string `json:"logo_url,omitempty"`
+	PrimaryColor string `json:"primary_color,omitempty"` // #RRGGBB
+	SupportEmail string `json:"support_email,omitempty"`
+	SupportPhone string `json:"support_phone,omitempty"`
+}
+
+// Settings override deployment defaults for the organisation's members
+type Settings struct {
+	Timezone      string  `json:"timezone,omitempty"`       // for members whose region and plant give none
+	DefaultTariff float64 `json:"default_tariff,omitempty"` // currency per kWh when a member has no tariff of their own
+}
+
+var (
+	ErrNotFound    = errors.New("organization not found")
+	ErrSlugTaken   = errors.New("organization slug already in use")
+	ErrHasMembers  = errors.New("organization still has members")
+	errInvalid     = errors.New("invalid organization")
+	slugPattern    = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,62}$`)
+	colorPattern   = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+	maxTariff      = 1000.0
+	maxBrandingLen = 200
+)
+
+func (o *Organization) validate() error {
+	if o.Name == "" || len(o.Name) > maxBrandingLen {
+		return fmt.Errorf("%w: name is required and at most %d characters", errInvalid, maxBrandingLen)
+	}
+	if !slugPattern.MatchString(o.Slug) {
+		return fmt.Errorf("%w: slug must be 2-63 lower-case letters, digits or hyphens", errInvalid)
+	}
+	if err := o.Branding.validate(); err != nil {
+		return err
+	}
+	return o.Settings.validate()
+}
+
+func (b *Branding) validate() error {
+	for _, v := range []string{b.DisplayName, b.LogoURL, b.SupportEmail, b.SupportPhone} {
+		if len(v) > maxBrandingLen {
+			return fmt.Errorf("%w: branding values are at most %d characters", errInvalid, maxBrandingLen)
+		}
+	}
+	if b.LogoURL != "" {
+		u, err := url.Parse(b.LogoURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("%w: logo_url must be an http(s) URL", errInvalid)
+		}
+	}
+	if b.PrimaryColor != "" && !colorPattern.MatchString(b.PrimaryColor) {
+		return fmt.Errorf("%w: primary_color must look like #1a2b3c", errInvalid)
+	}
+	if b.SupportEmail != "" {
+		if _, err := mail.ParseAddress(b.SupportEmail); err != nil {
+			return fmt.Errorf("%w: support_email is not an email address", errInvalid)
+		}
+	}
+	return nil
+}
+
+func (s *Settings) validate() error {
+	if s.Timezone != "" {
+		if _, err := time.LoadLocation(s.Timezone); err != nil {
+			return fmt.Errorf("%w: unknown timezone %q", errInvalid, s.Timezone)
+		}
+	}
+	if s.DefaultTariff < 0 || s.DefaultTariff > maxTariff {
+		return fmt.Errorf("%w: default_tariff must be between 0 and %g", errInvalid, maxTariff)
+	}
+	return nil
+}
@@ -0,0 +1,332 @@
+package orgs
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sems-backend/internal/database"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const selectOrganization = `
+	SELECT o.id, o.name, o.slug, o.branding, o.settings, o.is_active, o.created_at, o.updated_at,
+	       (SELECT COUNT(*) FROM users u WHERE u.org_id = o.id)
+	FROM organizations o`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanOrganization(row rowScanner) (*Organization, error) {
+	o := &Organization{}
+	var branding, settings string
+	if err := row.Scan(&o.ID, &o.Name, &o.Slug, &branding, &settings, &o.IsActive, &o.CreatedAt, &o.UpdatedAt, &o.Members); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(branding), &o.Branding); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(settings), &o.Settings); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func getOne(where string, arg interface{}) (*Organization, error) {
+	o, err := scanOrganization(database.DB.QueryRow(selectOrganization+" WHERE "+where, arg))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return o, err
+}
+
+// Get returns the organisation with the given ID
+func Get(id string) (*Organization, error) {
+	return getOne("o.id = ?", id)
+}
+
+// GetBySlug returns the organisation with the given slug
+func GetBySlug(slug string) (*Organization, error) {
+	return getOne("o.slug = ?", slug)
+}
+
+// List returns every organisation by name
+func List() ([]*Organization, error) {
+	rows, err := database.DB.Query(selectOrganization + " ORDER BY o.name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []*Organization{}
+	for rows.Next() {
+		o, err := scanOrganization(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, o)
+	}
+	return list, rows.Err()
+}
+
+// Create stores a new organisation; an empty slug is derived from the name
+func Create(o *Organization) error {
+	if o.Slug == "" {
+		o.Slug = slugify(o.Name)
+	}
+	if err := o.validate(); err != nil {
+		return err
+	}
+	if _, err := GetBySlug(o.Slug); err == nil {
+		return ErrSlugTaken
+	} else if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	branding, settings, err := encode(o)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	o.ID, o.IsActive, o.CreatedAt, o.UpdatedAt = uuid.New().String(), true, now, now
+	_, err = database.DB.Exec(`
+		INSERT INTO organizations (id, name, slug, branding, settings, is_active, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		o.ID, o.Name, o.Slug, branding, settings, o.IsActive, now, now)
+	return err
+}
+
+// Update saves the name, slug, branding, settings and status of o
+func Update(o *Organization) error {
+	if err := o.validate(); err != nil {
+		return err
+	}
+	if other, err := GetBySlug(o.Slug); err == nil && other.ID != o.ID {
+		return ErrSlugTaken
+	} else if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	branding, settings, err := encode(o)
+	if err != nil {
+		return err
+	}
+	o.UpdatedAt = time.Now().UTC()
+	result, err := database.DB.Exec(`
+		UPDATE organizations SET name = ?, slug = ?, branding = ?, settings = ?, is_active = ?, updated_at = ?
+		WHERE id = ?`,
+		o.Name, o.Slug, branding, settings, o.IsActive, o.UpdatedAt, o.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Delete removes an organisation without members. Its plants and inventory
+// pass to the platform.
+func Delete(id string) error {
+	var members int
+	if err := database.DB.QueryRow(`SELECT COUNT(*) FROM users WHERE org_id = ?`, id).Scan(&members); err != nil {
+		return err
+	}
+	if members > 0 {
+		return ErrHasMembers
+	}
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, table := range []string{"solar_plants", "inventory_items", "devices", "tickets"} {
+		if _, err := tx.Exec(`UPDATE `+table+` SET org_id = NULL WHERE org_id = ?`, id); err != nil {
+			return err
+		}
+	}
+	result, err := tx.Exec(`DELETE FROM organizations WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return tx.Commit()
+}
+
+// AddMember moves an account, with its devices and tickets, into an
+// organisation; an empty orgID returns it to the platform
+func AddMember(orgID, userID string) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := addMember(tx, orgID, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func addMember(tx *sql.Tx, orgID, userID string) error {
+	var org interface{}
+	if orgID != "" {
+		org = orgID
+	}
+	result, err := tx.Exec(`UPDATE users SET org_id = ?, updated_at = ? WHERE id = ?`, org, time.Now(), userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	for _, table := range []string{"devices", "tickets"} {
+		if _, err := tx.Exec(`UPDATE `+table+` SET org_id = ? WHERE user_id = ?`, org, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SettingsOf returns the settings of the account's organisation, zero for
+// platform accounts
+func SettingsOf(userID string) (Settings, error) {
+	var s Settings
+	var raw string
+	err := database.DB.QueryRow(`
+		SELECT o.settings FROM users u JOIN organizations o ON o.id = u.org_id
+		WHERE u.id = ?`, userID).Scan(&raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	return s, json.Unmarshal([]byte(raw), &s)
+}
+
+// Tariff is the default tariff for an account: its organisation's, else
+// fallback
+func Tariff(userID string, fallback float64) float64 {
+	s, err := SettingsOf(userID)
+	if err != nil || s.DefaultTariff == 0 {
+		return fallback
+	}
+	return s.DefaultTariff
+}
+
+// AdoptLegacy turns the free-text users.organization values recorded before
+// organisations existed into organisations, and moves each account that
+// named one into it. Accounts already in an organisation stay put and super
+// admins stay on the platform. It returns how many accounts moved.
+func AdoptLegacy() (int, error) {
+	rows, err := database.DB.Query(`
+		SELECT DISTINCT TRIM(organization) FROM users
+		WHERE org_id IS NULL AND role <> 'SUPER_ADMIN' AND TRIM(COALESCE(organization, '')) <> ''`)
+	if err != nil {
+		return 0, err
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	moved := 0
+	for _, name := range names {
+		slug := slugify(name)
+		o, err := GetBySlug(slug)
+		if errors.Is(err, ErrNotFound) {
+			display := name
+			if len(display) > maxBrandingLen {
+				display = display[:maxBrandingLen]
+			}
+			o = &Organization{Name: display, Slug: slug}
+			err = Create(o)
+		}
+		if err != nil {
+			return moved, err
+		}
+		n, err := adoptMembers(o.ID, name)
+		moved += n
+		if err != nil {
+			return moved, err
+		}
+	}
+	return moved, nil
+}
+
+func adoptMembers(orgID, name string) (int, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	rows, err := tx.Query(`
+		SELECT id FROM users
+		WHERE org_id IS NULL AND role <> 'SUPER_ADMIN' AND TRIM(organization) = ?`, name)
+	if err != nil {
+		return 0, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	for _, id := range ids {
+		if err := addMember(tx, orgID, id); err != nil {
+			return 0, err
+		}
+	}
+	return len(ids), tx.Commit()
+}
+
+func encode(o *Organization) (string, string, error) {
+	branding, err := json.Marshal(o.Branding)
+	if err != nil {
+		return "", "", err
+	}
+	settings, err := json.Marshal(o.Settings)
+	if err != nil {
+		return "", "", err
+	}
+	return string(branding), string(settings), nil
+}
+
+// slugify derives a slug from a name: "Sun & Co. EPC" becomes "sun-co-epc"
+func slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+			dash = false
+		case b.Len() > 0 && !dash:
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	slug := strings.TrimSuffix(b.String(), "-")
+	if len(slug) > 63 {
+		slug = strings.TrimSuffix(slug[:63], "-")
+	}
+	if len(slug) < 2 {
+		slug = "org-" + uuid.New().String()[:8]
+	}
+	return slug
+}
@@ -2,6 +2,8 @@ package plants
 
 import (
 	"net/http"
+	"sems-backend/internal/audit"
+	"sems-backend/internal/authz"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -19,6 +21,7 @@ type CreatePlantRequest struct {
 	Longitude       *float64 `json:"longitude"`
 	Status          string   `json:"status"`
 	Description     string   `json:"description"`
+	OrgID           string   `json:"org_id"` // platform operators only; members create plants in their own organisation
 }
 
 type UpdatePlantRequest struct {
@@ -53,6 +56,20 @@ func CreatePlantHandler(c *gin.Context) {
 		return
 	}
 
+	caller, err := authz.Caller(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	if caller.OrgID != "" {
+		req.OrgID = caller.OrgID
+	} else if req.OrgID != "" {
+		if ok, err := organizationExists(req.OrgID); err != nil || !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown organization"})
+			return
+		}
+	}
+
 	// Set defaults
 	if req.Status == "" {
 		req.Status = "ACTIVE"
@@ -85,12 +102,14 @@ func CreatePlantHandler(c *gin.Context) {
 		Longitude:       req.Longitude,
 		Status:          req.Status,
 		Description:     req.Description,
+		OrgID:           req.OrgID,
 	}
 
 	if err := CreatePlant(plant); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create plant", "details": err.Error()})
 		return
 	}
+	audit.Record(c, "plant.create", "plant", plant.ID.String(), nil, plant)
 
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Plant created successfully",
@@ -109,14 +128,18 @@ func CreatePlantHandler(c *gin.Context) {
 // @Security BearerAuth
 // @Router /superadmin/plants [get]
 func GetPlantsHandler(c *gin.Context) {
+	caller, err := authz.Caller(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
 	region := c.Query("region")
 	var plants []Plant
-	var err error
 
 	if region != "" {
-		plants, err = GetPlantsByRegion(region)
+		plants, err = GetPlantsByRegion(region, caller.OrgID)
 	} else {
-		plants, err = GetAllPlants()
+		plants, err = GetAllPlants(caller.OrgID)
 	}
 
 	if err != nil {
@@ -155,7 +178,7 @@ func GetPlantHandler(c *gin.Context) {
 		return
 	}
 
-	if plant == nil {
+	if plant == nil || !authz.InTenant(c, plant.OrgID) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Plant not found"})
 		return
 	}
@@ -192,7 +215,7 @@ func UpdatePlantHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch plant", "details": err.Error()})
 		return
 	}
-	if existing == nil {
+	if existing == nil || !authz.InTenant(c, existing.OrgID) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Plant not found"})
 		return
 	}
@@ -202,6 +225,7 @@ func UpdatePlantHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
 		return
 	}
+	before := *existing
 
 	// Update fields
 	if req.Name != "" {
@@ -243,6 +267,7 @@ func UpdatePlantHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update plant", "details": err.Error()})
 		return
 	}
+	audit.Record(c, "plant.update", "plant", existing.ID.String(), before, existing)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Plant updated successfully",
@@ -276,7 +301,7 @@ func DeletePlantHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch plant", "details": err.Error()})
 		return
 	}
-	if existing == nil {
+	if existing == nil || !authz.InTenant(c, existing.OrgID) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Plant not found"})
 		return
 	}
@@ -285,6 +310,7 @@ func DeletePlantHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete plant", "details": err.Error()})
 		return
 	}
+	audit.Record(c, "plant.delete", "plant", existing.ID.String(), existing, nil)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Plant deleted successfully",
@@ -19,6 +19,7 @@ type Plant struct {
 	Longitude       *float64   `json:"longitude" db:"longitude"`
 	Status          string     `json:"status" db:"status"`
 	Description     string     `json:"description" db:"description"`
+	OrgID           string     `json:"org_id,omitempty" db:"org_id"`
 	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt       time.Time  `json:"updated_at" db:"updated_at"`
 }
@@ -3,6 +3,7 @@ package plants
 import (
 	"database/sql"
 	"fmt"
+	"sems-backend/internal/authz"
 	"sems-backend/internal/database"
 	"time"
 
@@ -81,8 +82,8 @@ func getRegionIDByName(regionName string) *uuid.UUID {
 
 func CreatePlant(plant *Plant) error {
 	query := `
-		INSERT INTO solar_plants (id, name, location, region_id, region, capacity_kw, current_output_kw, efficiency, latitude, longitude, status, description)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO solar_plants (id, name, location, region_id, region, capacity_kw, current_output_kw, efficiency, latitude, longitude, status, description, org_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 	var regionID interface{}
 	if plant.RegionID != nil {
@@ -96,6 +97,10 @@ func CreatePlant(plant *Plant) error {
 	} else {
 		regionID = nil
 	}
+	var orgID interface{}
+	if plant.OrgID != "" {
+		orgID = plant.OrgID
+	}
 
 	_, err := database.DB.Exec(query,
 		plant.ID,
@@ -110,17 +115,28 @@ func CreatePlant(plant *Plant) error {
 		float64ToNullFloat64(plant.Longitude),
 		plant.Status,
 		plant.Description,
+		orgID,
 	)
 	return err
 }
 
-func GetAllPlants() ([]Plant, error) {
+// organizationExists reports whether a plant may be placed in orgID
+func organizationExists(orgID string) (bool, error) {
+	var n int
+	err := database.DB.QueryRow(`SELECT COUNT(*) FROM organizations WHERE id = ?`, orgID).Scan(&n)
+	return n > 0, err
+}
+
+// GetAllPlants returns every plant, or one organisation's when orgID is set
+func GetAllPlants(orgID string) ([]Plant, error) {
+	tenant, args := authz.TenantFilter(orgID, "org_id")
 	query := `
-		SELECT id, name, location, region_id, region, capacity_kw, current_output_kw, efficiency, latitude, longitude, status, description, created_at, updated_at
+		SELECT id, name, location, region_id, region, capacity_kw, current_output_kw, efficiency, latitude, longitude, status, description, created_at, updated_at, COALESCE(org_id, '')
 		FROM solar_plants
+		WHERE 1=1` + tenant + `
 		ORDER BY created_at DESC
 	`
-	rows, err := database.DB.Query(query)
+	rows, err := database.DB.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -146,6 +162,7 @@ func GetAllPlants() ([]Plant, error) {
 			&plant.Description,
 			&plant.CreatedAt,
 			&plant.UpdatedAt,
+			&plant.OrgID,
 		)
 		if err != nil {
 			return nil, err
@@ -180,7 +197,7 @@ func GetAllPlants() ([]Plant, error) {
 
 func GetPlantByID(id uuid.UUID) (*Plant, error) {
 	query := `
-		SELECT id, name, location, region_id, region, capacity_kw, current_output_kw, efficiency, latitude, longitude, status, description, created_at, updated_at
+		SELECT id, name, location, region_id, region, capacity_kw, current_output_kw, efficiency, latitude, longitude, status, description, created_at, updated_at, COALESCE(org_id, '')
 		FROM solar_plants
 		WHERE id = ?
 	`
@@ -202,6 +219,7 @@ func GetPlantByID(id uuid.UUID) (*Plant, error) {
 		&plant.Description,
 		&plant.CreatedAt,
 		&plant.UpdatedAt,
+		&plant.OrgID,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -352,15 +370,17 @@ func CreateDefaultPlantsForRegion(regionName string) error {
 	return nil
 }
 
-// GetPlantsByRegion returns all plants in a specific region
-func GetPlantsByRegion(regionName string) ([]Plant, error) {
+// GetPlantsByRegion returns all plants in a specific region, within one
+// organisation when orgID is set
+func GetPlantsByRegion(regionName, orgID string) ([]Plant, error) {
+	tenant, args := authz.TenantFilter(orgID, "org_id")
 	query := `
-		SELECT id, name, location, region_id, region, capacity_kw, current_output_kw, efficiency, latitude, longitude, status, description, created_at, updated_at
+		SELECT id, name, location, region_id, region, capacity_kw, current_output_kw, efficiency, latitude, longitude, status, description, created_at, updated_at, COALESCE(org_id, '')
 		FROM solar_plants
-		WHERE region = ?
+		WHERE region = ?` + tenant + `
 		ORDER BY created_at DESC
 	`
-	rows, err := database.DB.Query(query, regionName)
+	rows, err := database.DB.Query(query, append([]interface{}{regionName}, args...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -386,6 +406,7 @@ func GetPlantsByRegion(regionName string) ([]Plant, error) {
 			&plant.Description,
 			&plant.CreatedAt,
 			&plant.UpdatedAt,
+			&plant.OrgID,
 		)
 		if err != nil {
 			return nil, err
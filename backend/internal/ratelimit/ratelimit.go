@@ -0,0 +1,231 @@
+// Package ratelimit throttles requests with token buckets. Each route maps to
+// a policy that counts requests per device, client address or user.
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"sems-backend/internal/config"
+	"sems-backend/internal/metrics"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pendingKey holds a device- or user-keyed policy until authentication names
+// the caller
+const pendingKey = "rate_limit_pending"
+
+// maxPeekBody bounds how much of a request body is read to find its API key
+const maxPeekBody = 64 << 10
+
+type policy struct {
+	name  string
+	rate  float64 // tokens per second
+	burst float64
+	key   string
+}
+
+// deferred is a policy waiting for the caller to authenticate, and the
+// address whose token stands in for the caller's until then
+type deferred struct {
+	policy *policy
+	kind   string
+	ip     string
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+var (
+	enabled  bool
+	policies = map[string]*policy{}
+	routes   = map[string]string{}
+	fallback string
+)
+
+var buckets = struct {
+	sync.Mutex
+	m map[string]*bucket
+}{m: map[string]*bucket{}}
+
+// Configure applies the rate limit settings
+func Configure(cfg config.RateLimitConfig) {
+	enabled = cfg.Enabled
+	policies = map[string]*policy{}
+	for name, p := range cfg.Policies {
+		policies[name] = &policy{
+			name:  name,
+			rate:  float64(p.Requests) / p.Per.Seconds(),
+			burst: float64(p.Burst),
+			key:   p.Key,
+		}
+	}
+	routes = cfg.Routes
+	fallback = cfg.Default
+
+	buckets.Lock()
+	buckets.m = map[string]*bucket{}
+	buckets.Unlock()
+}
+
+// policyFor picks the policy of a matched route: an exact "METHOD /path",
+// then "/path", then the longest matching "/prefix/*", then the default
+func policyFor(method, route string) *policy {
+	if name, ok := routes[method+" "+route]; ok {
+		return policies[name]
+	}
+	if name, ok := routes[route]; ok {
+		return policies[name]
+	}
+	best, name := -1, fallback
+	for pattern, p := range routes {
+		if !strings.HasSuffix(pattern, "/*") {
+			continue
+		}
+		prefix, score := strings.TrimSuffix(pattern, "*"), 0
+		if m := strings.TrimPrefix(prefix, method+" "); m != prefix {
+			prefix, score = m, 1 // a method-specific pattern beats an equal plain one
+		}
+		if strings.Contains(prefix, " ") || !strings.HasPrefix(route, prefix) {
+			continue
+		}
+		if score += 2 * len(prefix); score > best {
+			best, name = score, p
+		}
+	}
+	return policies[name]
+}
+
+// Middleware throttles requests by the policy of their route. Policies keyed
+// by device or user are applied once the caller is authenticated (see
+// Authenticated). Until then a request is counted by address, so credentials
+// that fail to authenticate are throttled like no credentials at all.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !enabled || c.FullPath() == "" {
+			c.Next()
+			return
+		}
+		p := policyFor(c.Request.Method, c.FullPath())
+		if p == nil {
+			c.Next()
+			return
+		}
+
+		limit(c, p, "ip", c.ClientIP())
+		switch {
+		case c.IsAborted():
+		case p.key == "device" && peekAPIKey(c) != "":
+			c.Set(pendingKey, &deferred{policy: p, kind: "device", ip: c.ClientIP()})
+		case p.key == "user" && c.GetHeader("Authorization") != "":
+			c.Set(pendingKey, &deferred{policy: p, kind: "user", ip: c.ClientIP()})
+		}
+		if !c.IsAborted() {
+			c.Next()
+		}
+	}
+}
+
+// Authenticated applies a device- or user-keyed policy deferred by
+// Middleware to the caller id, a device ID or user ID, and returns the
+// address token taken in its place. It returns false when the request was
+// throttled.
+func Authenticated(c *gin.Context, id string) bool {
+	v, ok := c.Get(pendingKey)
+	if !ok {
+		return true
+	}
+	c.Set(pendingKey, nil)
+	d, _ := v.(*deferred)
+	if d == nil {
+		return true
+	}
+	refund(d.policy, "ip:"+d.ip)
+	limit(c, d.policy, d.kind, id)
+	return !c.IsAborted()
+}
+
+// limit takes a token from the caller's bucket or answers 429
+func limit(c *gin.Context, p *policy, kind, id string) {
+	wait := take(p, kind+":"+id, time.Now())
+	if wait <= 0 {
+		return
+	}
+	metrics.ThrottledRequests.WithLabelValues(p.name, kind).Inc()
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+		"error":       "Too many requests",
+		"retry_after": seconds,
+	})
+}
+
+// take spends a token and returns zero, or returns how long until one is free
+func take(p *policy, id string, now time.Time) time.Duration {
+	key := p.name + "|" + id
+	buckets.Lock()
+	defer buckets.Unlock()
+	b, ok := buckets.m[key]
+	if !ok {
+		b = &bucket{tokens: p.burst, last: now}
+		buckets.m[key] = b
+	}
+	b.tokens = math.Min(p.burst, b.tokens+now.Sub(b.last).Seconds()*p.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / p.rate * float64(time.Second))
+}
+
+// refund returns a token taken from a bucket
+func refund(p *policy, id string) {
+	buckets.Lock()
+	defer buckets.Unlock()
+	if b, ok := buckets.m[p.name+"|"+id]; ok {
+		b.tokens = math.Min(p.burst, b.tokens+1)
+	}
+}
+
+// peekAPIKey reads the api_key field of a JSON body and puts the body back
+func peekAPIKey(c *gin.Context) string {
+	if c.Request.Body == nil {
+		return ""
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxPeekBody))
+	c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), c.Request.Body))
+	if err != nil {
+		return ""
+	}
+	var payload struct {
+		APIKey string `json:"api_key"`
+	}
+	json.Unmarshal(body, &payload)
+	return payload.APIKey
+}
+
+// Prune forgets buckets that have refilled, which behave like new ones; run
+// it periodically
+func Prune(ctx context.Context) {
+	buckets.Lock()
+	defer buckets.Unlock()
+	now := time.Now()
+	for key, b := range buckets.m {
+		name := key[:strings.Index(key, "|")]
+		p, ok := policies[name]
+		if !ok || b.tokens+now.Sub(b.last).Seconds()*p.rate >= p.burst {
+			delete(buckets.m, key)
+		}
+	}
+}
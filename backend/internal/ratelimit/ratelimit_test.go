@@ -0,0 +1,130 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"sems-backend/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPoliciesByRouteAndKey(t *testing.T) {
+	Configure(config.RateLimitConfig{
+		Enabled: true,
+		Policies: map[string]config.RateLimitPolicy{
+			"ingest": {Requests: 60, Per: config.Duration{Duration: time.Minute}, Burst: 2, Key: "device"},
+			"auth":   {Requests: 60, Per: config.Duration{Duration: time.Minute}, Burst: 1, Key: "ip"},
+			"api":    {Requests: 60, Per: config.Duration{Duration: time.Minute}, Burst: 1, Key: "user"},
+		},
+		Routes:  map[string]string{"POST /iot/data": "ingest", "/auth/*": "auth"},
+		Default: "api",
+	})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Middleware())
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.POST("/iot/data", func(c *gin.Context) {
+		// The handler still sees the body the limiter read
+		var body struct {
+			APIKey string `json:"api_key"`
+		}
+		if c.ShouldBindJSON(&body) != nil || body.APIKey == "" {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		// Only sdk_ keys are genuine; the device ID is the key's suffix
+		if !strings.HasPrefix(body.APIKey, "sdk_") {
+			c.Status(http.StatusUnauthorized)
+			return
+		}
+		if !Authenticated(c, strings.TrimPrefix(body.APIKey, "sdk_")) {
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+	r.POST("/auth/login", ok)
+	r.GET("/user/profile", func(c *gin.Context) {
+		// Stands in for AuthMiddleware, which rejects bad tokens before Authenticated
+		if c.GetHeader("X-User") == "" {
+			c.Status(http.StatusUnauthorized)
+			return
+		}
+		if !Authenticated(c, c.GetHeader("X-User")) {
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	send := func(method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// Each device key has its own bucket
+	for i, want := range []int{200, 200, 429} {
+		if w := send("POST", "/iot/data", `{"api_key":"sdk_a"}`, nil); w.Code != want {
+			t.Fatalf("device a request %d: %d, want %d", i, w.Code, want)
+		}
+	}
+	if w := send("POST", "/iot/data", `{"api_key":"sdk_b"}`, nil); w.Code != 200 {
+		t.Fatalf("device b throttled with a: %d", w.Code)
+	}
+
+	// Keys that fail to authenticate count against the address, so a fresh
+	// random key per request does not get a fresh bucket
+	for i, want := range []int{401, 401, 429} {
+		if w := send("POST", "/iot/data", `{"api_key":"guess_`+strconv.Itoa(i)+`"}`, nil); w.Code != want {
+			t.Fatalf("random key request %d: %d, want %d", i, w.Code, want)
+		}
+	}
+
+	send("POST", "/auth/login", "", nil)
+	w := send("POST", "/auth/login", "", nil)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Fatalf("auth limit: %d Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	// Users are counted separately even from one address
+	alice := map[string]string{"Authorization": "Bearer x", "X-User": "alice"}
+	bob := map[string]string{"Authorization": "Bearer y", "X-User": "bob"}
+	if send("GET", "/user/profile", "", alice).Code != 200 || send("GET", "/user/profile", "", bob).Code != 200 {
+		t.Fatal("first request of each user throttled")
+	}
+	if w := send("GET", "/user/profile", "", alice).Code; w != http.StatusTooManyRequests {
+		t.Fatalf("alice's second request: %d", w)
+	}
+
+	// Bearer tokens that never authenticate are limited by address
+	garbage := map[string]string{"Authorization": "Bearer guess"}
+	if w := send("GET", "/user/profile", "", garbage).Code; w != http.StatusUnauthorized {
+		t.Fatalf("first bad token: %d", w)
+	}
+	if w := send("GET", "/user/profile", "", garbage).Code; w != http.StatusTooManyRequests {
+		t.Fatalf("second bad token: %d", w)
+	}
+}
+
+func TestBucketRefills(t *testing.T) {
+	p := &policy{name: "p", rate: 2, burst: 2}
+	Configure(config.RateLimitConfig{})
+	now := time.Now()
+	take(p, "ip:1", now)
+	take(p, "ip:1", now)
+	if wait := take(p, "ip:1", now); wait != 500*time.Millisecond {
+		t.Fatalf("wait = %s, want 500ms", wait)
+	}
+	if wait := take(p, "ip:1", now.Add(500*time.Millisecond)); wait != 0 {
+		t.Fatalf("no token after refill: %s", wait)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"sems-backend/internal/database"
+	"sems-backend/internal/timectx"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -50,6 +51,11 @@ func CreateRegionHandler(c *gin.Context) {
 		return
 	}
 
+	if _, err := time.LoadLocation(req.Timezone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timezone", "details": err.Error()})
+		return
+	}
+
 	// Set default status if not provided
 	if req.Status == "" {
 		req.Status = "ACTIVE"
@@ -97,6 +103,11 @@ func UpdateRegionHandler(c *gin.Context) {
 		return
 	}
 
+	if _, err := time.LoadLocation(req.Timezone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timezone", "details": err.Error()})
+		return
+	}
+
 	region, err := UpdateRegion(id, req)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update region", "details": err.Error()})
@@ -108,6 +119,9 @@ func UpdateRegionHandler(c *gin.Context) {
 		return
 	}
 
+	// Timezone may have changed; drop cached resolutions for users/devices/plants
+	timectx.Invalidate()
+
 	c.JSON(http.StatusOK, region)
 }
 
@@ -153,9 +167,7 @@ func GetAllRegions() ([]Region, error) {
 	}
 
 	// Check if regions table exists
-	var tableName string
-	err := database.DB.QueryRow("SELECT name FROM sqlite_master WHERE type='table' AND name='regions'").Scan(&tableName)
-	if err != nil || tableName != "regions" {
+	if !database.TableExists("regions") {
 		createTable()
 		return []Region{}, nil
 	}
@@ -199,8 +211,8 @@ func seedMissingRegions(existingRegions []Region) {
 		existingRegionNames[r.Name] = true
 	}
 
-	query := `INSERT OR IGNORE INTO regions (id, name, state, country, timezone, description, status, latitude, longitude, expected_users, expected_plants, capacity_mw, created_at, updated_at)
-			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	query := `INSERT INTO regions (id, name, state, country, timezone, description, status, latitude, longitude, expected_users, expected_plants, capacity_mw, created_at, updated_at)
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING`
 	now := time.Now().Format(time.RFC3339)
 	for _, r := range demoRegions {
 		if !existingRegionNames[r.Name] {
@@ -231,8 +243,8 @@ func seedMissingRegions(existingRegions []Region) {
 // seedRegions inserts demo regions into the database
 func seedRegions() {
 	demoRegions := getDemoRegions()
-	query := `INSERT OR IGNORE INTO regions (id, name, state, country, timezone, description, status, latitude, longitude, expected_users, expected_plants, capacity_mw, created_at, updated_at)
-			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	query := `INSERT INTO regions (id, name, state, country, timezone, description, status, latitude, longitude, expected_users, expected_plants, capacity_mw, created_at, updated_at)
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING`
 	now := time.Now().Format(time.RFC3339)
 	for _, r := range demoRegions {
 		_, err := database.DB.Exec(query,
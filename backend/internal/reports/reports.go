@@ -6,8 +6,10 @@ import (
 	"net/http"
 	"sems-backend/internal/energy"
 	"sems-backend/internal/plants"
+	"sems-backend/internal/timectx"
 	"sems-backend/internal/users"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -18,7 +20,7 @@ import (
 func ExportUsersHandler(c *gin.Context) {
 	format := c.DefaultQuery("format", "excel")
 
-	usersList, err := users.GetAllUsersIncludingAdmins()
+	usersList, err := users.GetAllUsersIncludingAdmins("")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users", "details": err.Error()})
 		return
@@ -95,7 +97,7 @@ func exportUsersExcel(c *gin.Context, usersList []*users.User) {
 func ExportPlantsHandler(c *gin.Context) {
 	format := c.DefaultQuery("format", "excel")
 
-	plantsList, err := plants.GetAllPlants()
+	plantsList, err := plants.GetAllPlants("")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch plants", "details": err.Error()})
 		return
@@ -181,14 +183,16 @@ func ExportEnergyDataHandler(c *gin.Context) {
 		return
 	}
 
+	// Report timestamps in the user's local time so rows line up with the daily window
+	loc := timectx.ForUser(userID.String())
 	if format == "csv" {
-		exportEnergyCSV(c, history)
+		exportEnergyCSV(c, history, loc)
 	} else {
-		exportEnergyExcel(c, history)
+		exportEnergyExcel(c, history, loc)
 	}
 }
 
-func exportEnergyCSV(c *gin.Context, history []*energy.EnergyData) {
+func exportEnergyCSV(c *gin.Context, history []*energy.EnergyData, loc *time.Location) {
 	c.Header("Content-Type", "text/csv")
 	c.Header("Content-Disposition", "attachment; filename=energy_report.csv")
 
@@ -199,7 +203,7 @@ func exportEnergyCSV(c *gin.Context, history []*energy.EnergyData) {
 
 	for _, d := range history {
 		writer.Write([]string{
-			d.Timestamp.Format("2006-01-02 15:04:05"),
+			d.Timestamp.In(loc).Format("2006-01-02 15:04:05"),
 			strconv.FormatFloat(d.SolarPower, 'f', 2, 64),
 			strconv.FormatFloat(d.LoadPower, 'f', 2, 64),
 			strconv.FormatFloat(d.GridPower, 'f', 2, 64),
@@ -210,7 +214,7 @@ func exportEnergyCSV(c *gin.Context, history []*energy.EnergyData) {
 	}
 }
 
-func exportEnergyExcel(c *gin.Context, history []*energy.EnergyData) {
+func exportEnergyExcel(c *gin.Context, history []*energy.EnergyData, loc *time.Location) {
 	f := excelize.NewFile()
 	defer f.Close()
 
@@ -225,7 +229,7 @@ func exportEnergyExcel(c *gin.Context, history []*energy.EnergyData) {
 
 	for i, d := range history {
 		rowIdx := i + 2
-		f.SetCellValue(sheet, fmt.Sprintf("A%d", rowIdx), d.Timestamp.Format("2006-01-02 15:04:05"))
+		f.SetCellValue(sheet, fmt.Sprintf("A%d", rowIdx), d.Timestamp.In(loc).Format("2006-01-02 15:04:05"))
 		f.SetCellValue(sheet, fmt.Sprintf("B%d", rowIdx), d.SolarPower)
 		f.SetCellValue(sheet, fmt.Sprintf("C%d", rowIdx), d.LoadPower)
 		f.SetCellValue(sheet, fmt.Sprintf("D%d", rowIdx), d.GridPower)
@@ -2,7 +2,7 @@ package tickets
 
 import (
 	"net/http"
-	"sems-backend/internal/users"
+	"sems-backend/internal/authz"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -30,13 +30,11 @@ type UpdateTicketRequest struct {
 // @Security BearerAuth
 // @Router /user/tickets [post]
 func CreateTicketHandler(c *gin.Context) {
-	user, exists := c.Get("user")
-	if !exists {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 		return
 	}
-	u := user.(*users.User)
-	userID, _ := uuid.Parse(u.ID)
 
 	var req CreateTicketRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -64,14 +62,13 @@ func CreateTicketHandler(c *gin.Context) {
 // @Security BearerAuth
 // @Router /user/tickets [get]
 func GetUserTicketsHandler(c *gin.Context) {
-	user, exists := c.Get("user")
-	if !exists {
+	userID := c.GetString("user_id")
+	if userID == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 		return
 	}
-	u := user.(*users.User)
 
-	tickets, err := GetTicketsByUserID(u.ID)
+	tickets, err := GetTicketsByUserID(userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tickets"})
 		return
@@ -92,20 +89,19 @@ func GetUserTicketsHandler(c *gin.Context) {
 // @Security BearerAuth
 // @Router /installer/tickets [get]
 func GetInstallerTicketsHandler(c *gin.Context) {
-	user, exists := c.Get("user")
-	if !exists {
+	userID := c.GetString("user_id")
+	if userID == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 		return
 	}
-	u := user.(*users.User)
 
 	// Ensure user is an installer
-	if u.Role != "INSTALLER" && u.Role != "SUPER_ADMIN" {
+	if !authz.Has(c, authz.TicketsWork) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
 		return
 	}
 
-	tickets, err := GetTicketsByInstallerID(u.ID)
+	tickets, err := GetTicketsByInstallerID(userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tickets"})
 		return
@@ -123,21 +119,26 @@ func GetInstallerTicketsHandler(c *gin.Context) {
 // @Param status body UpdateTicketRequest true "New status"
 // @Success 200 {object} map[string]string
 // @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Security BearerAuth
 // @Router /installer/tickets/{id}/status [put]
 func UpdateTicketStatusHandler(c *gin.Context) {
-	id := c.Param("id")
 	var req UpdateTicketRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// TODO: verify ownership/permission (installer assigned to ticket or ticket owner)
-	// For now, allowing any installer/admin to update structure
+	// Installers may only move tickets assigned to them; anything else looks
+	// like a missing ticket
+	ticket, err := GetTicketByID(c.Param("id"))
+	if err != nil || !authz.Allowed(c, authz.TicketsWork, authz.Resource{Kind: authz.Ticket, OwnerID: ticket.UserID, Assignee: deref(ticket.InstallerID)}) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
+		return
+	}
 
-	err := UpdateTicketStatus(id, req.Status)
+	err = UpdateTicketStatus(ticket.ID, req.Status)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update ticket"})
 		return
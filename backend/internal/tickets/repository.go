@@ -47,10 +47,10 @@ func CreateTicket(userID uuid.UUID, subject, description string) (*Ticket, error
 	}
 
 	query := `
-		INSERT INTO tickets (id, user_id, installer_id, subject, description, status, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO tickets (id, user_id, installer_id, subject, description, status, created_at, updated_at, org_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, (SELECT org_id FROM users WHERE id = ?))
 	`
-	_, err = database.DB.Exec(query, id, userID.String(), installerID, subject, description, status, now, now)
+	_, err = database.DB.Exec(query, id, userID.String(), installerID, subject, description, status, now, now, userID.String())
 	if err != nil {
 		return nil, err
 	}
@@ -130,6 +130,24 @@ func GetTicketsByInstallerID(installerID string) ([]Ticket, error) {
 	return tickets, nil
 }
 
+func GetTicketByID(id string) (*Ticket, error) {
+	var t Ticket
+	err := database.DB.QueryRow(`
+		SELECT id, user_id, installer_id, subject, description, status, created_at, updated_at
+		FROM tickets WHERE id = ?`, id).Scan(&t.ID, &t.UserID, &t.InstallerID, &t.Subject, &t.Description, &t.Status, &t.CreatedAt, &t.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
 func UpdateTicketStatus(ticketID string, status TicketStatus) error {
 	query := "UPDATE tickets SET status = ?, updated_at = ? WHERE id = ?"
 	_, err := database.DB.Exec(query, status, time.Now(), ticketID)
@@ -0,0 +1,208 @@
+package timectx
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"sems-backend/internal/database"
+	"sync"
+	"time"
+)
+
+// DefaultTimezone is used when a resource has no region, or its region carries
+// an unknown timezone. Regions are auto-created with Asia/Kolkata, so we match it.
+var DefaultTimezone = "Asia/Kolkata"
+
+// Configure sets the fallback timezone and drops cached resolutions
+func Configure(defaultTimezone string) {
+	if defaultTimezone != "" {
+		DefaultTimezone = defaultTimezone
+	}
+	Invalidate()
+}
+
+// cacheTTL bounds how long a resolved timezone is reused before hitting the DB again.
+// Workers resolve per device on every tick, so a short cache keeps that cheap.
+const cacheTTL = 10 * time.Minute
+
+type cacheEntry struct {
+	loc       *time.Location
+	expiresAt time.Time
+}
+
+var (
+	locations sync.Map // timezone name -> *time.Location
+	resolved  sync.Map // "kind:id" -> cacheEntry
+)
+
+// Default returns the fallback location
+func Default() *time.Location {
+	return LoadLocation(DefaultTimezone)
+}
+
+// LoadLocation returns the named location, falling back to the default on error
+func LoadLocation(name string) *time.Location {
+	if name == "" {
+		name = DefaultTimezone
+	}
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location)
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		log.Printf("⚠️  Unknown timezone %q, falling back to %s", name, DefaultTimezone)
+		if name == DefaultTimezone {
+			return time.UTC
+		}
+		return Default()
+	}
+	locations.Store(name, loc)
+	return loc
+}
+
+// ForRegion resolves the timezone of a region by its name (users.region, solar_plants.region)
+func ForRegion(regionName string) *time.Location {
+	if regionName == "" {
+		return Default()
+	}
+	return cached("region:"+regionName, func() string {
+		return lookup(`SELECT timezone FROM regions WHERE name = ? LIMIT 1`, regionName)
+	})
+}
+
+// ForRegionID resolves the timezone of a region by its ID
+func ForRegionID(regionID string) *time.Location {
+	if regionID == "" {
+		return Default()
+	}
+	return cached("region_id:"+regionID, func() string {
+		return lookup(`SELECT timezone FROM regions WHERE id = ?`, regionID)
+	})
+}
+
+// ForPlant resolves the timezone of a plant through its region
+func ForPlant(plantID string) *time.Location {
+	if plantID == "" {
+		return Default()
+	}
+	return cached("plant:"+plantID, func() string {
+		return lookup(plantTimezone, plantID)
+	})
+}
+
+const plantTimezone = `
+	SELECT r.timezone
+	FROM solar_plants p
+	JOIN regions r ON r.id = p.region_id OR (p.region_id IS NULL AND r.name = p.region)
+	WHERE p.id = ?
+	LIMIT 1`
+
+// ForUser resolves the timezone of a user from their region, then their
+// plant, then their organisation's settings
+func ForUser(userID string) *time.Location {
+	if userID == "" {
+		return Default()
+	}
+	return cached("user:"+userID, func() string {
+		var region, plantID, orgID sql.NullString
+		if database.DB == nil {
+			return ""
+		}
+		err := database.DB.QueryRow(`SELECT region, plant_id, org_id FROM users WHERE id = ?`, userID).Scan(&region, &plantID, &orgID)
+		if err != nil {
+			return ""
+		}
+		if region.Valid && region.String != "" {
+			if tz := lookup(`SELECT timezone FROM regions WHERE name = ? LIMIT 1`, region.String); tz != "" {
+				return tz
+			}
+		}
+		if plantID.Valid && plantID.String != "" {
+			if tz := lookup(plantTimezone, plantID.String); tz != "" {
+				return tz
+			}
+		}
+		if orgID.Valid && orgID.String != "" {
+			var settings struct {
+				Timezone string `json:"timezone"`
+			}
+			json.Unmarshal([]byte(lookup(`SELECT settings FROM organizations WHERE id = ?`, orgID.String)), &settings)
+			return settings.Timezone
+		}
+		return ""
+	})
+}
+
+// ForDevice resolves the timezone of a device through its owner
+func ForDevice(deviceID string) *time.Location {
+	if deviceID == "" {
+		return Default()
+	}
+	return cached("device:"+deviceID, func() string {
+		userID := lookup(`SELECT user_id FROM devices WHERE id = ?`, deviceID)
+		if userID == "" {
+			return ""
+		}
+		return ForUser(userID).String()
+	})
+}
+
+// Invalidate drops cached resolutions, e.g. after a region's timezone is edited
+func Invalidate() {
+	resolved.Range(func(key, _ interface{}) bool {
+		resolved.Delete(key)
+		return true
+	})
+}
+
+// Now returns the current time in the given location
+func Now(loc *time.Location) time.Time {
+	return time.Now().In(loc)
+}
+
+// StartOfDay returns local midnight of the day containing t
+func StartOfDay(t time.Time, loc *time.Location) time.Time {
+	local := t.In(loc)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+}
+
+// StartOfMonth returns local midnight of the first day of the month containing t
+func StartOfMonth(t time.Time, loc *time.Location) time.Time {
+	local := t.In(loc)
+	return time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, loc)
+}
+
+// WindowStart returns local midnight opening a window of n whole days that ends
+// today, so "last n days" totals are split at the resource's own midnight.
+func WindowStart(n int, loc *time.Location) time.Time {
+	if n < 1 {
+		n = 1
+	}
+	return StartOfDay(time.Now(), loc).AddDate(0, 0, -(n - 1))
+}
+
+func cached(key string, resolve func() string) *time.Location {
+	if v, ok := resolved.Load(key); ok {
+		entry := v.(cacheEntry)
+		if time.Now().Before(entry.expiresAt) {
+			return entry.loc
+		}
+	}
+
+	loc := LoadLocation(resolve())
+	resolved.Store(key, cacheEntry{loc: loc, expiresAt: time.Now().Add(cacheTTL)})
+	return loc
+}
+
+// lookup runs a single-column query and returns "" on any error (missing table, no row)
+func lookup(query string, args ...interface{}) string {
+	if database.DB == nil {
+		return ""
+	}
+	var value sql.NullString
+	if err := database.DB.QueryRow(query, args...).Scan(&value); err != nil {
+		return ""
+	}
+	return value.String
+}
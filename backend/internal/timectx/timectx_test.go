@@ -0,0 +1,29 @@
+package timectx
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStartOfDayUsesLocalMidnight(t *testing.T) {
+	kolkata := LoadLocation("Asia/Kolkata")
+
+	// 20:00 UTC is already 01:30 the next day in Kolkata
+	instant := time.Date(2026, 3, 10, 20, 0, 0, 0, time.UTC)
+	got := StartOfDay(instant, kolkata)
+
+	want := time.Date(2026, 3, 11, 0, 0, 0, 0, kolkata)
+	if !got.Equal(want) {
+		t.Errorf("StartOfDay = %v, want %v", got, want)
+	}
+	if got.UTC().Hour() != 18 || got.UTC().Minute() != 30 {
+		t.Errorf("Kolkata midnight should be 18:30 UTC, got %v", got.UTC())
+	}
+}
+
+func TestLoadLocationFallsBackToDefault(t *testing.T) {
+	loc := LoadLocation("Not/AZone")
+	if loc.String() != DefaultTimezone {
+		t.Errorf("expected fallback to %s, got %s", DefaultTimezone, loc)
+	}
+}
@@ -1,12 +1,27 @@
 package users
 
 import (
+	"sems-backend/internal/authz"
+	"sems-backend/internal/config"
 	"sems-backend/internal/database"
+	"sems-backend/internal/orgs"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+var (
+	defaultTariff = 8.0 // currency per kWh
+	co2Factor     = 0.7 // kg CO2 avoided per kWh
+)
+
+// Configure applies the tariff and CO2 factor used by dashboard stats
+func Configure(cfg config.EnergyConfig) {
+	defaultTariff = cfg.DefaultTariff
+	co2Factor = cfg.CO2FactorKgKWh
+}
+
 // GlobalStats represents global statistics for dashboards
 type GlobalStats struct {
 	TotalPlants      int     `json:"total_plants"`
@@ -77,15 +92,14 @@ type PublicRegionHierarchy struct {
 // @Security BearerAuth
 // @Router /superadmin/global/stats [get]
 func GetGlobalStatsHandler(c *gin.Context) {
-	currentUserRole := c.GetString("role")
-	if currentUserRole != "SUPER_ADMIN" {
+	if !authz.Has(c, authz.AnalyticsGlobal) {
 		c.JSON(403, gin.H{"error": "Access denied"})
 		return
 	}
 
 	region := c.Query("region")
 	period := c.DefaultQuery("period", "month")
-	stats, err := GetStats("", region, period)
+	stats, err := GetStats("", region, "", period)
 	if err != nil {
 		c.JSON(500, gin.H{"error": "Failed to fetch global stats"})
 		return
@@ -106,21 +120,19 @@ func GetGlobalStatsHandler(c *gin.Context) {
 // @Security BearerAuth
 // @Router /admin/analytics [get]
 func GetAdminStatsHandler(c *gin.Context) {
-	currentUserRole := c.GetString("role")
-	currentUserID := c.GetString("user_id")
-
-	if currentUserRole != "ADMIN" && currentUserRole != "SUPER_ADMIN" {
+	caller, err := authz.Caller(c)
+	if err != nil || !caller.Has(authz.AnalyticsRead) {
 		c.JSON(403, gin.H{"error": "Access denied"})
 		return
 	}
 
 	adminID := ""
-	if currentUserRole == "ADMIN" {
-		adminID = currentUserID
+	if caller.Scope != authz.Global {
+		adminID = caller.ID
 	}
 
 	period := c.DefaultQuery("period", "month")
-	stats, err := GetStats(adminID, "", period)
+	stats, err := GetStats(adminID, "", caller.OrgID, period)
 	if err != nil {
 		c.JSON(500, gin.H{"error": "Failed to fetch admin stats"})
 		return
@@ -129,8 +141,8 @@ func GetAdminStatsHandler(c *gin.Context) {
 	c.JSON(200, gin.H{"stats": stats})
 }
 
-// GetStats retrieves statistics from the database, optionally filtered by adminID, region and period
-func GetStats(adminID string, region string, period string) (*GlobalStats, error) {
+// GetStats retrieves statistics from the database, optionally filtered by adminID, region, organisation and period
+func GetStats(adminID string, region string, orgID string, period string) (*GlobalStats, error) {
 	stats := &GlobalStats{}
 
 	// Filter clause
@@ -144,17 +156,21 @@ func GetStats(adminID string, region string, period string) (*GlobalStats, error
 		whereClause += " AND region = ?"
 		params = append(params, region)
 	}
+	tenant, tenantParams := authz.TenantFilter(orgID, "org_id")
+	whereClause += tenant
+	params = append(params, tenantParams...)
 
 	// Period mapping
-	interval := "-30 days"
+	days := 30
 	switch period {
 	case "week":
-		interval = "-7 days"
+		days = 7
 	case "quarter":
-		interval = "-90 days"
+		days = 90
 	case "year":
-		interval = "-365 days"
+		days = 365
 	}
+	since := time.Now().UTC().AddDate(0, 0, -days)
 
 	// 1. Get total users
 	var totalUsers int
@@ -170,6 +186,8 @@ func GetStats(adminID string, region string, period string) (*GlobalStats, error
 		queryAdmins += " AND region = ?"
 		adminParams = append(adminParams, region)
 	}
+	queryAdmins += tenant
+	adminParams = append(adminParams, tenantParams...)
 	_ = database.DB.QueryRow(queryAdmins, adminParams...).Scan(&activeAdmins)
 	stats.ActiveAdmins = activeAdmins
 
@@ -179,9 +197,9 @@ func GetStats(adminID string, region string, period string) (*GlobalStats, error
 		SELECT COALESCE(SUM(ed.solar_power), 0) 
 		FROM energy_data ed
 		JOIN users u ON ed.device_id = u.device_id
-		WHERE ed.timestamp >= datetime('now', '` + interval + `')`
+		WHERE ed.timestamp >= ?`
 
-	energyParams := []interface{}{}
+	energyParams := []interface{}{since}
 	if adminID != "" {
 		queryEnergy += " AND u.admin_id = ?"
 		energyParams = append(energyParams, adminID)
@@ -190,6 +208,9 @@ func GetStats(adminID string, region string, period string) (*GlobalStats, error
 		queryEnergy += " AND u.region = ?"
 		energyParams = append(energyParams, region)
 	}
+	energyTenant, _ := authz.TenantFilter(orgID, "u.org_id")
+	queryEnergy += energyTenant
+	energyParams = append(energyParams, tenantParams...)
 
 	_ = database.DB.QueryRow(queryEnergy, energyParams...).Scan(&totalEnergy)
 	stats.TotalEnergy = totalEnergy
@@ -202,7 +223,13 @@ func GetStats(adminID string, region string, period string) (*GlobalStats, error
 	}
 
 	// 4. Calculate revenue (₹8 per kWh)
-	revenue := totalEnergy * 8
+	tariff := defaultTariff
+	if orgID != "" {
+		if o, err := orgs.Get(orgID); err == nil && o.Settings.DefaultTariff > 0 {
+			tariff = o.Settings.DefaultTariff
+		}
+	}
+	revenue := totalEnergy * tariff
 	stats.RevenueRaw = revenue
 
 	if revenue >= 10000000 {
@@ -216,8 +243,8 @@ func GetStats(adminID string, region string, period string) (*GlobalStats, error
 	// 5. System efficiency (Demo value)
 	stats.SystemEfficiency = "94.2%"
 
-	// 6. CO2 reduction (0.7 kg per kWh)
-	co2 := totalEnergy * 0.7
+	// 6. CO2 reduction (configured kg per kWh)
+	co2 := totalEnergy * co2Factor
 	if co2 >= 1000 {
 		stats.CO2Reduced = strconv.FormatFloat(co2/1000, 'f', 1, 64) + " tons"
 	} else {
@@ -248,8 +275,7 @@ func GetStats(adminID string, region string, period string) (*GlobalStats, error
 // @Security BearerAuth
 // @Router /superadmin/stats/regional [get]
 func GetRegionalStatsHandler(c *gin.Context) {
-	currentUserRole := c.GetString("role")
-	if currentUserRole != "SUPER_ADMIN" {
+	if !authz.Has(c, authz.AnalyticsGlobal) {
 		c.JSON(403, gin.H{"error": "Access denied"})
 		return
 	}
@@ -299,8 +325,7 @@ func GetRegionalStatsHandler(c *gin.Context) {
 // @Security BearerAuth
 // @Router /superadmin/hierarchy [get]
 func GetSystemHierarchyHandler(c *gin.Context) {
-	currentUserRole := c.GetString("role")
-	if currentUserRole != "SUPER_ADMIN" {
+	if !authz.Has(c, authz.AnalyticsGlobal) {
 		c.JSON(403, gin.H{"error": "Access denied"})
 		return
 	}
@@ -2,6 +2,9 @@ package users
 
 import (
 	"net/http"
+	"sems-backend/internal/audit"
+	"sems-backend/internal/authz"
+	"sems-backend/internal/orgs"
 	"sems-backend/internal/plants"
 	"strconv"
 	"time"
@@ -15,7 +18,7 @@ type CreateUserRequest struct {
 	LastName           string  `json:"last_name" binding:"required"`
 	Email              string  `json:"email" binding:"required,email"`
 	Password           string  `json:"password" binding:"required,min=6"`
-	Role               string  `json:"role" binding:"required,oneof=USER ADMIN SUPER_ADMIN INSTALLER GOVT"`
+	Role               string  `json:"role" binding:"required"` // built-in or custom role
 	Phone              string  `json:"phone"`
 	ProfileImage       string  `json:"profile_image"`
 	AddressLine1       string  `json:"address_line1"`
@@ -139,17 +142,17 @@ func CreateUserHandler(c *gin.Context) {
 		return
 	}
 
-	// Get current user info
-	currentUserRole := c.GetString("role")
-	currentUserID := c.GetString("user_id")
-
-	// Role-based access
-	if currentUserRole == "ADMIN" && req.Role != "USER" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Admins can only create users"})
+	// Only staff managers create staff; everyone else creates customers they manage
+	if _, err := authz.GetRole(req.Role); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role"})
 		return
 	}
-	if currentUserRole == "ADMIN" {
-		req.AdminID = currentUserID
+	if !authz.Has(c, authz.StaffManage) {
+		if req.Role != "USER" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Admins can only create users"})
+			return
+		}
+		req.AdminID = c.GetString("user_id")
 	}
 
 	user, err := CreateUser(req.FirstName, req.LastName, req.Email, string(hashedPassword), req.Role, req.Phone, req.ProfileImage, req.AddressLine1, req.AddressLine2, req.City, req.State, req.Pincode, req.Region, req.Latitude, req.Longitude, req.AdminID, req.InstallerID, req.PlantID)
@@ -157,6 +160,14 @@ func CreateUserHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 		return
 	}
+	// Accounts created inside an organisation belong to it
+	if caller, err := authz.Caller(c); err == nil && caller.OrgID != "" {
+		if err := orgs.AddMember(caller.OrgID, user.ID); err != nil {
+			DeleteUser(user.ID)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+			return
+		}
+	}
 
 	// Set solar-specific fields if provided
 	if req.InstallationStatus != "" {
@@ -193,6 +204,8 @@ func CreateUserHandler(c *gin.Context) {
 		}
 	}
 
+	audit.Record(c, "user.create", "user", user.ID, nil, user)
+
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "User created successfully",
 		"user":    user,
@@ -212,37 +225,39 @@ func CreateUserHandler(c *gin.Context) {
 // @Router /admin/users [get]
 // @Router /superadmin/users [get]
 func GetUsersHandler(c *gin.Context) {
-	currentUserRole := c.GetString("role")
+	caller, err := authz.Caller(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
 
-	// Get role from query parameter, default to "ALL" for superadmin, "USER" for admin
+	// Get role from query parameter, default to "ALL" for global roles, "USER" for scoped ones
 	var roleFilter string
-	if currentUserRole == "SUPER_ADMIN" {
+	if caller.Scope == authz.Global {
 		roleFilter = c.DefaultQuery("role", "ALL")
 	} else {
 		roleFilter = c.DefaultQuery("role", "USER")
 	}
 
 	var users []*User
-	var err error
 
-	if currentUserRole == "SUPER_ADMIN" {
-		// SuperAdmin can see all users or filter by role if specified
+	if caller.Scope == authz.Global {
+		// Global roles can see all users or filter by role if specified
 		if roleFilter == "ALL" {
-			users, err = GetAllUsersIncludingAdmins()
+			users, err = GetAllUsersIncludingAdmins(caller.OrgID)
 		} else {
-			users, err = GetUsersByRole(roleFilter)
+			users, err = GetUsersByRole(roleFilter, caller.OrgID)
 		}
-	} else if currentUserRole == "ADMIN" {
-		currentUserID := c.GetString("user_id")
+	} else if caller.Scope == authz.Scoped {
 		// Fetch current admin details to determine scope
-		adminUser, err := GetUserByID(currentUserID)
+		adminUser, err := GetUserByID(caller.ID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch admin details"})
 			return
 		}
 
 		// Fetch users based on Admin's scope (Region/Plant)
-		users, err = GetUsersByScope(adminUser)
+		users, err = GetUsersByScope(adminUser, caller.OrgID)
 
 		// Filter by role if not ALL
 		if err == nil && roleFilter != "ALL" {
@@ -288,10 +303,7 @@ func GetUserHandler(c *gin.Context) {
 	}
 
 	// Check permissions
-	currentUserRole := c.GetString("role")
-	currentUserID := c.GetString("user_id")
-
-	if (currentUserRole == "USER" && currentUserID != id) || (currentUserRole == "ADMIN" && user.AdminID != currentUserID) {
+	if !authz.Allowed(c, authz.UsersRead, authz.Resource{Kind: authz.Account, OwnerID: user.ID}) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
 		return
 	}
@@ -353,18 +365,23 @@ func UpdateUserHandler(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
+	before := *user
 
 	// Check permissions
-	currentUserRole := c.GetString("role")
-	currentUserID := c.GetString("user_id")
-
-	if (currentUserRole == "USER" && currentUserID != id) || (currentUserRole == "ADMIN" && user.AdminID != currentUserID) {
+	if !authz.Allowed(c, authz.UsersWrite, authz.Resource{Kind: authz.Account, OwnerID: user.ID}) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
 		return
 	}
-	if currentUserRole == "ADMIN" && req.Role != "" && req.Role != "USER" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Admins can only manage users"})
-		return
+	staffManager := authz.Has(c, authz.StaffManage)
+	if req.Role != "" {
+		if _, err := authz.GetRole(req.Role); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role"})
+			return
+		}
+		if req.Role != "USER" && !staffManager {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Admins can only manage users"})
+			return
+		}
 	}
 
 	// Update basic fields
@@ -406,7 +423,7 @@ func UpdateUserHandler(c *gin.Context) {
 	}
 	user.Latitude = req.Latitude
 	user.Longitude = req.Longitude
-	if currentUserRole == "SUPER_ADMIN" {
+	if staffManager {
 		user.AdminID = req.AdminID
 	}
 	if req.InstallerID != "" {
@@ -455,6 +472,7 @@ func UpdateUserHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
 		return
 	}
+	audit.Record(c, "user.update", "user", user.ID, before, user)
 
 	c.JSON(http.StatusOK, gin.H{"message": "User updated successfully", "user": user})
 }
@@ -612,19 +630,18 @@ func DeleteUserHandler(c *gin.Context) {
 	id := c.Param("id")
 
 	// Check permissions
-	currentUserRole := c.GetString("role")
-	currentUserID := c.GetString("user_id")
-
-	if currentUserRole == "USER" && currentUserID != id {
+	if !authz.Allowed(c, authz.UsersWrite, authz.Resource{Kind: authz.Account, OwnerID: id}) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
 		return
 	}
 
+	before, _ := GetUserByID(id)
 	err := DeleteUser(id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
 		return
 	}
+	audit.Record(c, "user.delete", "user", id, before, nil)
 
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
 }
@@ -641,14 +658,13 @@ func DeleteUserHandler(c *gin.Context) {
 // @Security BearerAuth
 // @Router /superadmin/admins [get]
 func GetAdminsHandler(c *gin.Context) {
-	currentUserRole := c.GetString("role")
-	if currentUserRole != "SUPER_ADMIN" {
+	if !authz.Has(c, authz.StaffManage) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
 		return
 	}
 
 	// Get users with role ADMIN directly
-	admins, err := GetUsersByRole("ADMIN")
+	admins, err := GetUsersByRole("ADMIN", "")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch admins"})
 		return
@@ -670,13 +686,13 @@ func GetAdminsHandler(c *gin.Context) {
 // @Router /superadmin/installers [get]
 // @Router /admin/installers [get]
 func GetInstallersHandler(c *gin.Context) {
-	currentUserRole := c.GetString("role")
-	if currentUserRole != "SUPER_ADMIN" && currentUserRole != "ADMIN" {
+	caller, err := authz.Caller(c)
+	if err != nil || !caller.Has(authz.UsersRead) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
 		return
 	}
 
-	installers, err := GetUsersByRole("INSTALLER")
+	installers, err := GetUsersByRole("INSTALLER", caller.OrgID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch installers"})
 		return
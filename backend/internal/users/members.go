@@ -0,0 +1,203 @@
+package users
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"sems-backend/internal/audit"
+	"sems-backend/internal/authz"
+	"sems-backend/internal/orgs"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type CreateMemberRequest struct {
+	FirstName string `json:"first_name" binding:"required"`
+	LastName  string `json:"last_name" binding:"required"`
+	Email     string `json:"email" binding:"required,email"`
+	Password  string `json:"password" binding:"required,min=6"`
+	Role      string `json:"role" binding:"required"`
+	Phone     string `json:"phone"`
+	Region    string `json:"region"`
+}
+
+type UpdateMemberRequest struct {
+	Role     string `json:"role"`
+	IsActive *bool  `json:"is_active"`
+}
+
+// @Summary List organization members
+// @Description Every account in the caller's organization, staff included
+// @Tags Organizations
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /org/members [get]
+func ListMembersHandler(c *gin.Context) {
+	caller, ok := orgManager(c)
+	if !ok {
+		return
+	}
+	members, err := GetAllUsersIncludingAdmins(caller.OrgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch members"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"members": members})
+}
+
+// @Summary Add organization member
+// @Description Create an account in the caller's organization with any role that holds no platform permission
+// @Tags Organizations
+// @Accept json
+// @Produce json
+// @Param member body CreateMemberRequest true "Member"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security BearerAuth
+// @Router /org/members [post]
+func CreateMemberHandler(c *gin.Context) {
+	caller, ok := orgManager(c)
+	if !ok {
+		return
+	}
+	var req CreateMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !tenantRole(c, req.Role) {
+		return
+	}
+	if _, err := GetUserByEmail(req.Email); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+	user, err := CreateUser(req.FirstName, req.LastName, req.Email, string(hashedPassword), req.Role, req.Phone, "", "", "", "", "", "", req.Region, 0, 0, "", "", "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create member"})
+		return
+	}
+	if err := orgs.AddMember(caller.OrgID, user.ID); err != nil {
+		log.Printf("Adding member %s to organization %s failed: %v", user.ID, caller.OrgID, err)
+		DeleteUser(user.ID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create member"})
+		return
+	}
+	audit.Record(c, "org.member_create", "user", user.ID, nil, user)
+	c.JSON(http.StatusCreated, gin.H{"message": "Member created", "user": user})
+}
+
+// @Summary Update organization member
+// @Description Change the role of a member of the caller's organization, or deactivate and reactivate them
+// @Tags Organizations
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param member body UpdateMemberRequest true "Fields to change"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /org/members/{id} [put]
+func UpdateMemberHandler(c *gin.Context) {
+	caller, ok := orgManager(c)
+	if !ok {
+		return
+	}
+	var req UpdateMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	member, ok := orgMember(c, caller)
+	if !ok {
+		return
+	}
+	if member.ID == caller.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot change your own membership"})
+		return
+	}
+	before := *member
+
+	if req.Role != "" && req.Role != member.Role {
+		if !tenantRole(c, req.Role) {
+			return
+		}
+		if err := SetRole(member.ID, req.Role); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update member"})
+			return
+		}
+		member.Role = req.Role
+	}
+	if req.IsActive != nil && *req.IsActive != member.IsActive {
+		if err := SetActive(member.ID, *req.IsActive); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update member"})
+			return
+		}
+		member.IsActive = *req.IsActive
+	}
+	audit.Record(c, "org.member_update", "user", member.ID,
+		gin.H{"role": before.Role, "is_active": before.IsActive},
+		gin.H{"role": member.Role, "is_active": member.IsActive})
+	c.JSON(http.StatusOK, gin.H{"message": "Member updated", "user": member})
+}
+
+// orgManager loads the caller, who must manage an organisation
+func orgManager(c *gin.Context) (*authz.Subject, bool) {
+	caller, err := authz.Caller(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return nil, false
+	}
+	if caller.OrgID == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account does not belong to an organization"})
+		return nil, false
+	}
+	return caller, true
+}
+
+// orgMember loads the account named in the path, which must belong to the
+// caller's organisation
+func orgMember(c *gin.Context, caller *authz.Subject) (*User, bool) {
+	member, err := authz.Lookup(c.Param("id"))
+	if err != nil || member.OrgID != caller.OrgID {
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Loading member %s failed: %v", c.Param("id"), err)
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+		return nil, false
+	}
+	user, err := GetUserByID(member.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+		return nil, false
+	}
+	return user, true
+}
+
+// tenantRole checks that an organisation admin may hand out role
+func tenantRole(c *gin.Context, role string) bool {
+	r, err := authz.GetRole(role)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role"})
+		return false
+	}
+	if !r.ForTenants() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Role " + role + " is reserved to the platform"})
+		return false
+	}
+	return true
+}
@@ -2,6 +2,7 @@ package users
 
 import (
 	"database/sql"
+	"sems-backend/internal/authz"
 	"sems-backend/internal/database"
 	"strings"
 	"time"
@@ -173,7 +174,7 @@ func CreateUser(firstName, lastName, email, passwordHash, role, phone, profileIm
 	query := `
 		INSERT INTO users (id, first_name, last_name, email, password_hash, role, phone, profile_image, address_line1, address_line2, city, state, pincode, region, latitude, longitude, admin_id, installer_id, plant_id, installation_status, property_type, avg_monthly_bill, roof_area_sqft, connection_type, subsidy_interest, project_cost, plant_capacity_kw, installation_date, net_metering, inverter_brand, discom_name, consumer_number, device_linked, device_id, last_data_received, subsidy_applied, subsidy_status, scheme_name, application_id, is_active, created_at, updated_at)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-	_, err := database.DB.Exec(query, user.ID, user.FirstName, user.LastName, user.Email, user.PasswordHash, user.Role, user.Phone, user.ProfileImage, user.AddressLine1, user.AddressLine2, user.City, user.State, user.Pincode, user.Region, user.Latitude, user.Longitude, user.AdminID, user.InstallerID, user.PlantID, user.InstallationStatus, user.PropertyType, user.AvgMonthlyBill, user.RoofAreaSqft, user.ConnectionType, user.SubsidyInterest, user.ProjectCost, user.PlantCapacityKW, user.InstallationDate, user.NetMetering, user.InverterBrand, user.DISCOMName, user.ConsumerNumber, user.DeviceLinked, user.DeviceID, user.LastDataReceived, user.SubsidyApplied, user.SubsidyStatus, user.SchemeName, user.ApplicationID, user.IsActive, user.CreatedAt, user.UpdatedAt)
+	_, err := database.DB.Exec(query, user.ID, user.FirstName, user.LastName, user.Email, user.PasswordHash, user.Role, user.Phone, user.ProfileImage, user.AddressLine1, user.AddressLine2, user.City, user.State, user.Pincode, user.Region, user.Latitude, user.Longitude, stringToNullString(user.AdminID), stringToNullString(user.InstallerID), stringToNullString(user.PlantID), user.InstallationStatus, user.PropertyType, user.AvgMonthlyBill, user.RoofAreaSqft, user.ConnectionType, user.SubsidyInterest, user.ProjectCost, user.PlantCapacityKW, user.InstallationDate, user.NetMetering, user.InverterBrand, user.DISCOMName, user.ConsumerNumber, user.DeviceLinked, user.DeviceID, user.LastDataReceived, user.SubsidyApplied, user.SubsidyStatus, user.SchemeName, user.ApplicationID, user.IsActive, user.CreatedAt, user.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -245,14 +246,16 @@ func GetUserByEmail(email string) (*User, error) {
 	return user, nil
 }
 
-// GetUsersByRole returns users with a specific role
-func GetUsersByRole(role string) ([]*User, error) {
+// GetUsersByRole returns users with a specific role, within one organisation
+// unless orgID is empty
+func GetUsersByRole(role, orgID string) ([]*User, error) {
 	users := []*User{}
 	query := `
 		SELECT id, first_name, last_name, email, password_hash, role, phone, profile_image, address_line1, address_line2, city, state, pincode, region, latitude, longitude, admin_id, installer_id, plant_id, installation_status, property_type, avg_monthly_bill, roof_area_sqft, connection_type, subsidy_interest, project_cost, plant_capacity_kw, installation_date, net_metering, inverter_brand, discom_name, consumer_number, device_linked, device_id, last_data_received, subsidy_applied, subsidy_status, scheme_name, application_id, is_active, created_at, updated_at, personnel_nexus_id
 		FROM users
 		WHERE role = ?`
-	rows, err := database.DB.Query(query, role)
+	tenant, args := authz.TenantFilter(orgID, "org_id")
+	rows, err := database.DB.Query(query+tenant, append([]interface{}{role}, args...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -392,13 +395,16 @@ func GetAllUsers() ([]*User, error) {
 	return users, nil
 }
 
-// GetAllUsersIncludingAdmins returns all users including admins and super admins
-func GetAllUsersIncludingAdmins() ([]*User, error) {
+// GetAllUsersIncludingAdmins returns all users including admins and super
+// admins, within one organisation unless orgID is empty
+func GetAllUsersIncludingAdmins(orgID string) ([]*User, error) {
 	users := []*User{}
 	query := `
 		SELECT id, first_name, last_name, email, password_hash, role, phone, profile_image, address_line1, address_line2, city, state, pincode, region, latitude, longitude, admin_id, installer_id, plant_id, installation_status, property_type, avg_monthly_bill, roof_area_sqft, connection_type, subsidy_interest, project_cost, plant_capacity_kw, installation_date, net_metering, inverter_brand, discom_name, consumer_number, device_linked, device_id, last_data_received, subsidy_applied, subsidy_status, scheme_name, application_id, is_active, created_at, updated_at, personnel_nexus_id
-		FROM users`
-	rows, err := database.DB.Query(query)
+		FROM users
+		WHERE 1=1`
+	tenant, args := authz.TenantFilter(orgID, "org_id")
+	rows, err := database.DB.Query(query+tenant, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -532,12 +538,14 @@ func GetUserByID(id string) (*User, error) {
 func UpdateUser(user *User) error {
 	query := `
 		UPDATE users
-		SET first_name = ?, last_name = ?, email = ?, role = ?, phone = ?, profile_image = ?, address_line1 = ?, address_line2 = ?, city = ?, state = ?, pincode = ?, region = ?, latitude = ?, longitude = ?, admin_id = ?, installer_id = ?, plant_id = ?, installation_status = ?, property_type = ?, avg_monthly_bill = ?, roof_area_sqft = ?, connection_type = ?, subsidy_interest = ?, project_cost = ?, plant_capacity_kw = ?, installation_date = ?, net_metering = ?, inverter_brand = ?, discom_name = ?, consumer_number = ?, device_linked = ?, device_id = ?, last_data_received = ?, subsidy_applied = ?, subsidy_status = ?, scheme_name = ?, application_id = ?, is_active = ?, updated_at = ?, personnel_nexus_id = ?
+		SET email_verified_at = CASE WHEN email = ? THEN email_verified_at END,
+		    first_name = ?, last_name = ?, email = ?, role = ?, phone = ?, profile_image = ?, address_line1 = ?, address_line2 = ?, city = ?, state = ?, pincode = ?, region = ?, latitude = ?, longitude = ?, admin_id = ?, installer_id = ?, plant_id = ?, installation_status = ?, property_type = ?, avg_monthly_bill = ?, roof_area_sqft = ?, connection_type = ?, subsidy_interest = ?, project_cost = ?, plant_capacity_kw = ?, installation_date = ?, net_metering = ?, inverter_brand = ?, discom_name = ?, consumer_number = ?, device_linked = ?, device_id = ?, last_data_received = ?, subsidy_applied = ?, subsidy_status = ?, scheme_name = ?, application_id = ?, is_active = ?, updated_at = ?, personnel_nexus_id = ?
 		WHERE id = ?`
 	_, err := database.DB.Exec(query,
+		user.Email, // a changed address has to be verified again
 		user.FirstName, user.LastName, user.Email, user.Role, user.Phone, user.ProfileImage,
 		user.AddressLine1, user.AddressLine2, user.City, user.State, user.Pincode, user.Region,
-		user.Latitude, user.Longitude, user.AdminID, user.InstallerID, user.PlantID, user.InstallationStatus, user.PropertyType,
+		user.Latitude, user.Longitude, stringToNullString(user.AdminID), stringToNullString(user.InstallerID), stringToNullString(user.PlantID), user.InstallationStatus, user.PropertyType,
 		user.AvgMonthlyBill, user.RoofAreaSqft, user.ConnectionType, user.SubsidyInterest, user.ProjectCost,
 		user.PlantCapacityKW, user.InstallationDate, user.NetMetering, user.InverterBrand,
 		user.DISCOMName, user.ConsumerNumber, user.DeviceLinked, user.DeviceID, user.LastDataReceived,
@@ -546,6 +554,55 @@ func UpdateUser(user *User) error {
 	return err
 }
 
+// UpdatePasswordHash replaces a user's bcrypt password hash
+func UpdatePasswordHash(id, passwordHash string) error {
+	result, err := database.DB.Exec(`UPDATE users SET password_hash = ?, updated_at = ? WHERE id = ?`, passwordHash, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetActive enables or disables a user's ability to sign in
+func SetActive(id string, active bool) error {
+	result, err := database.DB.Exec(`UPDATE users SET is_active = ?, updated_at = ? WHERE id = ?`, active, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetRole changes a user's role
+func SetRole(id, role string) error {
+	result, err := database.DB.Exec(`UPDATE users SET role = ?, updated_at = ? WHERE id = ?`, role, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// IsEmailVerified reports whether the user has confirmed their email address
+func IsEmailVerified(id string) (bool, error) {
+	var verifiedAt sql.NullTime
+	err := database.DB.QueryRow(`SELECT email_verified_at FROM users WHERE id = ?`, id).Scan(&verifiedAt)
+	return verifiedAt.Valid, err
+}
+
+// MarkEmailVerified records that the user confirmed their email address
+func MarkEmailVerified(id string) error {
+	_, err := database.DB.Exec(`UPDATE users SET email_verified_at = COALESCE(email_verified_at, ?) WHERE id = ?`, time.Now().UTC(), id)
+	return err
+}
+
 func DeleteUser(id string) error {
 	query := `
 		DELETE FROM users
@@ -554,14 +611,16 @@ func DeleteUser(id string) error {
 	return err
 }
 
-// GetUsersByInstallationStatus returns users with a specific installation status
-func GetUsersByInstallationStatus(status InstallationStatus) ([]*User, error) {
+// GetUsersByInstallationStatus returns users with a specific installation
+// status, within one organisation unless orgID is empty
+func GetUsersByInstallationStatus(status InstallationStatus, orgID string) ([]*User, error) {
 	users := []*User{}
 	query := `
 		SELECT id, first_name, last_name, email, password_hash, role, phone, profile_image, address_line1, address_line2, city, state, pincode, region, latitude, longitude, admin_id, installer_id, plant_id, installation_status, property_type, avg_monthly_bill, roof_area_sqft, connection_type, subsidy_interest, project_cost, plant_capacity_kw, installation_date, net_metering, inverter_brand, discom_name, consumer_number, device_linked, device_id, last_data_received, subsidy_applied, subsidy_status, scheme_name, application_id, is_active, created_at, updated_at, personnel_nexus_id
 		FROM users
 		WHERE installation_status = ?`
-	rows, err := database.DB.Query(query, status)
+	tenant, args := authz.TenantFilter(orgID, "org_id")
+	rows, err := database.DB.Query(query+tenant, append([]interface{}{status}, args...)...)
 	if err != nil {
 		return nil, err
 	}
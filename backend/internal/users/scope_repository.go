@@ -2,12 +2,14 @@ package users
 
 import (
 	"database/sql"
+	"sems-backend/internal/authz"
 	"sems-backend/internal/database"
 	"strings"
 )
 
 // GetUsersByScope returns users that fall within the scope of the given admin (by Region/Plant)
-func GetUsersByScope(admin *User) ([]*User, error) {
+// and, when orgID is set, within the admin's organisation
+func GetUsersByScope(admin *User, orgID string) ([]*User, error) {
 	users := []*User{}
 	var query string
 	var args []interface{}
@@ -32,7 +34,8 @@ func GetUsersByScope(admin *User) ([]*User, error) {
 		args = []interface{}{admin.ID}
 	}
 
-	rows, err := database.DB.Query(query, args...)
+	tenant, tenantArgs := authz.TenantFilter(orgID, "org_id")
+	rows, err := database.DB.Query(query+tenant, append(args, tenantArgs...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"sems-backend/internal/config"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -15,6 +16,11 @@ var (
 	baseURL = "https://api.openweathermap.org/data/2.5"
 )
 
+// Configure sets the OpenWeather API key; without one mock weather is served
+func Configure(cfg config.WeatherConfig) {
+	apiKey = cfg.APIKey
+}
+
 func GetWeather(lat, lon float64) (*WeatherResponse, error) {
 	if apiKey == "" {
 		return getMockWeather(lat, lon), nil
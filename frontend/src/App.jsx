@@ -23,6 +23,9 @@ function App() {
           <Route path="/login" element={<AuthPage />} />
           <Route path="/register" element={<AuthPage />} />
           <Route path="/forgot-password" element={<AuthPage />} />
+          <Route path="/reset-password" element={<AuthPage />} />
+          <Route path="/verify-email" element={<AuthPage />} />
+          <Route path="/sso/callback" element={<AuthPage />} />
           <Route path="/solar-onboarding" element={<SolarOnboarding />} />
           <Route path="/onboarding" element={<Onboarding />} /> {/* New Route */}
           <Route path="/solar-installation" element={<SolarInstallationShowcase />} />
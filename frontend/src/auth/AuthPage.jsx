@@ -1,6 +1,9 @@
 import Login from "./Login";
 import Register from "./Register";
 import ForgotPassword from "./ForgotPassword";
+import ResetPassword from "./ResetPassword";
+import VerifyEmail from "./VerifyEmail";
+import SSOCallback from "./SSOCallback";
 import { Link, useLocation } from "react-router-dom";
 import EnergyLayer from "../components/EnergyLayer";
 import ThemeToggle from "../components/ThemeToggle";
@@ -19,6 +22,9 @@ export default function AuthPage() {
   const isLoginPage = location.pathname === "/login" || location.pathname === "/auth";
   const isRegisterPage = location.pathname === "/register";
   const isForgotPasswordPage = location.pathname === "/forgot-password";
+  const isResetPasswordPage = location.pathname === "/reset-password";
+  const isVerifyEmailPage = location.pathname === "/verify-email";
+  const isSSOCallbackPage = location.pathname === "/sso/callback";
 
   useEffect(() => {
     // Listen for theme changes
@@ -116,7 +122,7 @@ export default function AuthPage() {
           </div>
 
           {/* 🔁 ADVANCED SOLAR GLOW AUTH TOGGLE - Only show for login/register */}
-          {!isForgotPasswordPage && (
+          {(isLoginPage || isRegisterPage) && (
             <div className="
               flex rounded-2xl overflow-hidden mb-8
               border border-solar-border
@@ -160,6 +166,9 @@ export default function AuthPage() {
               {isLoginPage && <Login />}
               {isRegisterPage && <Register />}
               {isForgotPasswordPage && <ForgotPassword />}
+              {isResetPasswordPage && <ResetPassword />}
+              {isVerifyEmailPage && <VerifyEmail />}
+              {isSSOCallbackPage && <SSOCallback />}
             </div>
           </div>
 
@@ -23,7 +23,6 @@ function ForgotPassword() {
     setError("");
     
     try {
-      // Mocking the API call for now or using a placeholder if backend doesn't exist yet
       await postRequest("/auth/forgot-password", { email });
       setSubmitted(true);
       notify.success("Reset link sent! Check your email.");
@@ -44,7 +43,7 @@ function ForgotPassword() {
         </div>
         <h2 className="text-2xl font-bold text-solar-primary dark:text-solar-yellow">Check your email</h2>
         <p className="text-solar-muted dark:text-solar-muted/80">
-          We've sent a password reset link to <span className="font-semibold text-solar-primary dark:text-solar-yellow">{email}</span>.
+          If an account exists for <span className="font-semibold text-solar-primary dark:text-solar-yellow">{email}</span>, we've sent it a password reset link.
         </p>
         <div className="pt-4">
           <Link
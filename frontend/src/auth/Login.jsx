@@ -1,10 +1,12 @@
-import { useState } from "react";
+import { useEffect, useState } from "react";
 import { useNavigate, Link } from "react-router-dom";
 import { Input } from "../components/ui/input";
 import { Button } from "../components/ui/button";
 import { login } from "../lib/auth";
 import { notify } from "../lib/toast";
-import { postRequest } from "../lib/apiService";
+import { getRequest, postRequest } from "../lib/apiService";
+import { API_BASE_URL } from "../lib/axios";
+import TwoFactorStep from "./TwoFactorStep";
 
 function Login() {
   const [formData, setFormData] = useState({
@@ -21,8 +23,32 @@ function Login() {
     password: false
   });
   const [loading, setLoading] = useState(false);
+  const [unverified, setUnverified] = useState(false);
+  const [challenge, setChallenge] = useState(null);
+  const [ssoProviders, setSsoProviders] = useState([]);
   const navigate = useNavigate();
 
+  useEffect(() => {
+    getRequest("/auth/oidc/providers")
+      .then(({ data }) => setSsoProviders(data || []))
+      .catch(() => setSsoProviders([]));
+  }, []);
+
+  const finishLogin = ({ token, refresh_token, user }) => {
+    login(token, user, refresh_token);
+    notify.success("Login successful! Welcome back.");
+    navigate("/dashboard");
+  };
+
+  const resendVerification = async () => {
+    try {
+      await postRequest("/auth/resend-verification", { email: formData.email });
+      notify.success("Verification email sent. Check your inbox.");
+    } catch {
+      notify.error("Could not send the verification email");
+    }
+  };
+
   // Validation rules
   const validateField = (name, value) => {
     let error = "";
@@ -119,19 +145,27 @@ function Login() {
     setLoading(true);
     try {
       const response = await postRequest("/auth/login", sanitizedData);
-      const { token, user } = response.data;
-      login(token, user);
-      notify.success("Login successful! Welcome back.");
-      navigate("/dashboard");
+      if (response.data.mfa_required || response.data.mfa_enrollment_required) {
+        setChallenge({
+          mode: response.data.mfa_required ? "login" : "enroll",
+          token: response.data.mfa_token,
+        });
+        return;
+      }
+      finishLogin(response.data);
     } catch (error) {
       // Handle specific API errors
       const errorMessage = error.response?.data?.error || "Login failed";
       
       // Map common API errors to global notification for security
-      if (error.response?.status === 401 || error.response?.status === 404) {
+      if (error.response?.data?.code === "email_unverified") {
+        setUnverified(true);
+        notify.warning("Please verify your email address before logging in.");
+      } else if (error.response?.status === 401 || error.response?.status === 404) {
         notify.error("Invalid email or password");
       } else if (error.response?.status === 429) {
-        notify.error("Too many attempts. Please try again later.");
+        const wait = error.response.headers?.["retry-after"];
+        notify.error(wait ? `Too many attempts. Try again in ${wait} seconds.` : "Too many attempts. Please try again later.");
       } else if (error.response?.status >= 500) {
         notify.error("Server error. Please try again later.");
       } else {
@@ -146,6 +180,16 @@ function Login() {
   const canSubmit = formData.email && formData.password && 
                     !errors.email && !errors.password;
 
+  if (challenge) {
+    return (
+      <TwoFactorStep
+        challenge={challenge}
+        onDone={finishLogin}
+        onCancel={() => setChallenge(null)}
+      />
+    );
+  }
+
   return (
     <form onSubmit={handleLogin} className="space-y-5" noValidate>
       <Field
@@ -205,6 +249,19 @@ function Login() {
         </Link>
       </div>
 
+      {unverified && (
+        <p className="text-center text-sm text-solar-muted dark:text-solar-muted/80">
+          Didn't get the verification email?{" "}
+          <button
+            type="button"
+            onClick={resendVerification}
+            className="text-solar-yellow hover:text-solar-orange transition-colors duration-200"
+          >
+            Send it again
+          </button>
+        </p>
+      )}
+
       <Button
         type="submit"
         disabled={loading || !canSubmit}
@@ -216,6 +273,21 @@ function Login() {
         {loading ? "Charging energy..." : "Login"}
       </Button>
 
+      {ssoProviders.length > 0 && (
+        <div className="space-y-2">
+          <p className="text-center text-xs uppercase tracking-wider text-solar-muted/70">Staff sign-in</p>
+          {ssoProviders.map((p) => (
+            <a
+              key={p.name}
+              href={`${API_BASE_URL}/auth/oidc/${encodeURIComponent(p.name)}/login`}
+              className="flex w-full items-center justify-center h-11 rounded-xl border border-solar-yellow/30 text-sm text-solar-primary dark:text-solar-yellow hover:bg-solar-yellow/10 transition-colors"
+            >
+              Continue with {p.display_name}
+            </a>
+          ))}
+        </div>
+      )}
+
       <p className="text-center text-sm text-solar-muted dark:text-solar-muted/80">
         Don't have an account?{" "}
         <Link
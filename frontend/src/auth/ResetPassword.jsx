@@ -0,0 +1,126 @@
+import { useState } from "react";
+import { Link, useNavigate, useSearchParams } from "react-router-dom";
+import { Button } from "../components/ui/button";
+import { notify } from "../lib/toast";
+import { postRequest } from "../lib/apiService";
+import { ArrowLeft, Lock, AlertCircle } from "lucide-react";
+import { Input } from "../components/ui/input";
+
+function ResetPassword() {
+  const [searchParams] = useSearchParams();
+  const token = searchParams.get("token") || "";
+  const [password, setPassword] = useState("");
+  const [confirm, setConfirm] = useState("");
+  const [loading, setLoading] = useState(false);
+  const [error, setError] = useState("");
+  const navigate = useNavigate();
+
+  const handleSubmit = async (e) => {
+    e.preventDefault();
+    if (password.length < 6) {
+      setError("Password must be at least 6 characters");
+      return;
+    }
+    if (password !== confirm) {
+      setError("Passwords do not match");
+      return;
+    }
+
+    setLoading(true);
+    setError("");
+
+    try {
+      await postRequest("/auth/reset-password", { token, password });
+      notify.success("Password updated. Please log in.");
+      navigate("/login");
+    } catch (err) {
+      const msg = err.response?.data?.error || "Failed to reset password";
+      setError(msg);
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  if (!token) {
+    return (
+      <div className="space-y-6 text-center animate-fade-in">
+        <h2 className="text-2xl font-bold text-solar-primary dark:text-solar-yellow">Invalid Link</h2>
+        <p className="text-solar-muted dark:text-solar-muted/80">
+          This reset link is incomplete. Request a new one.
+        </p>
+        <Link
+          to="/forgot-password"
+          className="inline-flex items-center text-sm text-solar-yellow hover:text-solar-orange transition-colors"
+        >
+          Request a new link
+        </Link>
+      </div>
+    );
+  }
+
+  return (
+    <div className="space-y-6 animate-fade-in">
+      <div className="text-center">
+        <h2 className="text-2xl font-bold text-solar-primary dark:text-solar-yellow">Set a New Password</h2>
+        <p className="mt-2 text-sm text-solar-muted dark:text-solar-muted/80">
+          You will be signed out on all your devices.
+        </p>
+      </div>
+
+      <form onSubmit={handleSubmit} className="space-y-5">
+        {[
+          { label: "New Password", value: password, setValue: setPassword },
+          { label: "Confirm Password", value: confirm, setValue: setConfirm },
+        ].map(({ label, value, setValue }) => (
+          <div className="space-y-2" key={label}>
+            <label className="block text-sm font-medium text-solar-primary dark:text-solar-yellow">
+              {label}
+            </label>
+            <div className="relative">
+              <div className="absolute left-3 top-1/2 -translate-y-1/2 text-solar-muted pointer-events-none">
+                <Lock size={18} />
+              </div>
+              <Input
+                type="password"
+                value={value}
+                onChange={(e) => setValue(e.target.value)}
+                className={`solar-input h-11 pl-10 ${error ? "border-red-500" : ""}`}
+                disabled={loading}
+                required
+              />
+            </div>
+          </div>
+        ))}
+        {error && (
+          <p className="text-xs text-red-500 flex items-center gap-1">
+            <AlertCircle size={12} />
+            {error}
+          </p>
+        )}
+
+        <Button
+          type="submit"
+          disabled={loading || !password || !confirm}
+          className="w-full sun-button"
+        >
+          {loading ? (
+            <span className="h-4 w-4 border-2 border-solar-dark border-t-transparent rounded-full animate-spin mr-2" />
+          ) : null}
+          {loading ? "Saving..." : "Reset Password"}
+        </Button>
+
+        <div className="text-center">
+          <Link
+            to="/login"
+            className="inline-flex items-center text-sm text-solar-muted hover:text-solar-yellow transition-colors"
+          >
+            <ArrowLeft size={16} className="mr-2" />
+            Back to Login
+          </Link>
+        </div>
+      </form>
+    </div>
+  );
+}
+
+export default ResetPassword;
@@ -0,0 +1,93 @@
+import { useEffect, useRef, useState } from "react";
+import { Link, useNavigate, useSearchParams } from "react-router-dom";
+import { postRequest } from "../lib/apiService";
+import { login } from "../lib/auth";
+import { notify } from "../lib/toast";
+import { ArrowLeft, AlertCircle } from "lucide-react";
+import TwoFactorStep from "./TwoFactorStep";
+
+const SSO_ERRORS = {
+  sso_expired: "The sign-in took too long or was started in another browser. Please try again.",
+  sso_cancelled: "Sign-in was cancelled at your organisation's login page.",
+  sso_not_authorized: "Your organisation account has no access to SEMS. Ask your administrator to add you to the right group.",
+  sso_account_conflict:
+    "An account with your email already exists, or this organisation login belongs to another account. Sign in with your password, then link your organisation login from your account.",
+  sso_no_email: "Your organisation did not share a verified email address.",
+  account_disabled: "Your account is deactivated.",
+};
+
+// Landing page after the identity provider: trade the one-time code for a session
+function SSOCallback() {
+  const [searchParams] = useSearchParams();
+  const code = searchParams.get("code");
+  const errorCode = searchParams.get("error");
+  const linked = searchParams.get("linked");
+  const [error, setError] = useState(
+    errorCode ? SSO_ERRORS[errorCode] || "Single sign-on failed. Please try again." : ""
+  );
+  const [challenge, setChallenge] = useState(null);
+  const sent = useRef(false);
+  const navigate = useNavigate();
+
+  const finishLogin = ({ token, refresh_token, user }) => {
+    login(token, user, refresh_token);
+    notify.success("Login successful! Welcome back.");
+    navigate("/dashboard");
+  };
+
+  useEffect(() => {
+    if (!linked) return;
+    notify.success("Your organisation login is now linked to this account.");
+    navigate("/dashboard");
+    // eslint-disable-next-line react-hooks/exhaustive-deps
+  }, [linked]);
+
+  useEffect(() => {
+    // Codes work once; guard against the double effect run in development
+    if (!code || errorCode || sent.current) return;
+    sent.current = true;
+
+    postRequest("/auth/oidc/exchange", { code })
+      .then(({ data }) => {
+        if (data.mfa_required || data.mfa_enrollment_required) {
+          setChallenge({ mode: data.mfa_required ? "login" : "enroll", token: data.mfa_token });
+        } else {
+          finishLogin(data);
+        }
+      })
+      .catch((err) => setError(err.response?.data?.error || "Single sign-on failed. Please try again."));
+    // eslint-disable-next-line react-hooks/exhaustive-deps
+  }, [code, errorCode]);
+
+  if (challenge) {
+    return <TwoFactorStep challenge={challenge} onDone={finishLogin} onCancel={() => navigate("/login")} />;
+  }
+
+  return (
+    <div className="space-y-6 text-center animate-fade-in">
+      {!error ? (
+        <>
+          <div className="h-8 w-8 border-4 border-solar-yellow border-t-transparent rounded-full animate-spin mx-auto" />
+          <p className="text-solar-muted dark:text-solar-muted/80">Signing you in...</p>
+        </>
+      ) : (
+        <>
+          <div className="w-16 h-16 bg-red-500/10 rounded-full flex items-center justify-center mx-auto mb-4 border border-red-500/30">
+            <AlertCircle className="w-8 h-8 text-red-500" />
+          </div>
+          <h2 className="text-2xl font-bold text-solar-primary dark:text-solar-yellow">Sign-in failed</h2>
+          <p className="text-solar-muted dark:text-solar-muted/80">{error}</p>
+          <Link
+            to="/login"
+            className="inline-flex items-center text-sm text-solar-yellow hover:text-solar-orange transition-colors"
+          >
+            <ArrowLeft size={16} className="mr-2" />
+            Back to Login
+          </Link>
+        </>
+      )}
+    </div>
+  );
+}
+
+export default SSOCallback;
@@ -0,0 +1,126 @@
+import { useEffect, useRef, useState } from "react";
+import { Button } from "../components/ui/button";
+import { Input } from "../components/ui/input";
+import { postRequest } from "../lib/apiService";
+import { ArrowLeft, AlertCircle, ShieldCheck } from "lucide-react";
+
+// Second login step: enter a code, or enroll an authenticator app first
+// when the account's role requires two-factor authentication
+function TwoFactorStep({ challenge, onDone, onCancel }) {
+  const enrolling = challenge.mode === "enroll";
+  const [setup, setSetup] = useState(null);
+  const [code, setCode] = useState("");
+  const [session, setSession] = useState(null);
+  const [loading, setLoading] = useState(false);
+  const [error, setError] = useState("");
+  const started = useRef(false);
+
+  useEffect(() => {
+    if (!enrolling || started.current) return;
+    started.current = true;
+    postRequest("/auth/login/2fa/setup", { mfa_token: challenge.token })
+      .then((res) => setSetup(res.data))
+      .catch((err) => setError(err.response?.data?.error || "Could not start enrollment"));
+  }, [enrolling, challenge.token]);
+
+  const handleSubmit = async (e) => {
+    e.preventDefault();
+    setLoading(true);
+    setError("");
+    try {
+      const path = enrolling ? "/auth/login/2fa/enable" : "/auth/login/2fa";
+      const res = await postRequest(path, { mfa_token: challenge.token, code: code.trim() });
+      // Recovery codes are shown once, before entering the app
+      if (res.data.recovery_codes) {
+        setSession(res.data);
+      } else {
+        onDone(res.data);
+      }
+    } catch (err) {
+      setError(err.response?.data?.error || "Verification failed");
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  if (session) {
+    return (
+      <div className="space-y-5 animate-fade-in">
+        <div className="text-center">
+          <ShieldCheck className="w-10 h-10 text-solar-success mx-auto mb-2" />
+          <h2 className="text-xl font-bold text-solar-primary dark:text-solar-yellow">Save your recovery codes</h2>
+          <p className="mt-2 text-sm text-solar-muted dark:text-solar-muted/80">
+            Each code signs you in once if you lose your authenticator. They will not be shown again.
+          </p>
+        </div>
+        <div className="grid grid-cols-2 gap-2 p-3 rounded-xl bg-solar-yellow/5 border border-solar-yellow/10 font-mono text-sm text-center">
+          {session.recovery_codes.map((c) => (
+            <span key={c}>{c}</span>
+          ))}
+        </div>
+        <Button type="button" onClick={() => onDone(session)} className="w-full sun-button">
+          I have saved them
+        </Button>
+      </div>
+    );
+  }
+
+  return (
+    <form onSubmit={handleSubmit} className="space-y-5 animate-fade-in">
+      <div className="text-center">
+        <h2 className="text-xl font-bold text-solar-primary dark:text-solar-yellow">
+          {enrolling ? "Set up two-factor authentication" : "Two-factor authentication"}
+        </h2>
+        <p className="mt-2 text-sm text-solar-muted dark:text-solar-muted/80">
+          {enrolling
+            ? "Your role requires a second factor. Add this account to an authenticator app, then enter the code it shows."
+            : "Enter the code from your authenticator app, or one of your recovery codes."}
+        </p>
+      </div>
+
+      {enrolling && setup && (
+        <div className="space-y-2 p-3 rounded-xl bg-solar-yellow/5 border border-solar-yellow/10 text-sm break-all">
+          <p className="text-solar-muted">Secret key</p>
+          <p className="font-mono text-solar-primary dark:text-solar-yellow">{setup.secret}</p>
+          <a href={setup.otpauth_uri} className="text-solar-yellow hover:text-solar-orange transition-colors">
+            Open in authenticator app
+          </a>
+        </div>
+      )}
+
+      <Input
+        value={code}
+        onChange={(e) => setCode(e.target.value)}
+        placeholder={enrolling ? "6-digit code" : "6-digit code or recovery code"}
+        autoComplete="one-time-code"
+        className={`solar-input h-11 text-center tracking-widest ${error ? "border-red-500" : ""}`}
+        disabled={loading || (enrolling && !setup)}
+        autoFocus
+        required
+      />
+      {error && (
+        <p className="text-xs text-red-500 flex items-center gap-1">
+          <AlertCircle size={12} />
+          {error}
+        </p>
+      )}
+
+      <Button type="submit" disabled={loading || !code.trim()} className="w-full sun-button">
+        {loading ? "Verifying..." : "Verify"}
+      </Button>
+
+      <div className="text-center">
+        <button
+          type="button"
+          onClick={onCancel}
+          className="inline-flex items-center text-sm text-solar-muted hover:text-solar-yellow transition-colors"
+        >
+          <ArrowLeft size={16} className="mr-2" />
+          Back to Login
+        </button>
+      </div>
+    </form>
+  );
+}
+
+export default TwoFactorStep;
@@ -0,0 +1,70 @@
+import { useEffect, useRef, useState } from "react";
+import { Link, useSearchParams } from "react-router-dom";
+import { postRequest } from "../lib/apiService";
+import { ArrowLeft, AlertCircle, CheckCircle2 } from "lucide-react";
+
+function VerifyEmail() {
+  const [searchParams] = useSearchParams();
+  const token = searchParams.get("token") || "";
+  const [status, setStatus] = useState(token ? "verifying" : "failed");
+  const [message, setMessage] = useState(token ? "" : "This verification link is incomplete.");
+  const sent = useRef(false);
+
+  useEffect(() => {
+    // Tokens work once; guard against the double effect run in development
+    if (!token || sent.current) return;
+    sent.current = true;
+
+    postRequest("/auth/verify-email", { token })
+      .then(() => setStatus("verified"))
+      .catch((err) => {
+        setStatus("failed");
+        setMessage(err.response?.data?.error || "Verification failed");
+      });
+  }, [token]);
+
+  return (
+    <div className="space-y-6 text-center animate-fade-in">
+      {status === "verifying" && (
+        <>
+          <div className="h-8 w-8 border-4 border-solar-yellow border-t-transparent rounded-full animate-spin mx-auto" />
+          <p className="text-solar-muted dark:text-solar-muted/80">Verifying your email...</p>
+        </>
+      )}
+
+      {status === "verified" && (
+        <>
+          <div className="w-16 h-16 bg-solar-success/20 rounded-full flex items-center justify-center mx-auto mb-4 border border-solar-success/30">
+            <CheckCircle2 className="w-8 h-8 text-solar-success" />
+          </div>
+          <h2 className="text-2xl font-bold text-solar-primary dark:text-solar-yellow">Email verified</h2>
+          <p className="text-solar-muted dark:text-solar-muted/80">You can now log in to your account.</p>
+        </>
+      )}
+
+      {status === "failed" && (
+        <>
+          <div className="w-16 h-16 bg-red-500/10 rounded-full flex items-center justify-center mx-auto mb-4 border border-red-500/30">
+            <AlertCircle className="w-8 h-8 text-red-500" />
+          </div>
+          <h2 className="text-2xl font-bold text-solar-primary dark:text-solar-yellow">Verification failed</h2>
+          <p className="text-solar-muted dark:text-solar-muted/80">
+            {message} Log in to request a new link.
+          </p>
+        </>
+      )}
+
+      <div className="pt-4">
+        <Link
+          to="/login"
+          className="inline-flex items-center text-sm text-solar-yellow hover:text-solar-orange transition-colors"
+        >
+          <ArrowLeft size={16} className="mr-2" />
+          Back to Login
+        </Link>
+      </div>
+    </div>
+  );
+}
+
+export default VerifyEmail;
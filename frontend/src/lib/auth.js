@@ -1,8 +1,15 @@
+import { API_BASE_URL } from "./axios";
+
 // Get stored token
 export const getToken = () => {
   return localStorage.getItem("token");
 };
 
+// Get stored refresh token
+export const getRefreshToken = () => {
+  return localStorage.getItem("refreshToken");
+};
+
 // Get stored user
 export const getUser = () => {
   const user = localStorage.getItem("user");
@@ -29,8 +36,19 @@ export const isAuthenticated = () => {
   return !!(token && user);
 };
 
-// Logout function - clears storage and redirects to login
+// Logout function - ends the server session, clears storage and redirects to login
 export const logout = () => {
+  const refreshToken = getRefreshToken();
+  if (refreshToken) {
+    // Best effort: keepalive lets the request finish while the page navigates away
+    fetch(`${API_BASE_URL}/auth/logout`, {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ refresh_token: refreshToken }),
+      keepalive: true,
+    }).catch(() => {});
+  }
+
   localStorage.clear();
 
   // Redirect to login page
@@ -53,8 +71,17 @@ export const isTokenExpired = () => {
   }
 };
 
-// Login function - stores token and user
-export const login = (token, user) => {
+// Login function - stores tokens and user
+export const login = (token, user, refreshToken) => {
   localStorage.setItem("token", token);
   localStorage.setItem("user", JSON.stringify(user));
+  if (refreshToken) {
+    localStorage.setItem("refreshToken", refreshToken);
+  }
+};
+
+// Store a refreshed token pair
+export const storeTokens = (token, refreshToken) => {
+  localStorage.setItem("token", token);
+  localStorage.setItem("refreshToken", refreshToken);
 };
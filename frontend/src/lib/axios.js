@@ -1,5 +1,5 @@
 import axios from "axios";
-import { logout } from "./auth";
+import { getRefreshToken, logout, storeTokens } from "./auth";
 import { showSolarToast as notify } from "./toast";
 
 // API Base URL
@@ -27,6 +27,25 @@ api.interceptors.request.use(
   }
 );
 
+// One refresh at a time: each refresh token works once, so concurrent
+// 401s wait for the same exchange instead of invalidating the session
+let refreshing = null;
+
+const refreshTokens = () => {
+  if (!refreshing) {
+    refreshing = axios
+      .post(`${API_BASE_URL}/auth/refresh`, { refresh_token: getRefreshToken() })
+      .then(({ data }) => {
+        storeTokens(data.token, data.refresh_token);
+        return data.token;
+      })
+      .finally(() => {
+        refreshing = null;
+      });
+  }
+  return refreshing;
+};
+
 // Response interceptor - Handle token expiration and errors
 api.interceptors.response.use(
   (response) => {
@@ -44,6 +63,17 @@ api.interceptors.response.use(
     if (error.response?.status === 401 && !originalRequest._retry && !isAuthRoute) {
       originalRequest._retry = true;
 
+      // Renew the access token and replay the request once
+      if (getRefreshToken()) {
+        try {
+          const token = await refreshTokens();
+          originalRequest.headers.Authorization = `Bearer ${token}`;
+          return api(originalRequest);
+        } catch {
+          // Session ended; fall through to logout
+        }
+      }
+
       // Show session expired toast
       notify.warning('Your session has expired. Please login again.');
 
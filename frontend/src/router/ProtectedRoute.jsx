@@ -1,6 +1,6 @@
 import React, { useEffect, useState } from 'react';
 import { Navigate, useLocation } from 'react-router-dom';
-import { isAuthenticated, isTokenExpired, logout, getUserRole, hasPermission } from '../lib/auth';
+import { isAuthenticated, isTokenExpired, getRefreshToken, logout, getUserRole, hasPermission } from '../lib/auth';
 import { notify } from '../lib/toast';
 
 const ProtectedRoute = ({ children, allowedRoles }) => {
@@ -20,8 +20,8 @@ const ProtectedRoute = ({ children, allowedRoles }) => {
         return;
       }
 
-      // Check token expiration
-      if (isTokenExpired()) {
+      // Check token expiration; with a refresh token the first API call renews it
+      if (isTokenExpired() && !getRefreshToken()) {
         // Token expired - logout and redirect
         notify.warning('Your session has expired. Please login again.');
         logout();